@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+	"github.com/kevmo314/appendable/pkg/mmap"
+)
+
+// compactIndex writes a compacted copy of the index file to the output file,
+// which may be the index file itself. The copy is written to a temporary file
+// that is renamed to the output file, so the output file is always complete.
+// The copy has pages of pageSize bytes, or the page size of the index file if
+// pageSize is zero. The locks of both files are held while compacting.
+func compactIndex(dataFilename, indexFilename, outputFilename string, dataHandler appendable.DataHandler, searchHeaders []string, pageSize int) error {
+	// the index file must not be synchronized while it's compacted.
+	lock, err := lockIndexFile(indexFilename)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if outputFilename != indexFilename {
+		outputLock, err := lockIndexFile(outputFilename)
+		if err != nil {
+			return err
+		}
+		defer outputLock.Unlock()
+	}
+
+	src, err := os.Open(indexFilename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	i, err := appendable.NewIndexFile(src, dataHandler, searchHeaders)
+	if err != nil {
+		return fmt.Errorf("failed to open index file: %w", err)
+	}
+
+	if pageSize == 0 {
+		pageSize = i.PageSize()
+	}
+
+	df, err := mmap.OpenFile(dataFilename, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer df.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(outputFilename), filepath.Base(outputFilename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	// os.CreateTemp creates files that only the owner can read, so give the
+	// copy the permissions of the index file.
+	if err := tmp.Chmod(fi.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	f, err := mmap.OpenFile(tmp.Name(), os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := i.CompactSize(df.Bytes(), f, pageSize); err != nil {
+		return fmt.Errorf("failed to compact index file: %w", err)
+	}
+	if err := f.File().Sync(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), outputFilename); err != nil {
+		return err
+	}
+	slog.Info("Compacted index file", "before", fi.Size(), "after", len(f.Bytes()))
+	return nil
+}
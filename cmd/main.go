@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"os/signal"
 	"runtime/pprof"
+	"syscall"
 	"time"
 
 	"github.com/kevmo314/appendable/pkg/appendable"
+	"github.com/kevmo314/appendable/pkg/flock"
 	"github.com/kevmo314/appendable/pkg/handlers"
 	"github.com/kevmo314/appendable/pkg/mmap"
 )
@@ -25,20 +30,46 @@ func (s *StringSlice) Set(value string) error {
 }
 
 func main() {
-	var debugFlag, jsonlFlag, csvFlag, showTimings bool
-	var indexFilename, pprofFilename, benchmarkFilename string
+	// the first argument may name a command other than synchronizing once.
+	var command string
+	arguments := os.Args[1:]
+	if len(arguments) > 0 {
+		switch arguments[0] {
+		case "watch", "serve", "verify", "compact", "typegen", "gogen":
+			command, arguments = arguments[0], arguments[1:]
+		}
+	}
+
+	var debugFlag, jsonlFlag, csvFlag, tsvFlag, parquetFlag, recordioFlag, showTimings bool
+	var indexFilename, outputFilename, pprofFilename, benchmarkFilename, specFilename, delimiter string
 	var searchHeaders StringSlice
+	var interval time.Duration
+	var addr, cacheControl, pkg string
+	var watchFlag bool
+	var pageSize int
 
 	flag.BoolVar(&debugFlag, "debug", false, "Use logger that prints at the debug-level")
 	flag.BoolVar(&jsonlFlag, "jsonl", false, "Use JSONL handler")
 	flag.BoolVar(&csvFlag, "csv", false, "Use CSV handler")
+	flag.BoolVar(&tsvFlag, "tsv", false, "Use TSV handler")
+	flag.BoolVar(&parquetFlag, "parquet", false, "Use Parquet handler")
+	flag.BoolVar(&recordioFlag, "recordio", false, "Use RecordIO handler for uvarint length-prefixed JSON records")
+	flag.StringVar(&delimiter, "delimiter", "", "Specify the field delimiter of a new CSV or TSV index, such as \";\" or \"|\"")
 	flag.BoolVar(&showTimings, "t", false, "Show time-related metrics")
 	flag.StringVar(&indexFilename, "i", "", "Specify the existing index of the file to be opened, writing to stdout")
+	flag.StringVar(&outputFilename, "o", "", "Specify the file that compact writes the compacted index to, replacing the index file if not set, or that typegen and gogen write the types to instead of stdout")
+	flag.StringVar(&pkg, "package", "main", "Specify the package of the file that gogen writes")
 	flag.StringVar(&pprofFilename, "pprof", "", "Specify the file to write the pprof data to")
 	flag.StringVar(&benchmarkFilename, "b", "", "Specify the file to write the benchmark data to")
 	flag.Var(&searchHeaders, "s", "Specify the headers you want to search")
+	flag.StringVar(&specFilename, "spec", "", "Specify a JSON index spec of the fields to index and how, which is stored in the index file so later synchronizations follow it")
+	flag.DurationVar(&interval, "interval", time.Second, "Specify how often watch mode polls the data file in case a change notification is missed")
+	flag.StringVar(&addr, "addr", ":8080", "Specify the address that serve listens on")
+	flag.StringVar(&cacheControl, "cache-control", "no-cache", "Specify the Cache-Control header that serve sends")
+	flag.BoolVar(&watchFlag, "watch", false, "Synchronize the index file as the data file grows while serving")
+	flag.IntVar(&pageSize, "page-size", 0, "Specify the page size of a new or compacted index file, such as 16384 or 65536 (default 4096, or the page size of the index file when compacting)")
 
-	flag.Parse()
+	flag.CommandLine.Parse(arguments)
 
 	logLevel := &slog.LevelVar{}
 
@@ -67,23 +98,34 @@ func main() {
 	}
 
 	flag.Usage = func() {
-		fmt.Printf("Usage: %s [-t] [-i index] [-I index] filename\n", os.Args[0])
+		fmt.Printf("Usage: %s [watch | serve | verify | compact] [-t] [-i index] filename|-\n", os.Args[0])
+		fmt.Printf("       %s typegen [-o types.ts] -i index\n", os.Args[0])
+		fmt.Printf("       %s gogen [-o types.go] [-package name] -i index\n", os.Args[0])
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
 	args := flag.Args()
 
-	if len(args) != 1 {
+	// typegen and gogen only read the index file.
+	wantArgs := 1
+	if command == "typegen" || command == "gogen" {
+		wantArgs = 0
+	}
+	if len(args) != wantArgs {
 		flag.Usage()
 	}
 
-	// Open the data df
-	df, err := mmap.OpenFile(args[0], os.O_RDONLY, 0)
-	if err != nil {
-		panic(err)
+	var delim byte
+	switch {
+	case delimiter == "\\t":
+		delim = '\t'
+	case len(delimiter) == 1:
+		delim = delimiter[0]
+	case delimiter != "":
+		logger.Error("The delimiter must be a single byte.")
+		os.Exit(1)
 	}
-	defer df.Close()
 
 	var dataHandler appendable.DataHandler
 
@@ -91,14 +133,103 @@ func main() {
 	case jsonlFlag:
 		dataHandler = handlers.JSONLHandler{}
 	case csvFlag:
-		dataHandler = handlers.CSVHandler{}
+		dataHandler = handlers.CSVHandler{Delimiter: delim}
+	case tsvFlag:
+		dataHandler = handlers.TSVHandler{Delimiter: delim}
+	case parquetFlag:
+		dataHandler = handlers.ParquetHandler{}
+	case recordioFlag:
+		dataHandler = handlers.RecordIOHandler{}
 	default:
-		logger.Error("Please specify the file type with -jsonl or -csv.")
+		logger.Error("Please specify the file type with -jsonl, -csv, -tsv, -parquet or -recordio.")
+		os.Exit(1)
+	}
+	if len(args) > 0 && args[0] == "-" && command != "" {
+		logger.Error("Only synchronizing reads the data file from standard input.")
+		os.Exit(1)
+	}
+	if command != "" && indexFilename == "" {
+		logger.Error("An index file must be specified with -i.")
 		os.Exit(1)
 	}
+	var spec *appendable.IndexSpec
+	if specFilename != "" {
+		buf, err := os.ReadFile(specFilename)
+		if err != nil {
+			panic(err)
+		}
+		if spec, err = appendable.ParseIndexSpec(buf); err != nil {
+			panic(err)
+		}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch command {
+	case "watch":
+		if err := watchDataFile(ctx, args[0], indexFilename, dataHandler, searchHeaders, spec, pageSize, interval); err != nil {
+			panic(err)
+		}
+		return
+	case "serve":
+		if err := serveFiles(ctx, addr, cacheControl, watchFlag, args[0], indexFilename, dataHandler, searchHeaders, spec, pageSize, interval); err != nil {
+			panic(err)
+		}
+		return
+	case "verify":
+		problems, err := verifyFiles(os.Stdout, args[0], indexFilename, dataHandler)
+		if err != nil {
+			panic(err)
+		}
+		if problems > 0 {
+			os.Exit(1)
+		}
+		return
+	case "typegen":
+		if err := generateTypes(os.Stdout, indexFilename, outputFilename, dataHandler); err != nil {
+			panic(err)
+		}
+		return
+	case "gogen":
+		if err := generateStructs(os.Stdout, indexFilename, outputFilename, pkg, dataHandler); err != nil {
+			panic(err)
+		}
+		return
+	case "compact":
+		if outputFilename == "" {
+			outputFilename = indexFilename
+		}
+		if err := compactIndex(args[0], indexFilename, outputFilename, dataHandler, searchHeaders, pageSize); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	if pageSize == 0 {
+		pageSize = appendable.DefaultPageSize
+	}
+
+	dataFilename := args[0]
+	if dataFilename == "-" {
+		// keys are resolved from earlier records, so standard input is
+		// spooled to a temporary file instead of being held in memory.
+		tmp, err := spoolStdin()
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(tmp)
+		dataFilename = tmp
+	}
+
 	if showTimings {
 		readStart = time.Now()
 	}
+	lock, err := lockIndexFile(indexFilename)
+	if err != nil {
+		panic(err)
+	}
+	defer lock.Unlock()
+
 	mmpif, err := mmap.OpenFile(indexFilename, os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
 		panic(err)
@@ -106,10 +237,15 @@ func main() {
 	defer mmpif.Close()
 
 	// Open the index file
-	i, err := appendable.NewIndexFile(mmpif, dataHandler, searchHeaders)
+	i, err := appendable.NewIndexFileSize(mmpif, dataHandler, searchHeaders, pageSize)
 	if err != nil {
 		panic(err)
 	}
+	if spec != nil {
+		if err := i.SetIndexSpec(spec); err != nil {
+			panic(err)
+		}
+	}
 
 	if benchmarkFilename != "" {
 		f, err := os.Create(benchmarkFilename)
@@ -120,8 +256,28 @@ func main() {
 		i.SetBenchmarkFile(f)
 	}
 
-	if err := i.Synchronize(df.Bytes()); err != nil {
-		panic(err)
+	if _, ok := dataHandler.(appendable.ReaderDataHandler); ok {
+		// stream the data file so it never has to be held in memory.
+		df, err := os.Open(dataFilename)
+		if err != nil {
+			panic(err)
+		}
+		defer df.Close()
+
+		if err := i.SynchronizeReader(df); err != nil {
+			panic(err)
+		}
+	} else {
+		// Open the data df
+		df, err := mmap.OpenFile(dataFilename, os.O_RDONLY, 0)
+		if err != nil {
+			panic(err)
+		}
+		defer df.Close()
+
+		if err := i.Synchronize(df.Bytes()); err != nil {
+			panic(err)
+		}
 	}
 
 	if showTimings {
@@ -148,3 +304,28 @@ func main() {
 
 	logger.Info("Done!")
 }
+
+// spoolStdin copies standard input to a temporary file and returns its name.
+func spoolStdin() (string, error) {
+	f, err := os.CreateTemp("", "appendable-stdin-")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, os.Stdin); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to read standard input: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// lockIndexFile takes the lock that writers of the index file hold so that
+// two processes never write it at once. The lock is a separate file so that
+// it's kept when the index file is replaced.
+func lockIndexFile(indexFilename string) (*flock.File, error) {
+	return flock.Lock(indexFilename + ".lock")
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+	"github.com/kevmo314/appendable/pkg/serve"
+)
+
+// serveFiles serves the data file and index file on addr until ctx is done,
+// optionally synchronizing the index file as the data file grows.
+func serveFiles(ctx context.Context, addr, cacheControl string, watch bool, dataFilename, indexFilename string, dataHandler appendable.DataHandler, searchHeaders []string, spec *appendable.IndexSpec, pageSize int, interval time.Duration) error {
+	errc := make(chan error, 2)
+	if watch {
+		go func() {
+			errc <- watchDataFile(ctx, dataFilename, indexFilename, dataHandler, searchHeaders, spec, pageSize, interval)
+		}()
+	}
+
+	s := &http.Server{
+		Addr: addr,
+		Handler: &serve.Handler{
+			DataPath:     dataFilename,
+			IndexPath:    indexFilename,
+			DataHandler:  dataHandler,
+			CacheControl: cacheControl,
+		},
+	}
+	go func() {
+		slog.Info("Serving", "addr", addr, "data", dataFilename, "index", indexFilename)
+		if err := s.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			errc <- err
+		}
+	}()
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			s.Close()
+			return err
+		}
+		// watching only stops without an error once ctx is done.
+		<-ctx.Done()
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.Shutdown(shutdownCtx)
+}
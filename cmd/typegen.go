@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+)
+
+// generateTypes writes the TypeScript definitions of the records of the index
+// file to the output file, or to w if outputFilename is empty.
+func generateTypes(w io.Writer, indexFilename, outputFilename string, dataHandler appendable.DataHandler) error {
+	return generate(w, indexFilename, outputFilename, dataHandler, func(i *appendable.IndexFile, w io.Writer) error {
+		return i.WriteTypescriptDefinitions(w)
+	})
+}
+
+// generateStructs writes the Go definitions of the records of the index file,
+// in package pkg, to the output file, or to w if outputFilename is empty.
+func generateStructs(w io.Writer, indexFilename, outputFilename, pkg string, dataHandler appendable.DataHandler) error {
+	return generate(w, indexFilename, outputFilename, dataHandler, func(i *appendable.IndexFile, w io.Writer) error {
+		return i.WriteGoDefinitions(w, pkg)
+	})
+}
+
+// generate writes the definitions that write writes for the index file to the
+// output file, or to w if outputFilename is empty.
+func generate(w io.Writer, indexFilename, outputFilename string, dataHandler appendable.DataHandler, write func(i *appendable.IndexFile, w io.Writer) error) error {
+	// the index file is opened read-only so that generating types never
+	// modifies it.
+	f, err := os.Open(indexFilename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var b bytes.Buffer
+	err = appendable.ReadConsistent(f, dataHandler, func(i *appendable.IndexFile) error {
+		b.Reset()
+		return write(i, &b)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to generate types: %w", err)
+	}
+	if outputFilename == "" {
+		_, err := w.Write(b.Bytes())
+		return err
+	}
+	return os.WriteFile(outputFilename, b.Bytes(), 0644)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+	"github.com/kevmo314/appendable/pkg/mmap"
+)
+
+// verifyFiles checks the index file against the data file and writes a
+// report of the problems found to w. It returns the number of problems.
+func verifyFiles(w io.Writer, dataFilename, indexFilename string, dataHandler appendable.DataHandler) (int, error) {
+	// the index file is opened read-only so that verifying never modifies it.
+	f, err := os.Open(indexFilename)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	df, err := mmap.OpenFile(dataFilename, os.O_RDONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer df.Close()
+
+	// another process may be synchronizing the index file in place.
+	var report *appendable.Report
+	err = appendable.ReadConsistent(f, dataHandler, func(i *appendable.IndexFile) error {
+		report, err = i.Verify(df.Bytes())
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to verify index file: %w", err)
+	}
+	for _, p := range report.Problems {
+		fmt.Fprintln(w, p)
+	}
+	fmt.Fprintf(w, "%d indexes, %d nodes, %d keys, %d problems\n", report.Indexes, report.Nodes, report.Keys, len(report.Problems))
+	return len(report.Problems), nil
+}
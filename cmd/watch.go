@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+	"github.com/kevmo314/appendable/pkg/mmap"
+	"github.com/kevmo314/appendable/pkg/watch"
+)
+
+// watchDataFile synchronizes the index file every time the data file grows until ctx
+// is done.
+//
+// The index file is synchronized in place while the lock of the index file is
+// held. Each generation is committed atomically, so readers that use
+// appendable.ReadConsistent never see a partially written index. A trailing
+// record that is still being written is left for the next generation. If the
+// index file doesn't exist, it's created with pages of pageSize bytes, or the
+// default page size if pageSize is zero. If spec is set, it replaces the
+// index spec of the index file.
+func watchDataFile(ctx context.Context, dataFilename, indexFilename string, dataHandler appendable.DataHandler, searchHeaders []string, spec *appendable.IndexSpec, pageSize int, interval time.Duration) error {
+	if pageSize == 0 {
+		pageSize = appendable.DefaultPageSize
+	}
+
+	lock, err := lockIndexFile(indexFilename)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	// start watching before the first synchronization so that no append
+	// is missed.
+	w, err := watch.NewWatcher(dataFilename, interval)
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %w", dataFilename, err)
+	}
+	defer w.Close()
+
+	// synchronize either streams the data file or maps it, which is remapped
+	// before each generation.
+	var synchronize func(i *appendable.IndexFile) error
+	if _, ok := dataHandler.(appendable.ReaderDataHandler); ok {
+		df, err := os.Open(dataFilename)
+		if err != nil {
+			return err
+		}
+		defer df.Close()
+		synchronize = func(i *appendable.IndexFile) error {
+			return i.SynchronizeReader(df)
+		}
+	} else {
+		df, err := mmap.OpenFile(dataFilename, os.O_RDONLY, 0)
+		if err != nil {
+			return err
+		}
+		defer df.Close()
+		synchronize = func(i *appendable.IndexFile) error {
+			if err := df.Remap(); err != nil {
+				return fmt.Errorf("failed to remap %s: %w", dataFilename, err)
+			}
+			return i.Synchronize(df.Bytes())
+		}
+	}
+
+	f, err := mmap.OpenFile(indexFilename, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	i, err := appendable.NewIndexFileSize(f, dataHandler, searchHeaders, pageSize)
+	if err != nil {
+		return err
+	}
+	if spec != nil {
+		if err := i.SetIndexSpec(spec); err != nil {
+			return err
+		}
+	}
+
+	for {
+		published, err := synchronizeGeneration(i, synchronize)
+		if err != nil {
+			return err
+		}
+		if published != nil {
+			slog.Info("Published index generation", "generation", published.Generation, "offset", published.ReadOffset, "entries", published.Entries)
+		}
+
+		if err := w.Wait(ctx); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// synchronizeGeneration synchronizes the index file and returns the metadata
+// of the new generation, or nil if no records were added.
+func synchronizeGeneration(i *appendable.IndexFile, synchronize func(i *appendable.IndexFile) error) (*appendable.FileMeta, error) {
+	before, err := i.Metadata()
+	if err != nil {
+		return nil, err
+	}
+	if err := synchronize(i); err != nil {
+		return nil, err
+	}
+	after, err := i.Metadata()
+	if err != nil {
+		return nil, err
+	}
+	if after.ReadOffset == before.ReadOffset {
+		return nil, nil
+	}
+	return after, nil
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/binary"
 	"fmt"
 	"github.com/kevmo314/appendable/pkg/encoding"
-	"strings"
 )
 
 /**
@@ -38,6 +37,9 @@ type Format byte
 const (
 	FormatJSONL Format = iota
 	FormatCSV
+	FormatParquet
+	FormatTSV
+	FormatRecordIO
 )
 
 // FieldType represents the type of data stored in the field, which follows
@@ -63,35 +65,25 @@ const (
 	FieldTypeVector
 )
 
+// TypescriptType returns the TypeScript type of values of type t.
 func (t FieldType) TypescriptType() string {
-	components := []string{}
-	if t&FieldTypeString != 0 || t&FieldTypeTrigram != 0 || t&FieldTypeBigram != 0 || t&FieldTypeUnigram != 0 {
-		components = append(components, "string")
-	}
-	if t&FieldTypeInt64 != 0 || t&FieldTypeFloat64 != 0 {
-		components = append(components, "number")
-	}
-	if t&FieldTypeObject != 0 {
-		components = append(components, "Record")
-	}
-	if t&FieldTypeArray != 0 {
-		components = append(components, "any[]")
-	}
-	if t&FieldTypeBoolean != 0 {
-		components = append(components, "boolean")
-	}
-	if t&FieldTypeNull != 0 {
-		components = append(components, "null")
-	}
-
-	if t&FieldTypeVector != 0 {
-		components = append(components, "number[]")
-	}
-
-	if len(components) == 0 {
-		return "unknown"
+	switch t {
+	case FieldTypeString, FieldTypeTrigram, FieldTypeBigram, FieldTypeUnigram:
+		return "string"
+	case FieldTypeInt64, FieldTypeUint64, FieldTypeFloat64:
+		return "number"
+	case FieldTypeObject:
+		return "{ [key: string]: unknown }"
+	case FieldTypeArray:
+		return "unknown[]"
+	case FieldTypeBoolean:
+		return "boolean"
+	case FieldTypeNull:
+		return "null"
+	case FieldTypeVector:
+		return "number[]"
 	}
-	return strings.Join(components, " | ")
+	return "unknown"
 }
 
 type FileMeta struct {
@@ -104,14 +96,47 @@ type FileMeta struct {
 	// and indexed so far.
 	ReadOffset uint64
 	Entries    uint64
+	// The field delimiter of delimited formats such as CSV and TSV. Zero
+	// means the default delimiter of the format.
+	Delimiter byte
+	// Generation is incremented by every commit that changes pages,
+	// including synchronizations that index records, see ReadConsistent.
+	Generation uint64
+	// Spec is the offset of the first page of the index spec, zero if there
+	// is none, see IndexSpec.
+	Spec uint64
 }
 
+// MarshalBinary encodes the version, format, read offset and entries,
+// followed by the delimiter, the generation and the spec, which are each
+// only serialized if they or a later field are set. The metadata of index
+// files that don't use them is unchanged.
 func (m *FileMeta) MarshalBinary() ([]byte, error) {
-	buf := make([]byte, 10+encoding.SizeVarint(m.Entries))
+	n := 10 + encoding.SizeVarint(m.Entries)
+	size := n
+	if m.Delimiter != 0 || m.Generation != 0 || m.Spec != 0 {
+		size++
+	}
+	if m.Generation != 0 || m.Spec != 0 {
+		size += encoding.SizeVarint(m.Generation)
+	}
+	if m.Spec != 0 {
+		size += encoding.SizeVarint(m.Spec)
+	}
+	buf := make([]byte, size)
 	buf[0] = byte(m.Version)
 	buf[1] = byte(m.Format)
 	binary.LittleEndian.PutUint64(buf[2:], m.ReadOffset)
 	binary.PutUvarint(buf[10:], m.Entries)
+	if size > n {
+		buf[n] = m.Delimiter
+	}
+	if m.Generation != 0 || m.Spec != 0 {
+		k := binary.PutUvarint(buf[n+1:], m.Generation)
+		if m.Spec != 0 {
+			binary.PutUvarint(buf[n+1+k:], m.Spec)
+		}
+	}
 	return buf, nil
 }
 
@@ -128,15 +153,42 @@ func (m *FileMeta) UnmarshalBinary(buf []byte) error {
 		m.Format = FormatJSONL
 	case byte(1):
 		m.Format = FormatCSV
+	case byte(2):
+		m.Format = FormatParquet
+	case byte(3):
+		m.Format = FormatTSV
+	case byte(4):
+		m.Format = FormatRecordIO
 	default:
 		return fmt.Errorf("unrecognized file format: %v", buf[1])
 	}
 
 	m.ReadOffset = binary.LittleEndian.Uint64(buf[2:])
 
-	e, _ := binary.Uvarint(buf[10:])
+	e, n := binary.Uvarint(buf[10:])
+	if n <= 0 {
+		return fmt.Errorf("invalid entries varint")
+	}
 	m.Entries = e
 
+	if len(buf) > 10+n {
+		m.Delimiter = buf[10+n]
+	}
+	if len(buf) > 11+n {
+		g, k := binary.Uvarint(buf[11+n:])
+		if k <= 0 {
+			return fmt.Errorf("invalid generation varint")
+		}
+		m.Generation = g
+		if len(buf) > 11+n+k {
+			s, j := binary.Uvarint(buf[11+n+k:])
+			if j <= 0 {
+				return fmt.Errorf("invalid spec varint")
+			}
+			m.Spec = s
+		}
+	}
+
 	return nil
 }
 
@@ -9,6 +9,27 @@ import (
 )
 
 func TestMarshalMetadata(t *testing.T) {
+	t.Run("file meta generation", func(t *testing.T) {
+		for _, fm := range []*FileMeta{
+			{Version: 1, Format: FormatJSONL, ReadOffset: 69, Entries: 38, Generation: 300},
+			{Version: 1, Format: FormatTSV, ReadOffset: 69, Entries: 38, Delimiter: '|', Generation: 1},
+			{Version: 1, Format: FormatJSONL, ReadOffset: 69, Entries: 38, Spec: 8192},
+			{Version: 1, Format: FormatCSV, ReadOffset: 69, Entries: 38, Delimiter: ',', Generation: 2, Spec: 4096},
+		} {
+			buf, err := fm.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			fm2 := &FileMeta{}
+			if err := fm2.UnmarshalBinary(buf); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(fm, fm2) {
+				t.Fatalf("got %+v, want %+v", fm2, fm)
+			}
+		}
+	})
+
 	t.Run("file meta", func(t *testing.T) {
 		b := buftest.NewSeekableBuffer()
 		p, err := pagefile.NewPageFile(b)
@@ -62,6 +83,33 @@ func TestMarshalMetadata(t *testing.T) {
 		}
 	})
 
+	t.Run("file meta delimiter", func(t *testing.T) {
+		fm := &FileMeta{Version: 1, Format: FormatTSV, ReadOffset: 69, Entries: 38, Delimiter: '|'}
+
+		buf, err := fm.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fm2 := &FileMeta{}
+		if err := fm2.UnmarshalBinary(buf); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(fm, fm2) {
+			t.Fatalf("got %+v, want %+v", fm2, fm)
+		}
+
+		// metadata without a delimiter is unchanged.
+		fm.Delimiter = 0
+		buf2, err := fm.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(buf2) != len(buf)-1 {
+			t.Fatalf("got %d bytes, want %d", len(buf2), len(buf)-1)
+		}
+	})
+
 	t.Run("file meta", func(t *testing.T) {
 		b := buftest.NewSeekableBuffer()
 		p, err := pagefile.NewPageFile(b)
@@ -0,0 +1,104 @@
+package appendable
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/kevmo314/appendable/pkg/bptree"
+	"github.com/kevmo314/appendable/pkg/linkedpage"
+)
+
+// Compact writes a copy of the index file to f, which must be empty. Each
+// index is rebuilt with fully packed nodes that are laid out breadth-first,
+// see bptree.BPTree.BulkInsert, and pages that are free or no longer used
+// aren't copied, so the copy is usually smaller and needs fewer requests to
+// query. Queries on the copy return the same results.
+//
+// df is the data file that the index file was synchronized with, which is
+// needed to read variable width keys.
+func (i *IndexFile) Compact(df []byte, f io.ReadWriteSeeker) (*IndexFile, error) {
+	return i.CompactSize(df, f, i.PageSize())
+}
+
+// CompactSize is like Compact but the copy has pages of pageSize bytes, see
+// NewIndexFileSize.
+func (i *IndexFile) CompactSize(df []byte, f io.ReadWriteSeeker, pageSize int) (*IndexFile, error) {
+	// the keys are copied as they are, so they must be current.
+	if err := i.CheckVersion(); err != nil {
+		return nil, err
+	}
+	metadata, err := i.Metadata()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	c, err := NewIndexFileSize(f, i.dataHandler, i.searchHeaders, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.Indexes(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("compacted index file must be empty")
+	}
+	err = c.transaction(func() error {
+		// the pages of the index spec are written anew and the copy is a new
+		// generation, since its pages differ.
+		metadata.Spec = 0
+		metadata.Generation++
+		if err := c.SetMetadata(metadata); err != nil {
+			return err
+		}
+		if err := c.setIndexSpec(i.spec); err != nil {
+			return err
+		}
+		page, err := i.Indexes()
+		for err == nil {
+			if err := i.compactIndex(c, page, df); err != nil {
+				return err
+			}
+			page, err = page.Next()
+		}
+		if !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read indexes: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.useIndexSpec(i.spec)
+	return c, nil
+}
+
+// compactIndex rebuilds the index of page in c.
+func (i *IndexFile) compactIndex(c *IndexFile, page *linkedpage.LinkedPage, df []byte) error {
+	meta := &IndexMeta{}
+	if err := page.UnmarshalMetadata(meta); err != nil {
+		return fmt.Errorf("failed to unmarshal index metadata: %w", err)
+	}
+	tree := page.BPTree(&bptree.BPTree{Data: df, DataParser: i.dataHandler, Width: meta.Width})
+	iter, err := tree.SeekFirst()
+	if err != nil {
+		return fmt.Errorf("failed to read index %s: %w", meta.FieldName, err)
+	}
+	var entries []bptree.Entry
+	for iter.Next() {
+		entries = append(entries, bptree.Entry{Key: iter.Key(), Value: iter.Pointer()})
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("failed to read index %s: %w", meta.FieldName, err)
+	}
+
+	cpage, _, err := c.FindOrCreateIndex(meta.FieldName, meta.FieldType)
+	if err != nil {
+		return err
+	}
+	// the metadata is copied as is, including the total field length.
+	if err := cpage.MarshalMetadata(meta); err != nil {
+		return fmt.Errorf("failed to set index metadata: %w", err)
+	}
+	ctree := cpage.BPTree(&bptree.BPTree{Data: df, DataParser: i.dataHandler, Width: meta.Width})
+	if err := ctree.BulkInsert(entries, 1); err != nil {
+		return fmt.Errorf("failed to rebuild index %s: %w", meta.FieldName, err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package appendable
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// typeNode is a field of the records and the types seen for it. Fields of
+// objects are named by their path joined with dots, so their types are
+// nested in the node of the object.
+type typeNode struct {
+	types  map[FieldType]bool
+	fields map[string]*typeNode
+}
+
+func newTypeNode() *typeNode {
+	return &typeNode{types: make(map[FieldType]bool), fields: make(map[string]*typeNode)}
+}
+
+func (n *typeNode) add(path []string, fieldType FieldType) {
+	if len(path) == 0 {
+		n.types[fieldType] = true
+		return
+	}
+	field, ok := n.fields[path[0]]
+	if !ok {
+		field = newTypeNode()
+		n.fields[path[0]] = field
+	}
+	field.add(path[1:], fieldType)
+}
+
+// names returns the names of the fields of n in order.
+func (n *typeNode) names() []string {
+	names := make([]string, 0, len(n.fields))
+	for name := range n.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// valueTypes returns the types seen for n other than objects and arrays in
+// order.
+func (n *typeNode) valueTypes() []FieldType {
+	fieldTypes := make([]FieldType, 0, len(n.types))
+	for t := range n.types {
+		if t != FieldTypeObject && t != FieldTypeArray {
+			fieldTypes = append(fieldTypes, t)
+		}
+	}
+	sort.Slice(fieldTypes, func(i, j int) bool { return fieldTypes[i] < fieldTypes[j] })
+	return fieldTypes
+}
+
+// fieldTypes returns the fields of the records, and the types seen for each
+// of them, from the indexes. Only the field names of JSONL and RecordIO
+// records are paths of nested objects, the names of other fields may contain
+// dots too.
+func (i *IndexFile) fieldTypes() (*typeNode, error) {
+	metadata, err := i.Metadata()
+	if err != nil {
+		return nil, err
+	}
+	nested := metadata.Format == FormatJSONL || metadata.Format == FormatRecordIO
+	root := newTypeNode()
+	page, err := i.Indexes()
+	for err == nil {
+		meta := &IndexMeta{}
+		if err := page.UnmarshalMetadata(meta); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal index metadata: %w", err)
+		}
+		path := []string{meta.FieldName}
+		if nested {
+			path = strings.Split(meta.FieldName, ".")
+		}
+		root.add(path, meta.FieldType)
+		page, err = page.Next()
+	}
+	if !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+	return root, nil
+}
@@ -0,0 +1,169 @@
+package appendable
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/kevmo314/appendable/pkg/pagefile"
+)
+
+// readAttempts is the number of times that ReadConsistent reads an index file
+// before giving up.
+const readAttempts = 10
+
+// ErrIndexFileChanged is returned by ReadConsistent if the index file was
+// synchronized during every attempt to read it.
+var ErrIndexFileChanged = errors.New("index file changed while reading")
+
+// errRetry is returned by readConsistent if the index file changed.
+var errRetry = errors.New("retry")
+
+// ReadConsistent opens the index file in f, which another process may be
+// synchronizing in place, and calls read with it. Like a seqlock, the
+// generation of the index file is read before and after read, and if it
+// changed or a synchronization was being committed, read is called again
+// with the index file reopened. So if read succeeds, it read an index file
+// that no synchronization changed meanwhile.
+//
+// f should be opened read-only, the writer holds the lock of the index file.
+func ReadConsistent(f io.ReadWriteSeeker, dataHandler DataHandler, read func(i *IndexFile) error) error {
+	for attempt := 0; attempt < readAttempts; attempt++ {
+		if attempt > 0 {
+			// give the writer time to finish its commit.
+			time.Sleep(time.Millisecond << attempt)
+		}
+		if err := readConsistent(f, dataHandler, read); !errors.Is(err, errRetry) {
+			return err
+		}
+	}
+	return ErrIndexFileChanged
+}
+
+func readConsistent(f io.ReadWriteSeeker, dataHandler DataHandler, read func(i *IndexFile) error) error {
+	state, pending, err := pagefile.CommitState(f)
+	if err != nil {
+		return err
+	}
+	if pending {
+		return errRetry
+	}
+	// changed reports whether a commit was written since state was read.
+	changed := func() bool {
+		s, pending, err := pagefile.CommitState(f)
+		return err != nil || pending || !bytes.Equal(s, state)
+	}
+
+	i, err := NewIndexFile(f, dataHandler, nil)
+	if err != nil {
+		if changed() {
+			return errRetry
+		}
+		return err
+	}
+	before, err := i.Metadata()
+	if err != nil {
+		if changed() {
+			return errRetry
+		}
+		return err
+	}
+	// the metadata is the first page that a commit writes, so if no commit
+	// was written, the rest of the index file matches it.
+	if changed() {
+		return errRetry
+	}
+	err = read(i)
+	after, merr := i.Metadata()
+	if merr != nil || after.Generation != before.Generation {
+		return errRetry
+	}
+	return err
+}
+
+// ConsistentReader reads the bytes of an index file that another process may
+// be synchronizing in place, see NewConsistentReader.
+type ConsistentReader struct {
+	f     io.ReadSeeker
+	state []byte
+	// offset is the offset of the page that holds the metadata, which every
+	// commit that changes the index file changes.
+	offset int64
+	page   []byte
+	pos    int64
+}
+
+var _ io.ReadSeeker = (*ConsistentReader)(nil)
+
+// NewConsistentReader returns a reader of the bytes of the index file in f as
+// they are while i is read, so it must be called in the read function of
+// ReadConsistent with the same f. Each read checks that no commit changed the
+// index file since then and fails with ErrIndexFileChanged otherwise, so the
+// index file can be streamed without being copied first.
+func NewConsistentReader(f io.ReadSeeker, i *IndexFile) (*ConsistentReader, error) {
+	state, pending, err := pagefile.CommitState(f)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return nil, ErrIndexFileChanged
+	}
+	r := &ConsistentReader{f: f, state: state, offset: int64(i.tree.Offset()), page: make([]byte, i.PageSize())}
+	if err := r.readPage(r.page); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *ConsistentReader) readPage(page []byte) error {
+	if _, err := r.f.Seek(r.offset, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.ReadFull(r.f, page)
+	return err
+}
+
+// check returns ErrIndexFileChanged if a commit changed the index file.
+func (r *ConsistentReader) check() error {
+	state, pending, err := pagefile.CommitState(r.f)
+	if err != nil {
+		return err
+	}
+	if pending || !bytes.Equal(state, r.state) {
+		return ErrIndexFileChanged
+	}
+	// the metadata is the first page that a commit writes.
+	page := make([]byte, len(r.page))
+	if err := r.readPage(page); err != nil {
+		return err
+	}
+	if !bytes.Equal(page, r.page) {
+		return ErrIndexFileChanged
+	}
+	return nil
+}
+
+func (r *ConsistentReader) Read(buf []byte) (int, error) {
+	if _, err := r.f.Seek(r.pos, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := r.f.Read(buf)
+	if cerr := r.check(); cerr != nil {
+		return 0, cerr
+	}
+	r.pos += int64(n)
+	return n, err
+}
+
+func (r *ConsistentReader) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekCurrent {
+		offset, whence = r.pos+offset, io.SeekStart
+	}
+	pos, err := r.f.Seek(offset, whence)
+	if err != nil {
+		return 0, err
+	}
+	r.pos = pos
+	return pos, nil
+}
@@ -0,0 +1,183 @@
+package appendable
+
+import (
+	"fmt"
+	"go/format"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// goGenerator collects the structs of the records and their objects.
+type goGenerator struct {
+	structs []string
+	names   map[string]bool
+	// usesJSON reports whether a type of encoding/json is used.
+	usesJSON bool
+}
+
+// structType adds a struct for the fields of n named after name and returns
+// its name.
+func (g *goGenerator) structType(name string, n *typeNode) string {
+	name = uniqueName(name, g.names)
+	// the struct comes before the structs of its fields.
+	index := len(g.structs)
+	g.structs = append(g.structs, "")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "type %s struct {\n", name)
+	fieldNames := make(map[string]bool)
+	for _, key := range n.names() {
+		if !isValidTag(key) {
+			fmt.Fprintf(&b, "\t// %s can't be named by a json tag.\n", strconv.Quote(key))
+			continue
+		}
+		field := uniqueName(goName(key), fieldNames)
+		fmt.Fprintf(&b, "\t%s %s `json:%s`\n", field, g.goType(name+field, n.fields[key]), strconv.Quote(key))
+	}
+	b.WriteString("}\n")
+	g.structs[index] = b.String()
+	return name
+}
+
+// goType returns the Go type that holds the values seen for n. Objects are
+// structs named after name, values that were seen as null are pointers and
+// values that were seen with types that no other Go type holds are any.
+//
+// The values of an array are indexed under the name of the array, so if an
+// array was seen, the other types are assumed to be the types of its values.
+func (g *goGenerator) goType(name string, n *typeNode) string {
+	var number string
+	switch {
+	case n.types[FieldTypeFloat64]:
+		number = "float64"
+	case n.types[FieldTypeInt64] && n.types[FieldTypeUint64]:
+		// int64 and uint64 values don't both fit in a float64 exactly.
+		number = "json.Number"
+	case n.types[FieldTypeInt64]:
+		number = "int64"
+	case n.types[FieldTypeUint64]:
+		number = "uint64"
+	}
+	var types []string
+	seen := make(map[string]bool)
+	add := func(t string) {
+		if !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+	for _, t := range n.valueTypes() {
+		switch t {
+		case FieldTypeString, FieldTypeTrigram, FieldTypeBigram, FieldTypeUnigram:
+			add("string")
+		case FieldTypeInt64, FieldTypeUint64, FieldTypeFloat64:
+			add(number)
+		case FieldTypeBoolean:
+			add("bool")
+		case FieldTypeVector:
+			add("[]float64")
+		}
+	}
+	if len(n.fields) > 0 || n.types[FieldTypeObject] {
+		add("object")
+	}
+
+	var t string
+	switch {
+	case len(types) != 1:
+		t = "any"
+	case types[0] != "object":
+		t = types[0]
+	case len(n.fields) > 0:
+		t = g.structType(name, n)
+	default:
+		t = "map[string]any"
+	}
+	if t == "json.Number" {
+		g.usesJSON = true
+	}
+	if n.types[FieldTypeNull] && t != "any" && !strings.HasPrefix(t, "[]") && !strings.HasPrefix(t, "map[") {
+		t = "*" + t
+	}
+	if n.types[FieldTypeArray] {
+		t = "[]" + t
+	}
+	return t
+}
+
+// goName returns an exported Go identifier for the field named key.
+func goName(key string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	name := b.String()
+	if r := []rune(name); len(r) == 0 || !unicode.IsUpper(r[0]) {
+		name = "X" + name
+	}
+	return name
+}
+
+// uniqueName returns name, with a number appended if it's already in names,
+// and adds it to names.
+func uniqueName(name string, names map[string]bool) string {
+	unique := name
+	for i := 2; names[unique]; i++ {
+		unique = name + strconv.Itoa(i)
+	}
+	names[unique] = true
+	return unique
+}
+
+// isValidTag reports whether encoding/json accepts key as the name in a json
+// tag.
+func isValidTag(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		if !strings.ContainsRune("!#$%&()*+-./:;<=>?@[]^_{|}~ ", r) && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteGoDefinitions writes a Go file of package pkg to w with the struct of
+// the records of the data file, Record, which can be decoded with
+// encoding/json. Fields of objects are nested in structs named after their
+// path.
+func (i *IndexFile) WriteGoDefinitions(w io.Writer, pkg string) error {
+	root, err := i.fieldTypes()
+	if err != nil {
+		return err
+	}
+	g := &goGenerator{names: make(map[string]bool)}
+	g.structType("Record", root)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Code generated by github.com/kevmo314/appendable/pkg/appendable/gostruct.go. DO NOT EDIT.\n\npackage %s\n", pkg)
+	if g.usesJSON {
+		b.WriteString("\nimport \"encoding/json\"\n")
+	}
+	for _, s := range g.structs {
+		b.WriteString("\n" + s)
+	}
+	src, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return fmt.Errorf("failed to format generated code: %w", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
@@ -0,0 +1,105 @@
+package appendable
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kevmo314/appendable/pkg/buftest"
+)
+
+func TestGoDefinitions(t *testing.T) {
+	newIndexFile := func(t *testing.T, fields map[string][]FieldType) *IndexFile {
+		i, err := NewIndexFile(buftest.NewSeekableBuffer(), &FormatHandler{ReturnsFormat: FormatJSONL}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, fieldTypes := range fields {
+			for _, ft := range fieldTypes {
+				if _, _, err := i.FindOrCreateIndex(name, ft); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		return i
+	}
+
+	t.Run("types are merged and nested", func(t *testing.T) {
+		i := newIndexFile(t, map[string][]FieldType{
+			"id":              {FieldTypeUint64, FieldTypeInt64},
+			"score":           {FieldTypeFloat64, FieldTypeInt64, FieldTypeNull},
+			"name":            {FieldTypeString, FieldTypeUnigram, FieldTypeBigram, FieldTypeTrigram},
+			"user":            {FieldTypeObject, FieldTypeNull},
+			"user.first_name": {FieldTypeString},
+			"user.tags":       {FieldTypeArray, FieldTypeString},
+			"items":           {FieldTypeArray},
+			"items.id":        {FieldTypeInt64, FieldTypeNull},
+			"values":          {FieldTypeArray, FieldTypeBoolean, FieldTypeInt64},
+			"empty":           {FieldTypeObject},
+			"list":            {FieldTypeArray},
+			"embedding":       {FieldTypeVector},
+			"a,b":             {FieldTypeString},
+		})
+		var b bytes.Buffer
+		if err := i.WriteGoDefinitions(&b, "records"); err != nil {
+			t.Fatal(err)
+		}
+		want := "// Code generated by github.com/kevmo314/appendable/pkg/appendable/gostruct.go. DO NOT EDIT.\n" + `
+package records
+
+import "encoding/json"
+
+type Record struct {
+	// "a,b" can't be named by a json tag.
+	Embedding []float64      ` + "`json:\"embedding\"`" + `
+	Empty     map[string]any ` + "`json:\"empty\"`" + `
+	Id        json.Number    ` + "`json:\"id\"`" + `
+	Items     []RecordItems  ` + "`json:\"items\"`" + `
+	List      []any          ` + "`json:\"list\"`" + `
+	Name      string         ` + "`json:\"name\"`" + `
+	Score     *float64       ` + "`json:\"score\"`" + `
+	User      *RecordUser    ` + "`json:\"user\"`" + `
+	Values    []any          ` + "`json:\"values\"`" + `
+}
+
+type RecordItems struct {
+	Id *int64 ` + "`json:\"id\"`" + `
+}
+
+type RecordUser struct {
+	FirstName string   ` + "`json:\"first_name\"`" + `
+	Tags      []string ` + "`json:\"tags\"`" + `
+}
+`
+		if b.String() != want {
+			t.Fatalf("got\n%s\nwant\n%s", b.String(), want)
+		}
+	})
+
+	t.Run("json is only imported when used", func(t *testing.T) {
+		i := newIndexFile(t, map[string][]FieldType{
+			"id": {FieldTypeInt64},
+		})
+		var b bytes.Buffer
+		if err := i.WriteGoDefinitions(&b, "main"); err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(b.Bytes(), []byte("import")) {
+			t.Fatalf("got\n%s", b.String())
+		}
+	})
+}
+
+func TestGoName(t *testing.T) {
+	for key, want := range map[string]string{
+		"id":         "Id",
+		"first_name": "FirstName",
+		"user-id":    "UserId",
+		"2fa":        "X2fa",
+		"_":          "X",
+		"Name":       "Name",
+	} {
+		if got := goName(key); got != want {
+			t.Errorf("goName(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -11,7 +11,24 @@ import (
 	"github.com/kevmo314/appendable/pkg/pagefile"
 )
 
-const CurrentVersion = 1
+// CurrentVersion is the version of newly created index files. Index files of
+// older versions are upgraded when they are opened.
+//
+// Version 2 encodes float64 keys with encoding.EncodeFloat64. Page checksums
+// aren't versioned: the commit record of the page file says whether pages end
+// with a checksum, so new index files have them and older ones don't.
+const CurrentVersion = 2
+
+// DefaultPageSize is the page size of index files created by NewIndexFile.
+const DefaultPageSize = 4096
+
+// DefaultNodeCacheSize is the number of bytes of decoded nodes that an index
+// file caches, see NodeCache.
+const DefaultNodeCacheSize = 16 << 20
+
+// ErrReaderUnsupported is returned by SynchronizeReader for formats that must
+// be synchronized from the whole data file.
+var ErrReaderUnsupported = errors.New("data handler does not support synchronizing from a reader")
 
 type DataHandler interface {
 	bptree.DataParser
@@ -19,70 +36,135 @@ type DataHandler interface {
 	Format() Format
 }
 
+// ReaderDataHandler is a DataHandler that can also synchronize from an
+// io.ReaderAt. Only the bytes after FileMeta.ReadOffset are read, through a
+// bounded buffer, and keys are resolved by reading from r, so the data file
+// never has to be held in memory.
+type ReaderDataHandler interface {
+	DataHandler
+	SynchronizeReader(f *IndexFile, r io.ReaderAt) error
+}
+
 // IndexFile is a representation of the entire index file.
 type IndexFile struct {
 	tree        *linkedpage.LinkedPage
 	dataHandler DataHandler
 
 	pf                *pagefile.PageFile
+	cache             *bptree.NodeCache
 	BenchmarkCallback func(int)
 
 	searchHeaders []string
+	spec          *IndexSpec
+	kinds         map[string]IndexKind
 }
 
+// NewIndexFile opens the index file in f, creating it with 4096 byte pages if
+// f is empty.
 func NewIndexFile(f io.ReadWriteSeeker, dataHandler DataHandler, searchHeaders []string) (*IndexFile, error) {
-	pf, err := pagefile.NewPageFile(f)
+	return NewIndexFileSize(f, dataHandler, searchHeaders, DefaultPageSize)
+}
+
+// NewIndexFileSize opens the index file in f, creating it with pages of
+// pageSize bytes if f is empty. Larger pages hold more keys per node, so
+// queries over a network need fewer requests. The page size must be a power
+// of two between 4096 and 65536, existing index files keep theirs.
+func NewIndexFileSize(f io.ReadWriteSeeker, dataHandler DataHandler, searchHeaders []string, pageSize int) (*IndexFile, error) {
+	pf, err := pagefile.NewPageFileSize(f, pageSize)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create page file: %w", err)
 	}
+	i := &IndexFile{dataHandler: dataHandler, pf: pf, cache: bptree.NewNodeCache(DefaultNodeCacheSize), searchHeaders: searchHeaders}
+	if err := i.transaction(i.open); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
 
-	tree, err := linkedpage.NewMultiBPTree(pf, 0)
+// open reads the metadata, creating it if the index file is new. Index
+// files of older versions are upgraded by the first transaction that writes
+// them, so that they can be opened read-only.
+func (i *IndexFile) open() error {
+	tree, err := linkedpage.NewMultiBPTree(i.pf, 0)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create multi b+ tree: %w", err)
+		return fmt.Errorf("failed to create multi b+ tree: %w", err)
 	}
+	tree.SetNodeCache(i.cache)
 	// ensure the first page is written.
 	node, err := tree.Next()
 	if err != nil && !errors.Is(err, io.EOF) {
-		return nil, fmt.Errorf("failed to get next meta page: %w", err)
+		return fmt.Errorf("failed to get next meta page: %w", err)
 	}
 	if errors.Is(err, io.EOF) {
 		// the page doesn't exist, so we need to create it
 		created, err := tree.AddNext()
 		if err != nil {
-			return nil, fmt.Errorf("failed to add next meta page: %w", err)
+			return fmt.Errorf("failed to add next meta page: %w", err)
 		}
 		metadata := &FileMeta{
 			Version: CurrentVersion,
-			Format:  dataHandler.Format(),
+			Format:  i.dataHandler.Format(),
 		}
 		buf, err := metadata.MarshalBinary()
 		if err != nil {
-			return nil, fmt.Errorf("failed to marshal metadata: %w", err)
+			return fmt.Errorf("failed to marshal metadata: %w", err)
 		}
 		if err := created.SetMetadata(buf); err != nil {
-			return nil, fmt.Errorf("failed to set metadata: %w", err)
+			return fmt.Errorf("failed to set metadata: %w", err)
 		}
-		return &IndexFile{tree: created, dataHandler: dataHandler, pf: pf, searchHeaders: searchHeaders}, nil
+		i.tree = created
+		return nil
 	} else {
 		// validate the metadata
 		buf, err := node.Metadata()
 		if err != nil {
-			return nil, fmt.Errorf("failed to read metadata: %w", err)
+			return fmt.Errorf("failed to read metadata: %w", err)
 		}
 		metadata := &FileMeta{}
 		if err := metadata.UnmarshalBinary(buf); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal metadata: %w", err)
+			return fmt.Errorf("failed to unmarshal metadata: %w", err)
 		}
-		if metadata.Version != CurrentVersion {
-			return nil, fmt.Errorf("unsupported version: %d", metadata.Version)
+		if metadata.Version > CurrentVersion {
+			return fmt.Errorf("unsupported version: %d", metadata.Version)
 		}
-		if metadata.Format != dataHandler.Format() {
-			return nil, fmt.Errorf("unsupported format: %x", metadata.Format)
+		if metadata.Format != i.dataHandler.Format() {
+			return fmt.Errorf("unsupported format: %x", metadata.Format)
 		}
-		return &IndexFile{tree: node, dataHandler: dataHandler, pf: pf, searchHeaders: searchHeaders}, nil
+		i.tree = node
+		if i.spec, err = i.readIndexSpec(metadata.Spec); err != nil {
+			return fmt.Errorf("failed to read index spec: %w", err)
+		}
+		return nil
 	}
 }
 
+// transaction calls f in a page file transaction, so either all of the
+// changes made by f are written or, if f fails or the process crashes, none
+// of them are. An index file of an older version is upgraded in the same
+// transaction before f is called.
+func (i *IndexFile) transaction(f func() error) error {
+	if err := i.pf.Begin(); err != nil {
+		return err
+	}
+	err := i.upgrade()
+	if err == nil {
+		err = f()
+	}
+	if err != nil {
+		// the cache may hold nodes that were written in the transaction.
+		i.cache.Clear()
+		if rerr := i.pf.Rollback(); rerr != nil {
+			return errors.Join(err, rerr)
+		}
+		return err
+	}
+	if err := i.pf.Commit(); err != nil {
+		i.cache.Clear()
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	return nil
+}
+
 func (i *IndexFile) Metadata() (*FileMeta, error) {
 	// the first page consists of associated metadata for the tree
 	buf, err := i.tree.Metadata()
@@ -101,6 +183,27 @@ func (i *IndexFile) SetMetadata(metadata *FileMeta) error {
 	return i.tree.SetMetadata(buf)
 }
 
+// DataHandler returns the data handler used to synchronize and parse the
+// data file backing this index.
+func (i *IndexFile) DataHandler() DataHandler {
+	return i.dataHandler
+}
+
+// PageSize returns the size of the pages of the index file, including their
+// checksums.
+func (i *IndexFile) PageSize() int {
+	// the offset of the first page after the free page indexes is the page
+	// size, Page only fails for negative pages.
+	offset, _ := i.pf.Page(0)
+	return int(offset)
+}
+
+// NodeCache returns the cache of decoded nodes that the indexes share, its
+// limit can be changed with SetLimit.
+func (i *IndexFile) NodeCache() *bptree.NodeCache {
+	return i.cache
+}
+
 func (i *IndexFile) Indexes() (*linkedpage.LinkedPage, error) {
 	return i.tree.Next()
 }
@@ -177,7 +280,7 @@ func (i *IndexFile) FindOrCreateIndex(name string, fieldType FieldType) (*linked
 	metadata := &IndexMeta{}
 	metadata.FieldName = name
 	metadata.FieldType = fieldType
-	metadata.Width = DetermineType(fieldType)
+	metadata.Width = i.indexWidth(fieldType)
 	metadata.TotalFieldValueLength = uint64(0)
 	buf, err := metadata.MarshalBinary()
 	if err != nil {
@@ -186,11 +289,60 @@ func (i *IndexFile) FindOrCreateIndex(name string, fieldType FieldType) (*linked
 	return next, metadata, next.SetMetadata(buf)
 }
 
+// indexWidth returns the width of a new index of fieldType. Strings in
+// compressed or dictionary encoded parquet column chunks aren't stored
+// verbatim in the data file, so parquet strings are stored in the index.
+func (i *IndexFile) indexWidth(fieldType FieldType) uint16 {
+	if fieldType == FieldTypeString && i.dataHandler.Format() == FormatParquet {
+		return bptree.StoredWidth
+	}
+	return DetermineType(fieldType)
+}
+
 // Synchronize will synchronize the index file with the data file.
 // This is a convenience method and is equivalent to calling
 // Synchronize() on the data handler itself.
 func (i *IndexFile) Synchronize(df []byte) error {
-	return i.dataHandler.Synchronize(i, df)
+	return i.synchronize(func() error {
+		return i.dataHandler.Synchronize(i, df)
+	})
+}
+
+// SynchronizeReader synchronizes the index file with a data file read through
+// r. It returns ErrReaderUnsupported if the data handler doesn't implement
+// ReaderDataHandler.
+func (i *IndexFile) SynchronizeReader(r io.ReaderAt) error {
+	h, ok := i.dataHandler.(ReaderDataHandler)
+	if !ok {
+		return ErrReaderUnsupported
+	}
+	return i.synchronize(func() error {
+		return h.SynchronizeReader(i, r)
+	})
+}
+
+// synchronize calls f in a transaction and increments the generation of the
+// index file with its changes. If f didn't consume any records the generation
+// is kept, so the transaction has nothing to commit.
+func (i *IndexFile) synchronize(f func() error) error {
+	return i.transaction(func() error {
+		before, err := i.Metadata()
+		if err != nil {
+			return err
+		}
+		if err := f(); err != nil {
+			return err
+		}
+		metadata, err := i.Metadata()
+		if err != nil {
+			return err
+		}
+		if metadata.ReadOffset == before.ReadOffset && metadata.Entries == before.Entries {
+			return nil
+		}
+		metadata.Generation++
+		return i.SetMetadata(metadata)
+	})
 }
 
 func (i *IndexFile) SetBenchmarkFile(f io.Writer) {
@@ -202,12 +354,8 @@ func (i *IndexFile) SetBenchmarkFile(f io.Writer) {
 	}
 }
 
+// IsSearch reports whether the strings of the field named fieldName are also
+// indexed as ngrams, see IndexKind.
 func (i *IndexFile) IsSearch(fieldName string) bool {
-	for _, sh := range i.searchHeaders {
-		if fieldName == sh {
-			return true
-		}
-	}
-
-	return false
+	return i.IndexKind(fieldName) == IndexKindNgram
 }
@@ -1,6 +1,8 @@
 package appendable
 
 import (
+	"bytes"
+	"errors"
 	"testing"
 
 	"github.com/kevmo314/appendable/pkg/buftest"
@@ -39,6 +41,16 @@ func TestIndexFile(t *testing.T) {
 			t.Fatal("expected error")
 		}
 	})
+
+	t.Run("synchronizing from a reader requires a reader data handler", func(t *testing.T) {
+		i, err := NewIndexFile(buftest.NewSeekableBuffer(), &FormatHandler{ReturnsFormat: FormatJSONL}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.SynchronizeReader(bytes.NewReader(nil)); !errors.Is(err, ErrReaderUnsupported) {
+			t.Fatalf("got %v, want ErrReaderUnsupported", err)
+		}
+	})
 }
 
 func TestWidthAllocation(t *testing.T) {
@@ -0,0 +1,64 @@
+package appendable
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kevmo314/appendable/pkg/bptree"
+	"github.com/kevmo314/appendable/pkg/linkedpage"
+	"github.com/kevmo314/appendable/pkg/pagefile"
+)
+
+// Snapshot is a read-only index file that is queried as it was when it was
+// taken, see IndexFile.Snapshot. Writing to it fails with
+// pagefile.ErrReadOnly.
+type Snapshot struct {
+	*IndexFile
+	ps *pagefile.Snapshot
+}
+
+// Snapshot returns a read-only copy of i as it was after its last
+// synchronization, or as it was before the synchronization in progress. The
+// metadata, including ReadOffset, and the indexes of a snapshot always match.
+//
+// Unlike i, which must only be used by one goroutine, snapshots can be taken
+// and queried from other goroutines while i is synchronized, and each
+// snapshot can be used by its own goroutine. The pages that i overwrites
+// while a snapshot is open are held in memory, so snapshots should be closed
+// once they are no longer needed.
+//
+// The index file must implement io.ReaderAt.
+func (i *IndexFile) Snapshot() (*Snapshot, error) {
+	ps, err := i.pf.Snapshot()
+	if err != nil {
+		return nil, fmt.Errorf("failed to take snapshot: %w", err)
+	}
+	// the node cache of i also holds nodes that aren't committed yet.
+	cache := bptree.NewNodeCache(DefaultNodeCacheSize)
+	tree, err := linkedpage.NewMultiBPTree(ps.PageFile, 0)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to create multi b+ tree: %w", err), ps.Close())
+	}
+	tree.SetNodeCache(cache)
+	node, err := tree.Next()
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to get next meta page: %w", err), ps.Close())
+	}
+	return &Snapshot{
+		IndexFile: &IndexFile{
+			tree:          node,
+			dataHandler:   i.dataHandler,
+			pf:            ps.PageFile,
+			cache:         cache,
+			searchHeaders: i.searchHeaders,
+			spec:          i.spec,
+		},
+		ps: ps,
+	}, nil
+}
+
+// Close releases the pages that the snapshot holds. It must not be queried
+// afterwards.
+func (s *Snapshot) Close() error {
+	return s.ps.Close()
+}
@@ -0,0 +1,368 @@
+package appendable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+)
+
+// IndexKind is how the values of a field are indexed.
+type IndexKind string
+
+const (
+	// IndexKindBTree indexes the values in a B+ tree for each of their types,
+	// which is how fields are indexed without an index spec.
+	IndexKindBTree IndexKind = "btree"
+	// IndexKindNgram also indexes the unigrams, bigrams and trigrams of
+	// strings for full text search, like the search headers.
+	IndexKindNgram IndexKind = "ngram"
+	// IndexKindVector indexes arrays of numbers as vectors. It's reserved
+	// until vector indexes are built, index specs that use it are rejected.
+	IndexKindVector IndexKind = "vector"
+	// IndexKindNone doesn't index the values.
+	IndexKindNone IndexKind = "none"
+)
+
+// ErrUnsupportedIndexKind is returned for index specs that declare a kind of
+// index that isn't built yet.
+var ErrUnsupportedIndexKind = errors.New("unsupported index kind")
+
+// IndexSpec declares which fields are indexed and how. Field names are the
+// dotted paths of the fields, such as "user.name", and patterns are matched
+// with path.Match, so * also matches dots.
+//
+// The kind of a field is, in order of precedence:
+//   - the kind of its name in Fields, or of the longest pattern in Fields
+//     that matches it.
+//   - IndexKindNone if Include is set and no pattern in it matches, or if a
+//     pattern in Exclude matches.
+//   - IndexKindBTree.
+//
+// Objects and arrays are always descended into, so a field can be included
+// without including its parents.
+type IndexSpec struct {
+	Include []string             `json:"include,omitempty"`
+	Exclude []string             `json:"exclude,omitempty"`
+	Fields  map[string]IndexKind `json:"fields,omitempty"`
+}
+
+// ParseIndexSpec parses a JSON index spec, such as
+//
+//	{
+//		"include": ["id", "user.*"],
+//		"exclude": ["user.password"],
+//		"fields": {"user.bio": "ngram", "payload": "none"}
+//	}
+func ParseIndexSpec(buf []byte) (*IndexSpec, error) {
+	spec, err := parseIndexSpec(buf)
+	if err != nil {
+		return nil, err
+	}
+	if err := spec.supported(); err != nil {
+		return nil, fmt.Errorf("invalid index spec: %w", err)
+	}
+	return spec, nil
+}
+
+// parseIndexSpec parses a JSON index spec without checking that its kinds
+// are supported, so that index files that were given a spec before a kind
+// was rejected can still be opened.
+func parseIndexSpec(buf []byte) (*IndexSpec, error) {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	spec := &IndexSpec{}
+	if err := dec.Decode(spec); err != nil {
+		return nil, fmt.Errorf("failed to parse index spec: %w", err)
+	}
+	if err := spec.validate(); err != nil {
+		return nil, fmt.Errorf("invalid index spec: %w", err)
+	}
+	return spec, nil
+}
+
+func (s *IndexSpec) validate() error {
+	for _, patterns := range [][]string{s.Include, s.Exclude} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	for pattern, kind := range s.Fields {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("pattern %q: %w", pattern, err)
+		}
+		switch kind {
+		case IndexKindBTree, IndexKindNgram, IndexKindVector, IndexKindNone:
+		default:
+			return fmt.Errorf("field %q: unknown index kind %q", pattern, kind)
+		}
+	}
+	return nil
+}
+
+// supported returns ErrUnsupportedIndexKind if the spec declares a kind of
+// index that the data handlers don't build.
+func (s *IndexSpec) supported() error {
+	for pattern, kind := range s.Fields {
+		if kind == IndexKindVector {
+			return fmt.Errorf("field %q: %w %q", pattern, ErrUnsupportedIndexKind, kind)
+		}
+	}
+	return nil
+}
+
+// Kind returns the kind of the field named name.
+func (s *IndexSpec) Kind(name string) IndexKind {
+	if kind, ok := s.Fields[name]; ok {
+		return kind
+	}
+	// the longest pattern is the most specific, ties are broken by the
+	// order of the patterns so that the kind doesn't depend on the map order.
+	patterns := make([]string, 0, len(s.Fields))
+	for pattern := range s.Fields {
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+	for _, pattern := range patterns {
+		if match(pattern, name) {
+			return s.Fields[pattern]
+		}
+	}
+
+	if len(s.Include) > 0 && !matchAny(s.Include, name) {
+		return IndexKindNone
+	}
+	if matchAny(s.Exclude, name) {
+		return IndexKindNone
+	}
+	return IndexKindBTree
+}
+
+// match reports whether name matches pattern, patterns are validated when the
+// spec is parsed.
+func match(pattern, name string) bool {
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if match(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *IndexSpec) MarshalBinary() ([]byte, error) {
+	return json.Marshal(s)
+}
+
+func (s *IndexSpec) UnmarshalBinary(buf []byte) error {
+	spec, err := parseIndexSpec(buf)
+	if err != nil {
+		return err
+	}
+	*s = *spec
+	return nil
+}
+
+// specPageHeaderSize is the size of the header of the pages that hold the
+// index spec, the offset of the next page followed by the number of bytes of
+// the spec in the page.
+const specPageHeaderSize = 8 + 2
+
+// IndexSpec returns the index spec that the index file was synchronized with,
+// or nil if it doesn't have one.
+func (i *IndexFile) IndexSpec() *IndexSpec {
+	return i.spec
+}
+
+// IndexKind returns how the field named fieldName is indexed. Fields are
+// indexed as the index spec declares and search headers that the spec
+// indexes in a B+ tree are also indexed as ngrams.
+func (i *IndexFile) IndexKind(fieldName string) IndexKind {
+	// the kind is looked up for every value, so it's cached per field.
+	if kind, ok := i.kinds[fieldName]; ok {
+		return kind
+	}
+	kind := IndexKindBTree
+	if i.spec != nil {
+		kind = i.spec.Kind(fieldName)
+	}
+	if kind == IndexKindBTree {
+		for _, sh := range i.searchHeaders {
+			if fieldName == sh {
+				kind = IndexKindNgram
+				break
+			}
+		}
+	}
+	if i.kinds == nil {
+		i.kinds = make(map[string]IndexKind)
+	}
+	i.kinds[fieldName] = kind
+	return kind
+}
+
+// SetIndexSpec stores spec in the index file, replacing its index spec, or
+// removes the index spec if spec is nil. Later synchronizations follow the
+// stored spec, but fields of records that were already synchronized stay
+// indexed as they are. Nothing is written if the spec is unchanged.
+func (i *IndexFile) SetIndexSpec(spec *IndexSpec) error {
+	if spec != nil {
+		if err := errors.Join(spec.validate(), spec.supported()); err != nil {
+			return fmt.Errorf("invalid index spec: %w", err)
+		}
+	}
+	if equalSpecs(i.spec, spec) {
+		return nil
+	}
+	err := i.transaction(func() error {
+		if err := i.setIndexSpec(spec); err != nil {
+			return err
+		}
+		// readers in other processes must see that the pages changed.
+		metadata, err := i.Metadata()
+		if err != nil {
+			return err
+		}
+		metadata.Generation++
+		return i.SetMetadata(metadata)
+	})
+	if err != nil {
+		return err
+	}
+	i.useIndexSpec(spec)
+	return nil
+}
+
+func equalSpecs(a, b *IndexSpec) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	abuf, aerr := a.MarshalBinary()
+	bbuf, berr := b.MarshalBinary()
+	return aerr == nil && berr == nil && bytes.Equal(abuf, bbuf)
+}
+
+// setIndexSpec writes spec to new pages, frees the pages of the previous spec
+// and points the metadata at the new pages. The index file only uses spec
+// once the transaction is committed, see useIndexSpec.
+func (i *IndexFile) setIndexSpec(spec *IndexSpec) error {
+	metadata, err := i.Metadata()
+	if err != nil {
+		return err
+	}
+	old, err := i.specPages(metadata.Spec)
+	if err != nil {
+		return err
+	}
+
+	metadata.Spec = 0
+	if spec != nil {
+		buf, err := spec.MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("failed to marshal index spec: %w", err)
+		}
+		size := i.pf.PageSize() - specPageHeaderSize
+		var chunks [][]byte
+		for len(buf) > size {
+			chunks, buf = append(chunks, buf[:size]), buf[size:]
+		}
+		chunks = append(chunks, buf)
+		// the pages are written back to front so that each page knows the
+		// offset of the next one.
+		var next int64
+		for j := len(chunks) - 1; j >= 0; j-- {
+			page := make([]byte, specPageHeaderSize+len(chunks[j]))
+			binary.LittleEndian.PutUint64(page, uint64(next))
+			binary.LittleEndian.PutUint16(page[8:], uint16(len(chunks[j])))
+			copy(page[specPageHeaderSize:], chunks[j])
+			if next, err = i.pf.NewPage(page); err != nil {
+				return fmt.Errorf("failed to write index spec: %w", err)
+			}
+		}
+		metadata.Spec = uint64(next)
+	}
+	for _, offset := range old {
+		if err := i.pf.FreePage(offset); err != nil {
+			return fmt.Errorf("failed to free index spec page: %w", err)
+		}
+	}
+	return i.SetMetadata(metadata)
+}
+
+// useIndexSpec makes spec the index spec of the index file once the
+// transaction that wrote it with setIndexSpec is committed.
+func (i *IndexFile) useIndexSpec(spec *IndexSpec) {
+	i.spec = spec
+	i.kinds = nil
+}
+
+// readIndexSpec reads the index spec whose first page is at offset, zero if
+// there is none.
+func (i *IndexFile) readIndexSpec(offset uint64) (*IndexSpec, error) {
+	if offset == 0 {
+		return nil, nil
+	}
+	var buf []byte
+	if _, err := i.walkSpecPages(offset, func(page []byte) {
+		n := binary.LittleEndian.Uint16(page[8:])
+		buf = append(buf, page[specPageHeaderSize:specPageHeaderSize+int(n)]...)
+	}); err != nil {
+		return nil, err
+	}
+	spec := &IndexSpec{}
+	if err := spec.UnmarshalBinary(buf); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// specPages returns the offsets of the pages of the index spec whose first
+// page is at offset.
+func (i *IndexFile) specPages(offset uint64) ([]int64, error) {
+	if offset == 0 {
+		return nil, nil
+	}
+	return i.walkSpecPages(offset, func([]byte) {})
+}
+
+// walkSpecPages calls f with each page of the index spec starting at offset
+// and returns their offsets.
+func (i *IndexFile) walkSpecPages(offset uint64, f func(page []byte)) ([]int64, error) {
+	var offsets []int64
+	seen := make(map[uint64]bool)
+	page := make([]byte, i.pf.PageSize())
+	for offset != 0 {
+		if seen[offset] {
+			return nil, fmt.Errorf("index spec page %d is in a cycle", offset)
+		}
+		seen[offset] = true
+		if _, err := i.pf.Seek(int64(offset), io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(i.pf, page); err != nil {
+			return nil, fmt.Errorf("failed to read index spec page %d: %w", offset, err)
+		}
+		if n := binary.LittleEndian.Uint16(page[8:]); specPageHeaderSize+int(n) > len(page) {
+			return nil, errors.New("invalid index spec page length")
+		}
+		offsets = append(offsets, int64(offset))
+		f(page)
+		offset = binary.LittleEndian.Uint64(page)
+	}
+	return offsets, nil
+}
@@ -0,0 +1,181 @@
+package appendable
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kevmo314/appendable/pkg/buftest"
+)
+
+// appendOnlyFile fails to write before end, so commits fail.
+type appendOnlyFile struct {
+	*buftest.SeekableBuffer
+	end int64
+}
+
+func (f *appendOnlyFile) Write(buf []byte) (int, error) {
+	pos, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if pos < f.end {
+		return 0, errors.New("append only")
+	}
+	return f.SeekableBuffer.Write(buf)
+}
+
+func TestIndexSpec(t *testing.T) {
+	t.Run("kinds follow the precedence of the spec", func(t *testing.T) {
+		spec, err := ParseIndexSpec([]byte(`{
+			"include": ["id", "user.*", "text"],
+			"exclude": ["user.password"],
+			"fields": {"text": "ngram", "user.bio*": "ngram", "user.b*": "none", "payload": "btree"}
+		}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, want := range map[string]IndexKind{
+			"id":                IndexKindBTree,
+			"user.name":         IndexKindBTree,
+			"user.address.city": IndexKindBTree,
+			"user.password":     IndexKindNone,
+			"user.bio":          IndexKindNgram,
+			"user.birthday":     IndexKindNone,
+			"text":              IndexKindNgram,
+			"payload":           IndexKindBTree,
+			"other":             IndexKindNone,
+			"user":              IndexKindNone,
+		} {
+			if got := spec.Kind(name); got != want {
+				t.Errorf("Kind(%q) = %q, want %q", name, got, want)
+			}
+		}
+	})
+
+	t.Run("invalid specs are rejected", func(t *testing.T) {
+		for _, buf := range []string{
+			`{"fields": {"a": "hash"}}`,
+			`{"fields": {"a": "vector"}}`,
+			`{"exclude": ["["]}`,
+			`{"fields": {"[": "none"}}`,
+			`{"includes": ["a"]}`,
+			`[]`,
+		} {
+			if _, err := ParseIndexSpec([]byte(buf)); err == nil {
+				t.Errorf("expected %s to be rejected", buf)
+			}
+		}
+	})
+
+	t.Run("search headers are indexed as ngrams unless the spec says otherwise", func(t *testing.T) {
+		i, err := NewIndexFile(buftest.NewSeekableBuffer(), &FormatHandler{ReturnsFormat: FormatJSONL}, []string{"a", "b"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !i.IsSearch("a") || i.IsSearch("c") {
+			t.Fatal("expected only a to be searched")
+		}
+		if err := i.SetIndexSpec(&IndexSpec{Fields: map[string]IndexKind{"b": IndexKindNone, "c": IndexKindNgram}}); err != nil {
+			t.Fatal(err)
+		}
+		for name, want := range map[string]IndexKind{"a": IndexKindNgram, "b": IndexKindNone, "c": IndexKindNgram} {
+			if got := i.IndexKind(name); got != want {
+				t.Errorf("IndexKind(%q) = %q, want %q", name, got, want)
+			}
+		}
+	})
+
+	t.Run("specs are stored in the index file", func(t *testing.T) {
+		b := buftest.NewSeekableBuffer()
+		i, err := NewIndexFile(b, &FormatHandler{ReturnsFormat: FormatJSONL}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i.IndexSpec() != nil {
+			t.Fatal("expected no spec")
+		}
+
+		// a spec that spans several pages.
+		large := &IndexSpec{Fields: make(map[string]IndexKind)}
+		for j := 0; j < 1000; j++ {
+			large.Fields[fmt.Sprintf("field%d", j)] = IndexKindNone
+		}
+		small := &IndexSpec{Exclude: []string{"payload.*"}}
+		for _, spec := range []*IndexSpec{large, small, nil} {
+			if err := i.SetIndexSpec(spec); err != nil {
+				t.Fatal(err)
+			}
+			reopened, err := NewIndexFile(b, &FormatHandler{ReturnsFormat: FormatJSONL}, []string{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(reopened.IndexSpec(), spec) {
+				t.Fatalf("got %+v, want %+v", reopened.IndexSpec(), spec)
+			}
+			report, err := reopened.Verify(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Problems) > 0 {
+				t.Fatalf("got problems %v", report.Problems)
+			}
+		}
+		// the pages of replaced specs are freed.
+		free, err := i.pf.FreePages()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(free) != int(i.pf.PageCount())-2 {
+			t.Fatalf("got %d free pages of %d", len(free), i.pf.PageCount())
+		}
+	})
+
+	t.Run("specs that fail to be written aren't used", func(t *testing.T) {
+		b := buftest.NewSeekableBuffer()
+		i, err := NewIndexFile(b, &FormatHandler{ReturnsFormat: FormatJSONL}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		spec := &IndexSpec{Fields: map[string]IndexKind{"text": IndexKindNgram}}
+		if err := i.SetIndexSpec(spec); err != nil {
+			t.Fatal(err)
+		}
+
+		// the new pages are written but the commit isn't.
+		r, err := NewIndexFile(&appendOnlyFile{SeekableBuffer: b, end: int64(len(b.Bytes()))}, &FormatHandler{ReturnsFormat: FormatJSONL}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.IndexKind("text") != IndexKindNgram {
+			t.Fatalf("got kind %v, want ngram", r.IndexKind("text"))
+		}
+		if err := r.SetIndexSpec(&IndexSpec{Fields: map[string]IndexKind{"text": IndexKindNone}}); err == nil {
+			t.Fatal("expected an error")
+		}
+		if !reflect.DeepEqual(r.IndexSpec(), spec) || r.IndexKind("text") != IndexKindNgram {
+			t.Fatalf("got %+v, want %+v", r.IndexSpec(), spec)
+		}
+	})
+
+	t.Run("compacted index files keep the spec", func(t *testing.T) {
+		i, err := NewIndexFile(buftest.NewSeekableBuffer(), &FormatHandler{ReturnsFormat: FormatJSONL}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		spec := &IndexSpec{Include: []string{strings.Repeat("a", 5000)}}
+		if err := i.SetIndexSpec(spec); err != nil {
+			t.Fatal(err)
+		}
+		c, err := i.Compact(nil, buftest.NewSeekableBuffer())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(c.IndexSpec(), spec) {
+			t.Fatalf("got %+v, want %+v", c.IndexSpec(), spec)
+		}
+	})
+}
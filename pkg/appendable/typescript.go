@@ -1,23 +1,96 @@
 package appendable
 
-// func (f *IndexFile) WriteTypescriptDefinitions(w io.Writer) error {
-// 	_, err := w.Write([]byte(`// This file was generated by github.com/kevmo314/appendable/pkg/appendable/typescript.go`))
-// 	if err != nil {
-// 		return err
-// 	}
-// 	if _, err := w.Write([]byte("\n\nexport type Record = {\n")); err != nil {
-// 		return err
-// 	}
-// 	// iterate over each field in the index header and generate a field for it
-// 	for _, index := range f.Indexes {
-// 		_, err := w.Write([]byte("\t\"" + index.FieldName + "\": " + index.FieldType.TypescriptType() + ";\n"))
-// 		if err != nil {
-// 			return err
-// 		}
-// 	}
-// 	if _, err := w.Write([]byte("}\n")); err != nil {
-// 		return err
-// 	}
+import (
+	"io"
+	"strconv"
+	"strings"
+)
 
-// 	return nil
-// }
+// writeFields writes the fields of n as the properties of an object type.
+// Fields that may be missing from records are optional.
+func (n *typeNode) writeFields(w io.Writer, indent string, optional bool) error {
+	for _, name := range n.names() {
+		separator := ": "
+		if optional {
+			separator = "?: "
+		}
+		if _, err := io.WriteString(w, indent+strconv.Quote(name)+separator); err != nil {
+			return err
+		}
+		if err := n.fields[name].writeType(w, indent, optional); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, ";\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeType writes the union of the types seen for n.
+//
+// The values of an array are indexed under the name of the array, so if an
+// array was seen, the other types are assumed to be the types of its values.
+func (n *typeNode) writeType(w io.Writer, indent string, optional bool) error {
+	var components []string
+	seen := make(map[string]bool)
+	for _, t := range n.valueTypes() {
+		if ts := t.TypescriptType(); !seen[ts] {
+			seen[ts] = true
+			components = append(components, ts)
+		}
+	}
+	switch {
+	case len(n.fields) > 0:
+		var b strings.Builder
+		b.WriteString("{\n")
+		if err := n.writeFields(&b, indent+"\t", optional); err != nil {
+			return err
+		}
+		b.WriteString(indent + "}")
+		components = append(components, b.String())
+	case n.types[FieldTypeObject]:
+		components = append(components, FieldTypeObject.TypescriptType())
+	}
+	if n.types[FieldTypeArray] {
+		switch len(components) {
+		case 0:
+			components = []string{FieldTypeArray.TypescriptType()}
+		case 1:
+			components = []string{components[0] + "[]"}
+		default:
+			components = []string{"(" + strings.Join(components, " | ") + ")[]"}
+		}
+	}
+	if len(components) == 0 {
+		components = []string{"unknown"}
+	}
+	_, err := io.WriteString(w, strings.Join(components, " | "))
+	return err
+}
+
+// WriteTypescriptDefinitions writes the TypeScript type of the records of the
+// data file, Record, to w. The type of each field is the union of the types
+// of its indexes, and fields of objects are nested in the type of the object.
+// Fields of JSONL and RecordIO records are optional, since the records don't
+// need to have all of them.
+func (i *IndexFile) WriteTypescriptDefinitions(w io.Writer) error {
+	metadata, err := i.Metadata()
+	if err != nil {
+		return err
+	}
+	root, err := i.fieldTypes()
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, "// This file was generated by github.com/kevmo314/appendable/pkg/appendable/typescript.go\n\nexport type Record = {\n"); err != nil {
+		return err
+	}
+	optional := metadata.Format == FormatJSONL || metadata.Format == FormatRecordIO
+	if err := root.writeFields(w, "\t", optional); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "};\n")
+	return err
+}
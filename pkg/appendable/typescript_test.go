@@ -0,0 +1,115 @@
+package appendable
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kevmo314/appendable/pkg/buftest"
+)
+
+func TestTypescriptDefinitions(t *testing.T) {
+	newIndexFile := func(t *testing.T, format Format, fields map[string][]FieldType) *IndexFile {
+		i, err := NewIndexFile(buftest.NewSeekableBuffer(), &FormatHandler{ReturnsFormat: format}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, fieldTypes := range fields {
+			for _, ft := range fieldTypes {
+				if _, _, err := i.FindOrCreateIndex(name, ft); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		return i
+	}
+
+	t.Run("types are merged and nested", func(t *testing.T) {
+		i := newIndexFile(t, FormatJSONL, map[string][]FieldType{
+			"id":        {FieldTypeUint64, FieldTypeInt64},
+			"score":     {FieldTypeFloat64, FieldTypeNull},
+			"name":      {FieldTypeString, FieldTypeUnigram, FieldTypeBigram, FieldTypeTrigram},
+			"user":      {FieldTypeObject},
+			"user.name": {FieldTypeString},
+			"user.tags": {FieldTypeArray, FieldTypeString},
+			"items":     {FieldTypeArray},
+			"items.id":  {FieldTypeInt64},
+			"values":    {FieldTypeArray, FieldTypeBoolean, FieldTypeInt64},
+			"empty":     {FieldTypeObject},
+			"list":      {FieldTypeArray},
+		})
+		var b bytes.Buffer
+		if err := i.WriteTypescriptDefinitions(&b); err != nil {
+			t.Fatal(err)
+		}
+		want := `// This file was generated by github.com/kevmo314/appendable/pkg/appendable/typescript.go
+
+export type Record = {
+	"empty"?: { [key: string]: unknown };
+	"id"?: number;
+	"items"?: {
+		"id"?: number;
+	}[];
+	"list"?: unknown[];
+	"name"?: string;
+	"score"?: number | null;
+	"user"?: {
+		"name"?: string;
+		"tags"?: string[];
+	};
+	"values"?: (number | boolean)[];
+};
+`
+		if b.String() != want {
+			t.Fatalf("got\n%s\nwant\n%s", b.String(), want)
+		}
+	})
+
+	t.Run("fields of csv records are required", func(t *testing.T) {
+		i := newIndexFile(t, FormatCSV, map[string][]FieldType{
+			"first name": {FieldTypeString, FieldTypeNull},
+		})
+		var b bytes.Buffer
+		if err := i.WriteTypescriptDefinitions(&b); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(b.Bytes(), []byte("\t\"first name\": string | null;\n")) {
+			t.Fatalf("got\n%s", b.String())
+		}
+	})
+
+	t.Run("headers of csv records with dots aren't nested", func(t *testing.T) {
+		i := newIndexFile(t, FormatCSV, map[string][]FieldType{
+			"a.b": {FieldTypeInt64},
+		})
+		var b bytes.Buffer
+		if err := i.WriteTypescriptDefinitions(&b); err != nil {
+			t.Fatal(err)
+		}
+		want := `// This file was generated by github.com/kevmo314/appendable/pkg/appendable/typescript.go
+
+export type Record = {
+	"a.b": number;
+};
+`
+		if b.String() != want {
+			t.Fatalf("got\n%s\nwant\n%s", b.String(), want)
+		}
+	})
+}
+
+func TestTypescriptType(t *testing.T) {
+	for ft, want := range map[FieldType]string{
+		FieldTypeString:  "string",
+		FieldTypeInt64:   "number",
+		FieldTypeUint64:  "number",
+		FieldTypeFloat64: "number",
+		FieldTypeBoolean: "boolean",
+		FieldTypeNull:    "null",
+		FieldTypeTrigram: "string",
+		FieldTypeVector:  "number[]",
+	} {
+		if got := ft.TypescriptType(); got != want {
+			t.Errorf("got %q for %d, want %q", got, ft, want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package appendable
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/kevmo314/appendable/pkg/bptree"
+	"github.com/kevmo314/appendable/pkg/encoding"
+	"github.com/kevmo314/appendable/pkg/pointer"
+)
+
+// upgradeFillFactor is the fraction of each page filled when an index is
+// rebuilt during an upgrade.
+const upgradeFillFactor = 0.9
+
+// upgrades maps a version to the function that converts an index file of
+// that version to the next version.
+var upgrades = map[Version]func(i *IndexFile) error{
+	1: upgradeSortableFloats,
+}
+
+// ErrNeedsUpgrade is returned when reading keys of an index file that are
+// encoded differently by its version. Index files are upgraded by the first
+// synchronization that writes them.
+var ErrNeedsUpgrade = errors.New("index file needs to be upgraded by synchronizing it")
+
+// CheckVersion returns ErrNeedsUpgrade if the keys of the index file aren't
+// encoded as they are by CurrentVersion.
+func (i *IndexFile) CheckVersion() error {
+	metadata, err := i.Metadata()
+	if err != nil {
+		return err
+	}
+	// version 1 encodes floats differently, see upgradeSortableFloats.
+	if metadata.Version < 2 {
+		return fmt.Errorf("version %d: %w", metadata.Version, ErrNeedsUpgrade)
+	}
+	return nil
+}
+
+// upgrade converts the index file to CurrentVersion. It must be called in a
+// transaction, nothing is written if the index file is current.
+func (i *IndexFile) upgrade() error {
+	if i.tree == nil {
+		// the index file is being opened.
+		return nil
+	}
+	metadata, err := i.Metadata()
+	if err != nil {
+		return err
+	}
+	for metadata.Version < CurrentVersion {
+		f, ok := upgrades[metadata.Version]
+		if !ok {
+			return fmt.Errorf("unsupported version: %d", metadata.Version)
+		}
+		if err := f(i); err != nil {
+			return fmt.Errorf("failed to upgrade index file from version %d: %w", metadata.Version, err)
+		}
+		metadata.Version++
+		// readers in other processes must see that the pages changed.
+		metadata.Generation++
+		if err := i.SetMetadata(metadata); err != nil {
+			return fmt.Errorf("failed to set metadata: %w", err)
+		}
+	}
+	return nil
+}
+
+// upgradeSortableFloats re-encodes the keys of float64 indexes from the
+// big-endian IEEE 754 bits used by version 1 to encoding.EncodeFloat64.
+// The old encoding sorts negative numbers after positive numbers, so each
+// index is rebuilt instead of rewritten in place and the pages of the old
+// tree are freed.
+func upgradeSortableFloats(i *IndexFile) error {
+	page, err := i.Indexes()
+	for err == nil {
+		meta := &IndexMeta{}
+		if err := page.UnmarshalMetadata(meta); err != nil {
+			return fmt.Errorf("failed to unmarshal index metadata: %w", err)
+		}
+		if meta.FieldType == FieldTypeFloat64 {
+			// float keys are inlined, so the tree doesn't need the data file.
+			tree := page.BPTree(&bptree.BPTree{Width: meta.Width})
+			iter, err := tree.SeekFirst()
+			if err != nil {
+				return fmt.Errorf("failed to read index %s: %w", meta.FieldName, err)
+			}
+			var entries []bptree.Entry
+			for iter.Next() {
+				key := iter.Key()
+				f := math.Float64frombits(binary.BigEndian.Uint64(key.Value))
+				entries = append(entries, bptree.Entry{
+					Key:   pointer.ReferencedValue{DataPointer: key.DataPointer, Value: encoding.EncodeFloat64(f)},
+					Value: iter.Pointer(),
+				})
+			}
+			if err := iter.Err(); err != nil {
+				return fmt.Errorf("failed to read index %s: %w", meta.FieldName, err)
+			}
+			var old []int64
+			if err := tree.Walk(func(offset uint64, _ *bptree.BPTreeNode, _, _ *pointer.ReferencedValue, err error) error {
+				if err != nil {
+					return err
+				}
+				old = append(old, int64(offset))
+				return nil
+			}); err != nil {
+				return fmt.Errorf("failed to read index %s: %w", meta.FieldName, err)
+			}
+			if err := page.SetRoot(pointer.MemoryPointer{}); err != nil {
+				return fmt.Errorf("failed to reset index %s: %w", meta.FieldName, err)
+			}
+			if err := tree.BulkInsert(entries, upgradeFillFactor); err != nil {
+				return fmt.Errorf("failed to rebuild index %s: %w", meta.FieldName, err)
+			}
+			// the old nodes are freed once they're no longer read.
+			for _, offset := range old {
+				if err := i.pf.FreePage(offset); err != nil {
+					return fmt.Errorf("failed to free page of index %s: %w", meta.FieldName, err)
+				}
+			}
+			// the cache may hold the freed nodes.
+			i.cache.Clear()
+		}
+		page, err = page.Next()
+	}
+	if !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read indexes: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package appendable
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/kevmo314/appendable/pkg/bptree"
+	"github.com/kevmo314/appendable/pkg/buftest"
+	"github.com/kevmo314/appendable/pkg/encoding"
+	"github.com/kevmo314/appendable/pkg/pointer"
+)
+
+// readOnlyFile fails to write, like an index file opened with os.Open.
+type readOnlyFile struct {
+	io.ReadSeeker
+}
+
+func (readOnlyFile) Write([]byte) (int, error) {
+	return 0, errors.New("read-only file")
+}
+
+func TestUpgrade(t *testing.T) {
+	t.Run("version 1 floats are re-encoded", func(t *testing.T) {
+		f := buftest.NewSeekableBuffer()
+		handler := &FormatHandler{ReturnsFormat: FormatJSONL}
+
+		i, err := NewIndexFile(f, handler, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// write a version 1 file by hand.
+		values := []float64{3, -1, 0.5, -2, 1e10, -1e10}
+		page, meta, err := i.FindOrCreateIndex("n", FieldTypeFloat64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree := page.BPTree(&bptree.BPTree{Width: meta.Width})
+		for j, v := range values {
+			buf := make([]byte, 8)
+			binary.BigEndian.PutUint64(buf, math.Float64bits(v))
+			if err := tree.Insert(pointer.ReferencedValue{
+				DataPointer: pointer.MemoryPointer{Offset: uint64(j), Length: 1},
+				Value:       buf,
+			}, pointer.MemoryPointer{Offset: uint64(j), Length: 2}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		metadata, err := i.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		metadata.Version = 1
+		if err := i.SetMetadata(metadata); err != nil {
+			t.Fatal(err)
+		}
+
+		root, err := page.Root()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// opening the index file doesn't upgrade it, so it can be opened
+		// read-only, but its floats can't be read.
+		r, err := NewIndexFile(readOnlyFile{f}, handler, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metadata, err := r.Metadata(); err != nil {
+			t.Fatal(err)
+		} else if metadata.Version != 1 {
+			t.Fatalf("got version %d, want 1", metadata.Version)
+		}
+		if err := r.CheckVersion(); !errors.Is(err, ErrNeedsUpgrade) {
+			t.Fatalf("got %v, want ErrNeedsUpgrade", err)
+		}
+		if _, err := r.Verify(nil); !errors.Is(err, ErrNeedsUpgrade) {
+			t.Fatalf("got %v, want ErrNeedsUpgrade", err)
+		}
+
+		// the first synchronization upgrades it.
+		i, err = NewIndexFile(f, handler, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(nil); err != nil {
+			t.Fatal(err)
+		}
+		if metadata, err := i.Metadata(); err != nil {
+			t.Fatal(err)
+		} else if metadata.Version != CurrentVersion {
+			t.Fatalf("got version %d, want %d", metadata.Version, CurrentVersion)
+		}
+		if err := i.CheckVersion(); err != nil {
+			t.Fatal(err)
+		}
+		free, err := i.pf.FreePages()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Contains(free, int64(root.Offset)) {
+			t.Fatalf("the old root %d isn't free, free pages are %v", root.Offset, free)
+		}
+
+		page, meta, err = i.FindOrCreateIndex("n", FieldTypeFloat64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		iter, err := page.BPTree(&bptree.BPTree{Width: meta.Width}).SeekFirst()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []float64
+		for iter.Next() {
+			v := encoding.DecodeFloat64(iter.Key().Value)
+			got = append(got, v)
+			// the pointers of each key must be kept.
+			j := iter.Pointer().Offset
+			if values[j] != v || iter.Key().DataPointer.Offset != j || iter.Pointer().Length != 2 {
+				t.Fatalf("key %v points at %+v", v, iter.Pointer())
+			}
+		}
+		if err := iter.Err(); err != nil {
+			t.Fatal(err)
+		}
+		want := []float64{-1e10, -2, -1, 0.5, 3, 1e10}
+		if len(got) != len(want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		for j := range want {
+			if got[j] != want[j] {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		}
+	})
+
+	t.Run("newer versions are rejected", func(t *testing.T) {
+		f := buftest.NewSeekableBuffer()
+		handler := &FormatHandler{ReturnsFormat: FormatJSONL}
+
+		i, err := NewIndexFile(f, handler, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		metadata, err := i.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		metadata.Version = CurrentVersion + 1
+		if err := i.SetMetadata(metadata); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewIndexFile(f, handler, []string{}); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
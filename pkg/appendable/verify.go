@@ -0,0 +1,225 @@
+package appendable
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/kevmo314/appendable/pkg/bptree"
+	"github.com/kevmo314/appendable/pkg/linkedpage"
+	"github.com/kevmo314/appendable/pkg/pointer"
+)
+
+// Problem is an inconsistency found by Verify.
+type Problem struct {
+	// Offset is the offset in the index file of the page with the problem.
+	Offset uint64
+	// Index is the index with the problem, nil if the problem isn't in an
+	// index.
+	Index   *IndexMeta
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Index == nil {
+		return fmt.Sprintf("offset %d: %s", p.Offset, p.Message)
+	}
+	return fmt.Sprintf("offset %d: index %q (type %d): %s", p.Offset, p.Index.FieldName, p.Index.FieldType, p.Message)
+}
+
+// Report is the result of Verify.
+type Report struct {
+	Indexes, Nodes, Keys int
+	Problems             []Problem
+}
+
+// Verify checks that the index file is consistent with the data file df,
+// which is the data file that the index file was synchronized with.
+//
+// Every index is walked and its keys are checked to be sorted, both within
+// and across nodes. The data pointers of keys and records are checked to be
+// in df and the keys stored in the index, which are the fixed width keys, are
+// checked to be the parsed value that they point to. A width that doesn't
+// match the stored keys is reported as keys that don't parse to the width.
+// Finally the free pages are checked to not be in use.
+//
+// Parquet data pointers are row groups instead of offsets, so they are only
+// checked to be synchronized.
+//
+// Problems are added to the report, errors are only returned if the index
+// file can't be walked at all or if it needs to be upgraded, see
+// CheckVersion.
+func (i *IndexFile) Verify(df []byte) (*Report, error) {
+	if err := i.CheckVersion(); err != nil {
+		return nil, err
+	}
+	report := &Report{}
+	metadata, err := i.Metadata()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	parquet := metadata.Format == FormatParquet
+	if !parquet && metadata.ReadOffset > uint64(len(df)) {
+		report.Problems = append(report.Problems, Problem{
+			Offset:  i.tree.Offset(),
+			Message: fmt.Sprintf("read offset %d is past the end of the %d byte data file", metadata.ReadOffset, len(df)),
+		})
+	}
+
+	// the first page holds the free page indexes.
+	live := map[uint64]bool{0: true, i.tree.Offset(): true}
+	specPages, err := i.specPages(metadata.Spec)
+	if err != nil {
+		report.Problems = append(report.Problems, Problem{Offset: metadata.Spec, Message: fmt.Sprintf("failed to read index spec: %v", err)})
+	}
+	for _, offset := range specPages {
+		live[uint64(offset)] = true
+	}
+	page, err := i.Indexes()
+	for err == nil {
+		live[page.Offset()] = true
+		report.Indexes++
+		if err := i.verifyIndex(report, page, metadata, df, live); err != nil {
+			return nil, err
+		}
+		page, err = page.Next()
+	}
+	if !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+
+	// the offset of the first page after the free page indexes is the page
+	// size.
+	pageSize, err := i.pf.Page(0)
+	if err != nil {
+		return nil, err
+	}
+	end := uint64(i.pf.PageCount() * pageSize)
+	free, err := i.pf.FreePages()
+	if err != nil {
+		report.Problems = append(report.Problems, Problem{Message: fmt.Sprintf("failed to read free pages: %v", err)})
+	}
+	for _, offset := range free {
+		switch {
+		case offset%pageSize != 0 || uint64(offset) >= end:
+			report.Problems = append(report.Problems, Problem{Offset: uint64(offset), Message: "free page is not a page of the file"})
+		case live[uint64(offset)]:
+			report.Problems = append(report.Problems, Problem{Offset: uint64(offset), Message: "free page is in use"})
+		}
+	}
+	return report, nil
+}
+
+func (i *IndexFile) verifyIndex(report *Report, page *linkedpage.LinkedPage, metadata *FileMeta, df []byte, live map[uint64]bool) error {
+	meta := &IndexMeta{}
+	if err := page.UnmarshalMetadata(meta); err != nil {
+		report.Problems = append(report.Problems, Problem{Offset: page.Offset(), Message: fmt.Sprintf("failed to read index metadata: %v", err)})
+		return nil
+	}
+	problem := func(offset uint64, format string, args ...interface{}) {
+		report.Problems = append(report.Problems, Problem{Offset: offset, Index: meta, Message: fmt.Sprintf(format, args...)})
+	}
+	// parquet string indexes created before their keys were stored resolve
+	// them from plain encoded values in the data file.
+	legacy := meta.FieldType == FieldTypeString && metadata.Format == FormatParquet && meta.Width == 0
+	if want := i.indexWidth(meta.FieldType); meta.Width != want && !legacy {
+		problem(page.Offset(), "width %d doesn't match the field type, want %d", meta.Width, want)
+	}
+
+	parquet := metadata.Format == FormatParquet
+	ngram := meta.FieldType == FieldTypeUnigram || meta.FieldType == FieldTypeBigram || meta.FieldType == FieldTypeTrigram
+
+	var last *pointer.ReferencedValue
+	tree := page.BPTree(&bptree.BPTree{Data: df, DataParser: i.dataHandler, Width: meta.Width})
+	err := tree.Walk(func(offset uint64, node *bptree.BPTreeNode, lo, hi *pointer.ReferencedValue, err error) error {
+		if err != nil {
+			problem(offset, "failed to read node: %v", err)
+			return nil
+		}
+		live[offset] = true
+		report.Nodes++
+
+		for j, key := range node.Keys {
+			if j > 0 && pointer.CompareReferencedValues(node.Keys[j-1], key) >= 0 {
+				problem(offset, "key %d %s is not greater than the key before it", j, describeKey(key))
+			}
+			if lo != nil && pointer.CompareReferencedValues(key, *lo) < 0 {
+				problem(offset, "key %d %s is less than the separator %s in its parent", j, describeKey(key), describeKey(*lo))
+			}
+			if hi != nil && pointer.CompareReferencedValues(key, *hi) >= 0 {
+				problem(offset, "key %d %s is not less than the separator %s in its parent", j, describeKey(key), describeKey(*hi))
+			}
+		}
+		if !node.Leaf() {
+			return nil
+		}
+
+		if len(node.Keys) > 0 && last != nil && pointer.CompareReferencedValues(*last, node.Keys[0]) >= 0 {
+			problem(offset, "key 0 %s is not greater than the last key %s of the previous leaf", describeKey(node.Keys[0]), describeKey(*last))
+		}
+		for j, key := range node.Keys {
+			report.Keys++
+			record := node.LeafPointers[j]
+			if parquet {
+				if record.Offset >= metadata.ReadOffset {
+					problem(offset, "record %d points to row group %d, which isn't synchronized", j, record.Offset)
+				}
+				continue
+			}
+			if !inData(record, df) {
+				problem(offset, "record %d %v is outside of the data file", j, record)
+			}
+
+			switch {
+			case ngram:
+				// the length of an n-gram is the length of the whole value.
+				if key.DataPointer.Offset >= uint64(len(df)) {
+					problem(offset, "key %d %s is outside of the data file", j, describeKey(key))
+				}
+			case !inData(key.DataPointer, df):
+				problem(offset, "key %d %s is outside of the data file", j, describeKey(key))
+			case meta.Width != 0 && meta.Width != bptree.StoredWidth:
+				// variable width keys are parsed from the data file when the node
+				// is read, so only the stored keys can differ.
+				value, ok := parse(i.dataHandler, df[key.DataPointer.Offset:key.DataPointer.Offset+uint64(key.DataPointer.Length)])
+				switch {
+				case !ok || value == nil:
+					problem(offset, "key %d %s doesn't parse", j, describeKey(key))
+				case len(value) != int(meta.Width)-1:
+					problem(offset, "key %d %s parses to %d bytes, which doesn't match width %d", j, describeKey(key), len(value), meta.Width)
+				case !bytes.Equal(value, key.Value):
+					problem(offset, "key %d %s doesn't match the parsed value %x", j, describeKey(key), value)
+				}
+			}
+		}
+		if len(node.Keys) > 0 {
+			last = &node.Keys[len(node.Keys)-1]
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to walk index %s: %w", meta.FieldName, err)
+	}
+	return nil
+}
+
+// describeKey formats a key for a problem, keys may not be printable.
+func describeKey(key pointer.ReferencedValue) string {
+	return fmt.Sprintf("%x at %v", key.Value, key.DataPointer)
+}
+
+// inData reports whether mp is a range of df.
+func inData(mp pointer.MemoryPointer, df []byte) bool {
+	return mp.Offset <= uint64(len(df)) && uint64(mp.Length) <= uint64(len(df))-mp.Offset
+}
+
+// parse parses value with p, which may panic on values that it didn't index.
+func parse(p bptree.DataParser, value []byte) (parsed []byte, ok bool) {
+	defer func() {
+		if recover() != nil {
+			parsed, ok = nil, false
+		}
+	}()
+	return p.Parse(value), true
+}
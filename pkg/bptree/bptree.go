@@ -2,7 +2,9 @@ package bptree
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"github.com/kevmo314/appendable/pkg/encoding"
 	"github.com/kevmo314/appendable/pkg/metapage"
 	"io"
 	"slices"
@@ -15,10 +17,22 @@ type BPTree struct {
 	MetaPage metapage.MetaPage
 	PageFile pagefile.ReadWriteSeekPager
 
+	// Data is the data file that variable width keys are resolved from. If
+	// DataReader is set, keys are read from it instead, so the data file
+	// doesn't have to be held in memory.
 	Data       []byte
+	DataReader io.ReaderAt
 	DataParser DataParser
 
 	Width uint16
+
+	// Cache holds the decoded nodes of the tree, it may be shared with the
+	// other trees of the page file.
+	Cache *NodeCache
+}
+
+func (t *BPTree) newNode() *BPTreeNode {
+	return &BPTreeNode{Data: t.Data, DataReader: t.DataReader, DataParser: t.DataParser, Width: t.Width}
 }
 
 func (t *BPTree) root() (*BPTreeNode, pointer.MemoryPointer, error) {
@@ -111,9 +125,15 @@ func (p *TraversalIterator) incr(i, delta int) bool {
 
 func (p *TraversalIterator) Next() bool {
 	if p.records == nil {
-		res := p.init()
-
-		return res && (p.records[0].index != p.records[0].node.NumPointers())
+		if !p.init() {
+			return false
+		}
+		if p.records[0].index != p.records[0].node.NumPointers() {
+			return true
+		}
+		// the key is greater than every key in this leaf but the next leaf
+		// may still contain larger keys, so roll over into it.
+		p.records[0].index--
 	}
 	return p.incr(0, 1)
 }
@@ -158,10 +178,14 @@ func (t *BPTree) Contains(key pointer.ReferencedValue) (bool, error) {
 }
 
 func (t *BPTree) readNode(ptr pointer.MemoryPointer) (*BPTreeNode, error) {
+	if node := t.Cache.get(ptr.Offset, t.Width); node != nil {
+		node.Data, node.DataReader, node.DataParser = t.Data, t.DataReader, t.DataParser
+		return node, nil
+	}
 	if _, err := t.PageFile.Seek(int64(ptr.Offset), io.SeekStart); err != nil {
 		return nil, err
 	}
-	node := &BPTreeNode{Data: t.Data, DataParser: t.DataParser, Width: t.Width}
+	node := t.newNode()
 	buf := make([]byte, t.PageFile.PageSize())
 	if _, err := t.PageFile.Read(buf); err != nil {
 		return nil, err
@@ -169,20 +193,39 @@ func (t *BPTree) readNode(ptr pointer.MemoryPointer) (*BPTreeNode, error) {
 	if err := node.UnmarshalBinary(buf); err != nil {
 		return nil, err
 	}
+	t.Cache.put(ptr.Offset, node)
 	return node, nil
 }
 
-func (t *BPTree) first() (pointer.ReferencedValue, error) {
-	rootNode, _, err := t.root()
-
+// newNodePage writes n to a new page and returns its offset.
+func (t *BPTree) newNodePage(n *BPTreeNode) (int64, []byte, error) {
+	buf, err := n.MarshalBinary()
 	if err != nil {
-		return pointer.ReferencedValue{}, err
+		return 0, nil, err
+	}
+	offset, err := t.PageFile.NewPage(buf)
+	if err != nil {
+		return 0, nil, err
 	}
+	t.Cache.put(uint64(offset), n)
+	return offset, buf, nil
+}
+
+// freeNode frees the page of the node at offset.
+func (t *BPTree) freeNode(offset uint64) error {
+	t.Cache.remove(offset)
+	return t.PageFile.FreePage(int64(offset))
+}
 
-	currNode, err := t.readNode(rootNode.Pointer(0))
+// first returns the smallest key in the tree or io.EOF if the tree is empty.
+func (t *BPTree) first() (pointer.ReferencedValue, error) {
+	currNode, _, err := t.root()
 	if err != nil {
 		return pointer.ReferencedValue{}, err
 	}
+	if currNode == nil {
+		return pointer.ReferencedValue{}, io.EOF
+	}
 
 	for !currNode.Leaf() {
 		childPointer := currNode.Pointer(0)
@@ -196,16 +239,14 @@ func (t *BPTree) first() (pointer.ReferencedValue, error) {
 	return currNode.Keys[0], nil
 }
 
+// last returns the largest key in the tree or io.EOF if the tree is empty.
 func (t *BPTree) last() (pointer.ReferencedValue, error) {
-	rootNode, _, err := t.root()
-
+	currNode, _, err := t.root()
 	if err != nil {
 		return pointer.ReferencedValue{}, err
 	}
-
-	currNode, err := t.readNode(rootNode.Pointer(rootNode.NumPointers() - 1))
-	if err != nil {
-		return pointer.ReferencedValue{}, err
+	if currNode == nil {
+		return pointer.ReferencedValue{}, io.EOF
 	}
 
 	for !currNode.Leaf() {
@@ -249,13 +290,30 @@ func (t *BPTree) traverse(key pointer.ReferencedValue, node *BPTreeNode, ptr poi
 	return append(path, TraversalRecord{node: node, index: index, ptr: ptr}), nil
 }
 
-func (t *BPTree) Insert(key pointer.ReferencedValue, value pointer.MemoryPointer) error {
-
-	if t.Width != uint16(0) {
-		if uint16(len(key.Value)) != t.Width-1 {
-			return fmt.Errorf("key |%v| to insert does not match with BPTree width. Expected width: %v, got: %v", string(key.Value), t.Width-1, len(key.Value))
+// ErrKeyTooLarge is returned when inserting a key that is larger than
+// MaxStoredKeySize into a tree with StoredWidth.
+var ErrKeyTooLarge = errors.New("key too large")
+
+// checkKey returns an error if key can't be inserted into the tree.
+func (t *BPTree) checkKey(key []byte) error {
+	switch t.Width {
+	case 0:
+	case StoredWidth:
+		if len(key) > MaxStoredKeySize(t.PageFile.PageSize()) {
+			return fmt.Errorf("%w: %d bytes, the limit is %d", ErrKeyTooLarge, len(key), MaxStoredKeySize(t.PageFile.PageSize()))
+		}
+	default:
+		if uint16(len(key)) != t.Width-1 {
+			return fmt.Errorf("key |%v| to insert does not match with BPTree width. Expected width: %v, got: %v", string(key), t.Width-1, len(key))
 		}
 	}
+	return nil
+}
+
+func (t *BPTree) Insert(key pointer.ReferencedValue, value pointer.MemoryPointer) error {
+	if err := t.checkKey(key.Value); err != nil {
+		return err
+	}
 
 	root, rootOffset, err := t.root()
 	if err != nil {
@@ -263,14 +321,10 @@ func (t *BPTree) Insert(key pointer.ReferencedValue, value pointer.MemoryPointer
 	}
 	if root == nil {
 		// special case, create the root as the first node
-		node := &BPTreeNode{Data: t.Data, DataParser: t.DataParser, Width: t.Width}
+		node := t.newNode()
 		node.Keys = []pointer.ReferencedValue{key}
 		node.LeafPointers = []pointer.MemoryPointer{value}
-		buf, err := node.MarshalBinary()
-		if err != nil {
-			return err
-		}
-		offset, err := t.PageFile.NewPage(buf)
+		offset, buf, err := t.newNodePage(node)
 		if err != nil {
 			return err
 		}
@@ -311,7 +365,7 @@ func (t *BPTree) Insert(key pointer.ReferencedValue, value pointer.MemoryPointer
 			midKey := n.Keys[mid]
 
 			// n is the left node, m the right node
-			m := &BPTreeNode{Data: t.Data, DataParser: t.DataParser, Width: t.Width}
+			m := t.newNode()
 			if n.Leaf() {
 				m.LeafPointers = n.LeafPointers[mid:]
 				m.Keys = n.Keys[mid:]
@@ -320,11 +374,7 @@ func (t *BPTree) Insert(key pointer.ReferencedValue, value pointer.MemoryPointer
 				m.InternalPointers = n.InternalPointers[mid+1:]
 				m.Keys = n.Keys[mid+1:]
 			}
-			mbuf, err := m.MarshalBinary()
-			if err != nil {
-				return err
-			}
-			moffset, err := t.PageFile.NewPage(mbuf)
+			moffset, _, err := t.newNodePage(m)
 			if err != nil {
 				return err
 			}
@@ -338,10 +388,7 @@ func (t *BPTree) Insert(key pointer.ReferencedValue, value pointer.MemoryPointer
 			}
 
 			noffset := tr.ptr.Offset
-			if _, err := t.PageFile.Seek(int64(noffset), io.SeekStart); err != nil {
-				return err
-			}
-			if _, err := n.WriteTo(t.PageFile); err != nil {
+			if err := t.writeNode(n, noffset); err != nil {
 				return err
 			}
 
@@ -361,17 +408,13 @@ func (t *BPTree) Insert(key pointer.ReferencedValue, value pointer.MemoryPointer
 				// the parent will be written to disk in the next iteration
 			} else {
 				// the root split, so create a new root
-				p := &BPTreeNode{Data: t.Data, DataParser: t.DataParser, Width: t.Width}
+				p := t.newNode()
 				p.Keys = []pointer.ReferencedValue{midKey}
 				p.InternalPointers = []uint64{
 					noffset, uint64(moffset),
 				}
 
-				pbuf, err := p.MarshalBinary()
-				if err != nil {
-					return err
-				}
-				poffset, err := t.PageFile.NewPage(pbuf)
+				poffset, pbuf, err := t.newNodePage(p)
 				if err != nil {
 					return err
 				}
@@ -382,10 +425,7 @@ func (t *BPTree) Insert(key pointer.ReferencedValue, value pointer.MemoryPointer
 			}
 		} else {
 			// write this node to disk and update the parent
-			if _, err := t.PageFile.Seek(int64(tr.ptr.Offset), io.SeekStart); err != nil {
-				return err
-			}
-			if _, err := tr.node.WriteTo(t.PageFile); err != nil {
+			if err := t.writeNode(tr.node, tr.ptr.Offset); err != nil {
 				return err
 			}
 			// no new nodes were produced, so we can return here
@@ -395,94 +435,359 @@ func (t *BPTree) Insert(key pointer.ReferencedValue, value pointer.MemoryPointer
 	panic("unreachable")
 }
 
+// ErrKeyNotFound is returned by Delete when the key does not exist in the tree.
+var ErrKeyNotFound = errors.New("key not found")
+
+// underfull reports whether n should be merged with or borrow from a sibling.
+// The threshold is a quarter page rather than the textbook half page because
+// a split produces two half-full nodes and we don't want a single delete
+// immediately after a split to trigger a merge.
+func (t *BPTree) underfull(n *BPTreeNode) bool {
+	return len(n.Keys) == 0 || int(n.Size()) < t.PageFile.PageSize()/4
+}
+
+func (t *BPTree) writeNode(n *BPTreeNode, offset uint64) error {
+	// if the write fails, the page may have been partially written.
+	t.Cache.remove(offset)
+	if _, err := t.PageFile.Seek(int64(offset), io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := n.WriteTo(t.PageFile); err != nil {
+		return err
+	}
+	t.Cache.put(offset, n)
+	return nil
+}
+
+// Delete removes the key from the tree. The key must match exactly,
+// including the DataPointer. Underfull nodes are merged with or redistribute
+// keys from a sibling, the root is collapsed when it has a single child, and
+// any pages that are no longer referenced are returned to the page file.
+func (t *BPTree) Delete(key pointer.ReferencedValue) error {
+	root, rootOffset, err := t.root()
+	if err != nil {
+		return fmt.Errorf("read root node: %w", err)
+	}
+	if root == nil {
+		return ErrKeyNotFound
+	}
+
+	path, err := t.traverse(key, root, rootOffset)
+	if err != nil {
+		return err
+	}
+
+	// remove the key from the leaf
+	n := path[0].node
+	j, found := slices.BinarySearchFunc(n.Keys, key, pointer.CompareReferencedValues)
+	if !found {
+		return ErrKeyNotFound
+	}
+	n.Keys = slices.Delete(n.Keys, j, j+1)
+	n.LeafPointers = slices.Delete(n.LeafPointers, j, j+1)
+
+	// traverse up the tree and rebalance if necessary
+	for i := 0; i < len(path); i++ {
+		tr := path[i]
+		n := tr.node
+
+		if i == len(path)-1 {
+			// this is the root, which is allowed to be underfull.
+			switch {
+			case len(n.Keys) > 0:
+				return t.writeNode(n, tr.ptr.Offset)
+			case n.NumPointers() == 0:
+				// the last key was removed, so the tree is now empty.
+				if err := t.freeNode(tr.ptr.Offset); err != nil {
+					return err
+				}
+				return t.MetaPage.SetRoot(pointer.MemoryPointer{})
+			default:
+				// the root has a single child, so the child becomes the root.
+				childPointer := n.Pointer(0)
+				child, err := t.readNode(childPointer)
+				if err != nil {
+					return err
+				}
+				if err := t.freeNode(tr.ptr.Offset); err != nil {
+					return err
+				}
+				return t.MetaPage.SetRoot(pointer.MemoryPointer{Offset: childPointer.Offset, Length: uint32(child.Size())})
+			}
+		}
+
+		if !t.underfull(n) {
+			return t.writeNode(n, tr.ptr.Offset)
+		}
+
+		// pick a sibling, preferring the left one. left and right are adjacent
+		// children of the parent separated by p.Keys[sep].
+		p := path[i+1].node
+		sep := path[i+1].index - 1
+		if sep < 0 {
+			sep = 0
+		}
+		leftOffset, rightOffset := p.InternalPointers[sep], p.InternalPointers[sep+1]
+		var left, right *BPTreeNode
+		if leftOffset == tr.ptr.Offset {
+			left = n
+			if right, err = t.readNode(pointer.MemoryPointer{Offset: rightOffset}); err != nil {
+				return err
+			}
+		} else {
+			right = n
+			if left, err = t.readNode(pointer.MemoryPointer{Offset: leftOffset}); err != nil {
+				return err
+			}
+		}
+
+		// merge the two nodes into one. internal nodes pull the separator
+		// down from the parent, leaves already contain it. note that n may be
+		// an empty leaf, so the leafness is derived from the depth instead.
+		leaf := i == 0
+		m := t.newNode()
+		if leaf {
+			m.Keys = append(append(m.Keys, left.Keys...), right.Keys...)
+			m.LeafPointers = append(append(m.LeafPointers, left.LeafPointers...), right.LeafPointers...)
+		} else {
+			m.Keys = append(append(append(m.Keys, left.Keys...), p.Keys[sep]), right.Keys...)
+			m.InternalPointers = append(append(m.InternalPointers, left.InternalPointers...), right.InternalPointers...)
+		}
+
+		if int(m.Size()) <= t.PageFile.PageSize() {
+			// the merged node fits in one page, so keep it in the left page,
+			// free the right page and remove the separator from the parent.
+			if err := t.writeNode(m, leftOffset); err != nil {
+				return err
+			}
+			if err := t.freeNode(rightOffset); err != nil {
+				return err
+			}
+			p.Keys = slices.Delete(p.Keys, sep, sep+1)
+			p.InternalPointers = slices.Delete(p.InternalPointers, sep+1, sep+2)
+			// the parent will be written to disk in the next iteration
+			continue
+		}
+
+		// otherwise redistribute the keys evenly between the two nodes and
+		// replace the separator in the parent.
+		mid := len(m.Keys) / 2
+		left = t.newNode()
+		right = t.newNode()
+		if leaf {
+			left.Keys, right.Keys = m.Keys[:mid], m.Keys[mid:]
+			left.LeafPointers, right.LeafPointers = m.LeafPointers[:mid], m.LeafPointers[mid:]
+		} else {
+			left.Keys, right.Keys = m.Keys[:mid], m.Keys[mid+1:]
+			left.InternalPointers, right.InternalPointers = m.InternalPointers[:mid+1], m.InternalPointers[mid+1:]
+		}
+		if err := t.writeNode(left, leftOffset); err != nil {
+			return err
+		}
+		if err := t.writeNode(right, rightOffset); err != nil {
+			return err
+		}
+		p.Keys[sep] = m.Keys[mid]
+		return t.writeNode(p, path[i+1].ptr.Offset)
+	}
+	panic("unreachable")
+}
+
 type Entry struct {
-	Key   []byte
+	Key   pointer.ReferencedValue
 	Value pointer.MemoryPointer
 }
 
+// IsEmpty returns true if the tree does not contain any keys.
+func (t *BPTree) IsEmpty() (bool, error) {
+	root, _, err := t.root()
+	if err != nil {
+		return false, err
+	}
+	return root == nil, nil
+}
+
+// bulkChild is a node built during a bulk insert that still needs to be
+// attached to a parent.
+type bulkChild struct {
+	key  pointer.ReferencedValue
+	node *BPTreeNode
+	// children are the children of an internal node.
+	children []*bulkChild
+	// offset is an upper bound on the offset of the node until its page is
+	// allocated, which sizes the pointer to it in its parent.
+	offset uint64
+	size   int64
+}
+
 // BulkInsert allows for the initial bulk loading of the tree. It is more efficient
 // than inserting one key at a time because it does not traverse the tree for each
-// key. Note that tree must be empty when calling this function.
-// func (t *Btree) BulkInsert(entries []Entry) error {
-// 	// verify that the tree is empty
-// 	if r, _, err := t.root(); err != nil || r != nil {
-// 		return fmt.Errorf("tree is not empty, err: %w", err)
-// 	}
-
-// 	// sort the data entries by key
-// 	slices.SortFunc(entries, func(x, y Entry) int {
-// 		return bytes.Compare(x.Key, y.Key)
-// 	})
-
-// 	parents := []struct {
-// 		key     []byte
-// 		pointer uint64
-// 	}{}
-
-// 	offset, err := t.tree.Seek(0, io.SeekEnd)
-// 	if err != nil {
-// 		return err
-// 	}
-
-// 	// break into maxPageSize chunks
-// 	for i := 0; i < len(entries); i += t.maxPageSize {
-// 		chunk := entries[i:min(i+t.maxPageSize, len(entries))]
-
-// 		// write the chunk to disk
-// 		node := &BPTreeNode{}
-// 		node.Keys = make([][]byte, len(chunk))
-// 		node.Pointers = make([]MemoryPointer, len(chunk))
-// 		for i, e := range chunk {
-// 			node.Keys[i] = e.Key
-// 			node.Pointers[i] = e.Value
-// 		}
-// 		n, err := node.WriteTo(t.tree)
-// 		if err != nil {
-// 			return err
-// 		}
-// 		parents = append(parents, struct {
-// 			key     []byte
-// 			pointer uint64
-// 		}{key: chunk[0].Key, pointer: uint64(offset)})
-// 		offset += n
-// 	}
-
-// 	for {
-// 		nextParents := []struct {
-// 			key     []byte
-// 			pointer uint64
-// 		}{}
-// 		// break into maxPageSize chunks
-// 		for i := 0; i < len(parents); i += t.maxPageSize {
-// 			chunk := parents[i:min(i+t.maxPageSize, len(parents))]
-
-// 			// write the chunk to disk
-// 			node := &BPTreeNode{}
-// 			node.Keys = make([][]byte, len(chunk)-1)
-// 			node.Pointers = make([]MemoryPointer, len(chunk))
-// 			for j, e := range chunk {
-// 				if j > 0 {
-// 					node.Keys[j-1] = e.key
-// 				}
-// 				node.Pointers[j] = e.pointer
-// 			}
-// 			n, err := node.WriteTo(t.tree)
-// 			if err != nil {
-// 				return err
-// 			}
-// 			nextParents = append(nextParents, struct {
-// 				key     []byte
-// 				pointer uint64
-// 			}{key: chunk[0].key, pointer: uint64(offset)})
-// 			offset += n
-// 		}
-// 		parents = nextParents
-// 		if len(parents) == 1 {
-// 			// this is the root
-// 			return t.meta.SetRoot(parents[0].pointer)
-// 		}
-// 	}
-// }
+// key. Instead, the entries are sorted and the tree is built bottom-up with each
+// node packed up to fillFactor of a page. Note that tree must be empty when calling
+// this function.
+//
+// The pages of the tree are laid out breadth-first, so the root and the upper
+// levels, which every lookup reads, are next to each other at the front.
+func (t *BPTree) BulkInsert(entries []Entry, fillFactor float64) error {
+	if fillFactor <= 0 || fillFactor > 1 {
+		return fmt.Errorf("fill factor must be in (0, 1], got %v", fillFactor)
+	}
+	// verify that the tree is empty
+	if empty, err := t.IsEmpty(); err != nil {
+		return fmt.Errorf("read root node: %w", err)
+	} else if !empty {
+		return fmt.Errorf("tree is not empty")
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	for _, e := range entries {
+		if err := t.checkKey(e.Key.Value); err != nil {
+			return err
+		}
+	}
+
+	// sort the data entries by key
+	slices.SortFunc(entries, func(x, y Entry) int {
+		return pointer.CompareReferencedValues(x.Key, y.Key)
+	})
+	for i := 1; i < len(entries); i++ {
+		if pointer.CompareReferencedValues(entries[i-1].Key, entries[i].Key) == 0 {
+			return fmt.Errorf("key already exists. Data pointer: %v", entries[i].Key.DataPointer)
+		}
+	}
+
+	capacity := int64(float64(t.PageFile.PageSize()) * fillFactor)
+	// there are fewer nodes than twice the entries and pages are smaller than
+	// twice the usable page size, so no page is allocated past bound.
+	bound := uint64(t.PageFile.LastPage()+1+2*int64(len(entries))) * uint64(2*t.PageFile.PageSize())
+
+	// pack the leaves
+	var level []*bulkChild
+	leaf := t.newNode()
+	size := int64(4)
+	for _, e := range entries {
+		n := int64(leaf.keySize(e.Key) + encoding.SizeVarint(e.Value.Offset) + encoding.SizeVarint(uint64(e.Value.Length)))
+		if len(leaf.Keys) > 0 && size+n > capacity {
+			level = append(level, &bulkChild{key: leaf.Keys[0], node: leaf, offset: bound})
+			leaf = t.newNode()
+			size = 4
+		}
+		leaf.Keys = append(leaf.Keys, e.Key)
+		leaf.LeafPointers = append(leaf.LeafPointers, e.Value)
+		size += n
+	}
+	level = append(level, &bulkChild{key: leaf.Keys[0], node: leaf, offset: bound})
+	levels := [][]*bulkChild{level}
+
+	// then pack each level of internal nodes until a single root remains
+	for len(level) > 1 {
+		var parents []*bulkChild
+		for _, group := range t.groupBulkChildren(level, capacity) {
+			node := t.newNode()
+			for _, c := range group[1:] {
+				node.Keys = append(node.Keys, c.key)
+			}
+			parents = append(parents, &bulkChild{key: group[0].key, node: node, children: group, offset: bound})
+		}
+		level = parents
+		levels = append(levels, level)
+	}
+
+	// allocate the pages of the internal nodes from the root down, then write
+	// the leaves, which don't point to other nodes, to the pages after them.
+	for l := len(levels) - 1; l > 0; l-- {
+		for _, c := range levels[l] {
+			offset, err := t.PageFile.NewPage(nil)
+			if err != nil {
+				return err
+			}
+			t.Cache.remove(uint64(offset))
+			c.offset = uint64(offset)
+		}
+	}
+	for _, c := range levels[0] {
+		if err := t.writeBulkNode(c); err != nil {
+			return err
+		}
+	}
+	for _, level := range levels[1:] {
+		for _, c := range level {
+			for _, child := range c.children {
+				c.node.InternalPointers = append(c.node.InternalPointers, child.offset)
+			}
+			if err := t.writeBulkNode(c); err != nil {
+				return err
+			}
+		}
+	}
+
+	root := levels[len(levels)-1][0]
+	return t.MetaPage.SetRoot(pointer.MemoryPointer{Offset: root.offset, Length: uint32(root.size)})
+}
+
+// groupBulkChildren splits children into groups that each fit in an internal
+// node of at most capacity bytes. Every group has at least two children.
+func (t *BPTree) groupBulkChildren(children []*bulkChild, capacity int64) [][]*bulkChild {
+	n := &BPTreeNode{Width: t.Width}
+	var groups [][]*bulkChild
+	var group []*bulkChild
+	size := int64(4)
+	for _, c := range children {
+		m := int64(encoding.SizeVarint(c.offset))
+		if len(group) > 0 {
+			m += int64(n.keySize(c.key))
+		}
+		if len(group) > 1 && size+m > capacity {
+			groups = append(groups, group)
+			group = nil
+			size = 4
+			m = int64(encoding.SizeVarint(c.offset))
+		}
+		group = append(group, c)
+		size += m
+	}
+	if len(group) == 1 && len(groups) > 0 {
+		// a single child can't form an internal node, so either borrow a
+		// child from the previous group or merge into it.
+		prev := groups[len(groups)-1]
+		if len(prev) > 2 {
+			groups[len(groups)-1] = prev[:len(prev)-1]
+			group = append([]*bulkChild{prev[len(prev)-1]}, group...)
+		} else {
+			groups[len(groups)-1] = append(prev, group...)
+			return groups
+		}
+	}
+	return append(groups, group)
+}
+
+// writeBulkNode writes the node of c to its page, allocating the page if it
+// hasn't been allocated yet.
+func (t *BPTree) writeBulkNode(c *bulkChild) error {
+	buf, err := c.node.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	c.size = int64(len(buf))
+	if c.children == nil {
+		offset, err := t.PageFile.NewPage(buf)
+		if err != nil {
+			return err
+		}
+		// bulk loaded nodes aren't cached, most of them aren't read again
+		// soon.
+		c.offset = uint64(offset)
+		t.Cache.remove(c.offset)
+		return nil
+	}
+	if _, err := t.PageFile.Seek(int64(c.offset), io.SeekStart); err != nil {
+		return err
+	}
+	_, err = t.PageFile.Write(buf)
+	return err
+}
 
 func (t *BPTree) recursiveString(n *BPTreeNode, indent int) string {
 	// print the node itself
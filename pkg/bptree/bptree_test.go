@@ -3,6 +3,7 @@ package bptree
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -347,24 +348,6 @@ func TestBPTree_RandomTests(t *testing.T) {
 			}
 		}
 	})
-
-	// t.Run("bulk insert", func(t *testing.T) {
-	// 	b := buftest.NewSeekableBuffer()
-	// 	tree :=NewBPTree(b, 2)
-	// 	if err != nil {
-	// 		t.Fatal(err)
-	// 	}
-	// 	if err := tree.BulkInsert([]Entry{
-	// 		{Key: []byte{0x05}, Value: 5},
-	// 		{Key: []byte{0x15}, Value: 15},
-	// 		{Key: []byte{0x25}, Value: 25},
-	// 		{Key: []byte{0x35}, Value: 35},
-	// 		{Key: []byte{0x45}, Value: 45},
-	// 	}); err != nil {
-	// 		t.Fatal(err)
-	// 	}
-	// 	fmt.Printf(tree.String())
-	// })
 }
 
 func TestBPTree_Iteration(t *testing.T) {
@@ -638,6 +621,53 @@ func TestBPTree_IncorrectWidth(t *testing.T) {
 	})
 }
 
+func TestBPTree_StoredWidth(t *testing.T) {
+	b := buftest.NewSeekableBuffer()
+	p, err := pagefile.NewPageFile(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := &BPTree{PageFile: p, MetaPage: newTestMetaPage(t, p), Width: StoredWidth}
+
+	// the keys aren't in a data file, so they can only be read from the nodes.
+	n := 2000
+	for _, i := range rand.Perm(n) {
+		key := []byte(fmt.Sprintf("%0*d", 1+i%40, i))
+		if err := tree.Insert(pointer.ReferencedValue{Value: key, DataPointer: pointer.MemoryPointer{Offset: uint64(i)}}, pointer.MemoryPointer{Offset: uint64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	iter, err := tree.Iter(pointer.ReferencedValue{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last []byte
+	count := 0
+	for iter.Next() {
+		k := iter.Key()
+		if want := fmt.Sprintf("%0*d", 1+int(k.DataPointer.Offset)%40, k.DataPointer.Offset); string(k.Value) != want {
+			t.Fatalf("expected key %q, got %q", want, k.Value)
+		}
+		if last != nil && bytes.Compare(last, k.Value) > 0 {
+			t.Fatalf("keys out of order: %q before %q", last, k.Value)
+		}
+		last = k.Value
+		count++
+	}
+	if err := iter.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if count != n {
+		t.Fatalf("expected %d keys, got %d", n, count)
+	}
+
+	large := make([]byte, MaxStoredKeySize(p.PageSize())+1)
+	if err := tree.Insert(pointer.ReferencedValue{Value: large}, pointer.MemoryPointer{}); !errors.Is(err, ErrKeyTooLarge) {
+		t.Fatalf("expected ErrKeyTooLarge, got %v", err)
+	}
+}
+
 func TestBPTree_Iteration_Overcount(t *testing.T) {
 	b := buftest.NewSeekableBuffer()
 	p, err := pagefile.NewPageFile(b)
@@ -766,3 +796,423 @@ func TestBPTree_Iteration_StartsAfterTree(t *testing.T) {
 		}
 	})
 }
+
+func TestBPTree_Iteration_StartsBetweenLeaves(t *testing.T) {
+	b := buftest.NewSeekableBuffer()
+	p, err := pagefile.NewPageFile(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree := &BPTree{PageFile: p, MetaPage: newTestMetaPage(t, p), Width: uint16(9)}
+	for i := 0; i < 2000; i++ {
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(i*2))
+		if err := tree.Insert(pointer.ReferencedValue{Value: buf}, pointer.MemoryPointer{Offset: uint64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// every odd key is missing, so iteration must start at the next even key
+	// even if it lives in the next leaf.
+	for i := 1; i < 3998; i += 2 {
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(i))
+		iter, err := tree.Iter(pointer.ReferencedValue{Value: buf})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !iter.Next() {
+			t.Fatalf("expected to find a key after %d", i)
+		}
+		if got := binary.BigEndian.Uint64(iter.Key().Value); got != uint64(i+1) {
+			t.Fatalf("expected key %d, got %d", i+1, got)
+		}
+	}
+}
+
+func TestBPTree_Delete(t *testing.T) {
+	// use wide keys so that the tree is several levels deep with few keys.
+	newKey := func(i int) pointer.ReferencedValue {
+		buf := make([]byte, 200)
+		binary.BigEndian.PutUint64(buf, uint64(i))
+		return pointer.ReferencedValue{Value: buf}
+	}
+
+	t.Run("delete from empty tree", func(t *testing.T) {
+		b := buftest.NewSeekableBuffer()
+		p, err := pagefile.NewPageFile(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree := &BPTree{PageFile: p, MetaPage: newTestMetaPage(t, p), Width: uint16(201)}
+		if err := tree.Delete(newKey(1)); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("expected ErrKeyNotFound, got %v", err)
+		}
+	})
+
+	t.Run("delete missing key", func(t *testing.T) {
+		b := buftest.NewSeekableBuffer()
+		p, err := pagefile.NewPageFile(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree := &BPTree{PageFile: p, MetaPage: newTestMetaPage(t, p), Width: uint16(201)}
+		if err := tree.Insert(newKey(1), pointer.MemoryPointer{Offset: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if err := tree.Delete(newKey(2)); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("expected ErrKeyNotFound, got %v", err)
+		}
+	})
+
+	t.Run("random deletion test", func(t *testing.T) {
+		b := buftest.NewSeekableBuffer()
+		p, err := pagefile.NewPageFile(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree := &BPTree{PageFile: p, MetaPage: newTestMetaPage(t, p), Width: uint16(201)}
+		const n = 2000
+		for i := 0; i < n; i++ {
+			if err := tree.Insert(newKey(i), pointer.MemoryPointer{Offset: uint64(i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		pages := p.PageCount()
+
+		r := rand.New(rand.NewSource(12345))
+		order := r.Perm(n)
+		deleted := make(map[int]bool)
+		for _, i := range order[:n/2] {
+			if err := tree.Delete(newKey(i)); err != nil {
+				t.Fatalf("failed to delete key %d: %v", i, err)
+			}
+			deleted[i] = true
+		}
+
+		// the remaining keys must still be found in order.
+		iter, err := tree.Iter(pointer.ReferencedValue{Value: []byte{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		prev := -1
+		count := 0
+		for iter.Next() {
+			i := int(binary.BigEndian.Uint64(iter.Key().Value))
+			if deleted[i] {
+				t.Fatalf("found deleted key %d", i)
+			}
+			if i <= prev {
+				t.Fatalf("expected increasing keys, got %d after %d", i, prev)
+			}
+			if iter.Pointer().Offset != uint64(i) {
+				t.Fatalf("expected value %d, got %d", i, iter.Pointer().Offset)
+			}
+			prev = i
+			count++
+		}
+		if err := iter.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if count != n/2 {
+			t.Fatalf("expected %d keys, got %d", n/2, count)
+		}
+		for i := range deleted {
+			ok, err := tree.Contains(newKey(i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok {
+				t.Fatalf("expected key %d to be deleted", i)
+			}
+		}
+
+		// deleting everything else collapses the tree.
+		for _, i := range order[n/2:] {
+			if err := tree.Delete(newKey(i)); err != nil {
+				t.Fatalf("failed to delete key %d: %v", i, err)
+			}
+		}
+		root, _, err := tree.root()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if root != nil {
+			t.Fatalf("expected empty tree, got %v", tree)
+		}
+
+		// the freed pages are reused when the tree grows again.
+		for i := 0; i < n; i++ {
+			if err := tree.Insert(newKey(i), pointer.MemoryPointer{Offset: uint64(i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if p.PageCount() != pages {
+			t.Fatalf("expected freed pages to be reused, page count went from %d to %d", pages, p.PageCount())
+		}
+	})
+
+	t.Run("delete duplicate values", func(t *testing.T) {
+		b := buftest.NewSeekableBuffer()
+		p, err := pagefile.NewPageFile(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree := &BPTree{PageFile: p, MetaPage: newTestMetaPage(t, p), Data: make([]byte, 4096+8), DataParser: &StubDataParser{}}
+		for i := 0; i < 4096; i++ {
+			if err := tree.Insert(pointer.ReferencedValue{
+				Value:       []byte{1, 2, 3, 4, 5, 6, 7, 8},
+				DataPointer: pointer.MemoryPointer{Offset: uint64(i), Length: 8},
+			}, pointer.MemoryPointer{Offset: uint64(i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// the DataPointer disambiguates which key is deleted.
+		for i := 0; i < 4096; i += 2 {
+			if err := tree.Delete(pointer.ReferencedValue{
+				Value:       []byte{1, 2, 3, 4, 5, 6, 7, 8},
+				DataPointer: pointer.MemoryPointer{Offset: uint64(i), Length: 8},
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		iter, err := tree.Iter(pointer.ReferencedValue{Value: []byte{1, 2, 3, 4, 5, 6, 7, 8}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		i := 1
+		for ; iter.Next(); i += 2 {
+			if iter.Pointer().Offset != uint64(i) {
+				t.Fatalf("expected value %d, got %d", i, iter.Pointer().Offset)
+			}
+		}
+		if err := iter.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if i != 4097 {
+			t.Fatalf("expected to find 2048 keys, got %d", (i-1)/2)
+		}
+	})
+}
+
+func TestBPTree_BulkInsert(t *testing.T) {
+	t.Run("bulk insert", func(t *testing.T) {
+		b := buftest.NewSeekableBuffer()
+		p, err := pagefile.NewPageFile(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree := &BPTree{PageFile: p, MetaPage: newTestMetaPage(t, p), Width: uint16(2)}
+		if err := tree.BulkInsert([]Entry{
+			{Key: pointer.ReferencedValue{Value: []byte{0x25}}, Value: pointer.MemoryPointer{Offset: 0x25}},
+			{Key: pointer.ReferencedValue{Value: []byte{0x05}}, Value: pointer.MemoryPointer{Offset: 0x05}},
+			{Key: pointer.ReferencedValue{Value: []byte{0x45}}, Value: pointer.MemoryPointer{Offset: 0x45}},
+			{Key: pointer.ReferencedValue{Value: []byte{0x15}}, Value: pointer.MemoryPointer{Offset: 0x15}},
+			{Key: pointer.ReferencedValue{Value: []byte{0x35}}, Value: pointer.MemoryPointer{Offset: 0x35}},
+		}, 1); err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range []byte{0x05, 0x15, 0x25, 0x35, 0x45} {
+			k, mp, err := tree.Find(pointer.ReferencedValue{Value: []byte{v}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(k.Value, []byte{v}) {
+				t.Fatalf("expected to find key %x", v)
+			}
+			if mp.Offset != uint64(v) {
+				t.Fatalf("expected value %d, got %d", v, mp.Offset)
+			}
+		}
+	})
+
+	t.Run("rejects non-empty tree", func(t *testing.T) {
+		b := buftest.NewSeekableBuffer()
+		p, err := pagefile.NewPageFile(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree := &BPTree{PageFile: p, MetaPage: newTestMetaPage(t, p), Width: uint16(2)}
+		if err := tree.Insert(pointer.ReferencedValue{Value: []byte{0x05}}, pointer.MemoryPointer{Offset: 5}); err != nil {
+			t.Fatal(err)
+		}
+		if err := tree.BulkInsert([]Entry{{Key: pointer.ReferencedValue{Value: []byte{0x15}}}}, 1); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("rejects duplicate keys", func(t *testing.T) {
+		b := buftest.NewSeekableBuffer()
+		p, err := pagefile.NewPageFile(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree := &BPTree{PageFile: p, MetaPage: newTestMetaPage(t, p), Width: uint16(2)}
+		if err := tree.BulkInsert([]Entry{
+			{Key: pointer.ReferencedValue{Value: []byte{0x15}}},
+			{Key: pointer.ReferencedValue{Value: []byte{0x15}}},
+		}, 1); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	for _, fillFactor := range []float64{0.5, 0.9, 1} {
+		t.Run(fmt.Sprintf("random bulk insert with fill factor %v", fillFactor), func(t *testing.T) {
+			b := buftest.NewSeekableBuffer()
+			p, err := pagefile.NewPageFile(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree := &BPTree{PageFile: p, MetaPage: newTestMetaPage(t, p), Width: uint16(9)}
+			r := rand.New(rand.NewSource(12345))
+			entries := make([]Entry, 65536)
+			for i := range entries {
+				buf := make([]byte, 8)
+				if _, err := r.Read(buf); err != nil {
+					t.Fatal(err)
+				}
+				entries[i] = Entry{Key: pointer.ReferencedValue{Value: buf}, Value: pointer.MemoryPointer{Offset: uint64(i)}}
+			}
+			if err := tree.BulkInsert(entries, fillFactor); err != nil {
+				t.Fatal(err)
+			}
+
+			s := rand.New(rand.NewSource(12345))
+			for i := 0; i < 65536; i++ {
+				buf := make([]byte, 8)
+				if _, err := s.Read(buf); err != nil {
+					t.Fatal(err)
+				}
+				k, v, err := tree.Find(pointer.ReferencedValue{Value: buf})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(k.Value, buf) {
+					t.Fatalf("expected to find key %d", i)
+				}
+				if v.Offset != uint64(i) {
+					t.Fatalf("expected value %d, got %d", i, v)
+				}
+			}
+
+			// the tree must remain usable for regular inserts.
+			for i := 0; i < 1024; i++ {
+				buf := make([]byte, 8)
+				if _, err := s.Read(buf); err != nil {
+					t.Fatal(err)
+				}
+				if err := tree.Insert(pointer.ReferencedValue{Value: buf}, pointer.MemoryPointer{Offset: uint64(65536 + i)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			iter, err := tree.Iter(pointer.ReferencedValue{Value: []byte{}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			count := 0
+			var prev []byte
+			for ; iter.Next(); count++ {
+				if prev != nil && bytes.Compare(prev, iter.Key().Value) > 0 {
+					t.Fatalf("expected increasing keys")
+				}
+				prev = iter.Key().Value
+			}
+			if err := iter.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if count != 65536+1024 {
+				t.Fatalf("expected %d keys, got %d", 65536+1024, count)
+			}
+		})
+	}
+
+	t.Run("lays out the tree breadth-first", func(t *testing.T) {
+		b := buftest.NewSeekableBuffer()
+		p, err := pagefile.NewPageFile(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree := &BPTree{PageFile: p, MetaPage: newTestMetaPage(t, p), Width: uint16(9)}
+		entries := make([]Entry, 65536)
+		for i := range entries {
+			entries[i] = Entry{Key: pointer.ReferencedValue{Value: binary.BigEndian.AppendUint64(nil, uint64(i))}, Value: pointer.MemoryPointer{Offset: uint64(i)}}
+		}
+		if err := tree.BulkInsert(entries, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		root, err := tree.MetaPage.Root()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the nodes in breadth-first order are on consecutive pages.
+		queue := []pointer.MemoryPointer{root}
+		for j := 0; j < len(queue); j++ {
+			if want := root.Offset + uint64(j*4096); queue[j].Offset != want {
+				t.Fatalf("got node %d at offset %d, want %d", j, queue[j].Offset, want)
+			}
+			node, err := tree.readNode(queue[j])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !node.Leaf() {
+				for i := range node.InternalPointers {
+					queue = append(queue, node.Pointer(i))
+				}
+			}
+		}
+		if len(queue) < 3 {
+			t.Fatalf("got %d nodes", len(queue))
+		}
+	})
+}
+
+type identityDataParser struct{}
+
+func (identityDataParser) Parse(value []byte) []byte {
+	return value
+}
+
+func TestBPTree_DataReader(t *testing.T) {
+	b := buftest.NewSeekableBuffer()
+	p, err := pagefile.NewPageFile(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the keys are only available through the reader.
+	var data []byte
+	var keys []pointer.ReferencedValue
+	r := rand.New(rand.NewSource(12345))
+	for i := 0; i < 4096; i++ {
+		word := []byte(fmt.Sprintf("key %d", r.Intn(1000)))
+		keys = append(keys, pointer.ReferencedValue{
+			DataPointer: pointer.MemoryPointer{Offset: uint64(len(data)), Length: uint32(len(word))},
+			Value:       word,
+		})
+		data = append(data, word...)
+	}
+
+	tree := &BPTree{PageFile: p, MetaPage: newTestMetaPage(t, p), DataReader: bytes.NewReader(data), DataParser: identityDataParser{}}
+	for i, k := range keys {
+		if err := tree.Insert(k, pointer.MemoryPointer{Offset: uint64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, k := range keys {
+		found, v, err := tree.Find(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(found.Value, k.Value) || v.Offset != uint64(i) {
+			t.Fatalf("expected to find key %d", i)
+		}
+	}
+
+	// keys outside of the data file can't be resolved.
+	tree.DataReader = bytes.NewReader(data[:len(data)/2])
+	if _, _, err := tree.Find(keys[0]); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,166 @@
+package bptree
+
+import (
+	"container/list"
+	"sync"
+	"unsafe"
+
+	"github.com/kevmo314/appendable/pkg/pointer"
+)
+
+// NodeCache is a least recently used cache of decoded nodes keyed by the
+// offset of their page, so that reading a node doesn't have to read its page
+// and resolve its keys again. A cache can be shared by the trees of a page
+// file, which keep it up to date as they write and free nodes. Pages written
+// by anything else, for example a rolled back transaction, must be removed
+// with Clear.
+//
+// A nil *NodeCache caches nothing.
+type NodeCache struct {
+	mu    sync.Mutex
+	limit int64
+	size  int64
+	lru   *list.List
+	nodes map[uint64]*list.Element
+}
+
+type cachedNode struct {
+	offset uint64
+	node   *BPTreeNode
+	size   int64
+}
+
+// NewNodeCache returns a cache that holds nodes up to about limit bytes.
+func NewNodeCache(limit int64) *NodeCache {
+	return &NodeCache{limit: limit, lru: list.New(), nodes: make(map[uint64]*list.Element)}
+}
+
+// SetLimit changes the number of bytes that the cache holds, evicting nodes
+// if it holds more. A limit of zero disables the cache.
+func (c *NodeCache) SetLimit(limit int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limit = limit
+	c.evict()
+}
+
+// Size returns the number of bytes that the cached nodes take.
+func (c *NodeCache) Size() int64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Clear removes every node from the cache.
+func (c *NodeCache) Clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	clear(c.nodes)
+	c.size = 0
+}
+
+// get returns a copy of the node at offset, or nil if it isn't cached with
+// width.
+func (c *NodeCache) get(offset uint64, width uint16) *BPTreeNode {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.nodes[offset]
+	if !ok {
+		return nil
+	}
+	cn := e.Value.(*cachedNode)
+	if cn.node.Width != width {
+		// the page is read as a node of a different tree.
+		return nil
+	}
+	c.lru.MoveToFront(e)
+	return cn.node.clone()
+}
+
+// put caches a copy of n as the node at offset.
+func (c *NodeCache) put(offset uint64, n *BPTreeNode) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(offset)
+	node := n.clone()
+	// the data file is set by the tree that reads the node.
+	node.Data, node.DataReader, node.DataParser = nil, nil, nil
+	if node.Width != 0 {
+		// stored values point into the page, which shouldn't be kept.
+		size := 0
+		for _, k := range node.Keys {
+			size += len(k.Value)
+		}
+		buf := make([]byte, 0, size)
+		for i := range node.Keys {
+			start := len(buf)
+			buf = append(buf, node.Keys[i].Value...)
+			node.Keys[i].Value = buf[start:len(buf):len(buf)]
+		}
+	}
+	cn := &cachedNode{offset: offset, node: node, size: node.memorySize()}
+	if cn.size > c.limit {
+		return
+	}
+	c.nodes[offset] = c.lru.PushFront(cn)
+	c.size += cn.size
+	c.evict()
+}
+
+// remove removes the node at offset, which is about to be written or freed.
+func (c *NodeCache) remove(offset uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(offset)
+}
+
+func (c *NodeCache) removeLocked(offset uint64) {
+	if e, ok := c.nodes[offset]; ok {
+		c.size -= e.Value.(*cachedNode).size
+		c.lru.Remove(e)
+		delete(c.nodes, offset)
+	}
+}
+
+func (c *NodeCache) evict() {
+	for c.size > c.limit {
+		c.removeLocked(c.lru.Back().Value.(*cachedNode).offset)
+	}
+}
+
+// clone returns a copy of n that can be modified without modifying n. Key
+// values are shared because they are replaced, not modified.
+func (n *BPTreeNode) clone() *BPTreeNode {
+	m := *n
+	m.Keys = append([]pointer.ReferencedValue(nil), n.Keys...)
+	m.LeafPointers = append([]pointer.MemoryPointer(nil), n.LeafPointers...)
+	m.InternalPointers = append([]uint64(nil), n.InternalPointers...)
+	return &m
+}
+
+// memorySize estimates the number of bytes that n takes in memory.
+func (n *BPTreeNode) memorySize() int64 {
+	size := int64(unsafe.Sizeof(*n))
+	for _, k := range n.Keys {
+		size += int64(unsafe.Sizeof(k)) + int64(len(k.Value))
+	}
+	size += int64(len(n.LeafPointers)) * int64(unsafe.Sizeof(pointer.MemoryPointer{}))
+	size += int64(len(n.InternalPointers)) * 8
+	return size
+}
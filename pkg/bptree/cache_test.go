@@ -0,0 +1,143 @@
+package bptree
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"testing"
+
+	"github.com/kevmo314/appendable/pkg/buftest"
+	"github.com/kevmo314/appendable/pkg/pagefile"
+	"github.com/kevmo314/appendable/pkg/pointer"
+)
+
+func TestNodeCache(t *testing.T) {
+	newTree := func(t *testing.T, cache *NodeCache) *BPTree {
+		b := buftest.NewSeekableBuffer()
+		p, err := pagefile.NewPageFile(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &BPTree{PageFile: p, MetaPage: newTestMetaPage(t, p), Width: uint16(9), Cache: cache}
+	}
+	key := func(i int) pointer.ReferencedValue {
+		return pointer.ReferencedValue{Value: binary.BigEndian.AppendUint64(nil, uint64(i))}
+	}
+	// contents returns the keys of the tree in order.
+	contents := func(t *testing.T, tree *BPTree) []uint64 {
+		iter, err := tree.SeekFirst()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []uint64
+		for iter.Next() {
+			keys = append(keys, binary.BigEndian.Uint64(iter.Key().Value))
+		}
+		if err := iter.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return keys
+	}
+
+	t.Run("inserts and deletes keep the cache up to date", func(t *testing.T) {
+		cache := NewNodeCache(1 << 20)
+		tree := newTree(t, cache)
+		uncached := &BPTree{PageFile: tree.PageFile, MetaPage: tree.MetaPage, Width: tree.Width}
+
+		r := rand.New(rand.NewSource(1))
+		perm := r.Perm(5000)
+		for _, i := range perm {
+			if err := tree.Insert(key(i), pointer.MemoryPointer{Offset: uint64(i), Length: 1}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if cache.Size() == 0 {
+			t.Fatal("expected nodes to be cached")
+		}
+		for _, i := range perm[:4000] {
+			if err := tree.Delete(key(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, want := contents(t, tree), contents(t, uncached)
+		if len(got) != 1000 || len(got) != len(want) {
+			t.Fatalf("got %d keys, want %d", len(got), len(want))
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("got key %d at %d, want %d", got[i], i, want[i])
+			}
+		}
+	})
+
+	t.Run("nodes are copied", func(t *testing.T) {
+		tree := newTree(t, NewNodeCache(1<<20))
+		for i := 0; i < 10; i++ {
+			if err := tree.Insert(key(i), pointer.MemoryPointer{Offset: uint64(i), Length: 1}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		root, _, err := tree.root()
+		if err != nil {
+			t.Fatal(err)
+		}
+		root.Keys = root.Keys[:1]
+		root.LeafPointers[0].Offset = 100
+		if got := contents(t, tree); len(got) != 10 {
+			t.Fatalf("got %d keys, want 10", len(got))
+		}
+		if _, ptr, err := tree.Find(key(0)); err != nil || ptr.Offset != 0 {
+			t.Fatalf("got pointer %v, %v, want offset 0", ptr, err)
+		}
+	})
+
+	t.Run("the limit is respected", func(t *testing.T) {
+		cache := NewNodeCache(1 << 20)
+		tree := newTree(t, cache)
+		for i := 0; i < 5000; i++ {
+			if err := tree.Insert(key(i), pointer.MemoryPointer{Offset: uint64(i), Length: 1}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		root, _, err := tree.root()
+		if err != nil {
+			t.Fatal(err)
+		}
+		limit := 2 * root.memorySize()
+		cache.SetLimit(limit)
+		if cache.Size() > limit {
+			t.Fatalf("got %d bytes, want at most %d", cache.Size(), limit)
+		}
+		if got := contents(t, tree); len(got) != 5000 {
+			t.Fatalf("got %d keys, want 5000", len(got))
+		}
+		if cache.Size() > limit {
+			t.Fatalf("got %d bytes, want at most %d", cache.Size(), limit)
+		}
+
+		cache.SetLimit(0)
+		if cache.Size() != 0 {
+			t.Fatalf("got %d bytes, want 0", cache.Size())
+		}
+		if got := contents(t, tree); len(got) != 5000 {
+			t.Fatalf("got %d keys, want 5000", len(got))
+		}
+	})
+
+	t.Run("nodes are only returned for the same width", func(t *testing.T) {
+		cache := NewNodeCache(1 << 20)
+		tree := newTree(t, cache)
+		if err := tree.Insert(key(1), pointer.MemoryPointer{Offset: 1, Length: 1}); err != nil {
+			t.Fatal(err)
+		}
+		root, err := tree.MetaPage.Root()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cache.get(root.Offset, 9) == nil {
+			t.Fatal("expected the root to be cached")
+		}
+		if cache.get(root.Offset, 5) != nil {
+			t.Fatal("expected a miss for a different width")
+		}
+	})
+}
@@ -2,18 +2,33 @@ package bptree
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"github.com/kevmo314/appendable/pkg/encoding"
 	"github.com/kevmo314/appendable/pkg/pointer"
 	"io"
+	"math"
 )
 
 type DataParser interface {
 	Parse([]byte) []byte
 }
 
+// StoredWidth is the width of trees whose keys are variable width and stored
+// in the nodes instead of being resolved from the data file, for data files
+// whose values can't be read in place.
+const StoredWidth = math.MaxUint16
+
+// MaxStoredKeySize returns the size of the largest key that a tree with
+// StoredWidth holds in pages of pageSize bytes, so that a node split always
+// yields nodes that fit in a page.
+func MaxStoredKeySize(pageSize int) int {
+	return pageSize / 8
+}
+
 type BPTreeNode struct {
 	Data       []byte
+	DataReader io.ReaderAt
 	DataParser DataParser
 	// contains the offset of the child node or the offset of the record for leaf
 	// if the node is a leaf, the last pointer is the offset of the next leaf
@@ -43,13 +58,7 @@ func (n *BPTreeNode) NumPointers() int {
 func (n *BPTreeNode) Size() int64 {
 	size := 4 // number of keys
 	for _, k := range n.Keys {
-		o := encoding.SizeVarint(uint64(k.DataPointer.Offset))
-		l := encoding.SizeVarint(uint64(k.DataPointer.Length))
-		size += l + o
-
-		if n.Width != uint16(0) {
-			size += len(k.Value)
-		}
+		size += n.keySize(k)
 	}
 	for _, n := range n.LeafPointers {
 		o := encoding.SizeVarint(uint64(n.Offset))
@@ -63,6 +72,19 @@ func (n *BPTreeNode) Size() int64 {
 	return int64(size)
 }
 
+// keySize returns the number of bytes k occupies when serialized in n.
+func (n *BPTreeNode) keySize(k pointer.ReferencedValue) int {
+	size := encoding.SizeVarint(k.DataPointer.Offset) + encoding.SizeVarint(uint64(k.DataPointer.Length))
+	switch n.Width {
+	case 0:
+	case StoredWidth:
+		size += encoding.SizeVarint(uint64(len(k.Value))) + len(k.Value)
+	default:
+		size += len(k.Value)
+	}
+	return size
+}
+
 func (n *BPTreeNode) MarshalBinary() ([]byte, error) {
 	size := int32(len(n.Keys))
 
@@ -81,6 +103,9 @@ func (n *BPTreeNode) MarshalBinary() ([]byte, error) {
 		on := binary.PutUvarint(buf[ct:], k.DataPointer.Offset)
 		ln := binary.PutUvarint(buf[ct+on:], uint64(k.DataPointer.Length))
 		ct += on + ln
+		if n.Width == StoredWidth {
+			ct += binary.PutUvarint(buf[ct:], uint64(len(k.Value)))
+		}
 		if n.Width != uint16(0) {
 			m := copy(buf[ct:ct+len(k.Value)], k.Value)
 			if m != len(k.Value) {
@@ -114,52 +139,119 @@ func (n *BPTreeNode) WriteTo(w io.Writer) (int64, error) {
 	return int64(m), err
 }
 
+// ErrCorruptNode is returned when a node can't be decoded.
+var ErrCorruptNode = errors.New("corrupt node")
+
 func (n *BPTreeNode) UnmarshalBinary(buf []byte) error {
+	if len(buf) < 4 {
+		return fmt.Errorf("%w: %d byte node", ErrCorruptNode, len(buf))
+	}
 	size := int32(binary.LittleEndian.Uint32(buf[:4]))
+	if size == 0 {
+		return fmt.Errorf("%w: empty node", ErrCorruptNode)
+	}
+	count := int64(size)
+	if count < 0 {
+		count = -count
+	}
+	// every key takes at least two bytes, so a larger count can't fit.
+	if count > int64(len(buf)-4)/2 {
+		return fmt.Errorf("%w: %d keys in a %d byte node", ErrCorruptNode, count, len(buf))
+	}
 	leaf := size < 0
 	if leaf {
-		n.LeafPointers = make([]pointer.MemoryPointer, -size)
-		n.Keys = make([]pointer.ReferencedValue, -size)
+		n.LeafPointers = make([]pointer.MemoryPointer, count)
+		n.Keys = make([]pointer.ReferencedValue, count)
 	} else {
-		n.InternalPointers = make([]uint64, size+1)
-		n.Keys = make([]pointer.ReferencedValue, size)
-	}
-	if size == 0 {
-		panic("empty node")
+		n.InternalPointers = make([]uint64, count+1)
+		n.Keys = make([]pointer.ReferencedValue, count)
 	}
 
 	m := 4
+	uvarint := func() (uint64, error) {
+		v, k := binary.Uvarint(buf[m:])
+		if k <= 0 {
+			return 0, fmt.Errorf("%w: invalid varint at byte %d", ErrCorruptNode, m)
+		}
+		m += k
+		return v, nil
+	}
+	memoryPointer := func() (pointer.MemoryPointer, error) {
+		o, err := uvarint()
+		if err != nil {
+			return pointer.MemoryPointer{}, err
+		}
+		l, err := uvarint()
+		if err != nil {
+			return pointer.MemoryPointer{}, err
+		}
+		if l > math.MaxUint32 {
+			return pointer.MemoryPointer{}, fmt.Errorf("%w: length %d out of range", ErrCorruptNode, l)
+		}
+		return pointer.MemoryPointer{Offset: o, Length: uint32(l)}, nil
+	}
 	for i := range n.Keys {
-		o, on := binary.Uvarint(buf[m:])
-		l, ln := binary.Uvarint(buf[m+on:])
-
-		n.Keys[i].DataPointer.Offset = o
-		n.Keys[i].DataPointer.Length = uint32(l)
-
-		m += on + ln
+		dp, err := memoryPointer()
+		if err != nil {
+			return err
+		}
+		n.Keys[i].DataPointer = dp
 
-		if n.Width == uint16(0) {
+		switch n.Width {
+		case 0:
 			// read the key out of the memory pointer stored at this position
-			dp := n.Keys[i].DataPointer
-			n.Keys[i].Value = n.DataParser.Parse(n.Data[dp.Offset : dp.Offset+uint64(dp.Length)]) // resolving the data-file
-		} else {
+			value, err := n.resolve(n.Keys[i].DataPointer)
+			if err != nil {
+				return err
+			}
+			n.Keys[i].Value = value
+		case StoredWidth:
+			l, err := uvarint()
+			if err != nil {
+				return err
+			}
+			if l > uint64(len(buf)-m) {
+				return fmt.Errorf("%w: key at byte %d out of range", ErrCorruptNode, m)
+			}
+			n.Keys[i].Value = buf[m : m+int(l)]
+			m += int(l)
+		default:
+			if m+int(n.Width-1) > len(buf) {
+				return fmt.Errorf("%w: key at byte %d out of range", ErrCorruptNode, m)
+			}
 			n.Keys[i].Value = buf[m : m+int(n.Width-1)]
 			m += int(n.Width - 1)
 		}
 	}
 	for i := range n.LeafPointers {
-
-		o, on := binary.Uvarint(buf[m:])
-		l, ln := binary.Uvarint(buf[m+on:])
-
-		n.LeafPointers[i].Offset = o
-		n.LeafPointers[i].Length = uint32(l)
-		m += on + ln
+		p, err := memoryPointer()
+		if err != nil {
+			return err
+		}
+		n.LeafPointers[i] = p
 	}
 	for i := range n.InternalPointers {
-		o, on := binary.Uvarint(buf[m:])
+		o, err := uvarint()
+		if err != nil {
+			return err
+		}
 		n.InternalPointers[i] = o
-		m += on
 	}
 	return nil
 }
+
+// resolve reads the value of a variable width key from the data file.
+func (n *BPTreeNode) resolve(dp pointer.MemoryPointer) ([]byte, error) {
+	if n.DataReader == nil {
+		if dp.Offset > uint64(len(n.Data)) || uint64(dp.Length) > uint64(len(n.Data))-dp.Offset {
+			return nil, fmt.Errorf("%w: key at offset %d out of range", ErrCorruptNode, dp.Offset)
+		}
+		return n.DataParser.Parse(n.Data[dp.Offset : dp.Offset+uint64(dp.Length)]), nil
+	}
+	buf := make([]byte, dp.Length)
+	// ReadAt may return io.EOF along with the last bytes of the data file.
+	if m, err := n.DataReader.ReadAt(buf, int64(dp.Offset)); m < len(buf) {
+		return nil, fmt.Errorf("failed to read key at offset %d: %w", dp.Offset, err)
+	}
+	return n.DataParser.Parse(buf), nil
+}
@@ -2,6 +2,7 @@ package bptree
 
 import (
 	"bytes"
+	"errors"
 	"github.com/kevmo314/appendable/pkg/pointer"
 	"reflect"
 	"testing"
@@ -42,6 +43,42 @@ func TestBPTreeNode_ReadWriteLeaf(t *testing.T) {
 	}
 }
 
+func TestBPTreeNode_ReadWriteStored(t *testing.T) {
+	node1 := &BPTreeNode{
+		LeafPointers: []pointer.MemoryPointer{
+			{Offset: 0, Length: 0},
+			{Offset: 0, Length: 1},
+			{Offset: 1, Length: 0},
+		},
+		Keys: []pointer.ReferencedValue{
+			{Value: []byte{}, DataPointer: pointer.MemoryPointer{Offset: 0, Length: 0}},
+			{Value: []byte("a"), DataPointer: pointer.MemoryPointer{Offset: 0, Length: 1}},
+			{Value: []byte("abcdef"), DataPointer: pointer.MemoryPointer{Offset: 1, Length: 0}},
+		},
+		Width: StoredWidth,
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := node1.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	node2 := &BPTreeNode{Width: StoredWidth}
+	if err := node2.UnmarshalBinary(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(node1, node2) {
+		t.Fatalf("expected %#v\ngot %#v", node1, node2)
+	}
+
+	// the stored lengths are checked against the page.
+	node3 := &BPTreeNode{Width: StoredWidth}
+	if err := node3.UnmarshalBinary(buf.Bytes()[:buf.Len()-8]); !errors.Is(err, ErrCorruptNode) {
+		t.Fatalf("expected ErrCorruptNode, got %v", err)
+	}
+}
+
 func TestBPTreeNode_ReadWriteIntermediate(t *testing.T) {
 	// Create a test BPTreeNode
 	node1 := &BPTreeNode{
@@ -104,3 +141,24 @@ func TestBPTreeNode_CompareReferencedValues(t *testing.T) {
 		}
 	}
 }
+
+func TestBPTreeNode_UnmarshalCorrupt(t *testing.T) {
+	for name, buf := range map[string][]byte{
+		"empty page":      make([]byte, 4096),
+		"short buffer":    {1, 0},
+		"too many keys":   {0xff, 0xff, 0xff, 0x7f, 0, 0, 0, 0},
+		"truncated key":   {0xff, 0xff, 0xff, 0xff, 1, 2, 3},
+		"invalid varint":  append([]byte{1, 0, 0, 0}, bytes.Repeat([]byte{0xff}, 12)...),
+		"key out of data": {0xff, 0xff, 0xff, 0xff, 100, 3, 0, 3},
+	} {
+		t.Run(name, func(t *testing.T) {
+			node := &BPTreeNode{Data: []byte("abc"), DataParser: &StubDataParser{}}
+			if name == "truncated key" {
+				node.Width = uint16(9)
+			}
+			if err := node.UnmarshalBinary(buf); !errors.Is(err, ErrCorruptNode) {
+				t.Fatalf("got %v, want ErrCorruptNode", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package bptree
+
+import (
+	"errors"
+	"io"
+	"math"
+
+	"github.com/kevmo314/appendable/pkg/pointer"
+)
+
+type Direction byte
+
+const (
+	Ascending Direction = iota
+	Descending
+)
+
+// Inclusivity is a bit set describing which bounds of a range are included.
+type Inclusivity byte
+
+const (
+	ExcludeBoth Inclusivity = 0
+	IncludeLo   Inclusivity = 1 << 0
+	IncludeHi   Inclusivity = 1 << 1
+	IncludeBoth             = IncludeLo | IncludeHi
+)
+
+// successor returns the smallest possible key that compares greater than rv.
+func successor(rv pointer.ReferencedValue) pointer.ReferencedValue {
+	switch {
+	case rv.DataPointer.Length < math.MaxUint32:
+		return pointer.ReferencedValue{
+			Value:       rv.Value,
+			DataPointer: pointer.MemoryPointer{Offset: rv.DataPointer.Offset, Length: rv.DataPointer.Length + 1},
+		}
+	case rv.DataPointer.Offset < math.MaxUint64:
+		return pointer.ReferencedValue{
+			Value:       rv.Value,
+			DataPointer: pointer.MemoryPointer{Offset: rv.DataPointer.Offset + 1},
+		}
+	default:
+		// every key with this value is smaller, so move on to the next value.
+		return pointer.ReferencedValue{Value: append(rv.Value[:len(rv.Value):len(rv.Value)], 0)}
+	}
+}
+
+// SeekFirst returns an iterator whose first call to Next yields the smallest
+// key in the tree.
+func (t *BPTree) SeekFirst() (*TraversalIterator, error) {
+	first, err := t.first()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return t.Iter(first)
+}
+
+// SeekLast returns an iterator whose first call to Prev yields the largest
+// key in the tree.
+func (t *BPTree) SeekLast() (*TraversalIterator, error) {
+	last, err := t.last()
+	if errors.Is(err, io.EOF) {
+		return t.Iter(last)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t.Iter(successor(last))
+}
+
+// RangeIterator iterates over the keys between two bounds in either direction.
+type RangeIterator struct {
+	iter        *TraversalIterator
+	lo, hi      *pointer.ReferencedValue
+	inclusivity Inclusivity
+	direction   Direction
+	done        bool
+}
+
+// Range returns an iterator over the keys between lo and hi, compared with
+// pointer.CompareReferencedValues. A nil bound leaves that side of the range
+// unbounded. To bound a range by value regardless of the DataPointer, use a
+// DataPointer of zero for an inclusive lower or exclusive upper bound and a
+// DataPointer of math.MaxUint64/math.MaxUint32 otherwise.
+func (t *BPTree) Range(lo, hi *pointer.ReferencedValue, inclusivity Inclusivity, direction Direction) (*RangeIterator, error) {
+	var iter *TraversalIterator
+	var err error
+	switch direction {
+	case Ascending:
+		switch {
+		case lo == nil:
+			iter, err = t.SeekFirst()
+		case inclusivity&IncludeLo != 0:
+			iter, err = t.Iter(*lo)
+		default:
+			iter, err = t.Iter(successor(*lo))
+		}
+	case Descending:
+		switch {
+		case hi == nil:
+			iter, err = t.SeekLast()
+		case inclusivity&IncludeHi != 0:
+			iter, err = t.Iter(successor(*hi))
+		default:
+			iter, err = t.Iter(*hi)
+		}
+	default:
+		return nil, errors.New("invalid direction")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &RangeIterator{iter: iter, lo: lo, hi: hi, inclusivity: inclusivity, direction: direction}, nil
+}
+
+// Next advances the iterator in the direction of the range, returning false
+// once the range is exhausted.
+func (r *RangeIterator) Next() bool {
+	if r.done {
+		return false
+	}
+	var ok bool
+	if r.direction == Ascending {
+		ok = r.iter.Next()
+	} else {
+		ok = r.iter.Prev()
+	}
+	if !ok || !r.inRange(r.iter.Key()) {
+		r.done = true
+		return false
+	}
+	return true
+}
+
+// inRange checks the bound that the iterator is moving towards. The other
+// bound is already satisfied by the starting position.
+func (r *RangeIterator) inRange(key pointer.ReferencedValue) bool {
+	if r.direction == Ascending {
+		if r.hi == nil {
+			return true
+		}
+		cmp := pointer.CompareReferencedValues(key, *r.hi)
+		return cmp < 0 || (cmp == 0 && r.inclusivity&IncludeHi != 0)
+	}
+	if r.lo == nil {
+		return true
+	}
+	cmp := pointer.CompareReferencedValues(key, *r.lo)
+	return cmp > 0 || (cmp == 0 && r.inclusivity&IncludeLo != 0)
+}
+
+func (r *RangeIterator) Key() pointer.ReferencedValue {
+	return r.iter.Key()
+}
+
+func (r *RangeIterator) Pointer() pointer.MemoryPointer {
+	return r.iter.Pointer()
+}
+
+func (r *RangeIterator) Err() error {
+	return r.iter.Err()
+}
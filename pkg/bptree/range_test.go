@@ -0,0 +1,189 @@
+package bptree
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/kevmo314/appendable/pkg/buftest"
+	"github.com/kevmo314/appendable/pkg/pagefile"
+	"github.com/kevmo314/appendable/pkg/pointer"
+)
+
+func newRangeTestTree(t *testing.T, n int) *BPTree {
+	b := buftest.NewSeekableBuffer()
+	p, err := pagefile.NewPageFile(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := &BPTree{PageFile: p, MetaPage: newTestMetaPage(t, p), Width: uint16(9)}
+	// every value is inserted twice with a different DataPointer.
+	for i := 0; i < n; i++ {
+		for j := 0; j < 2; j++ {
+			buf := make([]byte, 8)
+			binary.BigEndian.PutUint64(buf, uint64(i))
+			if err := tree.Insert(pointer.ReferencedValue{Value: buf, DataPointer: pointer.MemoryPointer{Offset: uint64(j)}}, pointer.MemoryPointer{Offset: uint64(2*i + j)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return tree
+}
+
+func TestBPTree_SeekFirstLast(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 2000} {
+		t.Run(fmt.Sprintf("%d values", n), func(t *testing.T) {
+			tree := newRangeTestTree(t, n)
+
+			first, err := tree.SeekFirst()
+			if err != nil {
+				t.Fatal(err)
+			}
+			count := 0
+			for ; first.Next(); count++ {
+				if first.Pointer().Offset != uint64(count) {
+					t.Fatalf("expected value %d, got %d", count, first.Pointer().Offset)
+				}
+			}
+			if err := first.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if count != 2*n {
+				t.Fatalf("expected %d keys, got %d", 2*n, count)
+			}
+
+			last, err := tree.SeekLast()
+			if err != nil {
+				t.Fatal(err)
+			}
+			count = 0
+			for ; last.Prev(); count++ {
+				if last.Pointer().Offset != uint64(2*n-1-count) {
+					t.Fatalf("expected value %d, got %d", 2*n-1-count, last.Pointer().Offset)
+				}
+			}
+			if err := last.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if count != 2*n {
+				t.Fatalf("expected %d keys, got %d", 2*n, count)
+			}
+		})
+	}
+}
+
+func TestBPTree_Range(t *testing.T) {
+	const n = 2000
+	tree := newRangeTestTree(t, n)
+
+	key := func(i int, dp uint64) *pointer.ReferencedValue {
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(i))
+		return &pointer.ReferencedValue{Value: buf, DataPointer: pointer.MemoryPointer{Offset: dp}}
+	}
+
+	// expected computes the pointers in range by brute force.
+	expected := func(lo, hi *pointer.ReferencedValue, inclusivity Inclusivity, direction Direction) []uint64 {
+		var out []uint64
+		for i := 0; i < n; i++ {
+			for j := 0; j < 2; j++ {
+				k := *key(i, uint64(j))
+				if lo != nil {
+					cmp := pointer.CompareReferencedValues(k, *lo)
+					if cmp < 0 || (cmp == 0 && inclusivity&IncludeLo == 0) {
+						continue
+					}
+				}
+				if hi != nil {
+					cmp := pointer.CompareReferencedValues(k, *hi)
+					if cmp > 0 || (cmp == 0 && inclusivity&IncludeHi == 0) {
+						continue
+					}
+				}
+				out = append(out, uint64(2*i+j))
+			}
+		}
+		if direction == Descending {
+			for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+				out[i], out[j] = out[j], out[i]
+			}
+		}
+		return out
+	}
+
+	check := func(t *testing.T, lo, hi *pointer.ReferencedValue, inclusivity Inclusivity, direction Direction) {
+		iter, err := tree.Range(lo, hi, inclusivity, direction)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []uint64
+		for iter.Next() {
+			got = append(got, iter.Pointer().Offset)
+		}
+		if err := iter.Err(); err != nil {
+			t.Fatal(err)
+		}
+		want := expected(lo, hi, inclusivity, direction)
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("range(%v, %v, %d, %d): expected %d keys, got %d", lo, hi, inclusivity, direction, len(want), len(got))
+		}
+		// the iterator stays exhausted.
+		if iter.Next() {
+			t.Fatal("expected iterator to be exhausted")
+		}
+	}
+
+	t.Run("unbounded", func(t *testing.T) {
+		check(t, nil, nil, IncludeBoth, Ascending)
+		check(t, nil, nil, IncludeBoth, Descending)
+	})
+
+	t.Run("half bounded", func(t *testing.T) {
+		for _, direction := range []Direction{Ascending, Descending} {
+			for _, inclusivity := range []Inclusivity{ExcludeBoth, IncludeBoth} {
+				check(t, key(500, 0), nil, inclusivity, direction)
+				check(t, key(500, 1), nil, inclusivity, direction)
+				check(t, nil, key(500, 0), inclusivity, direction)
+				check(t, nil, key(500, 1), inclusivity, direction)
+			}
+		}
+	})
+
+	t.Run("by value", func(t *testing.T) {
+		// a DataPointer of zero or max selects all keys with a given value.
+		lo := key(10, 0)
+		hi := key(20, math.MaxUint64)
+		hi.DataPointer.Length = math.MaxUint32
+		iter, err := tree.Range(lo, hi, IncludeBoth, Ascending)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count := 0
+		for ; iter.Next(); count++ {
+		}
+		if count != 22 {
+			t.Fatalf("expected 22 keys, got %d", count)
+		}
+	})
+
+	t.Run("random bounds", func(t *testing.T) {
+		r := rand.New(rand.NewSource(12345))
+		for i := 0; i < 200; i++ {
+			a, b := r.Intn(n+10)-5, r.Intn(n+10)-5
+			if a > b {
+				a, b = b, a
+			}
+			check(t, key(a, uint64(r.Intn(3))), key(b, uint64(r.Intn(3))), Inclusivity(r.Intn(4)), Direction(r.Intn(2)))
+		}
+	})
+
+	t.Run("empty range", func(t *testing.T) {
+		check(t, key(600, 0), key(500, 0), IncludeBoth, Ascending)
+		check(t, key(600, 0), key(500, 0), IncludeBoth, Descending)
+		check(t, key(500, 0), key(500, 0), ExcludeBoth, Ascending)
+		check(t, key(n+1, 0), nil, IncludeBoth, Ascending)
+		check(t, nil, key(-1, 0), IncludeBoth, Descending)
+	})
+}
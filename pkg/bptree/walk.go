@@ -0,0 +1,62 @@
+package bptree
+
+import (
+	"fmt"
+
+	"github.com/kevmo314/appendable/pkg/pointer"
+)
+
+// WalkFunc is called by Walk for each node of a tree. lo and hi are the
+// bounds that the keys of the node's ancestors place on its keys, so every
+// key k of the node should satisfy lo <= k < hi. They are nil if the node is
+// unbounded on that side.
+//
+// If the node can't be read, node is nil and err says why. Returning an
+// error stops the walk.
+type WalkFunc func(offset uint64, node *BPTreeNode, lo, hi *pointer.ReferencedValue, err error) error
+
+// Walk calls fn for each node of the tree in depth-first order, so leaves are
+// visited in key order. The children of a node that can't be read are
+// skipped, as are nodes that are referenced more than once.
+func (t *BPTree) Walk(fn WalkFunc) error {
+	mp, err := t.MetaPage.Root()
+	if err != nil {
+		return err
+	}
+	if mp.Length == 0 {
+		return nil
+	}
+	return t.walk(mp, nil, nil, make(map[uint64]bool), fn)
+}
+
+func (t *BPTree) walk(ptr pointer.MemoryPointer, lo, hi *pointer.ReferencedValue, visited map[uint64]bool, fn WalkFunc) error {
+	if visited[ptr.Offset] {
+		return fn(ptr.Offset, nil, lo, hi, fmt.Errorf("%w: node is referenced more than once", ErrCorruptNode))
+	}
+	visited[ptr.Offset] = true
+
+	node, err := t.readNode(ptr)
+	if err != nil {
+		return fn(ptr.Offset, nil, lo, hi, err)
+	}
+	if err := fn(ptr.Offset, node, lo, hi, nil); err != nil {
+		return err
+	}
+	if node.Leaf() {
+		return nil
+	}
+	for i := range node.InternalPointers {
+		// keys equal to a separator are stored to its right, see traverse.
+		clo, chi := lo, hi
+		if i > 0 {
+			clo = &node.Keys[i-1]
+		}
+		if i < len(node.Keys) {
+			chi = &node.Keys[i]
+		}
+		if err := t.walk(node.Pointer(i), clo, chi, visited, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package bptree
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/kevmo314/appendable/pkg/buftest"
+	"github.com/kevmo314/appendable/pkg/pagefile"
+	"github.com/kevmo314/appendable/pkg/pointer"
+)
+
+func TestBPTree_Walk(t *testing.T) {
+	b := buftest.NewSeekableBuffer()
+	p, err := pagefile.NewPageFile(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := &BPTree{PageFile: p, MetaPage: newTestMetaPage(t, p), Width: uint16(9)}
+	for i := 0; i < 2000; i++ {
+		buf := binary.BigEndian.AppendUint64(nil, uint64(i))
+		if err := tree.Insert(pointer.ReferencedValue{Value: buf}, pointer.MemoryPointer{Offset: uint64(i), Length: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("visits leaves in key order within their bounds", func(t *testing.T) {
+		next := uint64(0)
+		internal := 0
+		if err := tree.Walk(func(offset uint64, node *BPTreeNode, lo, hi *pointer.ReferencedValue, err error) error {
+			if err != nil {
+				return err
+			}
+			if !node.Leaf() {
+				internal++
+				return nil
+			}
+			if (lo == nil) != (next == 0) {
+				t.Fatalf("got lo %v for the leaf starting at %d", lo, next)
+			}
+			for _, k := range node.Keys {
+				if binary.BigEndian.Uint64(k.Value) != next {
+					t.Fatalf("got key %d, want %d", binary.BigEndian.Uint64(k.Value), next)
+				}
+				if (lo != nil && pointer.CompareReferencedValues(k, *lo) < 0) || (hi != nil && pointer.CompareReferencedValues(k, *hi) >= 0) {
+					t.Fatalf("key %d is out of bounds [%v, %v)", next, lo, hi)
+				}
+				next++
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if next != 2000 || internal == 0 {
+			t.Fatalf("got %d keys and %d internal nodes", next, internal)
+		}
+	})
+
+	t.Run("reports nodes that can't be read", func(t *testing.T) {
+		root, err := tree.MetaPage.Root()
+		if err != nil {
+			t.Fatal(err)
+		}
+		node, err := tree.readNode(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		child := node.Pointer(1).Offset
+		b.Bytes()[child+1] ^= 0xff
+
+		var failed []uint64
+		if err := tree.Walk(func(offset uint64, node *BPTreeNode, lo, hi *pointer.ReferencedValue, err error) error {
+			var corrupt *pagefile.CorruptPageError
+			if errors.As(err, &corrupt) {
+				failed = append(failed, offset)
+			} else if err != nil {
+				return err
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if len(failed) != 1 || failed[0] != child {
+			t.Fatalf("got failed nodes %v, want [%d]", failed, child)
+		}
+	})
+}
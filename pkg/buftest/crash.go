@@ -0,0 +1,38 @@
+package buftest
+
+import "errors"
+
+// ErrCrashed is returned by CrashingBuffer once it has crashed.
+var ErrCrashed = errors.New("crashed")
+
+// CrashingBuffer is a SeekableBuffer that fails every write after the first
+// Writes writes. This simulates a process that crashes part way through
+// writing a file, after which the file can be read from SeekableBuffer.
+type CrashingBuffer struct {
+	*SeekableBuffer
+	Writes int
+}
+
+func (b *CrashingBuffer) Write(p []byte) (int, error) {
+	if b.Writes == 0 {
+		return 0, ErrCrashed
+	}
+	b.Writes--
+	return b.SeekableBuffer.Write(p)
+}
+
+func (b *CrashingBuffer) WriteAt(p []byte, off int64) (int, error) {
+	if b.Writes == 0 {
+		return 0, ErrCrashed
+	}
+	b.Writes--
+	return b.SeekableBuffer.WriteAt(p, off)
+}
+
+func (b *CrashingBuffer) Truncate(size int64) error {
+	if b.Writes == 0 {
+		return ErrCrashed
+	}
+	b.Writes--
+	return b.SeekableBuffer.Truncate(size)
+}
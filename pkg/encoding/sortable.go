@@ -0,0 +1,57 @@
+package encoding
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// EncodeUint64 encodes v such that comparing the encoded bytes orders values
+// the same way as comparing the integers.
+func EncodeUint64(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, v)
+}
+
+func DecodeUint64(buf []byte) uint64 {
+	return binary.BigEndian.Uint64(buf)
+}
+
+// EncodeInt64 encodes v such that comparing the encoded bytes orders values
+// the same way as comparing the integers. The sign bit is flipped so negative
+// values sort before positive values.
+func EncodeInt64(v int64) []byte {
+	return EncodeUint64(uint64(v) ^ (1 << 63))
+}
+
+func DecodeInt64(buf []byte) int64 {
+	return int64(DecodeUint64(buf) ^ (1 << 63))
+}
+
+// EncodeFloat64 encodes v such that comparing the encoded bytes orders values
+// the same way as comparing the floats. The sign bit of positive values is set
+// so they sort after negative values, and all the bits of negative values are
+// inverted so larger magnitudes sort first.
+//
+// NaN sorts after +Inf and -NaN before -Inf. -0 is encoded as +0, since they
+// compare equal.
+func EncodeFloat64(v float64) []byte {
+	if v == 0 {
+		v = 0
+	}
+	bits := math.Float64bits(v)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	return EncodeUint64(bits)
+}
+
+func DecodeFloat64(buf []byte) float64 {
+	bits := DecodeUint64(buf)
+	if bits&(1<<63) != 0 {
+		bits &^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits)
+}
@@ -0,0 +1,70 @@
+package encoding
+
+import (
+	"bytes"
+	"cmp"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestSortableInt64(t *testing.T) {
+	values := []int64{math.MinInt64, math.MinInt64 + 1, -1 << 53, -2, -1, 0, 1, 2, 1<<53 + 1, math.MaxInt64 - 1, math.MaxInt64}
+	for i := 0; i < 1000; i++ {
+		values = append(values, int64(rand.Uint64()))
+	}
+
+	for _, a := range values {
+		if got := DecodeInt64(EncodeInt64(a)); got != a {
+			t.Fatalf("round trip of %d gave %d", a, got)
+		}
+		for _, b := range values[:20] {
+			if got, want := bytes.Compare(EncodeInt64(a), EncodeInt64(b)), cmp.Compare(a, b); got != want {
+				t.Fatalf("compare(%d, %d) = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+}
+
+func TestSortableUint64(t *testing.T) {
+	values := []uint64{0, 1, 1 << 53, 1<<53 + 1, math.MaxInt64, math.MaxInt64 + 1, math.MaxUint64}
+	for i := 0; i < 1000; i++ {
+		values = append(values, rand.Uint64())
+	}
+
+	for _, a := range values {
+		if got := DecodeUint64(EncodeUint64(a)); got != a {
+			t.Fatalf("round trip of %d gave %d", a, got)
+		}
+		for _, b := range values[:20] {
+			if got, want := bytes.Compare(EncodeUint64(a), EncodeUint64(b)), cmp.Compare(a, b); got != want {
+				t.Fatalf("compare(%d, %d) = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+}
+
+func TestSortableFloat64(t *testing.T) {
+	values := []float64{math.Inf(-1), -math.MaxFloat64, -1e100, -2.5, -1, -math.SmallestNonzeroFloat64, 0, math.SmallestNonzeroFloat64, 1, 2.5, 1e100, math.MaxFloat64, math.Inf(1)}
+	for i := 0; i < 1000; i++ {
+		values = append(values, rand.NormFloat64()*math.Pow(10, float64(rand.Intn(40)-20)))
+	}
+
+	for _, a := range values {
+		if got := DecodeFloat64(EncodeFloat64(a)); got != a {
+			t.Fatalf("round trip of %v gave %v", a, got)
+		}
+		for _, b := range values[:13] {
+			if got, want := bytes.Compare(EncodeFloat64(a), EncodeFloat64(b)), cmp.Compare(a, b); got != want {
+				t.Fatalf("compare(%v, %v) = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+
+	if got := DecodeFloat64(EncodeFloat64(math.NaN())); !math.IsNaN(got) {
+		t.Fatalf("round trip of NaN gave %v", got)
+	}
+	if !bytes.Equal(EncodeFloat64(math.Copysign(0, -1)), EncodeFloat64(0)) {
+		t.Fatal("expected -0 to be encoded as +0")
+	}
+}
@@ -0,0 +1,47 @@
+// flock takes advisory locks on files so that only one process writes an
+// index file at a time.
+package flock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrLocked is returned by Lock if another process holds the lock.
+var ErrLocked = errors.New("file is locked by another process")
+
+// File is a file that holds an advisory lock. Locks belong to the file that
+// they open, so two locks on the same path conflict even within one process.
+type File struct {
+	f *os.File
+}
+
+// Lock takes an exclusive lock on the file at path, creating it if it doesn't
+// exist. It doesn't wait for other processes to release their locks.
+func Lock(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, unix.EWOULDBLOCK) {
+			return nil, fmt.Errorf("%s: %w", path, ErrLocked)
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	return &File{f: f}, nil
+}
+
+// Unlock releases the lock. The file is kept, since removing it could let
+// another process lock a new file while the old one is still locked.
+func (l *File) Unlock() error {
+	if err := unix.Flock(int(l.f.Fd()), unix.LOCK_UN); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
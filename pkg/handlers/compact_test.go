@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+	"github.com/kevmo314/appendable/pkg/bptree"
+	"github.com/kevmo314/appendable/pkg/buftest"
+)
+
+// indexContents returns the metadata and entries of every index of i.
+func indexContents(t *testing.T, i *appendable.IndexFile, data []byte) ([]appendable.IndexMeta, [][]bptree.Entry) {
+	t.Helper()
+	var metas []appendable.IndexMeta
+	var entries [][]bptree.Entry
+	page, err := i.Indexes()
+	for err == nil {
+		meta := appendable.IndexMeta{}
+		if err := page.UnmarshalMetadata(&meta); err != nil {
+			t.Fatal(err)
+		}
+		iter, ierr := page.BPTree(&bptree.BPTree{Data: data, DataParser: JSONLHandler{}, Width: meta.Width}).SeekFirst()
+		if ierr != nil {
+			t.Fatal(ierr)
+		}
+		var es []bptree.Entry
+		for iter.Next() {
+			es = append(es, bptree.Entry{Key: iter.Key(), Value: iter.Pointer()})
+		}
+		if err := iter.Err(); err != nil {
+			t.Fatal(err)
+		}
+		metas = append(metas, meta)
+		entries = append(entries, es)
+		page, err = page.Next()
+	}
+	if !errors.Is(err, io.EOF) {
+		t.Fatal(err)
+	}
+	return metas, entries
+}
+
+func TestCompact(t *testing.T) {
+	var data []byte
+	f := buftest.NewSeekableBuffer()
+	i, err := appendable.NewIndexFile(f, JSONLHandler{}, []string{"s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// synchronizing in many steps inserts into existing trees, which splits
+	// nodes and leaves pages half full.
+	for j := 0; j < 2000; j++ {
+		data = append(data, fmt.Sprintf("{\"n\":%d,\"s\":\"value %d\",\"b\":%t}\n", (j*7919)%2000, j, j%3 == 0)...)
+		if j%100 == 99 {
+			if err := i.Synchronize(data); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	c, err := i.Compact(data, buftest.NewSeekableBuffer())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("queries return the same results", func(t *testing.T) {
+		m1, err := i.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m2, err := c.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the compacted index file is the next generation.
+		m1.Generation++
+		if *m1 != *m2 {
+			t.Fatalf("got metadata %+v, want %+v", m2, m1)
+		}
+
+		metas1, entries1 := indexContents(t, i, data)
+		metas2, entries2 := indexContents(t, c, data)
+		if !reflect.DeepEqual(metas1, metas2) {
+			t.Fatalf("got indexes %+v, want %+v", metas2, metas1)
+		}
+		if !reflect.DeepEqual(entries1, entries2) {
+			t.Fatal("indexes differ")
+		}
+	})
+
+	t.Run("the copy is smaller and consistent", func(t *testing.T) {
+		f2 := buftest.NewSeekableBuffer()
+		if _, err := i.Compact(data, f2); err != nil {
+			t.Fatal(err)
+		}
+		if len(f2.Bytes()) >= len(f.Bytes()) {
+			t.Fatalf("got %d bytes, want less than %d", len(f2.Bytes()), len(f.Bytes()))
+		}
+		c, err := appendable.NewIndexFile(f2, JSONLHandler{}, []string{"s"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		report, err := c.Verify(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Problems) > 0 {
+			t.Fatalf("got problems %v", report.Problems)
+		}
+	})
+
+	t.Run("the copy can have larger pages", func(t *testing.T) {
+		f2 := buftest.NewSeekableBuffer()
+		if _, err := i.CompactSize(data, f2, 65536); err != nil {
+			t.Fatal(err)
+		}
+		c, err := appendable.NewIndexFile(f2, JSONLHandler{}, []string{"s"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.PageSize() != 65536 {
+			t.Fatalf("got page size %d, want 65536", c.PageSize())
+		}
+		metas1, entries1 := indexContents(t, i, data)
+		metas2, entries2 := indexContents(t, c, data)
+		if !reflect.DeepEqual(metas1, metas2) {
+			t.Fatalf("got indexes %+v, want %+v", metas2, metas1)
+		}
+		if !reflect.DeepEqual(entries1, entries2) {
+			t.Fatal("indexes differ")
+		}
+		report, err := c.Verify(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Problems) > 0 {
+			t.Fatalf("got problems %v", report.Problems)
+		}
+		small, err := i.Verify(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Nodes >= small.Nodes {
+			t.Fatalf("got %d nodes, want less than %d", report.Nodes, small.Nodes)
+		}
+	})
+
+	t.Run("the copy can be synchronized", func(t *testing.T) {
+		more := append(data, "{\"n\":5000,\"s\":\"more\",\"b\":true}\n"...)
+		if err := c.Synchronize(more); err != nil {
+			t.Fatal(err)
+		}
+		metadata, err := c.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metadata.Entries != 2001 {
+			t.Fatalf("got %d entries, want 2001", metadata.Entries)
+		}
+	})
+
+	t.Run("the copy must be empty", func(t *testing.T) {
+		if _, err := i.Compact(data, f); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
@@ -2,13 +2,12 @@ package handlers
 
 import (
 	"bytes"
-	"encoding/binary"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"github.com/kevmo314/appendable/pkg/pointer"
 	"io"
 	"log/slog"
-	"math"
 	"strconv"
 	"strings"
 
@@ -18,9 +17,14 @@ import (
 
 type CSVHandler struct {
 	io.ReadSeeker
+
+	// Delimiter separates the fields of a new index and defaults to a comma.
+	// The delimiter is stored in the index file, so it only needs to be set
+	// when creating an index.
+	Delimiter byte
 }
 
-var _ appendable.DataHandler = (*CSVHandler)(nil)
+var _ appendable.ReaderDataHandler = (*CSVHandler)(nil)
 
 func (c CSVHandler) Format() appendable.Format {
 	return appendable.FormatCSV
@@ -28,60 +32,279 @@ func (c CSVHandler) Format() appendable.Format {
 
 func (c CSVHandler) Synchronize(f *appendable.IndexFile, df []byte) error {
 	slog.Debug("Starting CSV synchronization")
+	return synchronizeDelimited(f, df, c, c.dialect())
+}
 
-	var headers []string
-	var err error
+func (c CSVHandler) SynchronizeReader(f *appendable.IndexFile, r io.ReaderAt) error {
+	slog.Debug("Starting CSV synchronization")
+	return synchronizeDelimitedReader(f, r, c, c.dialect())
+}
+
+func (c CSVHandler) dialect() delimitedDialect {
+	return delimitedDialect{
+		delimiter:        c.Delimiter,
+		defaultDelimiter: ',',
+		recordEnd:        csvRecordEnd,
+		split:            splitCSVLine,
+		unescape:         unescapeCSVField,
+		offsets:          csvFieldOffsets,
+	}
+}
+
+// delimitedField is a raw field of a delimited line along with its offset
+// from the start of the line.
+type delimitedField struct {
+	raw    []byte
+	offset int
+}
+
+// delimitedDialect describes how fields of a delimited format are separated
+// and escaped.
+type delimitedDialect struct {
+	delimiter        byte
+	defaultDelimiter byte
+	// recordEnd returns the index of the newline that ends the first record
+	// of a chunk, or -1 if the record isn't complete yet.
+	recordEnd func(chunk []byte, delimiter byte) int
+	// split splits a line into its raw fields, that is including any quotes
+	// or escape sequences.
+	split func(line []byte, delimiter byte) ([]delimitedField, error)
+	// unescape returns the value of a raw field.
+	unescape func(raw []byte) []byte
+	// offsets returns the offset in a raw field of each byte of its value,
+	// or nil if the value is the raw field.
+	offsets func(raw []byte) []int
+}
+
+// synchronizeDelimited synchronizes a data file where each line is a record,
+// except for newlines in quoted CSV fields, and the first record holds the
+// headers.
+func synchronizeDelimited(f *appendable.IndexFile, df []byte, parser bptree.DataParser, d delimitedDialect) error {
+	metadata, headers, err := prepareDelimited(f, bytes.NewReader(df), d)
+	if err != nil {
+		return err
+	}
+	w := newIndexWriter(df, parser)
+	if _, err := handleDelimitedLines(f, w, d, metadata, &headers, df[metadata.ReadOffset:]); err != nil {
+		return err
+	}
+	return finishSynchronize(f, w, metadata)
+}
+
+// synchronizeDelimitedReader is synchronizeDelimited for a data file that is
+// read in chunks.
+func synchronizeDelimitedReader(f *appendable.IndexFile, r io.ReaderAt, parser bptree.DataParser, d delimitedDialect) error {
+	metadata, headers, err := prepareDelimited(f, r, d)
+	if err != nil {
+		return err
+	}
+	w := newReaderIndexWriter(r, parser)
+	if err := readChunks(r, metadata.ReadOffset, func(chunk []byte) (int, error) {
+		return handleDelimitedLines(f, w, d, metadata, &headers, chunk)
+	}); err != nil {
+		return err
+	}
+	return finishSynchronize(f, w, metadata)
+}
 
+// prepareDelimited reads the metadata, checking it against the delimiter of
+// the dialect, and the headers that have been read so far from the data file
+// in r.
+func prepareDelimited(f *appendable.IndexFile, r io.ReaderAt, d delimitedDialect) (*appendable.FileMeta, []string, error) {
 	metadata, err := f.Metadata()
 	if err != nil {
-		return fmt.Errorf("failed to read metadata: %w", err)
+		return nil, nil, fmt.Errorf("failed to read metadata: %w", err)
 	}
 
-	fieldNames, err := f.IndexFieldNames()
+	switch {
+	case metadata.Delimiter == 0:
+		// either the index is new or it predates storing the delimiter, in
+		// which case it was created with the default delimiter.
+		if d.delimiter != 0 && d.delimiter != d.defaultDelimiter && metadata.ReadOffset > 0 {
+			return nil, nil, fmt.Errorf("index was created with delimiter %q, got %q", d.defaultDelimiter, d.delimiter)
+		}
+		metadata.Delimiter = d.delimiter
+		if metadata.Delimiter == 0 {
+			metadata.Delimiter = d.defaultDelimiter
+		}
+	case d.delimiter != 0 && d.delimiter != metadata.Delimiter:
+		return nil, nil, fmt.Errorf("index was created with delimiter %q, got %q", metadata.Delimiter, d.delimiter)
+	}
+
+	if metadata.ReadOffset == 0 {
+		return metadata, nil, nil
+	}
+	headers, err := readDelimitedHeaders(r, d, metadata.Delimiter)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve index field names: %w", err)
+		return nil, nil, err
 	}
-	headers = fieldNames
+	return metadata, headers, nil
+}
 
+// errHeadersRead stops reading the data file once the headers are read.
+var errHeadersRead = errors.New("headers read")
+
+// readDelimitedHeaders reads the headers from the first line of the data file.
+// They are read again on each synchronization since the index spec may
+// exclude columns, which then have no indexes to recover their names from.
+func readDelimitedHeaders(r io.ReaderAt, d delimitedDialect, delimiter byte) ([]string, error) {
+	var headers []string
+	err := readChunks(r, 0, func(chunk []byte) (int, error) {
+		n := 0
+		for {
+			i := d.recordEnd(chunk[n:], delimiter)
+			if i == -1 {
+				return n, nil
+			}
+			line := bytes.TrimSuffix(chunk[n:n+i], []byte{'\r'})
+			n += i + 1
+			if len(line) == 0 {
+				// blank lines don't contain a record.
+				continue
+			}
+			fields, err := d.split(line, delimiter)
+			if err != nil {
+				return 0, fmt.Errorf("failed to parse headers: %w", err)
+			}
+			for _, field := range fields {
+				headers = append(headers, string(d.unescape(field.raw)))
+			}
+			return 0, errHeadersRead
+		}
+	})
+	if err != nil && !errors.Is(err, errHeadersRead) {
+		return nil, err
+	}
+	if headers == nil {
+		return nil, errors.New("failed to read headers: data file has no complete line")
+	}
+	return headers, nil
+}
+
+// handleDelimitedLines indexes the complete records of chunk, which starts at
+// metadata.ReadOffset in the data file, and returns the number of bytes
+// consumed. If headers is empty, the first line is read into it.
+func handleDelimitedLines(f *appendable.IndexFile, w *indexWriter, d delimitedDialect, metadata *appendable.FileMeta, headers *[]string, chunk []byte) (int, error) {
+	n := 0
 	for {
-		i := bytes.IndexByte(df[metadata.ReadOffset:], '\n')
+		i := d.recordEnd(chunk[n:], metadata.Delimiter)
 		if i == -1 {
-			break
+			return n, nil
+		}
+		line := bytes.TrimSuffix(chunk[n:n+i], []byte{'\r'})
+		if len(line) == 0 {
+			// blank lines don't contain a record.
+			n += i + 1
+			metadata.ReadOffset += uint64(i) + 1
+			continue
 		}
 
-		if len(headers) == 0 {
-			slog.Info("Parsing CSV headers")
-			dec := csv.NewReader(bytes.NewReader(df[metadata.ReadOffset : metadata.ReadOffset+uint64(i)]))
-			headers, err = dec.Read()
-			if err != nil {
-				slog.Error("failed to parse CSV header", "error", err)
-				return fmt.Errorf("failed to parse CSV header: %w", err)
+		fields, err := d.split(line, metadata.Delimiter)
+		if err != nil {
+			slog.Error("failed to parse line", "offset", metadata.ReadOffset, "error", err)
+			return n, fmt.Errorf("failed to parse line at offset %d: %w", metadata.ReadOffset, err)
+		}
+
+		if len(*headers) == 0 {
+			slog.Info("Parsing headers")
+			for _, field := range fields {
+				*headers = append(*headers, string(d.unescape(field.raw)))
 			}
+			n += i + 1
 			metadata.ReadOffset += uint64(i) + 1
 			continue
 		}
 
-		dec := csv.NewReader(bytes.NewReader(df[metadata.ReadOffset : metadata.ReadOffset+uint64(i)]))
-
-		if err := c.handleCSVLine(f, df, dec, headers, []string{}, pointer.MemoryPointer{
+		if err := handleDelimitedLine(f, w, d, fields, *headers, []string{}, pointer.MemoryPointer{
 			Offset: metadata.ReadOffset,
 			Length: uint32(i),
 		}); err != nil {
-			return fmt.Errorf("failed to handle object: %w", err)
+			return n, fmt.Errorf("failed to handle object: %w", err)
 		}
 
+		n += i + 1
 		metadata.ReadOffset += uint64(i) + 1 // include the newline
 	}
+}
 
-	// update the metadata
-	if err := f.SetMetadata(metadata); err != nil {
-		return fmt.Errorf("failed to set metadata: %w", err)
+// csvRecordEnd returns the index of the newline that ends the first record of
+// chunk following RFC 4180 quoting rules, so newlines in quoted fields don't
+// end it. A quote only starts a quoted field at the start of the field, like
+// csv.Reader, which reports other quotes when the record is split.
+func csvRecordEnd(chunk []byte, delimiter byte) int {
+	quoted, start := false, true
+	for i, c := range chunk {
+		switch {
+		case quoted:
+			// an escaped quote closes the field and opens it again.
+			if c == '"' {
+				quoted, start = false, true
+			}
+		case c == '"' && start:
+			quoted = true
+		case c == '\n':
+			return i
+		default:
+			start = c == delimiter
+		}
 	}
+	return -1
+}
 
-	slog.Debug("indexes", slog.Any("", f.Indexes))
-	slog.Debug("Ending CSV synchronization")
-	slog.Debug("=========")
-	return nil
+// splitCSVLine splits a record, which may span several lines if it has quoted
+// fields, following RFC 4180 quoting rules.
+func splitCSVLine(line []byte, delimiter byte) ([]delimitedField, error) {
+	dec := csv.NewReader(bytes.NewReader(line))
+	dec.Comma = rune(delimiter)
+	record, err := dec.Read()
+	if err != nil {
+		return nil, err
+	}
+	// the positions of fields are relative to the line that they start on.
+	starts := []int{0}
+	for i, c := range line {
+		if c == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	fields := make([]delimitedField, len(record))
+	for i := range record {
+		row, column := dec.FieldPos(i)
+		fields[i].offset = starts[row-1] + column - 1
+	}
+	// a field spans up to the delimiter preceding the next field.
+	for i := range fields {
+		end := len(line)
+		if i+1 < len(fields) {
+			end = fields[i+1].offset - 1
+		}
+		fields[i].raw = line[fields[i].offset:end]
+	}
+	return fields, nil
+}
+
+// unescapeCSVField removes the quotes around a quoted field.
+func unescapeCSVField(raw []byte) []byte {
+	if len(raw) < 2 || raw[0] != '"' || raw[len(raw)-1] != '"' {
+		return raw
+	}
+	return bytes.ReplaceAll(raw[1:len(raw)-1], []byte(`""`), []byte(`"`))
+}
+
+// csvFieldOffsets returns the offset in raw of each byte of the value that
+// unescapeCSVField returns.
+func csvFieldOffsets(raw []byte) []int {
+	if len(raw) < 2 || raw[0] != '"' || raw[len(raw)-1] != '"' {
+		return nil
+	}
+	offsets := make([]int, 0, len(raw)-2)
+	for i := 1; i < len(raw)-1; i++ {
+		offsets = append(offsets, i)
+		if raw[i] == '"' && i+1 < len(raw)-1 && raw[i+1] == '"' {
+			i++
+		}
+	}
+	return offsets
 }
 
 func fieldRankCsvField(fieldValue any) int {
@@ -93,7 +316,7 @@ func fieldRankCsvField(fieldValue any) int {
 	case bool:
 		slog.Debug("bool", slog.Any("fieldValue", fieldValue))
 		return 2
-	case int, int8, int16, int32, int64, float32, float64:
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
 		slog.Debug("number", slog.Any("fieldValue", fieldValue))
 		return 3
 	case string:
@@ -109,14 +332,8 @@ func InferCSVField(fieldValue string) (interface{}, appendable.FieldType) {
 		return nil, appendable.FieldTypeNull
 	}
 
-	if i, err := strconv.Atoi(fieldValue); err == nil {
-
-		return float64(i), appendable.FieldTypeFloat64
-	}
-
-	if f, err := strconv.ParseFloat(fieldValue, 64); err == nil {
-
-		return float64(f), appendable.FieldTypeFloat64
+	if n, ft, err := inferNumber(fieldValue); err == nil {
+		return n, ft
 	}
 
 	if b, err := strconv.ParseBool(fieldValue); err == nil {
@@ -127,13 +344,15 @@ func InferCSVField(fieldValue string) (interface{}, appendable.FieldType) {
 }
 
 func (c CSVHandler) Parse(value []byte) []byte {
+	return parseDelimitedField(unescapeCSVField(value))
+}
+
+func parseDelimitedField(value []byte) []byte {
 	parsed, fieldType := InferCSVField(string(value))
 
 	switch fieldType {
-	case appendable.FieldTypeFloat64:
-		buf := make([]byte, 8)
-		binary.BigEndian.PutUint64(buf, math.Float64bits(parsed.(float64)))
-		return buf
+	case appendable.FieldTypeInt64, appendable.FieldTypeUint64, appendable.FieldTypeFloat64:
+		return encodeNumber(parsed)
 	case appendable.FieldTypeBoolean:
 		if parsed.(bool) {
 			return []byte{1}
@@ -150,16 +369,8 @@ func (c CSVHandler) Parse(value []byte) []byte {
 	panic("unknown type")
 }
 
-func (c CSVHandler) handleCSVLine(f *appendable.IndexFile, df []byte, dec *csv.Reader, headers []string, path []string, data pointer.MemoryPointer) error {
-	record, err := dec.Read()
-	if err != nil {
-		slog.Error("Failed to read CSV record at index", "error", err)
-		return fmt.Errorf("failed to read CSV record: %w", err)
-	}
-
-	cumulativeLength := uint64(0)
-
-	for fieldIndex, fieldValue := range record {
+func handleDelimitedLine(f *appendable.IndexFile, w *indexWriter, d delimitedDialect, fields []delimitedField, headers []string, path []string, data pointer.MemoryPointer) error {
+	for fieldIndex, field := range fields {
 		if fieldIndex >= len(headers) {
 			slog.Error("Field index is out of bounds with headers", "fieldIndex", fieldIndex, "headers", slog.Any("headers", headers))
 			return fmt.Errorf("field index %d is out of bounds with header", fieldIndex)
@@ -169,26 +380,44 @@ func (c CSVHandler) handleCSVLine(f *appendable.IndexFile, df []byte, dec *csv.R
 
 		name := strings.Join(append(path, fieldName), ".")
 
-		fieldOffset := data.Offset + cumulativeLength
-		fieldLength := uint32(len(fieldValue))
+		kind, err := indexKind(f, name)
+		if err != nil {
+			return err
+		}
+		if kind == appendable.IndexKindNone {
+			continue
+		}
 
-		_, fieldType := InferCSVField(fieldValue)
-		page, _, err := f.FindOrCreateIndex(name, fieldType)
+		text := d.unescape(field.raw)
+		_, fieldType := InferCSVField(string(text))
+		page, meta, err := f.FindOrCreateIndex(name, fieldType)
 
 		if err != nil {
 			return fmt.Errorf("failed to find or create index: %w", err)
 		}
 
 		mp := pointer.MemoryPointer{
-			Offset: fieldOffset,
-			Length: fieldLength,
+			Offset: data.Offset + uint64(field.offset),
+			Length: uint32(len(field.raw)),
 		}
 
-		if err := page.BPTree(&bptree.BPTree{Data: df, DataParser: CSVHandler{}, Width: uint16(0)}).Insert(pointer.ReferencedValue{Value: c.Parse([]byte(fieldValue)), DataPointer: mp}, data); err != nil {
+		if err := w.insert(page, meta, meta.Width, pointer.ReferencedValue{Value: parseDelimitedField(text), DataPointer: mp}, data); err != nil {
 			return fmt.Errorf("failed to insert into b+tree: %w", err)
 		}
 
-		cumulativeLength += uint64(fieldLength + 1)
+		if kind == appendable.IndexKindNgram && fieldType == appendable.FieldTypeString {
+			for _, ft := range []appendable.FieldType{appendable.FieldTypeUnigram, appendable.FieldTypeBigram, appendable.FieldTypeTrigram} {
+				page, meta, err := f.FindOrCreateIndex(name, ft)
+				if err != nil {
+					return fmt.Errorf("failed to find or create index: %w", err)
+				}
+				// the n-grams point into the raw field, which may be quoted or
+				// escaped.
+				if err := w.insertNgrams(page, meta, meta.Width, string(text), d.offsets(field.raw), mp, data); err != nil {
+					return err
+				}
+			}
+		}
 	}
 
 	return nil
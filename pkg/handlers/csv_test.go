@@ -2,10 +2,10 @@ package handlers
 
 import (
 	"bytes"
-	"encoding/binary"
 	"log/slog"
-	"math"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/kevmo314/appendable/pkg/pointer"
@@ -13,6 +13,7 @@ import (
 	"github.com/kevmo314/appendable/pkg/appendable"
 	"github.com/kevmo314/appendable/pkg/bptree"
 	"github.com/kevmo314/appendable/pkg/buftest"
+	"github.com/kevmo314/appendable/pkg/encoding"
 )
 
 func TestCSV(t *testing.T) {
@@ -190,9 +191,8 @@ func TestCSV(t *testing.T) {
 			t.Errorf("got i.Indexes[0].FieldType = %#v, want FieldTypeString", md1.FieldType)
 		}
 
-		v2 := make([]byte, 8)
-		binary.BigEndian.PutUint64(v2, math.Float64bits(123))
-		rv2, mp2, err := collected[1].BPTree(&bptree.BPTree{Data: r2, DataParser: CSVHandler{}}).Find(pointer.ReferencedValue{Value: v2})
+		v2 := encoding.EncodeInt64(123)
+		rv2, mp2, err := collected[1].BPTree(&bptree.BPTree{Data: r2, DataParser: CSVHandler{}, Width: uint16(9)}).Find(pointer.ReferencedValue{Value: v2})
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -211,8 +211,8 @@ func TestCSV(t *testing.T) {
 		if err := collected[1].UnmarshalMetadata(md2); err != nil {
 			t.Fatal(err)
 		}
-		if md2.FieldType != appendable.FieldTypeFloat64 {
-			t.Errorf("got i.Indexes[1].FieldType = %#v, want FieldTypeFloat64", md2.FieldType)
+		if md2.FieldType != appendable.FieldTypeInt64 {
+			t.Errorf("got i.Indexes[1].FieldType = %#v, want FieldTypeInt64", md2.FieldType)
 		}
 	})
 
@@ -292,10 +292,9 @@ func TestCSV(t *testing.T) {
 			t.Errorf("got len(i.Indexes) = %d, want 1", len(collected))
 		}
 
-		v2 := make([]byte, 8)
-		binary.BigEndian.PutUint64(v2, math.Float64bits(1234))
+		v2 := encoding.EncodeInt64(1234)
 
-		iter, err := collected[0].BPTree(&bptree.BPTree{Data: r2, DataParser: JSONLHandler{}}).Iter(pointer.ReferencedValue{Value: v2})
+		iter, err := collected[0].BPTree(&bptree.BPTree{Data: r2, DataParser: CSVHandler{}, Width: uint16(9)}).Iter(pointer.ReferencedValue{Value: v2})
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -313,4 +312,272 @@ func TestCSV(t *testing.T) {
 		}
 	})
 
+	t.Run("infers integer and float fields", func(t *testing.T) {
+		r := []byte("n\n-3\n18446744073709551615\n1.5\n9007199254740993\n")
+
+		i, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), CSVHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(r); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tc := range []struct {
+			ft    appendable.FieldType
+			value []byte
+			raw   string
+		}{
+			{appendable.FieldTypeInt64, encoding.EncodeInt64(-3), "-3"},
+			{appendable.FieldTypeInt64, encoding.EncodeInt64(1<<53 + 1), "9007199254740993"},
+			{appendable.FieldTypeUint64, encoding.EncodeUint64(1<<64 - 1), "18446744073709551615"},
+			{appendable.FieldTypeFloat64, CSVHandler{}.Parse([]byte("1.5")), "1.5"},
+		} {
+			page, meta, err := i.FindOrCreateIndex("n", tc.ft)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rv, _, err := page.BPTree(&bptree.BPTree{Data: r, DataParser: CSVHandler{}, Width: meta.Width}).Find(pointer.ReferencedValue{Value: tc.value})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(r[rv.DataPointer.Offset : rv.DataPointer.Offset+uint64(rv.DataPointer.Length)]); got != tc.raw {
+				t.Errorf("got %q for %#v, want %q", got, tc.ft, tc.raw)
+			}
+		}
+	})
+
+	t.Run("quoted fields", func(t *testing.T) {
+		r := []byte("name,quote\n\"Doe, Jane\",\"say \"\"hi\"\"\"\nplain,\"\"\n")
+
+		i, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), CSVHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(r); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tc := range []struct {
+			field, value, raw string
+		}{
+			{"name", "Doe, Jane", `"Doe, Jane"`},
+			{"quote", `say "hi"`, `"say ""hi"""`},
+			{"name", "plain", "plain"},
+		} {
+			page, meta, err := i.FindOrCreateIndex(tc.field, appendable.FieldTypeString)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rv, mp, err := page.BPTree(&bptree.BPTree{Data: r, DataParser: CSVHandler{}, Width: meta.Width}).Find(pointer.ReferencedValue{Value: []byte(tc.value)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(rv.Value) != tc.value {
+				t.Fatalf("got %q, want %q", rv.Value, tc.value)
+			}
+			if got := string(r[rv.DataPointer.Offset : rv.DataPointer.Offset+uint64(rv.DataPointer.Length)]); got != tc.raw {
+				t.Fatalf("field points at %q, want %q", got, tc.raw)
+			}
+			if mp == (pointer.MemoryPointer{}) {
+				t.Fatalf("missing record for %q", tc.value)
+			}
+		}
+	})
+
+	t.Run("quoted fields span lines", func(t *testing.T) {
+		r := []byte("name,\"multi\nline\"\n\"Doe,\nJane\",\"say\r\n\"\"hi\"\"\"\nplain,x\n\"open,\n")
+
+		i, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), CSVHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(r); err != nil {
+			t.Fatal(err)
+		}
+
+		// the unterminated record waits for more data.
+		metadata, err := i.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := uint64(bytes.LastIndex(r, []byte("\"open"))); metadata.ReadOffset != want {
+			t.Fatalf("got read offset %d, want %d", metadata.ReadOffset, want)
+		}
+
+		for _, tc := range []struct {
+			field, value, raw, record string
+		}{
+			{"name", "Doe,\nJane", "\"Doe,\nJane\"", "\"Doe,\nJane\",\"say\r\n\"\"hi\"\"\""},
+			{"multi\nline", "say\r\n\"hi\"", "\"say\r\n\"\"hi\"\"\"", "\"Doe,\nJane\",\"say\r\n\"\"hi\"\"\""},
+			{"name", "plain", "plain", "plain,x"},
+		} {
+			page, meta, err := i.FindOrCreateIndex(tc.field, appendable.FieldTypeString)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rv, mp, err := page.BPTree(&bptree.BPTree{Data: r, DataParser: CSVHandler{}, Width: meta.Width}).Find(pointer.ReferencedValue{Value: []byte(tc.value)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(rv.Value) != tc.value {
+				t.Fatalf("got %q, want %q", rv.Value, tc.value)
+			}
+			if got := string(r[rv.DataPointer.Offset : rv.DataPointer.Offset+uint64(rv.DataPointer.Length)]); got != tc.raw {
+				t.Fatalf("field points at %q, want %q", got, tc.raw)
+			}
+			if got := string(r[mp.Offset : mp.Offset+uint64(mp.Length)]); got != tc.record {
+				t.Fatalf("record is %q, want %q", got, tc.record)
+			}
+		}
+	})
+
+	t.Run("n-grams of quoted fields point into the field", func(t *testing.T) {
+		r := []byte("id,text\n1,\"say \"\"Hello\"\" world\"\n")
+
+		i, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), CSVHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.SetIndexSpec(&appendable.IndexSpec{Fields: map[string]appendable.IndexKind{"text": appendable.IndexKindNgram}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(r); err != nil {
+			t.Fatal(err)
+		}
+
+		page, meta, err := i.FindOrCreateIndex("text", appendable.FieldTypeTrigram)
+		if err != nil {
+			t.Fatal(err)
+		}
+		iter, err := page.BPTree(&bptree.BPTree{Data: r, DataParser: CSVHandler{}, Width: meta.Width}).SeekFirst()
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for ; iter.Next(); n++ {
+			key := iter.Key()
+			if got := strings.ToLower(string(r[key.DataPointer.Offset : key.DataPointer.Offset+3])); got != string(key.Value) {
+				t.Errorf("trigram %q points at %q", key.Value, got)
+			}
+		}
+		if err := iter.Err(); err != nil {
+			t.Fatal(err)
+		}
+		// say, hello and world.
+		if n != 7 {
+			t.Fatalf("got %d trigrams, want 7", n)
+		}
+	})
+
+	t.Run("excluded columns keep the headers", func(t *testing.T) {
+		r1 := []byte("a,payload,b\nx,1,hello\n")
+		r2 := []byte("a,payload,b\nx,1,hello\ny,2,world\n")
+
+		i, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), CSVHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.SetIndexSpec(&appendable.IndexSpec{
+			Exclude: []string{"payload"},
+			Fields:  map[string]appendable.IndexKind{"b": appendable.IndexKindNgram},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		for _, data := range [][]byte{r1, r2} {
+			if err := i.Synchronize(data); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		names, err := i.IndexFieldNames()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(names, []string{"a", "b"}) {
+			t.Fatalf("got fields %v, want [a b]", names)
+		}
+		page, meta, err := i.FindOrCreateIndex("b", appendable.FieldTypeString)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, mp, err := page.BPTree(&bptree.BPTree{Data: r2, DataParser: CSVHandler{}, Width: meta.Width}).Find(pointer.ReferencedValue{Value: []byte("world")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mp.Offset != uint64(len("a,payload,b\nx,1,hello\n")) {
+			t.Fatalf("got %+v", mp)
+		}
+		page, meta, err = i.FindOrCreateIndex("b", appendable.FieldTypeTrigram)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, mp, err = page.BPTree(&bptree.BPTree{Data: r2, DataParser: CSVHandler{}, Width: meta.Width}).Find(pointer.ReferencedValue{Value: []byte("wor")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mp == (pointer.MemoryPointer{}) {
+			t.Fatal("expected the trigram to be found")
+		}
+
+		report, err := i.Verify(r2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Problems) > 0 {
+			t.Fatalf("got problems %v", report.Problems)
+		}
+	})
+
+	t.Run("custom delimiter is stored", func(t *testing.T) {
+		r1 := []byte("a;b\nx;1.5\n")
+		r2 := []byte("a;b\nx;1.5\ny;2\n")
+
+		f := buftest.NewSeekableBuffer()
+		i, err := appendable.NewIndexFile(f, CSVHandler{Delimiter: ';'}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(r1); err != nil {
+			t.Fatal(err)
+		}
+
+		// reopen the index without specifying the delimiter.
+		i, err = appendable.NewIndexFile(f, CSVHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(r2); err != nil {
+			t.Fatal(err)
+		}
+		metadata, err := i.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metadata.Delimiter != ';' {
+			t.Fatalf("got delimiter %q, want ';'", metadata.Delimiter)
+		}
+
+		page, meta, err := i.FindOrCreateIndex("a", appendable.FieldTypeString)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, mp, err := page.BPTree(&bptree.BPTree{Data: r2, DataParser: CSVHandler{}, Width: meta.Width}).Find(pointer.ReferencedValue{Value: []byte("y")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mp.Offset != uint64(len("a;b\nx;1.5\n")) || mp.Length != uint32(len("y;2")) {
+			t.Fatalf("got %+v", mp)
+		}
+
+		// a different delimiter is rejected.
+		i, err = appendable.NewIndexFile(f, CSVHandler{Delimiter: '|'}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(r2); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
 }
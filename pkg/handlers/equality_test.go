@@ -2,17 +2,16 @@ package handlers
 
 import (
 	"bytes"
-	"encoding/binary"
 	"fmt"
 	"github.com/kevmo314/appendable/pkg/linkedpage"
 	"github.com/kevmo314/appendable/pkg/pointer"
 	"log/slog"
-	"math"
 	"os"
 	"testing"
 
 	"github.com/kevmo314/appendable/pkg/appendable"
 	"github.com/kevmo314/appendable/pkg/bptree"
+	"github.com/kevmo314/appendable/pkg/encoding"
 )
 
 /*
@@ -217,8 +216,7 @@ func compareMetaPages(i1, i2 []*linkedpage.LinkedPage, jr, cr []byte) (bool, str
 		} else if i == 1 {
 			for _, val := range h2 {
 
-				v2 := make([]byte, 8)
-				binary.BigEndian.PutUint64(v2, math.Float64bits(val))
+				v2 := encoding.EncodeFloat64(val)
 				rv1, mp1, err := collected1.BPTree(&bptree.BPTree{Data: jr, DataParser: JSONLHandler{}}).Find(pointer.ReferencedValue{Value: v2})
 
 				if err != nil {
@@ -2,60 +2,71 @@ package handlers
 
 import (
 	"bytes"
-	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"github.com/kevmo314/appendable/pkg/ngram"
 	"github.com/kevmo314/appendable/pkg/pointer"
+	"io"
 	"log/slog"
-	"math"
 	"strings"
 
 	"github.com/kevmo314/appendable/pkg/appendable"
-	"github.com/kevmo314/appendable/pkg/bptree"
 )
 
 type JSONLHandler struct {
 }
 
-var _ appendable.DataHandler = (*JSONLHandler)(nil)
+var _ appendable.ReaderDataHandler = (*JSONLHandler)(nil)
 
 func (j JSONLHandler) Format() appendable.Format {
 	return appendable.FormatJSONL
 }
 
 func (j JSONLHandler) Synchronize(f *appendable.IndexFile, df []byte) error {
-	// read until the next newline
 	metadata, err := f.Metadata()
 	if err != nil {
 		return fmt.Errorf("failed to read metadata: %w", err)
 	}
+	w := newIndexWriter(df, j)
+	if _, err := j.handleJSONLLines(f, w, metadata, df[metadata.ReadOffset:]); err != nil {
+		return err
+	}
+	return finishSynchronize(f, w, metadata)
+}
+
+func (j JSONLHandler) SynchronizeReader(f *appendable.IndexFile, r io.ReaderAt) error {
+	metadata, err := f.Metadata()
+	if err != nil {
+		return fmt.Errorf("failed to read metadata: %w", err)
+	}
+	w := newReaderIndexWriter(r, j)
+	if err := readChunks(r, metadata.ReadOffset, func(chunk []byte) (int, error) {
+		return j.handleJSONLLines(f, w, metadata, chunk)
+	}); err != nil {
+		return err
+	}
+	return finishSynchronize(f, w, metadata)
+}
+
+// handleJSONLLines indexes the complete lines of chunk, which starts at
+// metadata.ReadOffset in the data file, and returns the number of bytes
+// consumed.
+func (j JSONLHandler) handleJSONLLines(f *appendable.IndexFile, w *indexWriter, metadata *appendable.FileMeta, chunk []byte) (int, error) {
+	n := 0
 	for {
-		i := bytes.IndexByte(df[metadata.ReadOffset:], '\n')
+		// read until the next newline
+		i := bytes.IndexByte(chunk[n:], '\n')
 		if i == -1 {
-			break
-		}
-		// create a new json decoder
-		dec := json.NewDecoder(bytes.NewReader(df[metadata.ReadOffset:(metadata.ReadOffset + uint64(i))]))
-
-		// if the first token is not {, then return an error
-		if t, err := dec.Token(); err != nil || t != json.Delim('{') {
-			return fmt.Errorf("expected '%U', got '%U' (only json objects are supported at the root)", '{', t)
+			return n, nil
 		}
-
-		if err := j.handleJSONLObject(f, df, dec, []string{}, pointer.MemoryPointer{
+		if err := j.handleJSONLRecord(f, w, chunk[n:n+i], pointer.MemoryPointer{
 			Offset: metadata.ReadOffset,
 			Length: uint32(i),
 		}); err != nil {
-			return fmt.Errorf("failed to handle object: %w", err)
-		}
-
-		// the next token must be a }
-		if t, err := dec.Token(); err != nil || t != json.Delim('}') {
-			return fmt.Errorf("expected '}', got '%v'", t)
+			return n, err
 		}
 
-		metadata.ReadOffset += uint64(i) + 1 // include the newline
+		n += i + 1 // include the newline
+		metadata.ReadOffset += uint64(i) + 1
 
 		if f.BenchmarkCallback != nil {
 			f.BenchmarkCallback(int(metadata.ReadOffset))
@@ -63,17 +74,34 @@ func (j JSONLHandler) Synchronize(f *appendable.IndexFile, df []byte) error {
 
 		metadata.Entries++
 	}
+}
+
+// handleJSONLRecord indexes the json object record which is stored at data in
+// the data file.
+func (j JSONLHandler) handleJSONLRecord(f *appendable.IndexFile, w *indexWriter, record []byte, data pointer.MemoryPointer) error {
+	// create a new json decoder
+	dec := json.NewDecoder(bytes.NewReader(record))
+	// numbers are kept as text so integers can be indexed exactly.
+	dec.UseNumber()
+
+	// if the first token is not {, then return an error
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return fmt.Errorf("expected '%U', got '%U' (only json objects are supported at the root)", '{', t)
+	}
 
-	// update the metadata
-	if err := f.SetMetadata(metadata); err != nil {
-		return fmt.Errorf("failed to set metadata: %w", err)
+	if err := j.handleJSONLObject(f, w, dec, []string{}, record, data); err != nil {
+		return fmt.Errorf("failed to handle object: %w", err)
 	}
 
+	// the next token must be a }
+	if t, err := dec.Token(); err != nil || t != json.Delim('}') {
+		return fmt.Errorf("expected '}', got '%v'", t)
+	}
 	return nil
 }
 
 func jsonTypeToFieldType(t json.Token) []appendable.FieldType {
-	switch t.(type) {
+	switch t := t.(type) {
 	case json.Delim:
 		switch t {
 		case json.Delim('{'):
@@ -81,7 +109,11 @@ func jsonTypeToFieldType(t json.Token) []appendable.FieldType {
 		case json.Delim('['):
 			return []appendable.FieldType{appendable.FieldTypeArray}
 		}
-	case json.Number, float64:
+	case json.Number:
+		if _, ft, err := inferNumber(t.String()); err == nil {
+			return []appendable.FieldType{ft}
+		}
+		// invalid numbers are rejected when they are inserted.
 		return []appendable.FieldType{appendable.FieldTypeFloat64}
 	case string:
 		return []appendable.FieldType{appendable.FieldTypeString}
@@ -94,7 +126,9 @@ func jsonTypeToFieldType(t json.Token) []appendable.FieldType {
 }
 
 func (j JSONLHandler) Parse(value []byte) []byte {
-	token, err := json.NewDecoder(bytes.NewReader(value)).Token()
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.UseNumber()
+	token, err := dec.Token()
 	if err != nil {
 		slog.Error("failed to parse token", "err", err)
 		return nil
@@ -102,20 +136,13 @@ func (j JSONLHandler) Parse(value []byte) []byte {
 	switch token := token.(type) {
 	case string:
 		return []byte(token)
-	case json.Number, float64:
-		buf := make([]byte, 8)
-		switch token := token.(type) {
-		case json.Number:
-			f, err := token.Float64()
-			if err != nil {
-				slog.Error("failed to parse float", "err", err)
-				return nil
-			}
-			binary.BigEndian.PutUint64(buf, math.Float64bits(f))
-		case float64:
-			binary.BigEndian.PutUint64(buf, math.Float64bits(token))
+	case json.Number:
+		number, _, err := inferNumber(token.String())
+		if err != nil {
+			slog.Error("failed to parse number", "err", err)
+			return nil
 		}
-		return buf
+		return encodeNumber(number)
 	case bool:
 		if token {
 			return []byte{1}
@@ -129,7 +156,7 @@ func (j JSONLHandler) Parse(value []byte) []byte {
 	panic(fmt.Sprintf("unexpected token '%v'", token))
 }
 
-func (j JSONLHandler) handleJSONLObject(f *appendable.IndexFile, r []byte, dec *json.Decoder, path []string, data pointer.MemoryPointer) error {
+func (j JSONLHandler) handleJSONLObject(f *appendable.IndexFile, w *indexWriter, dec *json.Decoder, path []string, record []byte, data pointer.MemoryPointer) error {
 	// while the next token is not }, read the key
 	for dec.More() {
 		key, err := dec.Token()
@@ -150,160 +177,32 @@ func (j JSONLHandler) handleJSONLObject(f *appendable.IndexFile, r []byte, dec *
 
 			name := strings.Join(append(path, key), ".")
 
-			fts := jsonTypeToFieldType(value)
-			if f.IsSearch(name) {
-				fts = append(fts, appendable.FieldTypeUnigram, appendable.FieldTypeBigram, appendable.FieldTypeTrigram)
+			mp := pointer.MemoryPointer{
+				Offset: data.Offset + uint64(fieldOffset),
+				Length: uint32(dec.InputOffset() - fieldOffset),
 			}
 
-			for _, ft := range fts {
-				page, meta, err := f.FindOrCreateIndex(name, ft)
-				if err != nil {
-					return fmt.Errorf("failed to find or create index: %w", err)
-				}
-				width := meta.Width
-				mp := pointer.MemoryPointer{
-					Offset: data.Offset + uint64(fieldOffset),
-					Length: uint32(dec.InputOffset() - fieldOffset),
+			switch value {
+			case json.Delim('['):
+				if err := createContainerIndex(f, name, appendable.FieldTypeArray); err != nil {
+					return err
 				}
-
-				switch ft {
-				case appendable.FieldTypeString:
-					valueStr, ok := value.(string)
-					if !ok {
-						return fmt.Errorf("expected string")
-					}
-					valueBytes := []byte(valueStr)
-
-					if err := page.BPTree(&bptree.BPTree{Data: r, DataParser: j, Width: width}).Insert(pointer.ReferencedValue{
-						DataPointer: mp,
-						Value:       valueBytes,
-					}, data); err != nil {
-						return fmt.Errorf("failed to insert into b+tree: %w", err)
-					}
-
-					meta.TotalFieldValueLength += uint64(mp.Length)
-				case appendable.FieldTypeUnigram, appendable.FieldTypeBigram, appendable.FieldTypeTrigram:
-					valueStr, ok := value.(string)
-					if !ok {
-						return fmt.Errorf("expected string")
-					}
-					trigrams := ngram.BuildNgram(valueStr, int(width-1))
-
-					for _, tri := range trigrams {
-						valueBytes := []byte(tri.Word)
-
-						if err := page.BPTree(&bptree.BPTree{Data: r, DataParser: j, Width: width}).Insert(pointer.ReferencedValue{
-							DataPointer: pointer.MemoryPointer{
-								Offset: mp.Offset + tri.Offset,
-								Length: uint32(len(valueStr)), // this is a degenerate case - for ngrams, we store the entire length of the valueStr. This is to help us with the ranking heuristic.
-							},
-							Value: valueBytes,
-						}, data); err != nil {
-							return fmt.Errorf("failed to insert into b+tree: %w", err)
-						}
-
-						meta.TotalFieldValueLength += uint64(tri.Length)
-					}
-				case appendable.FieldTypeNull:
-					// nil values are a bit of a degenerate case, we are essentially using the bptree
-					// as a set. we store the value as an empty byte slice.
-					if err := page.BPTree(&bptree.BPTree{Data: r, DataParser: j, Width: width}).Insert(pointer.ReferencedValue{
-						Value:       []byte{},
-						DataPointer: mp,
-					}, data); err != nil {
-						return fmt.Errorf("failed to insert into b+tree: %w\nmp: %v", err, data.Offset)
-					}
-				case appendable.FieldTypeFloat64, appendable.FieldTypeUint64, appendable.FieldTypeInt64:
-					buf := make([]byte, 8)
-					switch value := value.(type) {
-					case json.Number:
-						f, err := value.Float64()
-						if err != nil {
-							return fmt.Errorf("failed to parse float: %w", err)
-						}
-						binary.BigEndian.PutUint64(buf, math.Float64bits(f))
-					case float64:
-						binary.BigEndian.PutUint64(buf, math.Float64bits(value))
-					}
-
-					if err := page.BPTree(&bptree.BPTree{Data: r, DataParser: j, Width: width}).Insert(pointer.ReferencedValue{
-						DataPointer: mp,
-						Value:       buf,
-					},
-						data); err != nil {
-						return fmt.Errorf("failed to insert into b+tree: %w", err)
-					}
-
-					meta.TotalFieldValueLength += uint64(mp.Length)
-
-				case appendable.FieldTypeBoolean:
-					valueBool, ok := value.(bool)
-					if !ok {
-						return fmt.Errorf("expected bool type")
-					}
-					if valueBool {
-						if err := page.BPTree(&bptree.BPTree{Data: r, DataParser: j, Width: width}).Insert(pointer.ReferencedValue{
-							DataPointer: mp,
-							Value:       []byte{1},
-						}, data); err != nil {
-							return fmt.Errorf("failed to insert into b+tree: %w", err)
-						}
-					} else {
-						if err := page.BPTree(&bptree.BPTree{Data: r, DataParser: j, Width: width}).Insert(pointer.ReferencedValue{
-							DataPointer: mp,
-							Value:       []byte{0},
-						}, data); err != nil {
-							return fmt.Errorf("failed to insert into b+tree: %w", err)
-						}
-					}
-					meta.TotalFieldValueLength += uint64(1)
-				case appendable.FieldTypeArray, appendable.FieldTypeObject:
-					switch value := value.(type) {
-					case json.Token:
-						switch value {
-						case json.Delim('['):
-							// arrays are not indexed yet because we need to incorporate
-							// subindexing into the specification. however, we have to
-							// skip tokens until we reach the end of the array.
-							depth := 1
-							for {
-								t, err := dec.Token()
-								if err != nil {
-									return fmt.Errorf("failed to read token: %w", err)
-								}
-
-								switch t {
-								case json.Delim('['):
-									depth++
-								case json.Delim(']'):
-									depth--
-								}
-
-								if depth == 0 {
-									break
-								}
-							}
-						case json.Delim('{'):
-							// find the index to set the field type to unknown.
-							if err := j.handleJSONLObject(f, r, dec, append(path, key), data); err != nil {
-								return fmt.Errorf("failed to handle object: %w", err)
-							}
-							// read the }
-							if t, err := dec.Token(); err != nil || t != json.Delim('}') {
-								return fmt.Errorf("expected '}', got '%v'", t)
-							}
-						}
-					}
-
-				default:
-					return fmt.Errorf("unrecognized type: %T: %v", ft, ft)
+				if err := j.handleJSONLArray(f, w, dec, append(path, key), record, data); err != nil {
+					return fmt.Errorf("failed to handle array: %w", err)
 				}
-
-				buf, err := meta.MarshalBinary()
-				if err != nil {
+			case json.Delim('{'):
+				if err := createContainerIndex(f, name, appendable.FieldTypeObject); err != nil {
 					return err
 				}
-				if err := page.SetMetadata(buf); err != nil {
+				if err := j.handleJSONLObject(f, w, dec, append(path, key), record, data); err != nil {
+					return fmt.Errorf("failed to handle object: %w", err)
+				}
+				// read the }
+				if t, err := dec.Token(); err != nil || t != json.Delim('}') {
+					return fmt.Errorf("expected '}', got '%v'", t)
+				}
+			default:
+				if err := j.handleJSONLValue(f, w, name, value, mp, data); err != nil {
 					return err
 				}
 			}
@@ -312,3 +211,185 @@ func (j JSONLHandler) handleJSONLObject(f *appendable.IndexFile, r []byte, dec *
 
 	return nil
 }
+
+// handleJSONLArray indexes each element of an array as if it were the value
+// of the field itself, so an array is a multi-valued field. Objects within the
+// array are indexed under the array's path and nested arrays are flattened.
+func (j JSONLHandler) handleJSONLArray(f *appendable.IndexFile, w *indexWriter, dec *json.Decoder, path []string, record []byte, data pointer.MemoryPointer) error {
+	name := strings.Join(path, ".")
+
+	for dec.More() {
+		start := dec.InputOffset()
+		value, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("failed to read token: %w", err)
+		}
+		end := dec.InputOffset()
+		// the input offset precedes the separator and any whitespace.
+		for start < end && (record[start] == ',' || isJSONSpace(record[start])) {
+			start++
+		}
+
+		switch value {
+		case json.Delim('['):
+			if err := j.handleJSONLArray(f, w, dec, path, record, data); err != nil {
+				return err
+			}
+		case json.Delim('{'):
+			if err := j.handleJSONLObject(f, w, dec, path, record, data); err != nil {
+				return fmt.Errorf("failed to handle object: %w", err)
+			}
+			// read the }
+			if t, err := dec.Token(); err != nil || t != json.Delim('}') {
+				return fmt.Errorf("expected '}', got '%v'", t)
+			}
+		default:
+			if err := j.handleJSONLValue(f, w, name, value, pointer.MemoryPointer{
+				Offset: data.Offset + uint64(start),
+				Length: uint32(end - start),
+			}, data); err != nil {
+				return err
+			}
+		}
+	}
+
+	// read the ]
+	if t, err := dec.Token(); err != nil || t != json.Delim(']') {
+		return fmt.Errorf("expected ']', got '%v'", t)
+	}
+	return nil
+}
+
+// createContainerIndex creates the index that records that the field named
+// name was seen as an object or an array, unless the field isn't indexed. The
+// fields within are indexed regardless.
+func createContainerIndex(f *appendable.IndexFile, name string, ft appendable.FieldType) error {
+	kind, err := indexKind(f, name)
+	if err != nil {
+		return err
+	}
+	if kind == appendable.IndexKindNone {
+		return nil
+	}
+	if _, _, err := f.FindOrCreateIndex(name, ft); err != nil {
+		return fmt.Errorf("failed to find or create index: %w", err)
+	}
+	return nil
+}
+
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// handleJSONLValue indexes a scalar value located at mp in the data file.
+func (j JSONLHandler) handleJSONLValue(f *appendable.IndexFile, w *indexWriter, name string, value json.Token, mp, data pointer.MemoryPointer) error {
+	kind, err := indexKind(f, name)
+	if err != nil {
+		return err
+	}
+	if kind == appendable.IndexKindNone {
+		return nil
+	}
+	fts := jsonTypeToFieldType(value)
+	if _, ok := value.(string); ok && kind == appendable.IndexKindNgram {
+		fts = append(fts, appendable.FieldTypeUnigram, appendable.FieldTypeBigram, appendable.FieldTypeTrigram)
+	}
+
+	for _, ft := range fts {
+		page, meta, err := f.FindOrCreateIndex(name, ft)
+		if err != nil {
+			return fmt.Errorf("failed to find or create index: %w", err)
+		}
+		width := meta.Width
+
+		switch ft {
+		case appendable.FieldTypeString:
+			valueStr, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("expected string")
+			}
+			valueBytes := []byte(valueStr)
+
+			if err := w.insert(page, meta, width, pointer.ReferencedValue{
+				DataPointer: mp,
+				Value:       valueBytes,
+			}, data); err != nil {
+				return fmt.Errorf("failed to insert into b+tree: %w", err)
+			}
+
+			meta.TotalFieldValueLength += uint64(mp.Length)
+		case appendable.FieldTypeUnigram, appendable.FieldTypeBigram, appendable.FieldTypeTrigram:
+			valueStr, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("expected string")
+			}
+			if err := w.insertNgrams(page, meta, width, valueStr, nil, mp, data); err != nil {
+				return err
+			}
+		case appendable.FieldTypeNull:
+			// nil values are a bit of a degenerate case, we are essentially using the bptree
+			// as a set. we store the value as an empty byte slice.
+			if err := w.insert(page, meta, width, pointer.ReferencedValue{
+				Value:       []byte{},
+				DataPointer: mp,
+			}, data); err != nil {
+				return fmt.Errorf("failed to insert into b+tree: %w\nmp: %v", err, data.Offset)
+			}
+		case appendable.FieldTypeFloat64, appendable.FieldTypeUint64, appendable.FieldTypeInt64:
+			valueNumber, ok := value.(json.Number)
+			if !ok {
+				return fmt.Errorf("expected number")
+			}
+			number, _, err := inferNumber(valueNumber.String())
+			if err != nil {
+				return fmt.Errorf("failed to parse number: %w", err)
+			}
+			buf := encodeNumber(number)
+
+			if err := w.insert(page, meta, width, pointer.ReferencedValue{
+				DataPointer: mp,
+				Value:       buf,
+			},
+				data); err != nil {
+				return fmt.Errorf("failed to insert into b+tree: %w", err)
+			}
+
+			meta.TotalFieldValueLength += uint64(mp.Length)
+
+		case appendable.FieldTypeBoolean:
+			valueBool, ok := value.(bool)
+			if !ok {
+				return fmt.Errorf("expected bool type")
+			}
+			if valueBool {
+				if err := w.insert(page, meta, width, pointer.ReferencedValue{
+					DataPointer: mp,
+					Value:       []byte{1},
+				}, data); err != nil {
+					return fmt.Errorf("failed to insert into b+tree: %w", err)
+				}
+			} else {
+				if err := w.insert(page, meta, width, pointer.ReferencedValue{
+					DataPointer: mp,
+					Value:       []byte{0},
+				}, data); err != nil {
+					return fmt.Errorf("failed to insert into b+tree: %w", err)
+				}
+			}
+			meta.TotalFieldValueLength += uint64(1)
+
+		default:
+			return fmt.Errorf("unrecognized type: %T: %v", ft, ft)
+		}
+
+		buf, err := meta.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if err := page.SetMetadata(buf); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -2,17 +2,23 @@ package handlers
 
 import (
 	"bytes"
-	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
 	"math"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/kevmo314/appendable/pkg/linkedpage"
 	"github.com/kevmo314/appendable/pkg/ngram"
+	"github.com/kevmo314/appendable/pkg/pagefile"
 	"github.com/kevmo314/appendable/pkg/pointer"
 
 	"github.com/kevmo314/appendable/pkg/appendable"
 	"github.com/kevmo314/appendable/pkg/bptree"
 	"github.com/kevmo314/appendable/pkg/buftest"
+	"github.com/kevmo314/appendable/pkg/encoding"
 )
 
 func TestJSONL(t *testing.T) {
@@ -275,8 +281,7 @@ func TestJSONL(t *testing.T) {
 			t.Errorf("got i.Indexes[0].FieldType = %#v, want FieldTypeString", md1.FieldType)
 		}
 
-		v2 := make([]byte, 8)
-		binary.BigEndian.PutUint64(v2, math.Float64bits(123))
+		v2 := encoding.EncodeInt64(123)
 		rv2, mp2, err := collected[1].BPTree(&bptree.BPTree{Data: r2, DataParser: JSONLHandler{}, Width: uint16(9)}).Find(pointer.ReferencedValue{Value: v2})
 		if err != nil {
 			t.Fatal(err)
@@ -297,8 +302,8 @@ func TestJSONL(t *testing.T) {
 		if err := collected[1].UnmarshalMetadata(md2); err != nil {
 			t.Fatal(err)
 		}
-		if md2.FieldType != appendable.FieldTypeFloat64 {
-			t.Errorf("got i.Indexes[1].FieldType = %#v, want FieldTypeFloat64", md2.FieldType)
+		if md2.FieldType != appendable.FieldTypeInt64 {
+			t.Errorf("got i.Indexes[1].FieldType = %#v, want FieldTypeInt64", md2.FieldType)
 		}
 	})
 
@@ -357,8 +362,8 @@ func TestJSONL(t *testing.T) {
 			t.Errorf("got i.Indexes[1].FieldType = %#v, want FieldTypeObject", md1.FieldType)
 		}
 
-		if md2.FieldType != appendable.FieldTypeFloat64 {
-			t.Errorf("got i.Indexes[2].FieldType = %#v, want FieldTypeFloat64", md2.FieldType)
+		if md2.FieldType != appendable.FieldTypeInt64 {
+			t.Errorf("got i.Indexes[2].FieldType = %#v, want FieldTypeInt64", md2.FieldType)
 		}
 
 		if md3.FieldType != appendable.FieldTypeString {
@@ -438,8 +443,8 @@ func TestJSONL(t *testing.T) {
 			t.Errorf("got i.Indexes[1].FieldType = %#v, want FieldTypeObject", md1.FieldType)
 		}
 
-		if md2.FieldType != appendable.FieldTypeFloat64 {
-			t.Errorf("got i.Indexes[2].FieldType = %#v, want FieldTypeFloat64", md2.FieldType)
+		if md2.FieldType != appendable.FieldTypeInt64 {
+			t.Errorf("got i.Indexes[2].FieldType = %#v, want FieldTypeInt64", md2.FieldType)
 		}
 
 		if md3.FieldType != appendable.FieldTypeString {
@@ -486,8 +491,8 @@ func TestJSONL(t *testing.T) {
 		}
 
 		// check that the index file now has the additional data ranges but same number of indices
-		if len(collected) != 5 {
-			t.Errorf("got len(i.Indexes) = %d, want 5", len(collected))
+		if len(collected) != 6 {
+			t.Errorf("got len(i.Indexes) = %d, want 6", len(collected))
 		}
 
 		var vanillaIndexes []*linkedpage.LinkedPage
@@ -532,6 +537,74 @@ func TestJSONL(t *testing.T) {
 		if md1.FieldName != "test2" {
 			t.Errorf("got i.Indexes[1].FieldName = %s, want \"test2\"", md1.FieldName)
 		}
+
+		// the array elements are indexed under the array's name.
+		md2 := &appendable.IndexMeta{}
+		if err := vanillaIndexes[2].UnmarshalMetadata(md2); err != nil {
+			t.Fatal(err)
+		}
+
+		if md2.FieldName != "test2" || md2.FieldType != appendable.FieldTypeInt64 {
+			t.Errorf("got i.Indexes[2] = %s %#v, want test2 FieldTypeInt64", md2.FieldName, md2.FieldType)
+		}
+	})
+
+	t.Run("indexes array elements", func(t *testing.T) {
+		f := buftest.NewSeekableBuffer()
+		i, err := appendable.NewIndexFile(f, JSONLHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := []byte("{\"tags\":[\"a\", \"b\"],\"items\":[{\"sku\":\"x1\",\"qty\":1},{\"sku\":\"x2\",\"qty\":[2, [3]]}]}\n{\"tags\":[\"b\",null,true]}\n")
+		if err := i.Synchronize(r); err != nil {
+			t.Fatal(err)
+		}
+		second := pointer.MemoryPointer{Offset: uint64(bytes.IndexByte(r, '\n') + 1)}
+
+		// collect returns the raw keys and the records they point to.
+		collect := func(name string, ft appendable.FieldType) ([]string, []uint64) {
+			page, meta, err := i.FindOrCreateIndex(name, ft)
+			if err != nil {
+				t.Fatal(err)
+			}
+			iter, err := page.BPTree(&bptree.BPTree{Data: r, DataParser: JSONLHandler{}, Width: meta.Width}).SeekFirst()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var keys []string
+			var records []uint64
+			for iter.Next() {
+				dp := iter.Key().DataPointer
+				keys = append(keys, string(r[dp.Offset:dp.Offset+uint64(dp.Length)]))
+				records = append(records, iter.Pointer().Offset)
+			}
+			if err := iter.Err(); err != nil {
+				t.Fatal(err)
+			}
+			return keys, records
+		}
+
+		keys, records := collect("tags", appendable.FieldTypeString)
+		if !reflect.DeepEqual(keys, []string{`"a"`, `"b"`, `"b"`}) {
+			t.Errorf("got tags %v", keys)
+		}
+		if !reflect.DeepEqual(records, []uint64{0, 0, second.Offset}) {
+			t.Errorf("got tag records %v", records)
+		}
+
+		if keys, _ := collect("tags", appendable.FieldTypeNull); !reflect.DeepEqual(keys, []string{"null"}) {
+			t.Errorf("got null tags %v", keys)
+		}
+		if keys, _ := collect("tags", appendable.FieldTypeBoolean); !reflect.DeepEqual(keys, []string{"true"}) {
+			t.Errorf("got boolean tags %v", keys)
+		}
+		if keys, _ := collect("items.sku", appendable.FieldTypeString); !reflect.DeepEqual(keys, []string{`"x1"`, `"x2"`}) {
+			t.Errorf("got skus %v", keys)
+		}
+		if keys, _ := collect("items.qty", appendable.FieldTypeInt64); !reflect.DeepEqual(keys, []string{"1", "2", "3"}) {
+			t.Errorf("got quantities %v", keys)
+		}
 	})
 
 	t.Run("existing index but nullable type", func(t *testing.T) {
@@ -688,6 +761,54 @@ func TestJSONL(t *testing.T) {
 		}
 	})
 
+	t.Run("indexes integers exactly", func(t *testing.T) {
+		i, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), JSONLHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := []byte("{\"id\":9007199254740993}\n{\"id\":18446744073709551615}\n{\"id\":-5}\n{\"id\":1.5}\n{\"id\":1e3}\n{\"id\":9007199254740992}\n")
+		if err := i.Synchronize(r); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tc := range []struct {
+			ft   appendable.FieldType
+			keys [][]byte
+		}{
+			{appendable.FieldTypeInt64, [][]byte{encoding.EncodeInt64(-5), encoding.EncodeInt64(1 << 53), encoding.EncodeInt64(1<<53 + 1)}},
+			{appendable.FieldTypeUint64, [][]byte{encoding.EncodeUint64(math.MaxUint64)}},
+			{appendable.FieldTypeFloat64, [][]byte{encoding.EncodeFloat64(1.5), encoding.EncodeFloat64(1000)}},
+		} {
+			page, meta, err := i.FindOrCreateIndex("id", tc.ft)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if meta.Width != 9 {
+				t.Errorf("got width %d for %#v, want 9", meta.Width, tc.ft)
+			}
+			iter, err := page.BPTree(&bptree.BPTree{Data: r, DataParser: JSONLHandler{}, Width: meta.Width}).SeekFirst()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var keys [][]byte
+			for iter.Next() {
+				keys = append(keys, iter.Key().Value)
+				// the key must match what the data handler parses from the data file.
+				dp := iter.Key().DataPointer
+				if parsed := (JSONLHandler{}).Parse(r[dp.Offset : dp.Offset+uint64(dp.Length)]); !bytes.Equal(parsed, iter.Key().Value) {
+					t.Errorf("parsed %v, indexed %v", parsed, iter.Key().Value)
+				}
+			}
+			if err := iter.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(keys, tc.keys) {
+				t.Errorf("got keys %v for %#v, want %v", keys, tc.ft, tc.keys)
+			}
+		}
+	})
+
 	t.Run("correctly iterates through bptree", func(t *testing.T) {
 		f := buftest.NewSeekableBuffer()
 
@@ -716,8 +837,7 @@ func TestJSONL(t *testing.T) {
 			t.Errorf("got len(i.Indexes) = %d, want 1", len(collected))
 		}
 
-		v2 := make([]byte, 8)
-		binary.BigEndian.PutUint64(v2, math.Float64bits(1234))
+		v2 := encoding.EncodeInt64(1234)
 
 		iter, err := collected[0].BPTree(&bptree.BPTree{Data: r2, DataParser: JSONLHandler{}, Width: uint16(9)}).Iter(pointer.ReferencedValue{Value: v2})
 		if err != nil {
@@ -895,4 +1015,487 @@ func TestJSONL(t *testing.T) {
 		}
 	})
 
+	t.Run("bulk loaded first sync matches incremental sync", func(t *testing.T) {
+		var lines []string
+		for i := 0; i < 2000; i++ {
+			lines = append(lines, fmt.Sprintf("{\"id\":\"id%d\",\"value\":%d}\n", (i*7919)%2000, i%37))
+		}
+		data := []byte(strings.Join(lines, ""))
+
+		// bulk is synchronized in one go so its indexes are bulk loaded,
+		// incremental is synchronized line by line so every key is inserted.
+		bulk, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), JSONLHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bulk.Synchronize(data); err != nil {
+			t.Fatal(err)
+		}
+		incremental, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), JSONLHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for _, line := range lines {
+			n += len(line)
+			if err := incremental.Synchronize(data[:n]); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		collect := func(i *appendable.IndexFile) [][]pointer.MemoryPointer {
+			indexes, err := i.Indexes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			pages, err := indexes.Collect()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out [][]pointer.MemoryPointer
+			for _, page := range pages {
+				meta := &appendable.IndexMeta{}
+				if err := page.UnmarshalMetadata(meta); err != nil {
+					t.Fatal(err)
+				}
+				iter, err := page.BPTree(&bptree.BPTree{Data: data, DataParser: JSONLHandler{}, Width: meta.Width}).Iter(pointer.ReferencedValue{Value: []byte{}})
+				if err != nil {
+					t.Fatal(err)
+				}
+				var mps []pointer.MemoryPointer
+				for iter.Next() {
+					mps = append(mps, iter.Pointer())
+				}
+				if err := iter.Err(); err != nil {
+					t.Fatal(err)
+				}
+				out = append(out, mps)
+			}
+			return out
+		}
+
+		got, want := collect(bulk), collect(incremental)
+		if len(got) != 2 || len(got[0]) != 2000 || len(got[1]) != 2000 {
+			t.Fatalf("expected two indexes with 2000 keys, got %d", len(got))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("bulk loaded indexes differ from incrementally built indexes")
+		}
+	})
+
+	t.Run("a crash during synchronization keeps a consistent read offset", func(t *testing.T) {
+		var data []byte
+		for j := 0; j < 200; j++ {
+			data = append(data, fmt.Sprintf("{\"n\":%d,\"s\":\"%x\"}\n", j, j*j)...)
+		}
+		first := bytes.IndexByte(data[len(data)/2:], '\n') + len(data)/2 + 1
+
+		base := buftest.NewSeekableBuffer()
+		i, err := appendable.NewIndexFile(base, JSONLHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(data[:first]); err != nil {
+			t.Fatal(err)
+		}
+
+		for writes := 0; ; writes++ {
+			f := buftest.NewSeekableBuffer()
+			if _, err := f.Write(base.Bytes()); err != nil {
+				t.Fatal(err)
+			}
+			i, err := appendable.NewIndexFile(&buftest.CrashingBuffer{SeekableBuffer: f, Writes: writes}, JSONLHandler{}, []string{})
+			if err == nil {
+				err = i.Synchronize(data)
+			}
+			if err != nil && !errors.Is(err, buftest.ErrCrashed) {
+				t.Fatal(err)
+			}
+
+			i, rerr := appendable.NewIndexFile(f, JSONLHandler{}, []string{})
+			if rerr != nil {
+				t.Fatalf("after %d writes: %v", writes, rerr)
+			}
+			metadata, rerr := i.Metadata()
+			if rerr != nil {
+				t.Fatal(rerr)
+			}
+			if metadata.ReadOffset != uint64(first) && metadata.ReadOffset != uint64(len(data)) {
+				t.Fatalf("after %d writes got ReadOffset = %d", writes, metadata.ReadOffset)
+			}
+
+			// every indexed record can be found.
+			page, meta, rerr := i.FindOrCreateIndex("n", appendable.FieldTypeInt64)
+			if rerr != nil {
+				t.Fatal(rerr)
+			}
+			iter, rerr := page.BPTree(&bptree.BPTree{Data: data, DataParser: JSONLHandler{}, Width: meta.Width}).SeekFirst()
+			if rerr != nil {
+				t.Fatal(rerr)
+			}
+			count := uint64(0)
+			for iter.Next() {
+				if encoding.DecodeInt64(iter.Key().Value) != int64(count) {
+					t.Fatalf("after %d writes got key %d at %d", writes, encoding.DecodeInt64(iter.Key().Value), count)
+				}
+				count++
+			}
+			if rerr := iter.Err(); rerr != nil {
+				t.Fatal(rerr)
+			}
+			if count != metadata.Entries {
+				t.Fatalf("after %d writes got %d keys, want %d", writes, count, metadata.Entries)
+			}
+
+			if err == nil {
+				return
+			}
+		}
+	})
+
+	t.Run("a corrupt index page is reported", func(t *testing.T) {
+		var data []byte
+		for j := 0; j < 200; j++ {
+			data = append(data, fmt.Sprintf("{\"n\":%d}\n", j)...)
+		}
+		f := buftest.NewSeekableBuffer()
+		i, err := appendable.NewIndexFile(f, JSONLHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(data); err != nil {
+			t.Fatal(err)
+		}
+		page, _, err := i.FindOrCreateIndex("n", appendable.FieldTypeInt64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, err := page.Root()
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Bytes()[root.Offset+2] ^= 0x01
+
+		i, err = appendable.NewIndexFile(f, JSONLHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, meta, err := i.FindOrCreateIndex("n", appendable.FieldTypeInt64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = page.BPTree(&bptree.BPTree{Data: data, DataParser: JSONLHandler{}, Width: meta.Width}).Find(pointer.ReferencedValue{Value: encoding.EncodeInt64(100)})
+		var corrupt *pagefile.CorruptPageError
+		if !errors.As(err, &corrupt) || corrupt.Offset != int64(root.Offset) {
+			t.Fatalf("got %v, want a corrupt page at %d", err, root.Offset)
+		}
+	})
+	t.Run("a failed synchronization leaves no cached nodes", func(t *testing.T) {
+		var data []byte
+		for j := 0; j < 200; j++ {
+			data = append(data, fmt.Sprintf("{\"n\":%d}\n", j)...)
+		}
+		f := buftest.NewSeekableBuffer()
+		i, err := appendable.NewIndexFile(f, JSONLHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(data[:len(data)/2]); err != nil {
+			t.Fatal(err)
+		}
+		metadata, err := i.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the records before the invalid one are inserted, then rolled back.
+		invalid := append(data[:len(data):len(data)], "{\"n\":}\n"...)
+		if err := i.Synchronize(invalid); err == nil {
+			t.Fatal("expected an error")
+		}
+
+		page, meta, err := i.FindOrCreateIndex("n", appendable.FieldTypeInt64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		iter, err := page.BPTree(&bptree.BPTree{Data: invalid, DataParser: JSONLHandler{}, Width: meta.Width}).SeekFirst()
+		if err != nil {
+			t.Fatal(err)
+		}
+		count := uint64(0)
+		for iter.Next() {
+			count++
+		}
+		if err := iter.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if count != metadata.Entries {
+			t.Fatalf("got %d keys, want %d", count, metadata.Entries)
+		}
+	})
+
+	t.Run("snapshots can be queried while synchronizing", func(t *testing.T) {
+		var data []byte
+		for j := 0; j < 2000; j++ {
+			data = append(data, fmt.Sprintf("{\"n\":%d}\n", j)...)
+		}
+		i, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), JSONLHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(data[:100]); err != nil {
+			t.Fatal(err)
+		}
+
+		// query checks that the indexes of a snapshot match its metadata.
+		query := func() error {
+			s, err := i.Snapshot()
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+			metadata, err := s.Metadata()
+			if err != nil {
+				return err
+			}
+			page, meta, err := s.FindOrCreateIndex("n", appendable.FieldTypeInt64)
+			if err != nil {
+				return err
+			}
+			iter, err := page.BPTree(&bptree.BPTree{Data: data, DataParser: JSONLHandler{}, Width: meta.Width}).SeekFirst()
+			if err != nil {
+				return err
+			}
+			count := uint64(0)
+			for iter.Next() {
+				if iter.Pointer().Offset >= metadata.ReadOffset {
+					return fmt.Errorf("got a record at %d after the read offset %d", iter.Pointer().Offset, metadata.ReadOffset)
+				}
+				count++
+			}
+			if err := iter.Err(); err != nil {
+				return err
+			}
+			if count != metadata.Entries {
+				return fmt.Errorf("got %d keys, want %d", count, metadata.Entries)
+			}
+			return nil
+		}
+
+		done := make(chan struct{})
+		errs := make(chan error, 1)
+		go func() {
+			defer close(errs)
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if err := query(); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+		for end := 200; end <= len(data); end += 100 {
+			// synchronize whole records.
+			end := bytes.LastIndexByte(data[:end], '\n') + 1
+			if err := i.Synchronize(data[:end]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		close(done)
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("index spec selects the fields and how they're indexed", func(t *testing.T) {
+		f := buftest.NewSeekableBuffer()
+		i, err := appendable.NewIndexFile(f, JSONLHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.SetIndexSpec(&appendable.IndexSpec{
+			Include: []string{"id", "user.*"},
+			Exclude: []string{"user.password"},
+			Fields:  map[string]appendable.IndexKind{"user.bio": appendable.IndexKindNgram},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		data := []byte("{\"id\":1,\"payload\":{\"a\":[1,2]},\"user\":{\"name\":\"x\",\"password\":\"y\",\"bio\":\"hello\"}}\n")
+		// the spec is stored, so it's followed after reopening the index file.
+		i, err = appendable.NewIndexFile(f, JSONLHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(data); err != nil {
+			t.Fatal(err)
+		}
+
+		indexes, err := i.Indexes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		collected, err := indexes.Collect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, page := range collected {
+			meta := &appendable.IndexMeta{}
+			if err := page.UnmarshalMetadata(meta); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, fmt.Sprintf("%s:%d", meta.FieldName, meta.FieldType))
+		}
+		want := []string{
+			fmt.Sprintf("id:%d", appendable.FieldTypeInt64),
+			fmt.Sprintf("user.name:%d", appendable.FieldTypeString),
+			fmt.Sprintf("user.bio:%d", appendable.FieldTypeString),
+			fmt.Sprintf("user.bio:%d", appendable.FieldTypeUnigram),
+			fmt.Sprintf("user.bio:%d", appendable.FieldTypeBigram),
+			fmt.Sprintf("user.bio:%d", appendable.FieldTypeTrigram),
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("got indexes %v, want %v", got, want)
+		}
+
+		report, err := i.Verify(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Problems) > 0 {
+			t.Fatalf("got problems %v", report.Problems)
+		}
+	})
+
+	t.Run("vector fields are rejected", func(t *testing.T) {
+		i, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), JSONLHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.SetIndexSpec(&appendable.IndexSpec{Fields: map[string]appendable.IndexKind{"v": appendable.IndexKindVector}}); !errors.Is(err, ErrUnsupportedIndexKind) {
+			t.Fatalf("got %v, want ErrUnsupportedIndexKind", err)
+		}
+		if i.IndexSpec() != nil {
+			t.Fatalf("got spec %v, want none", i.IndexSpec())
+		}
+		if _, err := appendable.ParseIndexSpec([]byte(`{"fields": {"v": "vector"}}`)); !errors.Is(err, ErrUnsupportedIndexKind) {
+			t.Fatalf("got %v, want ErrUnsupportedIndexKind", err)
+		}
+	})
+
+	t.Run("synchronizing increments the generation", func(t *testing.T) {
+		f := buftest.NewSeekableBuffer()
+		i, err := appendable.NewIndexFile(f, JSONLHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var data []byte
+		for j := uint64(1); j <= 3; j++ {
+			data = append(data, "{\"n\":1}\n"...)
+			if err := i.Synchronize(data); err != nil {
+				t.Fatal(err)
+			}
+			metadata, err := i.Metadata()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if metadata.Generation != j {
+				t.Fatalf("got generation %d, want %d", metadata.Generation, j)
+			}
+		}
+		// synchronizing without new records doesn't commit anything.
+		committed := append([]byte(nil), f.Bytes()...)
+		if err := i.Synchronize(append(data, "{\"n\":"...)); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(f.Bytes(), committed) {
+			t.Fatal("synchronizing without new records changed the index file")
+		}
+		if err := i.Synchronize(append(data, "{\"n\":}\n"...)); err == nil {
+			t.Fatal("expected an error")
+		}
+		metadata, err := i.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metadata.Generation != 3 {
+			t.Fatalf("got generation %d, want 3", metadata.Generation)
+		}
+	})
+
+	t.Run("consistent reads are retried when the index file is synchronized", func(t *testing.T) {
+		data := []byte("{\"n\":1}\n{\"n\":2}\n")
+		f := buftest.NewSeekableBuffer()
+		i, err := appendable.NewIndexFile(f, JSONLHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(data[:8]); err != nil {
+			t.Fatal(err)
+		}
+
+		calls := 0
+		var metadata *appendable.FileMeta
+		err = appendable.ReadConsistent(f, JSONLHandler{}, func(r *appendable.IndexFile) error {
+			calls++
+			if calls == 1 {
+				// another process synchronizes the index file.
+				if err := i.Synchronize(data); err != nil {
+					return err
+				}
+			}
+			var err error
+			metadata, err = r.Metadata()
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if calls != 2 {
+			t.Fatalf("got %d calls, want 2", calls)
+		}
+		if metadata.ReadOffset != uint64(len(data)) || metadata.Generation != 2 {
+			t.Fatalf("got %+v, want the second generation", metadata)
+		}
+	})
+
+	t.Run("consistent readers fail once the index file is synchronized", func(t *testing.T) {
+		data := []byte("{\"n\":1}\n{\"n\":2}\n")
+		f := buftest.NewSeekableBuffer()
+		i, err := appendable.NewIndexFile(f, JSONLHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(data[:8]); err != nil {
+			t.Fatal(err)
+		}
+
+		var r *appendable.ConsistentReader
+		if err := appendable.ReadConsistent(f, JSONLHandler{}, func(j *appendable.IndexFile) error {
+			var err error
+			r, err = appendable.NewConsistentReader(f, j)
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		want := append([]byte(nil), f.Bytes()...)
+		got := make([]byte, 16)
+		if _, err := io.ReadFull(r, got); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want[:16]) {
+			t.Fatalf("got %x, want %x", got, want[:16])
+		}
+
+		if err := i.Synchronize(data); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Read(got); !errors.Is(err, appendable.ErrIndexFileChanged) {
+			t.Fatalf("got %v, want ErrIndexFileChanged", err)
+		}
+	})
 }
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+	"github.com/kevmo314/appendable/pkg/encoding"
+)
+
+// inferNumber parses a decimal number into the narrowest field type that
+// represents it exactly. Integers are int64 if they fit and uint64 otherwise,
+// everything else is float64.
+func inferNumber(s string) (interface{}, appendable.FieldType, error) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, appendable.FieldTypeInt64, nil
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return u, appendable.FieldTypeUint64, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, 0, err
+	}
+	return f, appendable.FieldTypeFloat64, nil
+}
+
+// encodeNumber encodes a number returned by inferNumber as a B+ tree key.
+func encodeNumber(value interface{}) []byte {
+	switch value := value.(type) {
+	case int64:
+		return encoding.EncodeInt64(value)
+	case uint64:
+		return encoding.EncodeUint64(value)
+	case float64:
+		return encoding.EncodeFloat64(value)
+	}
+	panic(fmt.Sprintf("unexpected number %v", value))
+}
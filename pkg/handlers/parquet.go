@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+	"github.com/kevmo314/appendable/pkg/bptree"
+	"github.com/kevmo314/appendable/pkg/linkedpage"
+	"github.com/kevmo314/appendable/pkg/ngram"
+	"github.com/kevmo314/appendable/pkg/parquet"
+	"github.com/kevmo314/appendable/pkg/pointer"
+)
+
+// ParquetHandler indexes the columns of a parquet file.
+//
+// Parquet files are appended to by writing new row groups over the footer and
+// then writing a new footer, so the ReadOffset in the file metadata is the
+// number of row groups indexed so far.
+//
+// A record is a row of a row group, so the MemoryPointer of a record is
+// MemoryPointer{Offset: row group, Length: row} with the row counted from the
+// start of the row group.
+//
+// Values are decoded from their column chunks and stored in the index, so
+// compressed and dictionary encoded chunks are indexed too. Column chunks that
+// can't be read, for example because their compression codec isn't
+// supported, are skipped with a warning instead of failing the
+// synchronization.
+type ParquetHandler struct {
+}
+
+var _ appendable.DataHandler = (*ParquetHandler)(nil)
+
+func (p ParquetHandler) Format() appendable.Format {
+	return appendable.FormatParquet
+}
+
+func (p ParquetHandler) Synchronize(f *appendable.IndexFile, df []byte) error {
+	metadata, err := f.Metadata()
+	if err != nil {
+		return fmt.Errorf("failed to read metadata: %w", err)
+	}
+
+	pf, err := parquet.Open(df)
+	if errors.Is(err, parquet.ErrIncomplete) {
+		// the footer hasn't been written yet, so there is nothing to index.
+		slog.Debug("parquet file is incomplete, skipping synchronization")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open parquet file: %w", err)
+	}
+
+	rowGroups := pf.RowGroups()
+	if metadata.ReadOffset > uint64(len(rowGroups)) {
+		return fmt.Errorf("index contains %d row groups but the data file only has %d", metadata.ReadOffset, len(rowGroups))
+	}
+
+	w := newIndexWriter(df, p)
+	for rg := int(metadata.ReadOffset); rg < len(rowGroups); rg++ {
+		for c, column := range pf.Columns() {
+			name := strings.Join(column.Path, ".")
+			if column.MaxRepetitionLevel > 0 || column.Type == parquet.TypeInt96 {
+				slog.Debug("skipping unsupported parquet column", "column", name)
+				continue
+			}
+			values, err := pf.ReadColumn(rg, c)
+			if err != nil {
+				slog.Warn("skipping parquet column chunk that can't be read", "column", name, "row_group", rg, "error", err)
+				continue
+			}
+			if err := p.handleParquetColumn(f, w, name, column, uint64(rg), metadata.Entries, values); err != nil {
+				return fmt.Errorf("failed to handle column %s in row group %d: %w", name, rg, err)
+			}
+		}
+
+		metadata.ReadOffset++
+		metadata.Entries += uint64(rowGroups[rg].NumRows)
+
+		if f.BenchmarkCallback != nil {
+			f.BenchmarkCallback(int(metadata.ReadOffset))
+		}
+	}
+
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	// update the metadata
+	if err := f.SetMetadata(metadata); err != nil {
+		return fmt.Errorf("failed to set metadata: %w", err)
+	}
+
+	return nil
+}
+
+// Parse decodes a string key of an index created before parquet strings
+// were stored in the index. Those keys point at the bytes of a plain encoded
+// value in an uncompressed column chunk, which are the value itself.
+func (p ParquetHandler) Parse(value []byte) []byte {
+	return value
+}
+
+func parquetTypeToFieldType(t parquet.Type) appendable.FieldType {
+	switch t {
+	case parquet.TypeBoolean:
+		return appendable.FieldTypeBoolean
+	case parquet.TypeInt32, parquet.TypeInt64:
+		return appendable.FieldTypeInt64
+	case parquet.TypeFloat, parquet.TypeDouble:
+		return appendable.FieldTypeFloat64
+	}
+	return appendable.FieldTypeString
+}
+
+type parquetIndex struct {
+	page *linkedpage.LinkedPage
+	meta *appendable.IndexMeta
+}
+
+// handleParquetColumn indexes the values of a column chunk of rowGroup, whose
+// first row is the firstRow-th row of the file.
+func (p ParquetHandler) handleParquetColumn(f *appendable.IndexFile, w *indexWriter, name string, column parquet.Column, rowGroup, firstRow uint64, values []parquet.Value) error {
+	// the indexes are looked up once per column chunk instead of once per value.
+	indexes := make(map[appendable.FieldType]*parquetIndex)
+	index := func(ft appendable.FieldType) (*parquetIndex, error) {
+		if idx, ok := indexes[ft]; ok {
+			return idx, nil
+		}
+		page, meta, err := f.FindOrCreateIndex(name, ft)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find or create index: %w", err)
+		}
+		indexes[ft] = &parquetIndex{page: page, meta: meta}
+		return indexes[ft], nil
+	}
+
+	ft := parquetTypeToFieldType(column.Type)
+	fts := []appendable.FieldType{ft}
+	if ft == appendable.FieldTypeString && f.IsSearch(name) {
+		fts = append(fts, appendable.FieldTypeUnigram, appendable.FieldTypeBigram, appendable.FieldTypeTrigram)
+	}
+
+	// legacy counts the values that an index created before strings were
+	// stored can't resolve, large counts the values too large to store.
+	legacy, large := 0, 0
+	for row, value := range values {
+		data := pointer.MemoryPointer{Offset: rowGroup, Length: uint32(row)}
+
+		if value.Null {
+			idx, err := index(appendable.FieldTypeNull)
+			if err != nil {
+				return err
+			}
+			// nil values are stored as an empty byte slice, see the jsonl handler.
+			if err := w.insert(idx.page, idx.meta, idx.meta.Width, pointer.ReferencedValue{
+				Value:       []byte{},
+				DataPointer: data,
+			}, data); err != nil {
+				return fmt.Errorf("failed to insert into b+tree: %w", err)
+			}
+			continue
+		}
+
+		if ft == appendable.FieldTypeString && len(value.Bytes) > bptree.MaxStoredKeySize(f.PageSize()) {
+			large++
+			continue
+		}
+
+		for _, ft := range fts {
+			idx, err := index(ft)
+			if err != nil {
+				return err
+			}
+			width := idx.meta.Width
+
+			switch ft {
+			case appendable.FieldTypeString:
+				key := pointer.ReferencedValue{DataPointer: data, Value: value.Bytes}
+				if width == 0 {
+					if value.Offset < 0 {
+						// the value isn't stored verbatim in the data file.
+						legacy++
+						continue
+					}
+					key.DataPointer = pointer.MemoryPointer{Offset: uint64(value.Offset), Length: uint32(len(value.Bytes))}
+				}
+				if err := w.insert(idx.page, idx.meta, width, key, data); err != nil {
+					return fmt.Errorf("failed to insert into b+tree: %w", err)
+				}
+				idx.meta.TotalFieldValueLength += uint64(len(value.Bytes))
+			case appendable.FieldTypeUnigram, appendable.FieldTypeBigram, appendable.FieldTypeTrigram:
+				// n-grams only need a distinct offset per occurrence, values
+				// that aren't stored verbatim use their position in the rows
+				// of the file.
+				base := (firstRow + uint64(row)) << 32
+				if value.Offset >= 0 {
+					base = uint64(value.Offset)
+				}
+				for _, tri := range ngram.BuildNgram(string(value.Bytes), int(width-1)) {
+					if err := w.insert(idx.page, idx.meta, width, pointer.ReferencedValue{
+						DataPointer: pointer.MemoryPointer{
+							Offset: base + tri.Offset,
+							Length: uint32(len(value.Bytes)), // the entire length of the value is stored for ranking, see the jsonl handler.
+						},
+						Value: []byte(tri.Word),
+					}, data); err != nil {
+						return fmt.Errorf("failed to insert into b+tree: %w", err)
+					}
+					idx.meta.TotalFieldValueLength += uint64(tri.Length)
+				}
+			case appendable.FieldTypeInt64, appendable.FieldTypeFloat64:
+				buf := encodeNumber(value.Float64)
+				if ft == appendable.FieldTypeInt64 {
+					buf = encodeNumber(value.Int64)
+				}
+				if err := w.insert(idx.page, idx.meta, width, pointer.ReferencedValue{
+					DataPointer: data,
+					Value:       buf,
+				}, data); err != nil {
+					return fmt.Errorf("failed to insert into b+tree: %w", err)
+				}
+				idx.meta.TotalFieldValueLength += uint64(len(buf))
+			case appendable.FieldTypeBoolean:
+				buf := []byte{0}
+				if value.Boolean {
+					buf = []byte{1}
+				}
+				if err := w.insert(idx.page, idx.meta, width, pointer.ReferencedValue{
+					DataPointer: data,
+					Value:       buf,
+				}, data); err != nil {
+					return fmt.Errorf("failed to insert into b+tree: %w", err)
+				}
+				idx.meta.TotalFieldValueLength += uint64(1)
+			}
+		}
+	}
+	if legacy > 0 {
+		slog.Warn("string values in compressed or dictionary encoded column chunks can't be added to an index created by an older version, compact the index to rebuild it", "column", name, "row_group", rowGroup, "values", legacy)
+	}
+	if large > 0 {
+		slog.Warn("string values larger than the index can store are not indexed", "column", name, "row_group", rowGroup, "values", large, "limit", bptree.MaxStoredKeySize(f.PageSize()))
+	}
+
+	for _, idx := range indexes {
+		buf, err := idx.meta.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if err := idx.page.SetMetadata(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
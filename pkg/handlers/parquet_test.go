@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+	"github.com/kevmo314/appendable/pkg/bptree"
+	"github.com/kevmo314/appendable/pkg/buftest"
+	"github.com/kevmo314/appendable/pkg/encoding"
+	"github.com/kevmo314/appendable/pkg/parquet"
+	"github.com/kevmo314/appendable/pkg/pointer"
+)
+
+func TestParquet(t *testing.T) {
+	fields := []parquet.Field{
+		{Name: "name", Type: parquet.TypeByteArray},
+		{Name: "count", Type: parquet.TypeInt64},
+		{Name: "score", Type: parquet.TypeDouble, Optional: true},
+		{Name: "ok", Type: parquet.TypeBoolean},
+	}
+	row := func(i int) []any {
+		var score any
+		if i%4 != 0 {
+			score = float64(i) / 2
+		}
+		return []any{fmt.Sprintf("name %d", i), int64(i), score, i%2 == 0}
+	}
+	rowGroup := func(w *parquet.Writer, start, n int) {
+		var rows [][]any
+		for i := start; i < start+n; i++ {
+			rows = append(rows, row(i))
+		}
+		if err := w.WriteRowGroup(rows); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// count returns the number of keys in the index.
+	count := func(t *testing.T, i *appendable.IndexFile, df []byte, name string, ft appendable.FieldType) int {
+		page, meta, err := i.FindOrCreateIndex(name, ft)
+		if err != nil {
+			t.Fatal(err)
+		}
+		iter, err := page.BPTree(&bptree.BPTree{Data: df, DataParser: ParquetHandler{}, Width: meta.Width}).SeekFirst()
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for iter.Next() {
+			n++
+		}
+		if err := iter.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	t.Run("indexes appended row groups", func(t *testing.T) {
+		w := parquet.NewWriter(fields, parquet.CodecUncompressed)
+		rowGroup(w, 0, 100)
+		r1 := w.Bytes()
+		rowGroup(w, 100, 50)
+		r2 := w.Bytes()
+
+		i, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), ParquetHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(r1); err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(r2); err != nil {
+			t.Fatal(err)
+		}
+
+		metadata, err := i.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metadata.ReadOffset != 2 || metadata.Entries != 150 {
+			t.Fatalf("got ReadOffset = %d, Entries = %d, want 2, 150", metadata.ReadOffset, metadata.Entries)
+		}
+
+		page, meta, err := i.FindOrCreateIndex("name", appendable.FieldTypeString)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree := page.BPTree(&bptree.BPTree{Data: r2, DataParser: ParquetHandler{}, Width: meta.Width})
+		rv, mp, err := tree.Find(pointer.ReferencedValue{Value: []byte("name 120")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(rv.Value) != "name 120" {
+			t.Fatalf("got %q, want %q", rv.Value, "name 120")
+		}
+		if mp != (pointer.MemoryPointer{Offset: 1, Length: 20}) {
+			t.Fatalf("got %+v, want row 20 of row group 1", mp)
+		}
+
+		page, meta, err = i.FindOrCreateIndex("count", appendable.FieldTypeInt64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree = page.BPTree(&bptree.BPTree{Data: r2, DataParser: ParquetHandler{}, Width: meta.Width})
+		_, mp, err = tree.Find(pointer.ReferencedValue{Value: encoding.EncodeInt64(42)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mp != (pointer.MemoryPointer{Offset: 0, Length: 42}) {
+			t.Fatalf("got %+v, want row 42 of row group 0", mp)
+		}
+
+		page, meta, err = i.FindOrCreateIndex("score", appendable.FieldTypeFloat64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree = page.BPTree(&bptree.BPTree{Data: r2, DataParser: ParquetHandler{}, Width: meta.Width})
+		_, mp, err = tree.Find(pointer.ReferencedValue{Value: encoding.EncodeFloat64(21)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mp != (pointer.MemoryPointer{Offset: 0, Length: 42}) {
+			t.Fatalf("got %+v, want row 42 of row group 0", mp)
+		}
+
+		if n := count(t, i, r2, "score", appendable.FieldTypeNull); n != 38 {
+			t.Fatalf("got %d null scores, want 38", n)
+		}
+		if n := count(t, i, r2, "score", appendable.FieldTypeFloat64); n != 112 {
+			t.Fatalf("got %d scores, want 112", n)
+		}
+		if n := count(t, i, r2, "ok", appendable.FieldTypeBoolean); n != 150 {
+			t.Fatalf("got %d booleans, want 150", n)
+		}
+	})
+
+	t.Run("incomplete file is not indexed", func(t *testing.T) {
+		w := parquet.NewWriter(fields, parquet.CodecUncompressed)
+		rowGroup(w, 0, 10)
+		df := w.Bytes()
+
+		i, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), ParquetHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(df[:len(df)-4]); err != nil {
+			t.Fatal(err)
+		}
+		metadata, err := i.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metadata.ReadOffset != 0 || metadata.Entries != 0 {
+			t.Fatalf("got ReadOffset = %d, Entries = %d, want 0, 0", metadata.ReadOffset, metadata.Entries)
+		}
+	})
+
+	t.Run("compressed strings are indexed", func(t *testing.T) {
+		w := parquet.NewWriter(fields, parquet.CodecSnappy)
+		rowGroup(w, 0, 100)
+		df := w.Bytes()
+
+		i, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), ParquetHandler{}, []string{"name"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(df); err != nil {
+			t.Fatal(err)
+		}
+		if n := count(t, i, df, "name", appendable.FieldTypeString); n != 100 {
+			t.Fatalf("got %d names, want 100", n)
+		}
+		if n := count(t, i, df, "name", appendable.FieldTypeTrigram); n == 0 {
+			t.Fatal("got no trigrams")
+		}
+		if n := count(t, i, df, "count", appendable.FieldTypeInt64); n != 100 {
+			t.Fatalf("got %d counts, want 100", n)
+		}
+
+		// the keys are stored in the index instead of pointing into the data file.
+		page, meta, err := i.FindOrCreateIndex("name", appendable.FieldTypeString)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree := page.BPTree(&bptree.BPTree{DataParser: ParquetHandler{}, Width: meta.Width})
+		rv, mp, err := tree.Find(pointer.ReferencedValue{Value: []byte("name 42")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(rv.Value) != "name 42" || mp != (pointer.MemoryPointer{Offset: 0, Length: 42}) {
+			t.Fatalf("got %q at %+v, want row 42 of row group 0", rv.Value, mp)
+		}
+
+		report, err := i.Verify(df)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Problems) > 0 {
+			t.Fatalf("got problems %v", report.Problems)
+		}
+	})
+
+	t.Run("unreadable column chunks are skipped", func(t *testing.T) {
+		w := parquet.NewWriter(fields, parquet.CodecUncompressed)
+		rowGroup(w, 0, 100)
+		df := w.Bytes()
+
+		// corrupt the page header of the name column.
+		pf, err := parquet.Open(df)
+		if err != nil {
+			t.Fatal(err)
+		}
+		offset := pf.RowGroups()[0].Columns[0].DataPageOffset
+		for j := offset; j < offset+8; j++ {
+			df[j] = 0xff
+		}
+		if _, err := pf.ReadColumn(0, 0); err == nil {
+			t.Fatal("expected the name column to be unreadable")
+		}
+
+		i, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), ParquetHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(df); err != nil {
+			t.Fatal(err)
+		}
+		if n := count(t, i, df, "name", appendable.FieldTypeString); n != 0 {
+			t.Fatalf("got %d names, want 0", n)
+		}
+		if n := count(t, i, df, "count", appendable.FieldTypeInt64); n != 100 {
+			t.Fatalf("got %d counts, want 100", n)
+		}
+	})
+}
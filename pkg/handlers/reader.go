@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// readerBufferSize is the initial size of the buffer that data is read into
+// by SynchronizeReader.
+const readerBufferSize = 1 << 20
+
+// readChunks reads r from offset and calls consume with each chunk that was
+// read. consume returns how many bytes at the start of the chunk it used, and
+// the rest, typically a partial record, is read again as the start of the
+// next chunk. The buffer is only grown if consume can't use any of a full
+// buffer, so it is bounded by the larger of readerBufferSize and the longest
+// record.
+//
+// readChunks returns once the end of r is reached.
+func readChunks(r io.ReaderAt, offset uint64, consume func(chunk []byte) (int, error)) error {
+	buf := make([]byte, readerBufferSize)
+	for {
+		n, err := r.ReadAt(buf, int64(offset))
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read data at offset %d: %w", offset, err)
+		}
+		// a short read is always accompanied by an error.
+		eof := n < len(buf)
+
+		used, cerr := consume(buf[:n])
+		if cerr != nil {
+			return cerr
+		}
+		offset += uint64(used)
+
+		if eof {
+			return nil
+		}
+		if used == 0 {
+			buf = make([]byte, 2*len(buf))
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+	"github.com/kevmo314/appendable/pkg/bptree"
+	"github.com/kevmo314/appendable/pkg/buftest"
+	"github.com/kevmo314/appendable/pkg/pointer"
+)
+
+func TestSynchronizeReader(t *testing.T) {
+	// a record longer than the read buffer forces the buffer to grow.
+	long := strings.Repeat("x", readerBufferSize+100)
+
+	var jsonl, csv, tsv, recordio bytes.Buffer
+	csv.WriteString("name,n\n")
+	tsv.WriteString("name\tn\n")
+	for j := 0; j < 5000; j++ {
+		name := fmt.Sprintf("record%d", j)
+		if j == 2500 {
+			name = long
+		}
+		fmt.Fprintf(&jsonl, "{\"name\":%q,\"n\":%d}\n", name, j)
+		fmt.Fprintf(&csv, "%s,%d\n", name, j)
+		fmt.Fprintf(&tsv, "%s\t%d\n", name, j)
+		record := fmt.Sprintf("{\"name\":%q,\"n\":%d}", name, j)
+		recordio.Write(binary.AppendUvarint(nil, uint64(len(record))))
+		recordio.WriteString(record)
+	}
+	// a partial trailing record must be left for the next synchronization.
+	jsonl.WriteString("{\"name\":\"partial\"")
+	csv.WriteString("partial,")
+	tsv.WriteString("partial\t")
+	recordio.Write([]byte{0x10, '{'})
+
+	for _, tc := range []struct {
+		name    string
+		handler appendable.ReaderDataHandler
+		data    []byte
+	}{
+		{"jsonl", JSONLHandler{}, jsonl.Bytes()},
+		{"csv", CSVHandler{}, csv.Bytes()},
+		{"tsv", TSVHandler{}, tsv.Bytes()},
+		{"recordio", RecordIOHandler{}, recordio.Bytes()},
+	} {
+		t.Run(tc.name+" matches Synchronize", func(t *testing.T) {
+			f1 := buftest.NewSeekableBuffer()
+			i1, err := appendable.NewIndexFile(f1, tc.handler, []string{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := i1.Synchronize(tc.data); err != nil {
+				t.Fatal(err)
+			}
+
+			f2 := buftest.NewSeekableBuffer()
+			i2, err := appendable.NewIndexFile(f2, tc.handler, []string{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := i2.SynchronizeReader(bytes.NewReader(tc.data)); err != nil {
+				t.Fatal(err)
+			}
+
+			m1, err := i1.Metadata()
+			if err != nil {
+				t.Fatal(err)
+			}
+			m2, err := i2.Metadata()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *m1 != *m2 {
+				t.Fatalf("got metadata %+v, want %+v", m2, m1)
+			}
+			if !bytes.Equal(f1.Bytes(), f2.Bytes()) {
+				t.Fatal("index files differ")
+			}
+
+			page, meta, err := i2.FindOrCreateIndex("name", appendable.FieldTypeString)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree := page.BPTree(&bptree.BPTree{DataReader: bytes.NewReader(tc.data), DataParser: tc.handler, Width: meta.Width})
+			rv, _, err := tree.Find(pointer.ReferencedValue{Value: []byte(long)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(rv.Value) != long {
+				t.Fatalf("got a %d byte key, want %d bytes", len(rv.Value), len(long))
+			}
+		})
+	}
+
+	t.Run("continues from the read offset", func(t *testing.T) {
+		data := jsonl.Bytes()
+		cut := bytes.IndexByte(data, '\n') + 1
+
+		i, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), JSONLHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.SynchronizeReader(bytes.NewReader(data[:cut+5])); err != nil {
+			t.Fatal(err)
+		}
+		if err := i.SynchronizeReader(bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		metadata, err := i.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metadata.ReadOffset != uint64(bytes.LastIndexByte(data, '\n')+1) || metadata.Entries != 5000 {
+			t.Fatalf("got ReadOffset = %d, Entries = %d", metadata.ReadOffset, metadata.Entries)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+	"github.com/kevmo314/appendable/pkg/pointer"
+)
+
+// RecordIOHandler handles streams of length-prefixed records. Each record is
+// framed as a uvarint length followed by that many bytes of payload, so
+// payloads may contain newlines, unlike JSONL.
+//
+// Payloads are json objects and are indexed the same way as JSONL records.
+// The MemoryPointer of a record points at its payload, excluding the length
+// prefix.
+type RecordIOHandler struct {
+	JSONLHandler
+}
+
+var _ appendable.ReaderDataHandler = (*RecordIOHandler)(nil)
+
+func (r RecordIOHandler) Format() appendable.Format {
+	return appendable.FormatRecordIO
+}
+
+func (r RecordIOHandler) Synchronize(f *appendable.IndexFile, df []byte) error {
+	metadata, err := f.Metadata()
+	if err != nil {
+		return fmt.Errorf("failed to read metadata: %w", err)
+	}
+	w := newIndexWriter(df, r)
+	if _, err := r.handleRecordIOFrames(f, w, metadata, df[metadata.ReadOffset:]); err != nil {
+		return err
+	}
+	return finishSynchronize(f, w, metadata)
+}
+
+func (r RecordIOHandler) SynchronizeReader(f *appendable.IndexFile, rd io.ReaderAt) error {
+	metadata, err := f.Metadata()
+	if err != nil {
+		return fmt.Errorf("failed to read metadata: %w", err)
+	}
+	w := newReaderIndexWriter(rd, r)
+	if err := readChunks(rd, metadata.ReadOffset, func(chunk []byte) (int, error) {
+		return r.handleRecordIOFrames(f, w, metadata, chunk)
+	}); err != nil {
+		return err
+	}
+	return finishSynchronize(f, w, metadata)
+}
+
+// handleRecordIOFrames indexes the complete records of chunk, which starts at
+// metadata.ReadOffset in the data file, and returns the number of bytes
+// consumed.
+func (r RecordIOHandler) handleRecordIOFrames(f *appendable.IndexFile, w *indexWriter, metadata *appendable.FileMeta, chunk []byte) (int, error) {
+	n := 0
+	for n < len(chunk) {
+		length, m := binary.Uvarint(chunk[n:])
+		if m == 0 {
+			// the length prefix is still being written.
+			break
+		}
+		if m < 0 || length > math.MaxUint32 {
+			return n, fmt.Errorf("invalid record length at offset %d", metadata.ReadOffset)
+		}
+		start := n + m
+		if uint64(start)+length > uint64(len(chunk)) {
+			// the payload is still being written.
+			break
+		}
+		end := start + int(length)
+
+		if err := r.handleJSONLRecord(f, w, chunk[start:end], pointer.MemoryPointer{
+			Offset: metadata.ReadOffset + uint64(m),
+			Length: uint32(length),
+		}); err != nil {
+			return n, fmt.Errorf("failed to handle record at offset %d: %w", metadata.ReadOffset, err)
+		}
+
+		n = end
+		metadata.ReadOffset += uint64(m) + length
+
+		if f.BenchmarkCallback != nil {
+			f.BenchmarkCallback(int(metadata.ReadOffset))
+		}
+
+		metadata.Entries++
+	}
+	return n, nil
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+	"github.com/kevmo314/appendable/pkg/bptree"
+	"github.com/kevmo314/appendable/pkg/buftest"
+	"github.com/kevmo314/appendable/pkg/pointer"
+)
+
+func TestRecordIO(t *testing.T) {
+	frame := func(records ...string) []byte {
+		var buf []byte
+		for _, r := range records {
+			buf = binary.AppendUvarint(buf, uint64(len(r)))
+			buf = append(buf, r...)
+		}
+		return buf
+	}
+
+	t.Run("indexes payloads with newlines", func(t *testing.T) {
+		r1 := frame("{\"test\":\n\"test1\"}", "{\n\"test\": \"test2\"\n}")
+
+		i, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), RecordIOHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(r1); err != nil {
+			t.Fatal(err)
+		}
+
+		metadata, err := i.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metadata.ReadOffset != uint64(len(r1)) || metadata.Entries != 2 {
+			t.Fatalf("got ReadOffset = %d, Entries = %d, want %d, 2", metadata.ReadOffset, metadata.Entries, len(r1))
+		}
+
+		page, meta, err := i.FindOrCreateIndex("test", appendable.FieldTypeString)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rv, mp, err := page.BPTree(&bptree.BPTree{Data: r1, DataParser: RecordIOHandler{}, Width: meta.Width}).Find(pointer.ReferencedValue{Value: []byte("test2")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(rv.Value) != "test2" {
+			t.Fatalf("got %q, want test2", rv.Value)
+		}
+		// the record points at the payload without the length prefix.
+		if got := string(r1[mp.Offset : mp.Offset+uint64(mp.Length)]); got != "{\n\"test\": \"test2\"\n}" {
+			t.Fatalf("record points at %q", got)
+		}
+	})
+
+	t.Run("waits for partial frames", func(t *testing.T) {
+		r2 := frame("{\"a\":1}", "{\"a\":2}", "{\"a\":3}")
+		first := len(frame("{\"a\":1}"))
+
+		i, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), RecordIOHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// cut in the middle of the second payload.
+		if err := i.Synchronize(r2[:first+3]); err != nil {
+			t.Fatal(err)
+		}
+		metadata, err := i.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metadata.ReadOffset != uint64(first) || metadata.Entries != 1 {
+			t.Fatalf("got ReadOffset = %d, Entries = %d, want %d, 1", metadata.ReadOffset, metadata.Entries, first)
+		}
+
+		if err := i.Synchronize(r2); err != nil {
+			t.Fatal(err)
+		}
+		metadata, err = i.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metadata.ReadOffset != uint64(len(r2)) || metadata.Entries != 3 {
+			t.Fatalf("got ReadOffset = %d, Entries = %d, want %d, 3", metadata.ReadOffset, metadata.Entries, len(r2))
+		}
+	})
+
+	t.Run("rejects non-object payloads", func(t *testing.T) {
+		i, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), RecordIOHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(frame("[1,2]")); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
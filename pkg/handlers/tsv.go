@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+)
+
+// TSVHandler handles tab separated values.
+//
+// Unlike CSV, fields are never quoted. Instead, tabs, newlines, carriage
+// returns and backslashes within a field are escaped as \t, \n, \r and \\
+// respectively.
+type TSVHandler struct {
+	// Delimiter separates the fields of a new index and defaults to a tab.
+	// The delimiter is stored in the index file, so it only needs to be set
+	// when creating an index.
+	Delimiter byte
+}
+
+var _ appendable.ReaderDataHandler = (*TSVHandler)(nil)
+
+func (t TSVHandler) Format() appendable.Format {
+	return appendable.FormatTSV
+}
+
+func (t TSVHandler) Synchronize(f *appendable.IndexFile, df []byte) error {
+	slog.Debug("Starting TSV synchronization")
+	return synchronizeDelimited(f, df, t, t.dialect())
+}
+
+func (t TSVHandler) SynchronizeReader(f *appendable.IndexFile, r io.ReaderAt) error {
+	slog.Debug("Starting TSV synchronization")
+	return synchronizeDelimitedReader(f, r, t, t.dialect())
+}
+
+func (t TSVHandler) dialect() delimitedDialect {
+	return delimitedDialect{
+		delimiter:        t.Delimiter,
+		defaultDelimiter: '\t',
+		recordEnd:        tsvRecordEnd,
+		split:            splitTSVLine,
+		unescape:         unescapeTSVField,
+		offsets:          tsvFieldOffsets,
+	}
+}
+
+func (t TSVHandler) Parse(value []byte) []byte {
+	return parseDelimitedField(unescapeTSVField(value))
+}
+
+// tsvRecordEnd returns the index of the newline that ends the first record of
+// chunk. Newlines in fields are escaped, so every newline ends a record.
+func tsvRecordEnd(chunk []byte, _ byte) int {
+	return bytes.IndexByte(chunk, '\n')
+}
+
+func splitTSVLine(line []byte, delimiter byte) ([]delimitedField, error) {
+	var fields []delimitedField
+	offset := 0
+	for {
+		i := bytes.IndexByte(line[offset:], delimiter)
+		if i == -1 {
+			return append(fields, delimitedField{raw: line[offset:], offset: offset}), nil
+		}
+		fields = append(fields, delimitedField{raw: line[offset : offset+i], offset: offset})
+		offset += i + 1
+	}
+}
+
+func unescapeTSVField(raw []byte) []byte {
+	if bytes.IndexByte(raw, '\\') == -1 {
+		return raw
+	}
+	out := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\\' || i+1 == len(raw) {
+			out = append(out, raw[i])
+			continue
+		}
+		i++
+		switch raw[i] {
+		case 't':
+			out = append(out, '\t')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case '\\':
+			out = append(out, '\\')
+		default:
+			// unknown escape sequences are kept as is.
+			out = append(out, '\\', raw[i])
+		}
+	}
+	return out
+}
+
+// tsvFieldOffsets returns the offset in raw of each byte of the value that
+// unescapeTSVField returns.
+func tsvFieldOffsets(raw []byte) []int {
+	if bytes.IndexByte(raw, '\\') == -1 {
+		return nil
+	}
+	offsets := make([]int, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		offsets = append(offsets, i)
+		if raw[i] != '\\' || i+1 == len(raw) {
+			continue
+		}
+		i++
+		switch raw[i] {
+		case 't', 'n', 'r', '\\':
+		default:
+			// unknown escape sequences are kept as is.
+			offsets = append(offsets, i)
+		}
+	}
+	return offsets
+}
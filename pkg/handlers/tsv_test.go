@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+	"github.com/kevmo314/appendable/pkg/bptree"
+	"github.com/kevmo314/appendable/pkg/buftest"
+	"github.com/kevmo314/appendable/pkg/pointer"
+)
+
+func TestTSV(t *testing.T) {
+	t.Run("splits on tabs with escapes", func(t *testing.T) {
+		r := []byte("name\tnote\tcount\r\n\"quoted\"\ta\\tb\\\\c\t12\r\nplain\tline\\nbreak\t\r\n")
+
+		i, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), TSVHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(r); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tc := range []struct {
+			field, value, raw string
+		}{
+			// quotes have no special meaning in tsv.
+			{"name", `"quoted"`, `"quoted"`},
+			{"note", "a\tb\\c", `a\tb\\c`},
+			{"note", "line\nbreak", `line\nbreak`},
+		} {
+			page, meta, err := i.FindOrCreateIndex(tc.field, appendable.FieldTypeString)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rv, _, err := page.BPTree(&bptree.BPTree{Data: r, DataParser: TSVHandler{}, Width: meta.Width}).Find(pointer.ReferencedValue{Value: []byte(tc.value)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(rv.Value) != tc.value {
+				t.Fatalf("got %q, want %q", rv.Value, tc.value)
+			}
+			if got := string(r[rv.DataPointer.Offset : rv.DataPointer.Offset+uint64(rv.DataPointer.Length)]); got != tc.raw {
+				t.Fatalf("field points at %q, want %q", got, tc.raw)
+			}
+		}
+
+		// the trailing empty field is null.
+		page, meta, err := i.FindOrCreateIndex("count", appendable.FieldTypeNull)
+		if err != nil {
+			t.Fatal(err)
+		}
+		iter, err := page.BPTree(&bptree.BPTree{Data: r, DataParser: TSVHandler{}, Width: meta.Width}).SeekFirst()
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for ; iter.Next(); n++ {
+		}
+		if n != 1 {
+			t.Fatalf("got %d null counts, want 1", n)
+		}
+	})
+
+	t.Run("n-grams of escaped fields point into the field", func(t *testing.T) {
+		r := []byte("text\nsay\\tline\\nbreak\n")
+
+		i, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), TSVHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.SetIndexSpec(&appendable.IndexSpec{Fields: map[string]appendable.IndexKind{"text": appendable.IndexKindNgram}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(r); err != nil {
+			t.Fatal(err)
+		}
+
+		page, meta, err := i.FindOrCreateIndex("text", appendable.FieldTypeBigram)
+		if err != nil {
+			t.Fatal(err)
+		}
+		iter, err := page.BPTree(&bptree.BPTree{Data: r, DataParser: TSVHandler{}, Width: meta.Width}).SeekFirst()
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for ; iter.Next(); n++ {
+			key := iter.Key()
+			if got := string(r[key.DataPointer.Offset : key.DataPointer.Offset+2]); got != string(key.Value) {
+				t.Errorf("bigram %q points at %q", key.Value, got)
+			}
+		}
+		if err := iter.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			t.Fatal("expected bigrams")
+		}
+	})
+
+	t.Run("default delimiter", func(t *testing.T) {
+		i, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), TSVHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize([]byte("a\tb\n1\t2\n")); err != nil {
+			t.Fatal(err)
+		}
+		metadata, err := i.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metadata.Format != appendable.FormatTSV || metadata.Delimiter != '\t' {
+			t.Fatalf("got format %d with delimiter %q", metadata.Format, metadata.Delimiter)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"testing"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+	"github.com/kevmo314/appendable/pkg/buftest"
+)
+
+func TestVerify(t *testing.T) {
+	var data []byte
+	for j := 0; j < 1000; j++ {
+		data = append(data, fmt.Sprintf("{\"n\":%d,\"s\":\"value %d\",\"b\":%t,\"z\":null}\n", j+1000, j, j%2 == 0)...)
+	}
+
+	// index returns an index file synchronized with data.
+	index := func(t *testing.T) *buftest.SeekableBuffer {
+		f := buftest.NewSeekableBuffer()
+		i, err := appendable.NewIndexFile(f, JSONLHandler{}, []string{"s"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(data); err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	verify := func(t *testing.T, f *buftest.SeekableBuffer, df []byte) *appendable.Report {
+		i, err := appendable.NewIndexFile(f, JSONLHandler{}, []string{"s"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		report, err := i.Verify(df)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+
+	t.Run("a consistent index has no problems", func(t *testing.T) {
+		report := verify(t, index(t), data)
+		if len(report.Problems) > 0 {
+			t.Fatalf("got problems %v", report.Problems)
+		}
+		if report.Indexes != 7 || report.Keys < 5000 {
+			t.Fatalf("got %d indexes and %d keys", report.Indexes, report.Keys)
+		}
+	})
+
+	t.Run("a changed value is reported", func(t *testing.T) {
+		changed := bytes.Replace(data, []byte(`"n":1500`), []byte(`"n":1501`), 1)
+		report := verify(t, index(t), changed)
+		if len(report.Problems) != 1 || !strings.Contains(report.Problems[0].Message, "doesn't match the parsed value") || report.Problems[0].Index.FieldName != "n" {
+			t.Fatalf("got problems %v", report.Problems)
+		}
+		if report.Problems[0].Offset == 0 {
+			t.Fatal("expected the offset of the leaf")
+		}
+	})
+
+	t.Run("a truncated data file is reported", func(t *testing.T) {
+		report := verify(t, index(t), data[:len(data)/2])
+		if len(report.Problems) == 0 || !strings.Contains(report.Problems[0].Message, "past the end of the") {
+			t.Fatalf("got problems %v", report.Problems)
+		}
+		outside := 0
+		for _, p := range report.Problems {
+			if strings.Contains(p.Message, "outside of the data file") {
+				outside++
+			}
+		}
+		if outside == 0 {
+			t.Fatalf("got problems %v", report.Problems)
+		}
+	})
+
+	t.Run("a free page in use is reported", func(t *testing.T) {
+		f := index(t)
+		// the free page indexes are stored at the start of the first page.
+		binary.LittleEndian.PutUint64(f.Bytes()[0:], 2*4096)
+		// and followed by their checksum, which is written as if a bug freed
+		// the page.
+		binary.LittleEndian.PutUint32(f.Bytes()[4056:], crc32.Checksum(f.Bytes()[:4056], crc32.MakeTable(crc32.Castagnoli)))
+		report := verify(t, f, data)
+		if len(report.Problems) != 1 || report.Problems[0].Message != "free page is in use" || report.Problems[0].Offset != 2*4096 {
+			t.Fatalf("got problems %v", report.Problems)
+		}
+	})
+}
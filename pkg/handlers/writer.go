@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"unsafe"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+	"github.com/kevmo314/appendable/pkg/bptree"
+	"github.com/kevmo314/appendable/pkg/linkedpage"
+	"github.com/kevmo314/appendable/pkg/ngram"
+	"github.com/kevmo314/appendable/pkg/pointer"
+)
+
+// bulkFillFactor is the fraction of each page filled when bulk loading an
+// index. Some slack is left so that subsequent appends with keys that don't
+// sort last don't immediately split every leaf.
+const bulkFillFactor = 0.9
+
+// maxBulkBytes bounds the memory held by the bulk buffers of an index writer.
+// Once the buffered keys exceed it, they are bulk loaded and the rest of the
+// synchronization inserts into the indexes directly.
+var maxBulkBytes = 64 << 20
+
+type indexKey struct {
+	name      string
+	fieldType appendable.FieldType
+}
+
+// bulkIndex is an index that was empty at the start of the synchronization
+// and whose entries are buffered to be bulk loaded.
+type bulkIndex struct {
+	tree    *bptree.BPTree
+	entries []bptree.Entry
+}
+
+// indexWriter inserts keys into the field indexes during a synchronization.
+//
+// Indexes that are empty the first time they are written to, which includes
+// every index on the first synchronization, are buffered in memory and bulk
+// loaded in flush, or once the buffers exceed maxBulkBytes. Indexes that
+// already contain keys are inserted into directly.
+type indexWriter struct {
+	// data or, if set, reader is the data file that keys are resolved from.
+	data   []byte
+	reader io.ReaderAt
+	parser bptree.DataParser
+
+	// indexes maps every index seen so far to its bulk buffer, or nil if the
+	// index already contained keys. order records the order in which the
+	// indexes were first seen so that the page layout is deterministic.
+	indexes map[indexKey]*bulkIndex
+	order   []indexKey
+
+	// buffered is the approximate size of the buffered entries in bytes.
+	buffered int
+}
+
+func newIndexWriter(data []byte, parser bptree.DataParser) *indexWriter {
+	return &indexWriter{data: data, parser: parser, indexes: make(map[indexKey]*bulkIndex)}
+}
+
+func newReaderIndexWriter(r io.ReaderAt, parser bptree.DataParser) *indexWriter {
+	return &indexWriter{reader: r, parser: parser, indexes: make(map[indexKey]*bulkIndex)}
+}
+
+func (w *indexWriter) tree(page *linkedpage.LinkedPage, width uint16) *bptree.BPTree {
+	return page.BPTree(&bptree.BPTree{Data: w.data, DataReader: w.reader, DataParser: w.parser, Width: width})
+}
+
+func (w *indexWriter) insert(page *linkedpage.LinkedPage, meta *appendable.IndexMeta, width uint16, key pointer.ReferencedValue, value pointer.MemoryPointer) error {
+	k := indexKey{name: meta.FieldName, fieldType: meta.FieldType}
+	bi, ok := w.indexes[k]
+	if !ok {
+		tree := w.tree(page, width)
+		empty, err := tree.IsEmpty()
+		if err != nil {
+			return fmt.Errorf("failed to read b+tree root: %w", err)
+		}
+		if empty {
+			bi = &bulkIndex{tree: tree}
+		}
+		w.indexes[k] = bi
+		w.order = append(w.order, k)
+	}
+	if bi != nil {
+		bi.entries = append(bi.entries, bptree.Entry{Key: key, Value: value})
+		w.buffered += int(unsafe.Sizeof(bptree.Entry{})) + len(key.Value)
+		if w.buffered > maxBulkBytes {
+			return w.flush()
+		}
+		return nil
+	}
+	return w.tree(page, width).Insert(key, value)
+}
+
+// flush bulk loads the buffered entries into their indexes.
+func (w *indexWriter) flush() error {
+	for _, k := range w.order {
+		bi := w.indexes[k]
+		if bi == nil {
+			continue
+		}
+		if err := bi.tree.BulkInsert(bi.entries, bulkFillFactor); err != nil {
+			return fmt.Errorf("failed to bulk insert into b+tree %s: %w", k.name, err)
+		}
+		// the index is no longer empty, so further writes go directly to it.
+		w.indexes[k] = nil
+	}
+	w.buffered = 0
+	return nil
+}
+
+// finishSynchronize flushes the index writer and stores the updated metadata
+// once the new records are indexed.
+func finishSynchronize(f *appendable.IndexFile, w *indexWriter, metadata *appendable.FileMeta) error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	// update the metadata
+	if err := f.SetMetadata(metadata); err != nil {
+		return fmt.Errorf("failed to set metadata: %w", err)
+	}
+	return nil
+}
+
+// insertNgrams inserts the n-grams of value, which is at mp in the data file,
+// into the n-gram index of page. The width of the index is one more than the
+// length of its n-grams. offsets holds the offset from mp of each byte of
+// value if value is escaped in the data file, otherwise it's nil.
+func (w *indexWriter) insertNgrams(page *linkedpage.LinkedPage, meta *appendable.IndexMeta, width uint16, value string, offsets []int, mp, data pointer.MemoryPointer) error {
+	for _, tri := range ngram.BuildNgram(value, int(width-1)) {
+		offset := tri.Offset
+		if offsets != nil && offset < uint64(len(offsets)) {
+			offset = uint64(offsets[offset])
+		}
+		if err := w.insert(page, meta, width, pointer.ReferencedValue{
+			DataPointer: pointer.MemoryPointer{
+				Offset: mp.Offset + offset,
+				Length: uint32(len(value)), // this is a degenerate case - for ngrams, we store the entire length of the value. This is to help us with the ranking heuristic.
+			},
+			Value: []byte(tri.Word),
+		}, data); err != nil {
+			return fmt.Errorf("failed to insert into b+tree: %w", err)
+		}
+		meta.TotalFieldValueLength += uint64(tri.Length)
+	}
+	return nil
+}
+
+// ErrUnsupportedIndexKind is returned when synchronizing a field whose kind in
+// the index spec the data handler can't index.
+var ErrUnsupportedIndexKind = appendable.ErrUnsupportedIndexKind
+
+// indexKind returns how the field named name is indexed, see
+// appendable.IndexSpec. Vector indexes aren't built by the handlers yet,
+// index specs that declare them are rejected unless they were stored before
+// they were.
+func indexKind(f *appendable.IndexFile, name string) (appendable.IndexKind, error) {
+	kind := f.IndexKind(name)
+	if kind == appendable.IndexKindVector {
+		return kind, fmt.Errorf("field %s: %w %q", name, ErrUnsupportedIndexKind, kind)
+	}
+	return kind, nil
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+	"github.com/kevmo314/appendable/pkg/buftest"
+	"github.com/kevmo314/appendable/pkg/pointer"
+)
+
+func TestIndexWriter(t *testing.T) {
+	t.Run("bulk buffers are flushed at the limit", func(t *testing.T) {
+		defer func(limit int) { maxBulkBytes = limit }(maxBulkBytes)
+		maxBulkBytes = 4096
+
+		var lines []string
+		for i := 0; i < 1000; i++ {
+			lines = append(lines, fmt.Sprintf(`{"id":%d,"name":"name %d"}`, i, i))
+		}
+		df := []byte(strings.Join(lines, "\n") + "\n")
+
+		i, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), JSONLHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := newIndexWriter(df, JSONLHandler{})
+		page, meta, err := i.FindOrCreateIndex("id", appendable.FieldTypeInt64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		k := indexKey{name: "id", fieldType: appendable.FieldTypeInt64}
+		for j := 0; j < 1000; j++ {
+			mp := pointer.MemoryPointer{Offset: uint64(j), Length: 1}
+			if err := w.insert(page, meta, meta.Width, pointer.ReferencedValue{Value: encodeNumber(int64(j)), DataPointer: mp}, mp); err != nil {
+				t.Fatal(err)
+			}
+			if w.buffered > maxBulkBytes {
+				t.Fatalf("buffered %d bytes, limit is %d", w.buffered, maxBulkBytes)
+			}
+		}
+		if w.indexes[k] != nil {
+			t.Fatal("expected the index to be inserted into directly once the limit was reached")
+		}
+		if err := w.flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		// a synchronization with the limit indexes every record.
+		i, err = appendable.NewIndexFile(buftest.NewSeekableBuffer(), JSONLHandler{}, []string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(df); err != nil {
+			t.Fatal(err)
+		}
+		report, err := i.Verify(df)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Problems) > 0 {
+			t.Fatalf("got problems %v", report.Problems)
+		}
+		// each record has an id and a name.
+		if report.Keys != 2000 {
+			t.Fatalf("got %d keys, want 2000", report.Keys)
+		}
+	})
+}
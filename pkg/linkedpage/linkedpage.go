@@ -33,6 +33,9 @@ type LinkedPage struct {
 	offset uint64
 
 	index uint8
+
+	// cache is shared by the trees of the pages linked to this one.
+	cache *bptree.NodeCache
 }
 
 /**
@@ -57,20 +60,21 @@ The SLOT_WIDTH is 12 + 1 + 256 for a given slot.
 
 12 + 1 + (index) * (12 + 1 + 256) = 4048 bytes for count 15
 
+The number of slots depends on the page size, see slotCount, so a page of a
+file with 4096 byte pages has 15 slots.
+
 0th index slot => 12 + 1
 ith index slot => 12 + 1 + <width of the ith slot> => 12 + 1 + i * SLOT_WIDTH
 i+1th index slot = > 12 + 1 + <width of the i+1th slot> => 12 + 1 + (i + 1) + SLOT_WIDTH);
 NewBPTree( page num ) => LinkedPage
 */
 
-const numSlots = 15
-
 type memoryLayout struct {
 	header struct {
 		nextPointer uint64
 		count       uint8
 	}
-	slots [numSlots]struct {
+	slots []struct {
 		rootPointer    uint64
 		metadataLength uint8
 		metadata       [256]byte
@@ -110,9 +114,18 @@ func (m *LinkedPage) SetRoot(mp pointer.MemoryPointer) error {
 func (m *LinkedPage) BPTree(t *bptree.BPTree) *bptree.BPTree {
 	t.PageFile = m.rws
 	t.MetaPage = m
+	if t.Cache == nil {
+		t.Cache = m.cache
+	}
 	return t
 }
 
+// SetNodeCache sets the cache of decoded nodes used by the trees returned by
+// BPTree. Pages returned by Next and AddNext share it.
+func (m *LinkedPage) SetNodeCache(c *bptree.NodeCache) {
+	m.cache = c
+}
+
 func (m *LinkedPage) BTree(t *btree.BTree) *btree.BTree {
 	t.PageFile = m.rws
 	t.MetaPage = m
@@ -185,6 +198,21 @@ func (m *LinkedPage) count() (uint8, error) {
 	return count, binary.Read(m.rws, binary.LittleEndian, &count)
 }
 
+// Offset returns the offset of the page that holds this slot.
+func (m *LinkedPage) Offset() uint64 {
+	return m.offset
+}
+
+// slotCount returns the number of slots that fit in a page. The metadata of a
+// slot is read with 4 bytes of padding past the slot size.
+func (m *LinkedPage) slotCount() uint8 {
+	width := uint64(m.rws.SlotSize()) + pointerBytes + countByte
+	last := pointerBytes + 4 + 4 + uint64(m.rws.SlotSize())
+	n := (uint64(m.rws.PageSize())-pointerBytes-countByte-last)/width + 1
+	// the largest index marks a LinkedPage that isn't a slot.
+	return uint8(min(n, uint64(^uint8(0))))
+}
+
 func (m *LinkedPage) rootMemoryPointerPageOffset() uint64 {
 	return m.offset + pointerBytes + countByte + uint64(m.index)*(uint64(m.rws.SlotSize())+pointerBytes+countByte)
 }
@@ -196,7 +224,7 @@ func (m *LinkedPage) Next() (*LinkedPage, error) {
 		return nil, err
 	}
 	if m.index+1 < count {
-		return &LinkedPage{rws: m.rws, offset: m.offset, index: m.index + 1}, nil
+		return &LinkedPage{rws: m.rws, offset: m.offset, index: m.index + 1, cache: m.cache}, nil
 	}
 	// otherwise, read the next page
 	nextOffset, err := m.nextPageOffset()
@@ -207,7 +235,7 @@ func (m *LinkedPage) Next() (*LinkedPage, error) {
 		// we've reached the end of the linked list
 		return nil, io.EOF
 	}
-	return &LinkedPage{rws: m.rws, offset: nextOffset}, nil
+	return &LinkedPage{rws: m.rws, offset: nextOffset, cache: m.cache}, nil
 }
 
 func (m *LinkedPage) AddNext() (*LinkedPage, error) {
@@ -218,7 +246,7 @@ func (m *LinkedPage) AddNext() (*LinkedPage, error) {
 	if m.index+1 < count {
 		return nil, errors.New("next pointer already exists")
 	}
-	if count != numSlots {
+	if count != m.slotCount() {
 		// increment the count
 		if _, err := m.rws.Seek(int64(m.offset+pointerBytes), io.SeekStart); err != nil {
 			return nil, err
@@ -226,7 +254,7 @@ func (m *LinkedPage) AddNext() (*LinkedPage, error) {
 		if err := binary.Write(m.rws, binary.LittleEndian, count+1); err != nil {
 			return nil, err
 		}
-		return &LinkedPage{rws: m.rws, offset: m.offset, index: m.index + 1}, nil
+		return &LinkedPage{rws: m.rws, offset: m.offset, index: m.index + 1, cache: m.cache}, nil
 	} else {
 		// otherwise, read the next page
 		nextOffset, err := m.nextPageOffset()
@@ -240,7 +268,7 @@ func (m *LinkedPage) AddNext() (*LinkedPage, error) {
 		if err != nil {
 			return nil, err
 		}
-		next := &LinkedPage{rws: m.rws, offset: uint64(offset)}
+		next := &LinkedPage{rws: m.rws, offset: uint64(offset), cache: m.cache}
 		if err := next.reset(1); err != nil {
 			return nil, err
 		}
@@ -1,6 +1,7 @@
 package linkedpage
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
 
@@ -327,4 +328,57 @@ func TestMultiBPTree(t *testing.T) {
 			prevOffset = slot.rootMemoryPointerPageOffset()
 		}
 	})
+
+	t.Run("larger pages have more slots", func(t *testing.T) {
+		b := buftest.NewSeekableBuffer()
+		p, err := pagefile.NewPageFileSize(b, 16384)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree, err := NewMultiBPTree(p, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tree.offset != 16384 {
+			t.Fatalf("expected the tree at 16384, got %d", tree.offset)
+		}
+
+		node := tree
+		n := 70
+		for i := 0; i < n; i++ {
+			next, err := node.AddNext()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := next.SetMetadata([]byte(fmt.Sprintf("slot %d", i))); err != nil {
+				t.Fatal(err)
+			}
+			node = next
+		}
+
+		pages, err := tree.Collect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pages) != n {
+			t.Fatalf("expected num pages to be %v, got %v", n, len(pages))
+		}
+		// (16380 - 16) / 265 slots fit in the first page.
+		for i, slot := range pages {
+			offset := uint64(16384)
+			if i >= 61 {
+				offset = 2 * 16384
+			}
+			if slot.offset != offset {
+				t.Fatalf("expected slot %d in the page at %d, got %d", i, offset, slot.offset)
+			}
+			md, err := slot.Metadata()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(md) != fmt.Sprintf("slot %d", i) {
+				t.Fatalf("expected metadata slot %d, got %q", i, md)
+			}
+		}
+	})
 }
@@ -69,6 +69,58 @@ func (m *MemoryMappedFile) Bytes() []byte {
 	return m.bytes
 }
 
+// Remap updates the mapping to the current size of the file, for example
+// after another process has appended to it.
+func (m *MemoryMappedFile) Remap() error {
+	fi, err := m.file.Stat()
+	if err != nil {
+		return fmt.Errorf("stat: %v", err)
+	}
+	size := int(fi.Size())
+	switch {
+	case size == len(m.bytes):
+		return nil
+	case m.bytes == nil:
+		m.bytes, err = unix.Mmap(int(m.file.Fd()), 0, size, m.prot, m.flags)
+		if err != nil {
+			return fmt.Errorf("mmap: %v", err)
+		}
+	case size == 0:
+		if err := unix.Munmap(m.bytes); err != nil {
+			return fmt.Errorf("munmap: %v", err)
+		}
+		m.bytes = nil
+	default:
+		b, err := mremap(m.bytes, int(m.file.Fd()), size, m.prot, m.flags)
+		if err != nil {
+			return fmt.Errorf("mmap: %v", err)
+		}
+		m.bytes = b
+	}
+	if m.seek > int64(len(m.bytes)) {
+		m.seek = int64(len(m.bytes))
+	}
+	return nil
+}
+
+// Sync flushes the mapped memory and the file to disk.
+func (m *MemoryMappedFile) Sync() error {
+	if m.bytes != nil {
+		if err := unix.Msync(m.bytes, unix.MS_SYNC); err != nil {
+			return fmt.Errorf("msync: %v", err)
+		}
+	}
+	return m.file.Sync()
+}
+
+// Truncate changes the size of the file and remaps it.
+func (m *MemoryMappedFile) Truncate(size int64) error {
+	if err := m.file.Truncate(size); err != nil {
+		return err
+	}
+	return m.Remap()
+}
+
 // Close closes the file and unmaps the memory.
 func (m *MemoryMappedFile) Close() error {
 	if m.bytes == nil {
@@ -150,11 +202,11 @@ func (m *MemoryMappedFile) WriteAt(b []byte, off int64) (int, error) {
 			}
 			return len(b), nil
 		}
-		b, err := mremap(m.bytes, int(m.file.Fd()), int(fi.Size()), m.prot, m.flags)
+		remapped, err := mremap(m.bytes, int(m.file.Fd()), int(fi.Size()), m.prot, m.flags)
 		if err != nil {
 			return 0, fmt.Errorf("mmap: %v", err)
 		}
-		m.bytes = b
+		m.bytes = remapped
 		return len(b), nil
 	}
 	// write the data
@@ -252,6 +252,35 @@ func TestMemoryMappedFile_Write(t *testing.T) {
 			t.Fatalf("expected %s, got %s", "Hello, world!", string(b))
 		}
 	})
+
+	t.Run("Write that remaps returns the bytes written", func(t *testing.T) {
+		f, err := os.CreateTemp("", "writeremap")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		defer os.Remove(f.Name())
+
+		m, err := NewMemoryMappedFile(f, unix.PROT_READ|unix.PROT_WRITE)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer m.Close()
+
+		if _, err := m.Write([]byte("Hello")); err != nil {
+			log.Fatal(err)
+		}
+		n, err := m.Write([]byte(", world!"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if n != 8 {
+			t.Fatalf("expected 8 bytes written, got %d", n)
+		}
+		if pos, _ := m.Seek(0, io.SeekCurrent); pos != 13 {
+			t.Fatalf("expected seek position 13, got %d", pos)
+		}
+	})
 }
 
 func TestMemoryMappedFile_Seek(t *testing.T) {
@@ -404,3 +433,33 @@ func TestMemoryMappedFile_Close(t *testing.T) {
 		}
 	})
 }
+
+func TestMemoryMappedFile_Remap(t *testing.T) {
+	t.Run("Remap picks up appends", func(t *testing.T) {
+		f, err := os.CreateTemp("", "remap")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+
+		m, err := OpenFile(f.Name(), os.O_RDONLY, 0)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer m.Close()
+
+		// append through another file descriptor, as a producer would.
+		for _, s := range []string{"Hello, ", "world!"} {
+			if _, err := f.Write([]byte(s)); err != nil {
+				log.Fatal(err)
+			}
+			if err := m.Remap(); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if string(m.Bytes()) != "Hello, world!" {
+			t.Errorf("expected %q, got %q", "Hello, world!", m.Bytes())
+		}
+	})
+}
@@ -6,6 +6,7 @@ func main() {
 	//generateBasicBtree()
 	//generateInternalNode()
 	//generateLeafNode()
+	//generateStoredNode()
 	//generateBtreeIterator()
 	// generateFileMeta()
 	//generateIndexMeta()
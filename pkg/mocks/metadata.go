@@ -41,7 +41,7 @@ func writeByteToFile(data []byte, filename string) error {
 func generateFileMeta() {
 	fm := appendable.FileMeta{}
 	fm.Format = 1
-	fm.Version = 1
+	fm.Version = appendable.CurrentVersion
 	fm.ReadOffset = 4096
 	fm.Entries = 34
 
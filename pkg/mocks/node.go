@@ -41,6 +41,29 @@ func generateLeafNode() {
 	writeBufferToFile(buf, "leafnode.bin")
 }
 
+func generateStoredNode() {
+	node1 := &bptree.BPTreeNode{
+		LeafPointers: []pointer.MemoryPointer{
+			{Offset: 0, Length: 0},
+			{Offset: 0, Length: 1},
+			{Offset: 1, Length: 0},
+		},
+		Keys: []pointer.ReferencedValue{
+			{Value: []byte("a"), DataPointer: pointer.MemoryPointer{Offset: 0, Length: 0}},
+			{Value: []byte("bc"), DataPointer: pointer.MemoryPointer{Offset: 0, Length: 1}},
+			{Value: []byte("def"), DataPointer: pointer.MemoryPointer{Offset: 1, Length: 0}},
+		},
+		Width: bptree.StoredWidth,
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := node1.WriteTo(buf); err != nil {
+		log.Fatal(err)
+	}
+
+	writeBufferToFile(buf, "storednode.bin")
+}
+
 func generateInternalNode() {
 	// Create a test BPTreeNode
 	node1 := &bptree.BPTreeNode{
@@ -0,0 +1,67 @@
+package pagefile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// Each page ends with a CRC32C of the rest of the page, which is verified
+// whenever the page is read, except for the first page. Its checksum follows
+// the free page indexes and only covers them, since the commit record after
+// it has its own checksum and is written separately.
+const checksumSize = 4
+
+// freePageChecksumOffset is the offset of the checksum of the first page.
+const freePageChecksumOffset = maxFreePageIndices * 8
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrChecksumMismatch is the error of a CorruptPageError for a page that
+// doesn't match its checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// CorruptPageError is returned when a page can't be read intact, either
+// because it doesn't match its checksum or because the file is truncated.
+type CorruptPageError struct {
+	Offset int64
+	Err    error
+}
+
+func (e *CorruptPageError) Error() string {
+	return fmt.Sprintf("corrupt page at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *CorruptPageError) Unwrap() error {
+	return e.Err
+}
+
+// seal sets the checksum of the page at offset.
+func (pf *PageFile) seal(offset int64, page []byte) {
+	if !pf.checksums {
+		return
+	}
+	n := checksumOffset(offset, page)
+	binary.LittleEndian.PutUint32(page[n:], crc32.Checksum(page[:n], castagnoli))
+}
+
+// verify checks the checksum of the page at offset.
+func (pf *PageFile) verify(offset int64, page []byte) error {
+	if !pf.checksums {
+		return nil
+	}
+	n := checksumOffset(offset, page)
+	if binary.LittleEndian.Uint32(page[n:]) != crc32.Checksum(page[:n], castagnoli) {
+		return &CorruptPageError{Offset: offset, Err: ErrChecksumMismatch}
+	}
+	return nil
+}
+
+// checksumOffset returns the offset of the checksum in the page at offset.
+func checksumOffset(offset int64, page []byte) int {
+	if offset == 0 {
+		return freePageChecksumOffset
+	}
+	return len(page) - checksumSize
+}
@@ -0,0 +1,150 @@
+package pagefile
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/kevmo314/appendable/pkg/buftest"
+)
+
+func TestChecksum(t *testing.T) {
+	// newFile returns a page file with two pages.
+	newFile := func(t *testing.T) *buftest.SeekableBuffer {
+		buf := buftest.NewSeekableBuffer()
+		pf, err := NewPageFile(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, data := range []string{"page1", "page2"} {
+			if _, err := pf.NewPage([]byte(data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return buf
+	}
+
+	t.Run("rewritten pages are sealed", func(t *testing.T) {
+		buf := newFile(t)
+		pf, err := NewPageFile(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pf.PageSize() != pageSizeBytes-checksumSize {
+			t.Fatalf("got page size %d, want %d", pf.PageSize(), pageSizeBytes-checksumSize)
+		}
+		if err := writePage(pf, pageSizeBytes+2, "ge"); err != nil {
+			t.Fatal(err)
+		}
+		if err := pf.Begin(); err != nil {
+			t.Fatal(err)
+		}
+		if err := writePage(pf, 2*pageSizeBytes, "PAGE"); err != nil {
+			t.Fatal(err)
+		}
+		if err := pf.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		pf, err = NewPageFile(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := readPage(t, pf, pageSizeBytes); string(got) != "page1" {
+			t.Fatalf("got %q, want page1", got)
+		}
+		if got := readPage(t, pf, 2*pageSizeBytes); string(got) != "PAGE2" {
+			t.Fatalf("got %q, want PAGE2", got)
+		}
+	})
+
+	t.Run("a flipped bit is reported", func(t *testing.T) {
+		buf := newFile(t)
+		buf.Bytes()[2*pageSizeBytes+100] ^= 0x10
+
+		pf, err := NewPageFile(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		readPage(t, pf, pageSizeBytes)
+		if _, err := pf.Seek(2*pageSizeBytes, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		_, err = pf.Read(make([]byte, 8))
+		var corrupt *CorruptPageError
+		if !errors.As(err, &corrupt) || !errors.Is(err, ErrChecksumMismatch) {
+			t.Fatalf("got %v, want a checksum mismatch", err)
+		}
+		if corrupt.Offset != 2*pageSizeBytes {
+			t.Fatalf("got offset %d, want %d", corrupt.Offset, 2*pageSizeBytes)
+		}
+		// the corrupt page isn't used as the base of a write either.
+		if err := writePage(pf, 2*pageSizeBytes+1, "x"); !errors.Is(err, ErrChecksumMismatch) {
+			t.Fatalf("got %v, want a checksum mismatch", err)
+		}
+	})
+
+	t.Run("a changed free page index is reported", func(t *testing.T) {
+		buf := newFile(t)
+		pf, err := NewPageFile(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pf.FreePage(pageSizeBytes); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewPageFile(buf); err != nil {
+			t.Fatal(err)
+		}
+
+		// the free page indexes aren't covered by the commit record.
+		buf.Bytes()[1] ^= 0x10
+		if _, err := NewPageFile(buf); !errors.Is(err, ErrChecksumMismatch) {
+			t.Fatalf("got %v, want a checksum mismatch", err)
+		}
+	})
+
+	t.Run("a truncated file is reported", func(t *testing.T) {
+		buf := newFile(t)
+		if err := buf.Truncate(2*pageSizeBytes + 100); err != nil {
+			t.Fatal(err)
+		}
+
+		pf, err := NewPageFile(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pf.Seek(2*pageSizeBytes, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		_, err = pf.Read(make([]byte, 8))
+		var corrupt *CorruptPageError
+		if !errors.As(err, &corrupt) || !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("got %v, want a truncated page", err)
+		}
+	})
+
+	t.Run("files without checksums are still read", func(t *testing.T) {
+		// files written before checksums were added have no commit record.
+		buf := buftest.NewSeekableBuffer()
+		page := make([]byte, 2*pageSizeBytes)
+		copy(page[pageSizeBytes:], "legacy")
+		if _, err := buf.Write(page); err != nil {
+			t.Fatal(err)
+		}
+
+		pf, err := NewPageFile(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pf.PageSize() != pageSizeBytes {
+			t.Fatalf("got page size %d, want %d", pf.PageSize(), pageSizeBytes)
+		}
+		if got := readPage(t, pf, pageSizeBytes); string(got) != "legacy" {
+			t.Fatalf("got %q, want legacy", got)
+		}
+		if err := writePage(pf, pageSizeBytes+pageSizeBytes-2, "ok"); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -3,7 +3,9 @@ package pagefile
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"sync"
 )
 
 type ReadWriteSeekPager interface {
@@ -21,25 +23,75 @@ type ReadWriteSeekPager interface {
 	PageCount() int64
 }
 
+// PageFile divides a file into pages. The first 4096 bytes of the first page
+// hold the free page indexes followed by a commit record, see Begin, which
+// also records the page size.
 type PageFile struct {
 	io.ReadWriteSeeker
 	pageSize int
 	slotSize int
 
 	// local cache of free pages to avoid reading from disk too often.
-	freePageIndexes             [512]int64
+	freePageIndexes             [maxFreePageIndices]int64
 	freePageHead, freePageCount int
 
-	lastPage int64
+	// pos is the offset of the next read or write.
+	pos int64
+	// end is the offset after the last page.
+	end int64
+
+	// committed reports whether the file has a commit record. Files written
+	// without transactions don't.
+	committed bool
+	// checksums reports whether pages end with a checksum.
+	checksums bool
+	// chained reports whether the last free page index is the offset of the
+	// first page in the free page chain, freePageChain, see FreePage.
+	chained       bool
+	freePageChain int64
+	// legacyFreePages are the free page indexes of a file without a commit
+	// record that are where the commit record goes, see
+	// upgradeLegacyFreePages.
+	legacyFreePages []int64
+	tx              *transaction
+
+	// mu guards the underlying file, which snapshots read from other
+	// goroutines, and the fields below.
+	mu        sync.Mutex
+	snapshots map[*snapshotFile]struct{}
+	// visibleEnd is the end of the pages that new snapshots read, see
+	// Snapshot.
+	visibleEnd int64
 }
 
 var _ ReadWriteSeekPager = &PageFile{}
 
-// const maxFreePageIndices = 512
+const maxFreePageIndices = (pageSizeBytes - commitRecordSize) / 8
+
+// legacyFreePageIndices is the number of free page indexes of files written
+// before the commit record was added, which fill the first 4096 bytes.
+const legacyFreePageIndices = pageSizeBytes / 8
 const pageSizeBytes = 4096 // 4kB by default.
+const maxPageSizeBytes = 64 * 1024
 const slotSizeBytes = 256
 
+// ErrPageSize is returned by NewPageFileSize for page sizes that aren't a
+// power of two between 4096 and 65536 bytes.
+var ErrPageSize = errors.New("page size must be a power of two between 4096 and 65536 bytes")
+
+// NewPageFile opens the page file in rws, creating it with 4096 byte pages if
+// rws is empty.
 func NewPageFile(rws io.ReadWriteSeeker) (*PageFile, error) {
+	return NewPageFileSize(rws, pageSizeBytes)
+}
+
+// NewPageFileSize opens the page file in rws, creating it with pages of
+// pageSize bytes if rws is empty. Existing files keep the page size that they
+// were created with.
+func NewPageFileSize(rws io.ReadWriteSeeker, pageSize int) (*PageFile, error) {
+	if pageSizeShift(pageSize) < 0 {
+		return nil, ErrPageSize
+	}
 	// check if the rws is empty. if it is, allocate one page for the free page indexes
 	// if it is not, read the free page indexes from the last page
 	if _, err := rws.Seek(0, io.SeekStart); err != nil {
@@ -56,36 +108,96 @@ func NewPageFile(rws io.ReadWriteSeeker) (*PageFile, error) {
 		slotSize:        slotSizeBytes,
 	}
 	if err == io.EOF {
-		// allocate one page for the free page indexes
+		// allocate one page for the free page indexes, committing only that
+		// page so that a crash while the rest of the file is first written
+		// doesn't leave partial pages behind.
+		pf.pageSize = pageSize
+		record, err := commitRecord{flags: flagChecksums | flagFreePageChain | uint32(pageSizeShift(pageSize))<<pageSizeFlagShift, end: uint64(pf.pageSize)}.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		pf.checksums = true
+		buf = make([]byte, pf.pageSize)
+		copy(buf[commitRecordOffset:], record)
+		pf.seal(0, buf)
 		if _, err := rws.Write(buf); err != nil {
 			return nil, err
 		}
+		pf.pos = int64(pf.pageSize)
+		pf.end = int64(pf.pageSize)
+		pf.visibleEnd = pf.end
+		pf.committed = true
+		pf.chained = true
+		return pf, nil
+	}
+
+	var record commitRecord
+	if record.UnmarshalBinary(buf[commitRecordOffset:]) == nil {
+		pf.committed = true
+		pf.checksums = record.flags&flagChecksums != 0
+		pf.chained = record.flags&flagFreePageChain != 0
+		pf.pageSize = pageSizeBytes << (record.flags >> pageSizeFlagShift & 0xff)
+		if pageSizeShift(pf.pageSize) < 0 {
+			return nil, fmt.Errorf("commit record has an invalid page size %d", pf.pageSize)
+		}
+		pf.end = int64(record.end)
+		if record.journalPages > 0 {
+			if err := pf.replay(record); err != nil {
+				return nil, err
+			}
+			// the free page indexes may have been replayed.
+			if _, err := rws.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+			if _, err := io.ReadFull(rws, buf); err != nil {
+				return nil, err
+			}
+		}
 	} else {
-		for i := 0; i < len(pf.freePageIndexes); i++ {
+		// figure out what the last page is
+		n, err := rws.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		if n%int64(pf.pageSize) != 0 {
+			return nil, errors.New("file size is not a multiple of the page size")
+		}
+		pf.end = n
+	}
+	if err := pf.verify(0, buf); err != nil {
+		return nil, err
+	}
+	if pf.chained {
+		pf.freePageChain = int64(binary.LittleEndian.Uint64(buf[pf.freePageCapacity()*8:]))
+	}
+	for i := 0; i < pf.freePageCapacity(); i++ {
+		offset := int64(binary.LittleEndian.Uint64(buf[i*8 : (i+1)*8]))
+		if offset != 0 {
+			pf.freePageIndexes[pf.freePageHead] = offset
+			pf.freePageHead = (pf.freePageHead + 1) % len(pf.freePageIndexes)
+			pf.freePageCount++
+		} else {
+			break
+		}
+	}
+	if !pf.committed && pf.freePageCount == pf.freePageCapacity() {
+		for i := pf.freePageCapacity(); i < legacyFreePageIndices; i++ {
 			offset := int64(binary.LittleEndian.Uint64(buf[i*8 : (i+1)*8]))
-			if offset != 0 {
-				pf.freePageIndexes[pf.freePageHead] = offset
-				pf.freePageHead = (pf.freePageHead + 1) % len(pf.freePageIndexes)
-				pf.freePageCount++
-			} else {
+			if offset == 0 {
 				break
 			}
+			pf.legacyFreePages = append(pf.legacyFreePages, offset)
 		}
 	}
-	// figure out what the last page is
-	n, err := rws.Seek(0, io.SeekEnd)
-	if err != nil {
+	if _, err := rws.Seek(0, io.SeekStart); err != nil {
 		return nil, err
 	}
-	if n%int64(pf.pageSize) != 0 {
-		return nil, errors.New("file size is not a multiple of the page size")
-	}
-	pf.lastPage = n / int64(pf.pageSize)
+	pf.visibleEnd = pf.end
 	return pf, nil
 }
 
 func (pf *PageFile) LastPage() int64 {
-	return pf.lastPage
+	return pf.end / int64(pf.pageSize)
 }
 
 func (pf *PageFile) Page(i int) (int64, error) {
@@ -96,26 +208,314 @@ func (pf *PageFile) Page(i int) (int64, error) {
 	return int64(i+1) * int64(pf.pageSize), nil
 }
 
+// Seek sets the offset for the next Read or Write. io.SeekEnd is relative to
+// the end of the last page.
+func (pf *PageFile) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = pf.pos + offset
+	case io.SeekEnd:
+		abs = pf.end + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+	pf.pos = abs
+	if err := pf.syncPosition(); err != nil {
+		return 0, err
+	}
+	return abs, nil
+}
+
+func (pf *PageFile) read(buf []byte) (int, error) {
+	if pf.pos >= pf.end {
+		return 0, io.EOF
+	}
+	if int64(len(buf)) > pf.end-pf.pos {
+		n, err := pf.read(buf[:pf.end-pf.pos])
+		if err != nil {
+			return n, err
+		}
+		return n, io.EOF
+	}
+	n := 0
+	for n < len(buf) {
+		start := pf.pos - pf.pos%int64(pf.pageSize)
+		page, err := pf.page(start)
+		if err != nil {
+			return n, err
+		}
+		m := copy(buf[n:], page[pf.pos-start:])
+		n += m
+		pf.pos += int64(m)
+	}
+	return n, pf.syncPosition()
+}
+
+// write writes whole pages so that their checksums can be updated.
+func (pf *PageFile) write(buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		start := pf.pos - pf.pos%int64(pf.pageSize)
+		var page []byte
+		var err error
+		switch {
+		case pf.tx != nil && start < pf.tx.committedEnd:
+			// pages that the committed file references are sealed and
+			// written when the transaction is committed.
+			page, err = pf.page(start)
+			if err != nil {
+				return n, err
+			}
+			pf.tx.dirty[start] = page
+		case start < pf.end:
+			page, err = pf.readPage(start)
+			if err != nil {
+				return n, err
+			}
+		default:
+			page = make([]byte, pf.pageSize)
+		}
+		m := copy(page[pf.pos-start:], buf[n:])
+		if pf.tx == nil || start >= pf.tx.committedEnd {
+			pf.seal(start, page)
+			if err := pf.writeAt(page, start); err != nil {
+				return n, err
+			}
+		}
+		n += m
+		pf.pos += int64(m)
+		if end := start + int64(pf.pageSize); end > pf.end {
+			pf.end = end
+			if pf.tx == nil {
+				pf.setVisibleEnd(end)
+			}
+			if pf.tx == nil && pf.committed {
+				// keep the commit record covering pages that were added
+				// outside of a transaction.
+				if err := pf.writeCommitRecord(commitRecord{end: uint64(pf.end)}); err != nil {
+					return n, err
+				}
+			}
+		}
+	}
+	return n, pf.syncPosition()
+}
+
+// page returns the page at offset, which is the buffered copy if it was
+// written in the current transaction.
+func (pf *PageFile) page(offset int64) ([]byte, error) {
+	if pf.tx != nil {
+		if page, ok := pf.tx.dirty[offset]; ok {
+			return page, nil
+		}
+	}
+	return pf.readPage(offset)
+}
+
+// readPage reads the page at offset from the underlying file and verifies
+// its checksum.
+func (pf *PageFile) readPage(offset int64) ([]byte, error) {
+	page := make([]byte, pf.pageSize)
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	if _, err := pf.ReadWriteSeeker.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(pf.ReadWriteSeeker, page); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, &CorruptPageError{Offset: offset, Err: io.ErrUnexpectedEOF}
+		}
+		return nil, err
+	}
+	if err := pf.verify(offset, page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// syncPosition moves the underlying file to the position of the page file
+// outside of transactions, so that it can still be used directly.
+func (pf *PageFile) syncPosition() error {
+	if pf.tx != nil {
+		return nil
+	}
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	_, err := pf.ReadWriteSeeker.Seek(pf.pos, io.SeekStart)
+	return err
+}
+
+// setVisibleEnd sets the end of the pages that new snapshots read.
+func (pf *PageFile) setVisibleEnd(end int64) {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	pf.visibleEnd = end
+}
+
+// pageSizeShift returns the number of times that 4096 is doubled to get
+// pageSize, or -1 if pageSize isn't a valid page size.
+func pageSizeShift(pageSize int) int {
+	for shift := 0; pageSizeBytes<<shift <= maxPageSizeBytes; shift++ {
+		if pageSizeBytes<<shift == pageSize {
+			return shift
+		}
+	}
+	return -1
+}
+
+// freePageCapacity returns the number of free page indexes that fit in the
+// first page. The last slot holds the head of the free page chain.
+func (pf *PageFile) freePageCapacity() int {
+	if pf.chained {
+		return len(pf.freePageIndexes) - 1
+	}
+	return len(pf.freePageIndexes)
+}
+
 func (pf *PageFile) writeFreePageIndices() error {
 	buf := make([]byte, len(pf.freePageIndexes)*8)
 	tail := (pf.freePageHead - pf.freePageCount + len(pf.freePageIndexes)) % len(pf.freePageIndexes)
 	for i := 0; i < pf.freePageCount; i++ {
-		offset := pf.freePageIndexes[tail+i]
+		offset := pf.freePageIndexes[(tail+i)%len(pf.freePageIndexes)]
 		binary.LittleEndian.PutUint64(buf[i*8:(i+1)*8], uint64(offset))
 	}
-	if _, err := pf.ReadWriteSeeker.Seek(0, io.SeekStart); err != nil {
+	if pf.chained {
+		binary.LittleEndian.PutUint64(buf[len(buf)-8:], uint64(pf.freePageChain))
+	}
+	if _, err := pf.Seek(0, io.SeekStart); err != nil {
 		return err
 	}
-	if _, err := pf.ReadWriteSeeker.Write(buf); err != nil {
+	if _, err := pf.Write(buf); err != nil {
 		return err
 	}
 	return nil
 }
 
+// upgradeFreePageChain starts using the last free page index for the free page
+// chain in files that were written before it was added. Files without a
+// commit record can't say that they use it, so they aren't upgraded.
+func (pf *PageFile) upgradeFreePageChain() error {
+	if pf.chained || !pf.committed {
+		return nil
+	}
+	pf.chained = true
+	if pf.freePageCount > pf.freePageCapacity() {
+		// the last slot is in use, so that page moves to the chain.
+		tail := (pf.freePageHead - pf.freePageCount + len(pf.freePageIndexes)) % len(pf.freePageIndexes)
+		offset := pf.freePageIndexes[tail]
+		pf.freePageIndexes[tail] = 0
+		pf.freePageCount--
+		if err := pf.pushFreePageChain(offset); err != nil {
+			return err
+		}
+	}
+	if err := pf.writeFreePageIndices(); err != nil {
+		return err
+	}
+	if pf.tx != nil {
+		// the commit record is written on commit.
+		return nil
+	}
+	return pf.writeCommitRecord(commitRecord{end: uint64(pf.end)})
+}
+
+// upgradeLegacyFreePages rewrites the free page indexes of a file without a
+// commit record in the layout of files with one before the commit record is
+// first written over them. The free page chain is started and the free pages
+// that don't fit next to the commit record are moved to it.
+func (pf *PageFile) upgradeLegacyFreePages() error {
+	if pf.committed || pf.chained {
+		return nil
+	}
+	pf.chained = true
+	for pf.freePageCount > pf.freePageCapacity() {
+		tail := (pf.freePageHead - pf.freePageCount + len(pf.freePageIndexes)) % len(pf.freePageIndexes)
+		offset := pf.freePageIndexes[tail]
+		pf.freePageIndexes[tail] = 0
+		pf.freePageCount--
+		if err := pf.pushFreePageChain(offset); err != nil {
+			return err
+		}
+	}
+	for _, offset := range pf.legacyFreePages {
+		if err := pf.pushFreePageChain(offset); err != nil {
+			return err
+		}
+	}
+	return pf.writeFreePageIndices()
+}
+
+// The free pages that don't fit in the first page are chained together: each
+// one starts with freePageMagic followed by the offset of the next page in
+// the chain, or zero for the last page. Pages in the first page are marked
+// with freePageMagic too, which is how pages that are freed twice are found.
+var freePageMagic = [8]byte{'a', 'p', 'f', 'r', 'e', 'e', 0, 0}
+
+// markFreePage writes the free page header to the page at offset.
+func (pf *PageFile) markFreePage(offset, next int64) error {
+	buf := make([]byte, 16)
+	copy(buf, freePageMagic[:])
+	binary.LittleEndian.PutUint64(buf[8:], uint64(next))
+	if _, err := pf.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := pf.Write(buf)
+	return err
+}
+
+// readFreePage reads the free page header of the page at offset. ok is false
+// if the page isn't marked free.
+func (pf *PageFile) readFreePage(offset int64) (next int64, ok bool, err error) {
+	buf := make([]byte, 16)
+	if _, err := pf.Seek(offset, io.SeekStart); err != nil {
+		return 0, false, err
+	}
+	if _, err := io.ReadFull(pf, buf); err != nil {
+		return 0, false, err
+	}
+	if [8]byte(buf[:8]) != freePageMagic {
+		return 0, false, nil
+	}
+	return int64(binary.LittleEndian.Uint64(buf[8:])), true, nil
+}
+
+// pushFreePageChain adds the page at offset to the front of the chain.
+func (pf *PageFile) pushFreePageChain(offset int64) error {
+	if err := pf.markFreePage(offset, pf.freePageChain); err != nil {
+		return err
+	}
+	pf.freePageChain = offset
+	return nil
+}
+
+// FreePageIndex removes a free page and returns its offset, or -1 if there
+// are no free pages. The free page indexes in the first page are used in the
+// order they were freed before the chain is used.
 func (pf *PageFile) FreePageIndex() (int64, error) {
-	// find the first free page index and return it
 	if pf.freePageCount == 0 {
-		return -1, nil
+		if pf.freePageChain == 0 {
+			return -1, nil
+		}
+		// pop from the chain
+		offset := pf.freePageChain
+		next, ok, err := pf.readFreePage(offset)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 0, fmt.Errorf("page at offset %d in the free page chain is not free", offset)
+		}
+		pf.freePageChain = next
+		if err := pf.writeFreePageIndices(); err != nil {
+			return 0, err
+		}
+		return offset, nil
 	}
 	// pop from the tail
 	tail := (pf.freePageHead - pf.freePageCount + len(pf.freePageIndexes)) % len(pf.freePageIndexes)
@@ -130,8 +530,34 @@ func (pf *PageFile) FreePageIndex() (int64, error) {
 	return offset, nil
 }
 
+// FreePages returns the offsets of the pages that have been freed and not
+// reused yet, which reads the pages in the free page chain.
+func (pf *PageFile) FreePages() ([]int64, error) {
+	offsets := make([]int64, pf.freePageCount)
+	tail := (pf.freePageHead - pf.freePageCount + len(pf.freePageIndexes)) % len(pf.freePageIndexes)
+	for i := range offsets {
+		offsets[i] = pf.freePageIndexes[(tail+i)%len(pf.freePageIndexes)]
+	}
+	offsets = append(offsets, pf.legacyFreePages...)
+	for offset := pf.freePageChain; offset != 0; {
+		if len(offsets) > int(pf.LastPage()) {
+			return nil, errors.New("free page chain has a cycle")
+		}
+		next, ok, err := pf.readFreePage(offset)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("page at offset %d in the free page chain is not free", offset)
+		}
+		offsets = append(offsets, offset)
+		offset = next
+	}
+	return offsets, nil
+}
+
 func (pf *PageFile) NewPage(buf []byte) (int64, error) {
-	if buf != nil && len(buf) > pf.pageSize {
+	if buf != nil && len(buf) > pf.PageSize() {
 		return 0, errors.New("buffer is too large")
 	}
 
@@ -140,56 +566,57 @@ func (pf *PageFile) NewPage(buf []byte) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
-	if offset != -1 {
-		// seek to the free page
-		if _, err := pf.ReadWriteSeeker.Seek(offset, io.SeekStart); err != nil {
-			return 0, err
-		}
-	} else {
-		n, err := pf.ReadWriteSeeker.Seek(0, io.SeekEnd)
-		if err != nil {
-			return 0, err
-		}
-		offset = n
-		pf.lastPage++
+	if offset == -1 {
+		offset = pf.end
 	}
-
-	// if the offset is not a multiple of the page size, we need to pad the file
-	// with zeros to the next page boundary.
-	var pad int64
-	if pf.pageSize > 0 && offset%int64(pf.pageSize) != 0 {
-		// Calculate the number of bytes to pad
-		pad = int64(pf.pageSize) - (offset % int64(pf.pageSize))
-		// Write the padding
-		if _, err := pf.Write(make([]byte, pad)); err != nil {
-			return 0, err
-		}
+	if _, err := pf.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
 	}
-	page := make([]byte, pf.pageSize)
+
+	page := make([]byte, pf.PageSize())
 	if buf != nil {
 		copy(page, buf)
 	}
-	if _, err := pf.ReadWriteSeeker.Write(page); err != nil {
+	if _, err := pf.Write(page); err != nil {
 		return 0, err
 	}
-	if _, err := pf.ReadWriteSeeker.Seek(offset, io.SeekStart); err != nil {
+	if _, err := pf.Seek(offset, io.SeekStart); err != nil {
 		return 0, err
 	}
-	return offset + pad, nil
+	return offset, nil
 }
 
+// FreePage returns the page at offset to the free pages. It takes a constant
+// number of reads and writes no matter how many pages are free.
 func (pf *PageFile) FreePage(offset int64) error {
 	if offset%int64(pf.pageSize) != 0 {
 		return errors.New("offset is not a multiple of the page size")
 	}
-	if pf.freePageCount == len(pf.freePageIndexes) {
-		return errors.New("free page index is full")
+	if offset < int64(pf.pageSize) || offset >= pf.end {
+		return errors.New("offset is not a page of the file")
+	}
+	if _, free, err := pf.readFreePage(offset); err != nil {
+		return err
+	} else if free {
+		return errors.New("page is already free")
+	}
+	if err := pf.upgradeFreePageChain(); err != nil {
+		return err
 	}
 
-	for i := range pf.freePageIndexes {
-		if pf.freePageIndexes[i] == offset {
-			return errors.New("offset already exists")
+	if pf.freePageCount == pf.freePageCapacity() {
+		if !pf.chained {
+			// the free page chain can't be recorded without a commit
+			// record.
+			return errors.New("free page index is full")
 		}
+		if err := pf.pushFreePageChain(offset); err != nil {
+			return err
+		}
+		return pf.writeFreePageIndices()
+	}
+	if err := pf.markFreePage(offset, 0); err != nil {
+		return err
 	}
 
 	// push to the head
@@ -200,7 +627,12 @@ func (pf *PageFile) FreePage(offset int64) error {
 	return pf.writeFreePageIndices()
 }
 
+// PageSize returns the number of bytes of each page that can be used, which
+// excludes the checksum.
 func (pf *PageFile) PageSize() int {
+	if pf.checksums {
+		return pf.pageSize - checksumSize
+	}
 	return pf.pageSize
 }
 
@@ -209,5 +641,9 @@ func (pf *PageFile) SlotSize() int {
 }
 
 func (pf *PageFile) PageCount() int64 {
-	return pf.lastPage
+	return pf.LastPage()
+}
+
+func roundUp(n, multiple int64) int64 {
+	return (n + multiple - 1) / multiple * multiple
 }
@@ -2,26 +2,16 @@
 
 package pagefile
 
-import "io"
-
 func (pf *PageFile) Write(buf []byte) (int, error) {
-	n, err := pf.ReadWriteSeeker.Seek(0, io.SeekCurrent)
-	if err != nil {
-		return 0, err
-	}
-	if n%int64(pf.pageSize)+int64(len(buf)) > int64(pf.pageSize) {
+	if pf.pos%int64(pf.pageSize)+int64(len(buf)) > int64(pf.PageSize()) {
 		panic("writing across page boundary not allowed")
 	}
-	return pf.ReadWriteSeeker.Write(buf)
+	return pf.write(buf)
 }
 
 func (pf *PageFile) Read(buf []byte) (int, error) {
-	n, err := pf.ReadWriteSeeker.Seek(0, io.SeekCurrent)
-	if err != nil {
-		return 0, err
-	}
-	if n%int64(pf.pageSize)+int64(len(buf)) > int64(pf.pageSize) {
+	if pf.pos%int64(pf.pageSize)+int64(len(buf)) > int64(pf.PageSize()) {
 		panic("reading across page boundary not allowed")
 	}
-	return pf.ReadWriteSeeker.Read(buf)
+	return pf.read(buf)
 }
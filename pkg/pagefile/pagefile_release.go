@@ -0,0 +1,11 @@
+//go:build release
+
+package pagefile
+
+func (pf *PageFile) Write(buf []byte) (int, error) {
+	return pf.write(buf)
+}
+
+func (pf *PageFile) Read(buf []byte) (int, error) {
+	return pf.read(buf)
+}
@@ -1,6 +1,8 @@
 package pagefile
 
 import (
+	"encoding/binary"
+	"errors"
 	"io"
 	"testing"
 
@@ -193,6 +195,230 @@ func TestPageFile(t *testing.T) {
 		}
 	})
 
+	t.Run("free pages past the first page are chained", func(t *testing.T) {
+		buf := buftest.NewSeekableBuffer()
+		pf, err := NewPageFile(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 3 * maxFreePageIndices
+		offsets := make(map[int64]bool)
+		for i := 0; i < n; i++ {
+			offset, err := pf.NewPage(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			offsets[offset] = true
+		}
+		for offset := range offsets {
+			if err := pf.FreePage(offset); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for offset := range offsets {
+			if err := pf.FreePage(offset); err == nil {
+				t.Fatal("expected error")
+			}
+			break
+		}
+
+		pf, err = NewPageFile(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		free, err := pf.FreePages()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(free) != n {
+			t.Fatalf("expected %d free pages, got %d", n, len(free))
+		}
+		for i := 0; i < n; i++ {
+			offset, err := pf.NewPage(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !offsets[offset] {
+				t.Fatalf("expected a free page, got %d", offset)
+			}
+			delete(offsets, offset)
+		}
+		if pf.PageCount() != int64(n+1) {
+			t.Fatalf("expected %d pages, got %d", n+1, pf.PageCount())
+		}
+	})
+
+	t.Run("chained free pages are rolled back", func(t *testing.T) {
+		buf := buftest.NewSeekableBuffer()
+		pf, err := NewPageFile(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := maxFreePageIndices + 10
+		offsets := make([]int64, n)
+		for i := range offsets {
+			if offsets[i], err = pf.NewPage(nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, offset := range offsets[:n-5] {
+			if err := pf.FreePage(offset); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := pf.Begin(); err != nil {
+			t.Fatal(err)
+		}
+		for _, offset := range offsets[n-5:] {
+			if err := pf.FreePage(offset); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := pf.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+
+		pf, err = NewPageFile(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		free, err := pf.FreePages()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(free) != n-5 {
+			t.Fatalf("expected %d free pages, got %d", n-5, len(free))
+		}
+		if err := pf.FreePage(offsets[n-1]); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("files without a free page chain are upgraded", func(t *testing.T) {
+		// files written before the free page chain was added use every slot
+		// of the first page for free page indexes.
+		buf := buftest.NewSeekableBuffer()
+		pf, err := NewPageFile(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets := make(map[int64]bool)
+		for i := 0; i <= maxFreePageIndices; i++ {
+			offset, err := pf.NewPage(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			offsets[offset] = true
+		}
+		pf.committed, pf.chained = false, false
+		var last int64
+		for offset := range offsets {
+			if pf.freePageCount == maxFreePageIndices {
+				last = offset
+				break
+			}
+			if err := pf.FreePage(offset); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := pf.FreePage(last); err == nil {
+			t.Fatal("expected error")
+		}
+		if err := pf.writeCommitRecord(commitRecord{end: uint64(pf.end)}); err != nil {
+			t.Fatal(err)
+		}
+
+		pf, err = NewPageFile(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pf.chained || pf.freePageCount != maxFreePageIndices {
+			t.Fatalf("expected %d unchained free pages, got %d", maxFreePageIndices, pf.freePageCount)
+		}
+		if err := pf.FreePage(last); err != nil {
+			t.Fatal(err)
+		}
+
+		pf, err = NewPageFile(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pf.chained {
+			t.Fatal("expected the free page chain")
+		}
+		for range offsets {
+			offset, err := pf.NewPage(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !offsets[offset] {
+				t.Fatalf("expected a free page, got %d", offset)
+			}
+			delete(offsets, offset)
+		}
+	})
+
+	t.Run("free pages of files without a commit record are kept", func(t *testing.T) {
+		// files written before the commit record was added use all of the
+		// first 4096 bytes for free page indexes.
+		buf := buftest.NewSeekableBuffer()
+		file := make([]byte, (legacyFreePageIndices+2)*pageSizeBytes)
+		for i := 0; i < legacyFreePageIndices; i++ {
+			binary.LittleEndian.PutUint64(file[i*8:], uint64((i+1)*pageSizeBytes))
+		}
+		if _, err := buf.Write(file); err != nil {
+			t.Fatal(err)
+		}
+
+		pf, err := NewPageFile(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		free, err := pf.FreePages()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(free) != legacyFreePageIndices {
+			t.Fatalf("got %d free pages, want %d", len(free), legacyFreePageIndices)
+		}
+
+		// the first commit writes the commit record over the last free page
+		// indexes, so they're moved to the free page chain.
+		if err := pf.Begin(); err != nil {
+			t.Fatal(err)
+		}
+		if err := writePage(pf, int64(legacyFreePageIndices+1)*pageSizeBytes, "data"); err != nil {
+			t.Fatal(err)
+		}
+		if err := pf.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		pf, err = NewPageFile(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pf.committed || !pf.chained {
+			t.Fatal("expected a commit record and the free page chain")
+		}
+		offsets := make(map[int64]bool)
+		for range legacyFreePageIndices {
+			offset, err := pf.NewPage(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if offsets[offset] || offset < pageSizeBytes || offset > legacyFreePageIndices*pageSizeBytes {
+				t.Fatalf("expected a new free page, got %d", offset)
+			}
+			offsets[offset] = true
+		}
+		if offset, err := pf.NewPage(nil); err != nil {
+			t.Fatal(err)
+		} else if offset != (legacyFreePageIndices+2)*pageSizeBytes {
+			t.Fatalf("expected a page at the end, got %d", offset)
+		}
+	})
+
 	t.Run("track number of pages", func(t *testing.T) {
 		buf := buftest.NewSeekableBuffer()
 		pf, err := NewPageFile(buf)
@@ -229,3 +455,69 @@ func TestPageFile(t *testing.T) {
 		}
 	})
 }
+
+func TestPageSize(t *testing.T) {
+	t.Run("page size is persisted", func(t *testing.T) {
+		buf := buftest.NewSeekableBuffer()
+		pf, err := NewPageFileSize(buf, 16384)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pf.PageSize() != 16384-checksumSize {
+			t.Fatalf("expected page size %d, got %d", 16384-checksumSize, pf.PageSize())
+		}
+		offset, err := pf.NewPage([]byte("page1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offset != 16384 {
+			t.Fatalf("expected offset 16384, got %d", offset)
+		}
+		if len(buf.Bytes()) != 2*16384 {
+			t.Fatalf("expected %d bytes, got %d", 2*16384, len(buf.Bytes()))
+		}
+
+		// the page size of an existing file is used.
+		pf, err = NewPageFile(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pf.PageSize() != 16384-checksumSize {
+			t.Fatalf("expected page size %d, got %d", 16384-checksumSize, pf.PageSize())
+		}
+		if got := readPage(t, pf, 16384); string(got) != "page1" {
+			t.Fatalf("got %q, want page1", got)
+		}
+		if err := pf.Begin(); err != nil {
+			t.Fatal(err)
+		}
+		if err := writePage(pf, 0, "free"); err != nil {
+			t.Fatal(err)
+		}
+		if err := writePage(pf, 16384, "PAGE"); err != nil {
+			t.Fatal(err)
+		}
+		if err := pf.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		pf, err = NewPageFileSize(buf, 65536)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pf.PageCount() != 2 {
+			t.Fatalf("expected 2 pages, got %d", pf.PageCount())
+		}
+		if got := readPage(t, pf, 16384); string(got) != "PAGE1" {
+			t.Fatalf("got %q, want PAGE1", got)
+		}
+	})
+
+	t.Run("invalid page sizes are rejected", func(t *testing.T) {
+		for _, size := range []int{0, 2048, 5000, 128 * 1024} {
+			if _, err := NewPageFileSize(buftest.NewSeekableBuffer(), size); !errors.Is(err, ErrPageSize) {
+				t.Fatalf("got %v for page size %d, want ErrPageSize", err, size)
+			}
+		}
+	})
+}
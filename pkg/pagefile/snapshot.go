@@ -0,0 +1,159 @@
+package pagefile
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrReadOnly is returned when writing to a snapshot.
+var ErrReadOnly = errors.New("page file is read-only")
+
+// ErrSnapshotClosed is returned when reading from a closed snapshot.
+var ErrSnapshotClosed = errors.New("snapshot is closed")
+
+// Snapshot is a read-only page file that reads the pages of another page
+// file as they were when it was taken, see PageFile.Snapshot.
+type Snapshot struct {
+	*PageFile
+	file *snapshotFile
+}
+
+// Snapshot returns a read-only copy of the committed pages of pf. While a
+// transaction is in progress, that's the pages as they were when it began.
+//
+// The snapshot can be read from other goroutines while pf is written. Before
+// pf overwrites a page that the snapshot reads, the page is copied to the
+// snapshot, so the snapshot holds every page that was overwritten since it
+// was taken in memory until it's closed. Writes made outside of transactions
+// are only seen by snapshots taken after them, but each of them is seen on its
+// own.
+//
+// The underlying file must implement io.ReaderAt.
+func (pf *PageFile) Snapshot() (*Snapshot, error) {
+	ra, ok := pf.ReadWriteSeeker.(io.ReaderAt)
+	if !ok {
+		return nil, errors.New("underlying file does not implement io.ReaderAt")
+	}
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	f := &snapshotFile{pf: pf, ra: ra, end: pf.visibleEnd, pages: make(map[int64][]byte)}
+	if pf.snapshots == nil {
+		pf.snapshots = make(map[*snapshotFile]struct{})
+	}
+	pf.snapshots[f] = struct{}{}
+	return &Snapshot{
+		PageFile: &PageFile{
+			ReadWriteSeeker: f,
+			pageSize:        pf.pageSize,
+			slotSize:        pf.slotSize,
+			end:             f.end,
+			visibleEnd:      f.end,
+			checksums:       pf.checksums,
+		},
+		file: f,
+	}, nil
+}
+
+// Close releases the pages that the snapshot holds. It must not be read
+// afterwards.
+func (s *Snapshot) Close() error {
+	pf := s.file.pf
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	delete(pf.snapshots, s.file)
+	s.file.pages = nil
+	s.file.closed = true
+	return nil
+}
+
+// snapshotFile reads the underlying file of pf up to end, preferring the
+// pages that were copied to it before they were overwritten. Its fields are
+// guarded by pf.mu.
+type snapshotFile struct {
+	pf  *PageFile
+	ra  io.ReaderAt
+	end int64
+	pos int64
+
+	pages  map[int64][]byte
+	closed bool
+}
+
+func (f *snapshotFile) Read(buf []byte) (int, error) {
+	f.pf.mu.Lock()
+	defer f.pf.mu.Unlock()
+	if f.closed {
+		return 0, ErrSnapshotClosed
+	}
+	if f.pos >= f.end {
+		return 0, io.EOF
+	}
+	if int64(len(buf)) > f.end-f.pos {
+		buf = buf[:f.end-f.pos]
+	}
+	pageSize := int64(f.pf.pageSize)
+	n := 0
+	for n < len(buf) {
+		start := f.pos - f.pos%pageSize
+		chunk := buf[n:min(int64(len(buf)), int64(n)+start+pageSize-f.pos)]
+		if page, ok := f.pages[start]; ok {
+			copy(chunk, page[f.pos-start:])
+		} else if _, err := f.ra.ReadAt(chunk, f.pos); err != nil && !errors.Is(err, io.EOF) {
+			return n, err
+		}
+		n += len(chunk)
+		f.pos += int64(len(chunk))
+	}
+	return n, nil
+}
+
+func (f *snapshotFile) Write([]byte) (int, error) {
+	return 0, ErrReadOnly
+}
+
+func (f *snapshotFile) Seek(offset int64, whence int) (int64, error) {
+	f.pf.mu.Lock()
+	defer f.pf.mu.Unlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += f.end
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+// preserve copies the pages between offset and offset+n to the snapshots
+// that read them, before they are overwritten. pf.mu must be held.
+func (pf *PageFile) preserve(offset, n int64) error {
+	size := int64(pf.pageSize)
+	for start := offset - offset%size; start < offset+n && len(pf.snapshots) > 0; start += size {
+		if start == 0 {
+			// the free page indexes and the commit record aren't read by
+			// snapshots.
+			continue
+		}
+		var page []byte
+		for f := range pf.snapshots {
+			if _, ok := f.pages[start]; ok || start >= f.end {
+				continue
+			}
+			if page == nil {
+				page = make([]byte, size)
+				if _, err := f.ra.ReadAt(page, start); err != nil && !errors.Is(err, io.EOF) {
+					return err
+				}
+			}
+			// the copy is shared by the snapshots, which don't modify it.
+			f.pages[start] = page
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package pagefile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/kevmo314/appendable/pkg/buftest"
+)
+
+func TestSnapshot(t *testing.T) {
+	// newFile returns a page file with two pages.
+	newFile := func(t *testing.T) *PageFile {
+		pf, err := NewPageFile(buftest.NewSeekableBuffer())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, data := range []string{"old1", "old2"} {
+			if _, err := pf.NewPage([]byte(data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return pf
+	}
+
+	t.Run("snapshots read the pages as they were", func(t *testing.T) {
+		pf := newFile(t)
+		s, err := pf.Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		if err := pf.Begin(); err != nil {
+			t.Fatal(err)
+		}
+		if err := writePage(pf, pageSizeBytes, "new1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pf.NewPage([]byte("new3")); err != nil {
+			t.Fatal(err)
+		}
+		if err := pf.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		if err := writePage(pf, 2*pageSizeBytes, "new2"); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := string(readPage(t, s.PageFile, pageSizeBytes)); got != "old1" {
+			t.Fatalf("got %q, want old1", got)
+		}
+		if got := string(readPage(t, s.PageFile, 2*pageSizeBytes)); got != "old2" {
+			t.Fatalf("got %q, want old2", got)
+		}
+		if s.LastPage() != 3 {
+			t.Fatalf("got %d pages, want 3", s.LastPage())
+		}
+		if got := string(readPage(t, pf, pageSizeBytes)); got != "new1" {
+			t.Fatalf("got %q, want new1", got)
+		}
+	})
+
+	t.Run("snapshots don't see transactions in progress", func(t *testing.T) {
+		pf := newFile(t)
+		if err := pf.Begin(); err != nil {
+			t.Fatal(err)
+		}
+		if err := writePage(pf, pageSizeBytes, "new1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pf.NewPage([]byte("new3")); err != nil {
+			t.Fatal(err)
+		}
+		s, err := pf.Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		if err := pf.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := string(readPage(t, s.PageFile, pageSizeBytes)); got != "old1" {
+			t.Fatalf("got %q, want old1", got)
+		}
+		if s.LastPage() != 3 {
+			t.Fatalf("got %d pages, want 3", s.LastPage())
+		}
+	})
+
+	t.Run("snapshots are read-only", func(t *testing.T) {
+		pf := newFile(t)
+		s, err := pf.Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		if err := writePage(s.PageFile, pageSizeBytes, "new1"); !errors.Is(err, ErrReadOnly) {
+			t.Fatalf("got %v, want ErrReadOnly", err)
+		}
+		if _, err := s.NewPage([]byte("new3")); !errors.Is(err, ErrReadOnly) {
+			t.Fatalf("got %v, want ErrReadOnly", err)
+		}
+		if got := string(readPage(t, pf, pageSizeBytes)); got != "old1" {
+			t.Fatalf("got %q, want old1", got)
+		}
+	})
+
+	t.Run("closed snapshots don't hold pages", func(t *testing.T) {
+		pf := newFile(t)
+		s, err := pf.Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := writePage(pf, pageSizeBytes, "new1"); err != nil {
+			t.Fatal(err)
+		}
+		if len(s.file.pages) != 0 || len(pf.snapshots) != 0 {
+			t.Fatal("expected the snapshot to be released")
+		}
+		if _, err := s.Seek(pageSizeBytes, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Read(make([]byte, 4)); !errors.Is(err, ErrSnapshotClosed) {
+			t.Fatalf("got %v, want ErrSnapshotClosed", err)
+		}
+	})
+
+	t.Run("snapshots can be read while committing", func(t *testing.T) {
+		pf := newFile(t)
+		var wg sync.WaitGroup
+		done := make(chan struct{})
+		errs := make(chan error, 1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				s, err := pf.Snapshot()
+				if err != nil {
+					errs <- err
+					return
+				}
+				// both pages are written in the same transaction.
+				buf1, buf2 := make([]byte, 8), make([]byte, 8)
+				for _, r := range []struct {
+					offset int64
+					buf    []byte
+				}{{pageSizeBytes, buf1}, {2 * pageSizeBytes, buf2}} {
+					if _, err := s.Seek(r.offset, io.SeekStart); err != nil {
+						errs <- err
+						return
+					}
+					if _, err := s.Read(r.buf); err != nil {
+						errs <- err
+						return
+					}
+				}
+				s.Close()
+				if string(buf1[:3]) == "old" && string(buf2[:3]) == "old" {
+					continue
+				}
+				if string(buf1) != string(buf2) {
+					errs <- fmt.Errorf("got %q and %q", buf1, buf2)
+					return
+				}
+			}
+		}()
+		for j := 0; j < 1000; j++ {
+			if err := pf.Begin(); err != nil {
+				t.Fatal(err)
+			}
+			for _, offset := range []int64{pageSizeBytes, 2 * pageSizeBytes} {
+				if err := writePage(pf, offset, fmt.Sprintf("new%05d", j)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := pf.Commit(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		close(done)
+		wg.Wait()
+		select {
+		case err := <-errs:
+			t.Fatal(err)
+		default:
+		}
+	})
+}
@@ -0,0 +1,369 @@
+package pagefile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+)
+
+// The commit record is stored at the end of the first 4096 bytes of the
+// file, whatever the page size is, and says which part of the file is
+// committed:
+//
+//	[magic 4][flags 4][end 8][journal offset 8][journal pages 4][journal crc 4][crc 4]
+//
+// The journal holds the pages that a commit overwrites. It starts with the
+// offsets of those pages, padded to a whole number of pages, followed by
+// the new contents of each page.
+const commitRecordSize = 36
+
+const commitRecordOffset = pageSizeBytes - commitRecordSize
+
+var commitRecordMagic = [4]byte{'a', 'p', 'c', 'r'}
+
+// flagChecksums is set in the commit record of files whose pages end with a
+// checksum. Files created before checksums were added don't have it.
+const flagChecksums = 1 << 0
+
+// flagFreePageChain is set in the commit record of files whose free pages
+// that don't fit in the first page are chained, see FreePage.
+const flagFreePageChain = 1 << 1
+
+// pageSizeFlagShift is the position in the flags of the number of times that
+// 4096 is doubled to get the page size, so files written before the page size
+// was configurable have 4096 byte pages.
+const pageSizeFlagShift = 8
+
+// ErrTransaction is returned by Begin if a transaction is already in
+// progress and by Commit and Rollback if there is none.
+var ErrTransaction = errors.New("invalid transaction state")
+
+type commitRecord struct {
+	flags uint32
+	// end is the offset after the last committed page.
+	end uint64
+
+	journalOffset uint64
+	journalPages  uint32
+	journalCRC    uint32
+}
+
+func (r commitRecord) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, commitRecordSize)
+	copy(buf, commitRecordMagic[:])
+	binary.LittleEndian.PutUint32(buf[4:], r.flags)
+	binary.LittleEndian.PutUint64(buf[8:], r.end)
+	binary.LittleEndian.PutUint64(buf[16:], r.journalOffset)
+	binary.LittleEndian.PutUint32(buf[24:], r.journalPages)
+	binary.LittleEndian.PutUint32(buf[28:], r.journalCRC)
+	binary.LittleEndian.PutUint32(buf[32:], crc32.Checksum(buf[:32], castagnoli))
+	return buf, nil
+}
+
+func (r *commitRecord) UnmarshalBinary(buf []byte) error {
+	if len(buf) < commitRecordSize || [4]byte(buf[:4]) != commitRecordMagic {
+		return errors.New("missing commit record")
+	}
+	if binary.LittleEndian.Uint32(buf[32:]) != crc32.Checksum(buf[:32], castagnoli) {
+		return errors.New("commit record checksum mismatch")
+	}
+	r.flags = binary.LittleEndian.Uint32(buf[4:])
+	r.end = binary.LittleEndian.Uint64(buf[8:])
+	r.journalOffset = binary.LittleEndian.Uint64(buf[16:])
+	r.journalPages = binary.LittleEndian.Uint32(buf[24:])
+	r.journalCRC = binary.LittleEndian.Uint32(buf[28:])
+	return nil
+}
+
+// transaction buffers the writes to pages that existed when it began.
+type transaction struct {
+	pf *PageFile
+
+	// committedEnd is the end of the file when the transaction began.
+	// Pages after it aren't referenced by the committed file, so they are
+	// written directly.
+	committedEnd int64
+	dirty        map[int64][]byte
+
+	// the state to restore on rollback.
+	freePageIndexes             [maxFreePageIndices]int64
+	freePageHead, freePageCount int
+	chained                     bool
+	freePageChain               int64
+}
+
+// Begin starts a transaction. Until it is committed, pages that already
+// exist are only modified in memory and new pages are only referenced by
+// the commit record once it is committed, so if the process crashes the
+// file is read as it was before Begin.
+func (pf *PageFile) Begin() error {
+	if pf.tx != nil {
+		return ErrTransaction
+	}
+	pf.tx = &transaction{
+		pf:              pf,
+		committedEnd:    pf.end,
+		dirty:           make(map[int64][]byte),
+		freePageIndexes: pf.freePageIndexes,
+		freePageHead:    pf.freePageHead,
+		freePageCount:   pf.freePageCount,
+		chained:         pf.chained,
+		freePageChain:   pf.freePageChain,
+	}
+	return nil
+}
+
+// Rollback discards the changes made since Begin.
+func (pf *PageFile) Rollback() error {
+	tx := pf.tx
+	if tx == nil {
+		return ErrTransaction
+	}
+	pf.tx = nil
+	pf.end = tx.committedEnd
+	pf.freePageIndexes = tx.freePageIndexes
+	pf.freePageHead = tx.freePageHead
+	pf.freePageCount = tx.freePageCount
+	pf.chained = tx.chained
+	pf.freePageChain = tx.freePageChain
+	_, err := pf.Seek(0, io.SeekStart)
+	return err
+}
+
+// Commit atomically writes the changes made since Begin.
+//
+// The pages that are overwritten are first written to a journal after the
+// last page. Once the journal is synced, the commit record is updated to
+// point at it, which is the point where the transaction is committed, and
+// the pages are copied to their place. If the process crashes while they are
+// copied, NewPageFile replays the journal. The pages are copied in order of
+// their offset, so a reader in another process that reads the lowest page
+// that every commit writes before and after reading other pages, see
+// CommitState, can tell whether a commit changed them.
+//
+// Writes are synced if the underlying file has a Sync method and the journal
+// is removed if it has a Truncate method.
+func (pf *PageFile) Commit() error {
+	tx := pf.tx
+	if tx == nil {
+		return ErrTransaction
+	}
+	if len(tx.dirty) == 0 && pf.end == tx.committedEnd {
+		pf.tx = nil
+		return nil
+	}
+	// the free page indexes of files without a commit record overlap it.
+	if err := pf.upgradeLegacyFreePages(); err != nil {
+		return err
+	}
+
+	offsets := make([]int64, 0, len(tx.dirty))
+	for offset, page := range tx.dirty {
+		pf.seal(offset, page)
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	journal := pf.journal(offsets, tx.dirty)
+	record := commitRecord{
+		end:           uint64(pf.end),
+		journalOffset: uint64(pf.end),
+		journalPages:  uint32(len(offsets)),
+		journalCRC:    crc32.Checksum(journal, castagnoli),
+	}
+	if err := pf.writeAt(journal, pf.end); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := pf.sync(); err != nil {
+		return err
+	}
+	if err := pf.writeCommitRecord(record); err != nil {
+		return err
+	}
+	if err := pf.sync(); err != nil {
+		return err
+	}
+
+	// the transaction is committed, so it must not be rolled back from here.
+	pf.tx = nil
+	pf.legacyFreePages = nil
+	if err := pf.apply(offsets, tx.dirty); err != nil {
+		return err
+	}
+	if err := pf.truncateJournal(); err != nil {
+		return err
+	}
+	_, err := pf.Seek(0, io.SeekStart)
+	return err
+}
+
+// journal returns the journal of the pages at offsets.
+func (pf *PageFile) journal(offsets []int64, pages map[int64][]byte) []byte {
+	n := roundUp(int64(len(offsets)*8), int64(pf.pageSize))
+	journal := make([]byte, n, n+int64(len(offsets)*pf.pageSize))
+	for i, offset := range offsets {
+		binary.LittleEndian.PutUint64(journal[i*8:], uint64(offset))
+	}
+	for _, offset := range offsets {
+		journal = append(journal, pages[offset]...)
+	}
+	return journal
+}
+
+// apply writes the pages to their place, then clears the journal from the
+// commit record. Snapshots can't be taken while the pages are written, so
+// they see either none or all of them.
+func (pf *PageFile) apply(offsets []int64, pages map[int64][]byte) error {
+	if err := pf.applyPages(offsets, pages); err != nil {
+		return err
+	}
+	if err := pf.sync(); err != nil {
+		return err
+	}
+	if err := pf.writeCommitRecord(commitRecord{end: uint64(pf.end)}); err != nil {
+		return err
+	}
+	return pf.sync()
+}
+
+func (pf *PageFile) applyPages(offsets []int64, pages map[int64][]byte) error {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	for _, offset := range offsets {
+		page := pages[offset]
+		if offset == 0 {
+			// the commit record in the first page is only written through
+			// writeCommitRecord.
+			if len(page) > pageSizeBytes {
+				if err := pf.writeAtLocked(page[pageSizeBytes:], pageSizeBytes); err != nil {
+					return fmt.Errorf("failed to apply journal: %w", err)
+				}
+			}
+			page = page[:commitRecordOffset]
+		}
+		if err := pf.writeAtLocked(page, offset); err != nil {
+			return fmt.Errorf("failed to apply journal: %w", err)
+		}
+	}
+	pf.visibleEnd = pf.end
+	return nil
+}
+
+// replay applies the journal of a commit that may not have been applied.
+func (pf *PageFile) replay(record commitRecord) error {
+	n := int64(record.journalPages)
+	size := roundUp(n*8, int64(pf.pageSize)) + n*int64(pf.pageSize)
+	journal := make([]byte, size)
+	if _, err := pf.ReadWriteSeeker.Seek(int64(record.journalOffset), io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(pf.ReadWriteSeeker, journal); err != nil {
+		return fmt.Errorf("failed to read journal: %w", err)
+	}
+	// the journal is synced before the commit record points at it.
+	if crc32.Checksum(journal, castagnoli) != record.journalCRC {
+		return &CorruptPageError{Offset: int64(record.journalOffset), Err: ErrChecksumMismatch}
+	}
+
+	offsets := make([]int64, n)
+	pages := make(map[int64][]byte, n)
+	images := journal[roundUp(n*8, int64(pf.pageSize)):]
+	for i := range offsets {
+		offsets[i] = int64(binary.LittleEndian.Uint64(journal[i*8:]))
+		pages[offsets[i]] = images[int64(i)*int64(pf.pageSize) : int64(i+1)*int64(pf.pageSize)]
+	}
+	if err := pf.apply(offsets, pages); err != nil {
+		return err
+	}
+	return pf.truncateJournal()
+}
+
+func (pf *PageFile) writeAt(buf []byte, offset int64) error {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	return pf.writeAtLocked(buf, offset)
+}
+
+// writeAtLocked is writeAt with pf.mu held. The pages that it overwrites are
+// copied to the snapshots that read them first.
+func (pf *PageFile) writeAtLocked(buf []byte, offset int64) error {
+	if err := pf.preserve(offset, int64(len(buf))); err != nil {
+		return err
+	}
+	if _, err := pf.ReadWriteSeeker.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := pf.ReadWriteSeeker.Write(buf)
+	return err
+}
+
+func (pf *PageFile) writeCommitRecord(record commitRecord) error {
+	if pf.checksums {
+		record.flags |= flagChecksums
+	}
+	if pf.chained {
+		record.flags |= flagFreePageChain
+	}
+	record.flags |= uint32(pageSizeShift(pf.pageSize)) << pageSizeFlagShift
+	buf, err := record.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err := pf.writeAt(buf, commitRecordOffset); err != nil {
+		return fmt.Errorf("failed to write commit record: %w", err)
+	}
+	pf.committed = true
+	if pf.tx == nil {
+		// restore the position of the underlying file.
+		pf.mu.Lock()
+		defer pf.mu.Unlock()
+		if _, err := pf.ReadWriteSeeker.Seek(pf.pos, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CommitState returns the commit record of the page file in r, which changes
+// when a commit is written, and whether the pages of a commit are still being
+// copied to their place. Readers in other processes use it to detect commits.
+func CommitState(r io.ReadSeeker) ([]byte, bool, error) {
+	buf := make([]byte, commitRecordSize)
+	if _, err := r.Seek(commitRecordOffset, io.SeekStart); err != nil {
+		return nil, false, err
+	}
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			// the file is empty.
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	var record commitRecord
+	if err := record.UnmarshalBinary(buf); err != nil {
+		// files written without transactions don't have a commit record.
+		return buf, false, nil
+	}
+	return buf, record.journalPages > 0, nil
+}
+
+func (pf *PageFile) sync() error {
+	if s, ok := pf.ReadWriteSeeker.(interface{ Sync() error }); ok {
+		pf.mu.Lock()
+		defer pf.mu.Unlock()
+		return s.Sync()
+	}
+	return nil
+}
+
+func (pf *PageFile) truncateJournal() error {
+	if t, ok := pf.ReadWriteSeeker.(interface{ Truncate(int64) error }); ok {
+		pf.mu.Lock()
+		defer pf.mu.Unlock()
+		return t.Truncate(pf.end)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package pagefile
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/kevmo314/appendable/pkg/buftest"
+)
+
+func readPage(t *testing.T, pf *PageFile, offset int64) []byte {
+	t.Helper()
+	if _, err := pf.Seek(offset, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, pf.PageSize())
+	if _, err := pf.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.TrimRight(buf, "\x00")
+}
+
+func writePage(pf *PageFile, offset int64, data string) error {
+	if _, err := pf.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := pf.Write([]byte(data))
+	return err
+}
+
+func TestTransaction(t *testing.T) {
+	// newFile returns a page file with two pages.
+	newFile := func(t *testing.T) *buftest.SeekableBuffer {
+		buf := buftest.NewSeekableBuffer()
+		pf, err := NewPageFile(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, data := range []string{"old1", "old2"} {
+			if _, err := pf.NewPage([]byte(data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return buf
+	}
+
+	t.Run("commit writes changes", func(t *testing.T) {
+		buf := newFile(t)
+		pf, err := NewPageFile(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pf.Begin(); err != nil {
+			t.Fatal(err)
+		}
+		if err := writePage(pf, pageSizeBytes, "new1"); err != nil {
+			t.Fatal(err)
+		}
+		offset, err := pf.NewPage([]byte("new3"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// reads within the transaction see its writes.
+		if got := readPage(t, pf, pageSizeBytes); string(got) != "new1" {
+			t.Fatalf("got %q, want new1", got)
+		}
+		if err := pf.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		pf, err = NewPageFile(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pf.PageCount() != 4 {
+			t.Fatalf("got %d pages, want 4", pf.PageCount())
+		}
+		for offset, want := range map[int64]string{pageSizeBytes: "new1", 2 * pageSizeBytes: "old2", offset: "new3"} {
+			if got := readPage(t, pf, offset); string(got) != want {
+				t.Fatalf("got %q at %d, want %q", got, offset, want)
+			}
+		}
+		// the journal is removed once it is applied.
+		if len(buf.Bytes()) != 4*pageSizeBytes {
+			t.Fatalf("got %d bytes, want %d", len(buf.Bytes()), 4*pageSizeBytes)
+		}
+	})
+
+	t.Run("rollback discards changes", func(t *testing.T) {
+		buf := newFile(t)
+		pf, err := NewPageFile(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pf.Begin(); err != nil {
+			t.Fatal(err)
+		}
+		if err := writePage(pf, pageSizeBytes, "new1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := pf.FreePage(2 * pageSizeBytes); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pf.NewPage([]byte("new3")); err != nil {
+			t.Fatal(err)
+		}
+		if err := pf.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := readPage(t, pf, pageSizeBytes); string(got) != "old1" {
+			t.Fatalf("got %q, want old1", got)
+		}
+		if pf.PageCount() != 3 {
+			t.Fatalf("got %d pages, want 3", pf.PageCount())
+		}
+		// the freed page is still in use, so a new page is appended.
+		if offset, err := pf.NewPage(nil); err != nil {
+			t.Fatal(err)
+		} else if offset != 3*pageSizeBytes {
+			t.Fatalf("got offset %d, want %d", offset, 3*pageSizeBytes)
+		}
+	})
+
+	t.Run("transactions can't be nested", func(t *testing.T) {
+		pf, err := NewPageFile(newFile(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pf.Commit(); !errors.Is(err, ErrTransaction) {
+			t.Fatalf("got %v, want ErrTransaction", err)
+		}
+		if err := pf.Begin(); err != nil {
+			t.Fatal(err)
+		}
+		if err := pf.Begin(); !errors.Is(err, ErrTransaction) {
+			t.Fatalf("got %v, want ErrTransaction", err)
+		}
+	})
+
+	t.Run("a crash leaves either the old or the new pages", func(t *testing.T) {
+		base := newFile(t).Bytes()
+		for writes := 0; ; writes++ {
+			buf := buftest.NewSeekableBuffer()
+			if _, err := buf.Write(base); err != nil {
+				t.Fatal(err)
+			}
+
+			err := func() error {
+				pf, err := NewPageFile(&buftest.CrashingBuffer{SeekableBuffer: buf, Writes: writes})
+				if err != nil {
+					return err
+				}
+				if err := pf.Begin(); err != nil {
+					return err
+				}
+				if err := writePage(pf, pageSizeBytes, "new1"); err != nil {
+					return err
+				}
+				if err := writePage(pf, 2*pageSizeBytes, "new2"); err != nil {
+					return err
+				}
+				if err := pf.FreePage(2 * pageSizeBytes); err != nil {
+					return err
+				}
+				if _, err := pf.NewPage([]byte("new3")); err != nil {
+					return err
+				}
+				if _, err := pf.NewPage([]byte("new4")); err != nil {
+					return err
+				}
+				return pf.Commit()
+			}()
+			if err != nil && !errors.Is(err, buftest.ErrCrashed) {
+				t.Fatal(err)
+			}
+
+			// reopening replays the journal if the commit was interrupted
+			// after it was committed.
+			pf, rerr := NewPageFile(buf)
+			if rerr != nil {
+				t.Fatalf("after %d writes: %v", writes, rerr)
+			}
+			got := []string{
+				string(readPage(t, pf, pageSizeBytes)),
+				string(readPage(t, pf, 2*pageSizeBytes)),
+			}
+			switch {
+			case pf.PageCount() == 3 && got[0] == "old1" && got[1] == "old2":
+			case pf.PageCount() == 4 && got[0] == "new1" && got[1] == "new3" && string(readPage(t, pf, 3*pageSizeBytes)) == "new4":
+			default:
+				t.Fatalf("after %d writes got %d pages with %q", writes, pf.PageCount(), got)
+			}
+
+			if err == nil {
+				if writes == 0 {
+					t.Fatal("expected writes")
+				}
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,411 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+var errCorrupt = errors.New("corrupt page data")
+
+// decodeHybrid decodes n values of the RLE/bit-packing hybrid encoding used
+// for levels and dictionary indexes. It returns the values and the number of
+// bytes consumed.
+func decodeHybrid(buf []byte, width, n int) ([]uint32, int, error) {
+	if width > 32 {
+		return nil, 0, fmt.Errorf("invalid bit width %d", width)
+	}
+	out := make([]uint32, 0, n)
+	pos := 0
+	for len(out) < n {
+		header, m := binary.Uvarint(buf[pos:])
+		if m <= 0 {
+			return nil, 0, errCorrupt
+		}
+		pos += m
+		if header&1 == 0 {
+			// rle run: the value is stored in ceil(width/8) little-endian bytes.
+			count := int(header >> 1)
+			size := (width + 7) / 8
+			if pos+size > len(buf) {
+				return nil, 0, errCorrupt
+			}
+			var v uint32
+			for i := 0; i < size; i++ {
+				v |= uint32(buf[pos+i]) << (8 * i)
+			}
+			pos += size
+			for i := 0; i < count && len(out) < n; i++ {
+				out = append(out, v)
+			}
+		} else {
+			// bit-packed run of groups of eight values, packed lsb first.
+			count := int(header>>1) * 8
+			size := int(header>>1) * width
+			if pos+size > len(buf) {
+				return nil, 0, errCorrupt
+			}
+			packed := buf[pos : pos+size]
+			pos += size
+			for i := 0; i < count && len(out) < n; i++ {
+				var v uint32
+				for b := 0; b < width; b++ {
+					bit := i*width + b
+					v |= uint32(packed[bit/8]>>(bit%8)&1) << b
+				}
+				out = append(out, v)
+			}
+		}
+	}
+	return out, pos, nil
+}
+
+// decodeDeltaBinaryPacked decodes n integers of the DELTA_BINARY_PACKED
+// encoding. It returns the values and the number of bytes consumed.
+func decodeDeltaBinaryPacked(buf []byte, n int) ([]int64, int, error) {
+	r := &compactReader{buf: buf}
+	blockSize, err := r.readUvarint()
+	if err != nil {
+		return nil, 0, errCorrupt
+	}
+	miniblocks, err := r.readUvarint()
+	if err != nil {
+		return nil, 0, errCorrupt
+	}
+	total, err := r.readUvarint()
+	if err != nil {
+		return nil, 0, errCorrupt
+	}
+	value, err := r.readVarint()
+	if err != nil {
+		return nil, 0, errCorrupt
+	}
+	if miniblocks == 0 || blockSize%miniblocks != 0 || total < uint64(n) {
+		return nil, 0, errCorrupt
+	}
+	perMiniblock := int(blockSize / miniblocks)
+
+	out := make([]int64, 0, n)
+	if n > 0 {
+		out = append(out, value)
+	}
+	for len(out) < n {
+		minDelta, err := r.readVarint()
+		if err != nil {
+			return nil, 0, errCorrupt
+		}
+		if r.pos+int(miniblocks) > len(buf) {
+			return nil, 0, errCorrupt
+		}
+		widths := buf[r.pos : r.pos+int(miniblocks)]
+		r.pos += int(miniblocks)
+		for _, width := range widths {
+			if len(out) == n {
+				break
+			}
+			if width > 64 {
+				return nil, 0, errCorrupt
+			}
+			// miniblocks are always padded to their full length.
+			size := perMiniblock * int(width) / 8
+			if r.pos+size > len(buf) {
+				return nil, 0, errCorrupt
+			}
+			packed := buf[r.pos : r.pos+size]
+			r.pos += size
+			for i := 0; i < perMiniblock && len(out) < n; i++ {
+				var delta uint64
+				for b := 0; b < int(width); b++ {
+					bit := i*int(width) + b
+					delta |= uint64(packed[bit/8]>>(bit%8)&1) << b
+				}
+				value += minDelta + int64(delta)
+				out = append(out, value)
+			}
+		}
+	}
+	return out, r.pos, nil
+}
+
+// encodeHybrid encodes values with the RLE/bit-packing hybrid encoding using
+// only rle runs.
+func encodeHybrid(values []uint32, width int) []byte {
+	var buf []byte
+	size := (width + 7) / 8
+	for i := 0; i < len(values); {
+		j := i
+		for j < len(values) && values[j] == values[i] {
+			j++
+		}
+		buf = binary.AppendUvarint(buf, uint64(j-i)<<1)
+		for b := 0; b < size; b++ {
+			buf = append(buf, byte(values[i]>>(8*b)))
+		}
+		i = j
+	}
+	return buf
+}
+
+// decodePlain decodes n values of column type c starting at buf. base is the
+// position of buf in the file, or -1 if buf is not stored verbatim in the
+// file.
+func decodePlain(buf []byte, c Column, n int, base int64) ([]Value, error) {
+	if c.Type == TypeInt96 {
+		c.TypeLength = 12
+	}
+	out := make([]Value, n)
+	pos := 0
+	offset := func() int64 {
+		if base < 0 {
+			return -1
+		}
+		return base + int64(pos)
+	}
+	for i := range out {
+		out[i].Offset = -1
+		switch c.Type {
+		case TypeBoolean:
+			if i/8 >= len(buf) {
+				return nil, errCorrupt
+			}
+			out[i].Boolean = buf[i/8]>>(i%8)&1 == 1
+		case TypeInt32:
+			if pos+4 > len(buf) {
+				return nil, errCorrupt
+			}
+			out[i].Int64 = int64(int32(binary.LittleEndian.Uint32(buf[pos:])))
+			pos += 4
+		case TypeInt64:
+			if pos+8 > len(buf) {
+				return nil, errCorrupt
+			}
+			out[i].Int64 = int64(binary.LittleEndian.Uint64(buf[pos:]))
+			pos += 8
+		case TypeFloat:
+			if pos+4 > len(buf) {
+				return nil, errCorrupt
+			}
+			out[i].Float64 = float64(math.Float32frombits(binary.LittleEndian.Uint32(buf[pos:])))
+			pos += 4
+		case TypeDouble:
+			if pos+8 > len(buf) {
+				return nil, errCorrupt
+			}
+			out[i].Float64 = math.Float64frombits(binary.LittleEndian.Uint64(buf[pos:]))
+			pos += 8
+		case TypeByteArray:
+			if pos+4 > len(buf) {
+				return nil, errCorrupt
+			}
+			m := int(binary.LittleEndian.Uint32(buf[pos:]))
+			pos += 4
+			if m < 0 || pos+m > len(buf) {
+				return nil, errCorrupt
+			}
+			out[i].Offset = offset()
+			out[i].Bytes = buf[pos : pos+m]
+			pos += m
+		case TypeFixedLenByteArray, TypeInt96:
+			m := c.TypeLength
+			if pos+m > len(buf) {
+				return nil, errCorrupt
+			}
+			out[i].Offset = offset()
+			out[i].Bytes = buf[pos : pos+m]
+			pos += m
+		default:
+			return nil, fmt.Errorf("%w type %d", ErrUnsupported, c.Type)
+		}
+	}
+	return out, nil
+}
+
+// encodePlain appends the plain encoding of values to buf.
+func encodePlain(buf []byte, t Type, values []any) ([]byte, error) {
+	var bools byte
+	for i, v := range values {
+		switch t {
+		case TypeBoolean:
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("expected bool, got %T", v)
+			}
+			if b {
+				bools |= 1 << (i % 8)
+			}
+			if i%8 == 7 || i == len(values)-1 {
+				buf = append(buf, bools)
+				bools = 0
+			}
+		case TypeInt32:
+			x, ok := v.(int32)
+			if !ok {
+				return nil, fmt.Errorf("expected int32, got %T", v)
+			}
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(x))
+		case TypeInt64:
+			x, ok := v.(int64)
+			if !ok {
+				return nil, fmt.Errorf("expected int64, got %T", v)
+			}
+			buf = binary.LittleEndian.AppendUint64(buf, uint64(x))
+		case TypeFloat:
+			x, ok := v.(float32)
+			if !ok {
+				return nil, fmt.Errorf("expected float32, got %T", v)
+			}
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(x))
+		case TypeDouble:
+			x, ok := v.(float64)
+			if !ok {
+				return nil, fmt.Errorf("expected float64, got %T", v)
+			}
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(x))
+		case TypeByteArray:
+			var b []byte
+			switch x := v.(type) {
+			case string:
+				b = []byte(x)
+			case []byte:
+				b = x
+			default:
+				return nil, fmt.Errorf("expected string or []byte, got %T", v)
+			}
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(len(b)))
+			buf = append(buf, b...)
+		default:
+			return nil, fmt.Errorf("unsupported type %d", t)
+		}
+	}
+	return buf, nil
+}
+
+func decompress(codec Codec, buf []byte, size int) ([]byte, error) {
+	switch codec {
+	case CodecUncompressed:
+		return buf, nil
+	case CodecSnappy:
+		return decodeSnappy(buf)
+	case CodecGzip:
+		r, err := gzip.NewReader(bytes.NewReader(buf))
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, 0, size)
+		w := bytes.NewBuffer(out)
+		if _, err := io.Copy(w, r); err != nil {
+			return nil, err
+		}
+		return w.Bytes(), nil
+	}
+	return nil, fmt.Errorf("%w compression codec %d", ErrUnsupported, codec)
+}
+
+func compress(codec Codec, buf []byte) ([]byte, error) {
+	switch codec {
+	case CodecUncompressed:
+		return buf, nil
+	case CodecSnappy:
+		return encodeSnappy(buf), nil
+	case CodecGzip:
+		var out bytes.Buffer
+		w := gzip.NewWriter(&out)
+		if _, err := w.Write(buf); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return out.Bytes(), nil
+	}
+	return nil, fmt.Errorf("%w compression codec %d", ErrUnsupported, codec)
+}
+
+// decodeSnappy decodes a snappy block, which is what parquet uses as opposed
+// to the snappy framing format.
+func decodeSnappy(src []byte) ([]byte, error) {
+	n, m := binary.Uvarint(src)
+	if m <= 0 || n > math.MaxInt32 {
+		return nil, errCorrupt
+	}
+	src = src[m:]
+	dst := make([]byte, 0, n)
+	for len(src) > 0 {
+		tag := src[0]
+		var length, offset int
+		switch tag & 3 {
+		case 0:
+			// literal
+			length = int(tag>>2) + 1
+			src = src[1:]
+			if length > 60 {
+				size := length - 60
+				if len(src) < size {
+					return nil, errCorrupt
+				}
+				length = 0
+				for i := 0; i < size; i++ {
+					length |= int(src[i]) << (8 * i)
+				}
+				length++
+				src = src[size:]
+			}
+			if length <= 0 || length > len(src) {
+				return nil, errCorrupt
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+		case 1:
+			if len(src) < 2 {
+				return nil, errCorrupt
+			}
+			length = 4 + int(tag>>2)&7
+			offset = int(tag>>5)<<8 | int(src[1])
+			src = src[2:]
+		case 2:
+			if len(src) < 3 {
+				return nil, errCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case 3:
+			if len(src) < 5 {
+				return nil, errCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+		if offset <= 0 || offset > len(dst) {
+			return nil, errCorrupt
+		}
+		// copies may overlap their own output, so copy byte by byte.
+		start := len(dst) - offset
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[start+i])
+		}
+	}
+	if uint64(len(dst)) != n {
+		return nil, errCorrupt
+	}
+	return dst, nil
+}
+
+// encodeSnappy encodes src as a snappy block consisting only of literals.
+func encodeSnappy(src []byte) []byte {
+	dst := binary.AppendUvarint(nil, uint64(len(src)))
+	for len(src) > 0 {
+		n := min(len(src), 1<<16)
+		// a tag of 61 means the literal length - 1 follows in two bytes.
+		dst = append(dst, 61<<2, byte(n-1), byte((n-1)>>8))
+		dst = append(dst, src[:n]...)
+		src = src[n:]
+	}
+	return dst
+}
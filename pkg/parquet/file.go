@@ -0,0 +1,318 @@
+// parquet implements a minimal reader and writer for parquet files.
+//
+// Only flat columns, that is columns without repetition, can be read. The
+// PLAIN, dictionary, DELTA_BINARY_PACKED and DELTA_LENGTH_BYTE_ARRAY encodings
+// are supported along with the uncompressed, snappy and gzip codecs, which
+// covers the files written by most tools with their default settings.
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var magic = []byte("PAR1")
+
+var (
+	// ErrIncomplete is returned when the data does not end with a parquet
+	// footer, for example because the file is still being written.
+	ErrIncomplete = errors.New("incomplete parquet file")
+
+	// ErrRepeatedColumn is returned when reading a column that is nested in a
+	// repeated field.
+	ErrRepeatedColumn = errors.New("repeated columns are not supported")
+
+	// ErrUnsupported is returned when reading a column that uses a type,
+	// encoding or compression codec that isn't supported.
+	ErrUnsupported = errors.New("unsupported")
+)
+
+// Value is a single value read from a column.
+type Value struct {
+	// Null is set if the value is not defined.
+	Null bool
+
+	Boolean bool
+	// Int64 holds INT32 and INT64 values.
+	Int64 int64
+	// Float64 holds FLOAT and DOUBLE values.
+	Float64 float64
+	// Bytes holds BYTE_ARRAY, FIXED_LEN_BYTE_ARRAY and INT96 values.
+	Bytes []byte
+
+	// Offset is the position of Bytes in the file, or -1 if the value does
+	// not have its own copy in the file, for example because the page is
+	// compressed or the value is dictionary encoded.
+	Offset int64
+}
+
+type File struct {
+	data     []byte
+	metadata *FileMetaData
+	columns  []Column
+}
+
+// Open parses the footer of the parquet file data.
+func Open(data []byte) (*File, error) {
+	if len(data) < 12 || !bytes.Equal(data[len(data)-4:], magic) {
+		return nil, ErrIncomplete
+	}
+	if !bytes.Equal(data[:4], magic) {
+		return nil, fmt.Errorf("not a parquet file")
+	}
+	n := int64(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	if n > int64(len(data)-12) {
+		return nil, fmt.Errorf("invalid footer length %d", n)
+	}
+	metadata, err := decodeFileMetaData(data[int64(len(data)-8)-n : len(data)-8])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode file metadata: %w", err)
+	}
+	cols, err := columns(metadata.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	for _, rg := range metadata.RowGroups {
+		if len(rg.Columns) != len(cols) {
+			return nil, fmt.Errorf("row group has %d columns, expected %d", len(rg.Columns), len(cols))
+		}
+	}
+	return &File{data: data, metadata: metadata, columns: cols}, nil
+}
+
+func (f *File) Metadata() *FileMetaData {
+	return f.metadata
+}
+
+func (f *File) Columns() []Column {
+	return f.columns
+}
+
+func (f *File) RowGroups() []RowGroup {
+	return f.metadata.RowGroups
+}
+
+// ReadColumn decodes every value of a column in a row group.
+func (f *File) ReadColumn(rowGroup, column int) ([]Value, error) {
+	c := f.columns[column]
+	if c.MaxRepetitionLevel > 0 {
+		return nil, ErrRepeatedColumn
+	}
+	chunk := f.metadata.RowGroups[rowGroup].Columns[column]
+
+	pos := chunk.DataPageOffset
+	if chunk.DictionaryPageOffset > 0 && chunk.DictionaryPageOffset < pos {
+		pos = chunk.DictionaryPageOffset
+	}
+
+	var dictionary []Value
+	values := make([]Value, 0, chunk.NumValues)
+	for int64(len(values)) < chunk.NumValues {
+		if pos < 0 || pos >= int64(len(f.data)) {
+			return nil, fmt.Errorf("page offset %d out of bounds", pos)
+		}
+		r := &compactReader{buf: f.data[pos:]}
+		h, err := decodePageHeader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode page header at %d: %w", pos, err)
+		}
+		start := pos + int64(r.pos)
+		end := start + int64(h.compressedSize)
+		if end > int64(len(f.data)) {
+			return nil, fmt.Errorf("page at %d out of bounds", pos)
+		}
+		page := f.data[start:end]
+		pos = end
+
+		switch h.typ {
+		case pageTypeDictionary:
+			buf, err := decompress(chunk.Codec, page, h.uncompressedSize)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decompress dictionary page: %w", err)
+			}
+			base := int64(-1)
+			if chunk.Codec == CodecUncompressed {
+				base = start
+			}
+			if dictionary, err = decodePlain(buf, c, h.numValues, base); err != nil {
+				return nil, fmt.Errorf("failed to decode dictionary page: %w", err)
+			}
+			// dictionary values are shared between rows.
+			for i := range dictionary {
+				dictionary[i].Offset = -1
+			}
+		case pageTypeData, pageTypeDataV2:
+			vs, err := f.readDataPage(c, chunk.Codec, h, page, start, dictionary)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read data page at %d: %w", start, err)
+			}
+			values = append(values, vs...)
+		default:
+			// index pages carry no values.
+		}
+	}
+	return values, nil
+}
+
+func (f *File) readDataPage(c Column, codec Codec, h *pageHeader, page []byte, start int64, dictionary []Value) ([]Value, error) {
+	var levels, buf []byte
+	base := int64(-1)
+	if h.typ == pageTypeData {
+		var err error
+		if buf, err = decompress(codec, page, h.uncompressedSize); err != nil {
+			return nil, err
+		}
+		if codec == CodecUncompressed {
+			base = start
+		}
+		// v1 pages prefix each level section with its length.
+		for _, max := range []int{c.MaxRepetitionLevel, c.MaxDefinitionLevel} {
+			if max == 0 {
+				continue
+			}
+			if len(buf) < 4 {
+				return nil, errCorrupt
+			}
+			n := int(binary.LittleEndian.Uint32(buf))
+			if n < 0 || 4+n > len(buf) {
+				return nil, errCorrupt
+			}
+			levels = buf[4 : 4+n]
+			buf = buf[4+n:]
+			if base >= 0 {
+				base += int64(4 + n)
+			}
+		}
+	} else {
+		// v2 pages store the levels uncompressed ahead of the values.
+		n := h.repLevelsLength + h.defLevelsLength
+		if n < 0 || n > len(page) {
+			return nil, errCorrupt
+		}
+		levels = page[h.repLevelsLength:n]
+		buf = page[n:]
+		if h.isCompressed && codec != CodecUncompressed {
+			var err error
+			if buf, err = decompress(codec, buf, h.uncompressedSize-n); err != nil {
+				return nil, err
+			}
+		} else {
+			base = start + int64(n)
+		}
+	}
+
+	defined := make([]bool, h.numValues)
+	count := h.numValues
+	if c.MaxDefinitionLevel > 0 {
+		defs, _, err := decodeHybrid(levels, bitWidth(c.MaxDefinitionLevel), h.numValues)
+		if err != nil {
+			return nil, err
+		}
+		count = 0
+		for i, d := range defs {
+			if int(d) == c.MaxDefinitionLevel {
+				defined[i] = true
+				count++
+			}
+		}
+	} else {
+		for i := range defined {
+			defined[i] = true
+		}
+	}
+
+	var vs []Value
+	switch h.encoding {
+	case EncodingPlain:
+		var err error
+		if vs, err = decodePlain(buf, c, count, base); err != nil {
+			return nil, err
+		}
+	case EncodingPlainDictionary, EncodingRLEDictionary:
+		if dictionary == nil {
+			return nil, fmt.Errorf("dictionary encoded page without a dictionary")
+		}
+		if count > 0 {
+			if len(buf) == 0 {
+				return nil, errCorrupt
+			}
+			indexes, _, err := decodeHybrid(buf[1:], int(buf[0]), count)
+			if err != nil {
+				return nil, err
+			}
+			vs = make([]Value, count)
+			for i, j := range indexes {
+				if int(j) >= len(dictionary) {
+					return nil, fmt.Errorf("dictionary index %d out of range", j)
+				}
+				vs[i] = dictionary[j]
+			}
+		}
+	case EncodingDeltaBinaryPacked:
+		if c.Type != TypeInt32 && c.Type != TypeInt64 {
+			return nil, fmt.Errorf("delta binary packed encoding is only supported for integers")
+		}
+		ints, _, err := decodeDeltaBinaryPacked(buf, count)
+		if err != nil {
+			return nil, err
+		}
+		vs = make([]Value, count)
+		for i, v := range ints {
+			if c.Type == TypeInt32 {
+				v = int64(int32(v))
+			}
+			vs[i] = Value{Int64: v, Offset: -1}
+		}
+	case EncodingDeltaLengthByteArray:
+		if c.Type != TypeByteArray {
+			return nil, fmt.Errorf("delta length byte array encoding is only supported for byte arrays")
+		}
+		lengths, n, err := decodeDeltaBinaryPacked(buf, count)
+		if err != nil {
+			return nil, err
+		}
+		vs = make([]Value, count)
+		pos := n
+		for i, m := range lengths {
+			if m < 0 || int64(pos)+m > int64(len(buf)) {
+				return nil, errCorrupt
+			}
+			vs[i] = Value{Bytes: buf[pos : pos+int(m)], Offset: -1}
+			if base >= 0 {
+				vs[i].Offset = base + int64(pos)
+			}
+			pos += int(m)
+		}
+	case EncodingRLE:
+		if c.Type != TypeBoolean {
+			return nil, fmt.Errorf("rle encoding is only supported for booleans")
+		}
+		if len(buf) < 4 {
+			return nil, errCorrupt
+		}
+		bs, _, err := decodeHybrid(buf[4:], 1, count)
+		if err != nil {
+			return nil, err
+		}
+		vs = make([]Value, count)
+		for i, b := range bs {
+			vs[i] = Value{Boolean: b == 1, Offset: -1}
+		}
+	default:
+		return nil, fmt.Errorf("%w encoding %d", ErrUnsupported, h.encoding)
+	}
+
+	out := make([]Value, h.numValues)
+	j := 0
+	for i := range out {
+		if !defined[i] {
+			out[i] = Value{Null: true, Offset: -1}
+			continue
+		}
+		out[i] = vs[j]
+		j++
+	}
+	return out, nil
+}
@@ -0,0 +1,340 @@
+package parquet
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// Type is the physical type of a column.
+type Type int32
+
+const (
+	TypeBoolean Type = iota
+	TypeInt32
+	TypeInt64
+	TypeInt96
+	TypeFloat
+	TypeDouble
+	TypeByteArray
+	TypeFixedLenByteArray
+)
+
+type Repetition int32
+
+const (
+	RepetitionRequired Repetition = iota
+	RepetitionOptional
+	RepetitionRepeated
+)
+
+// Codec is the compression codec of a column chunk.
+type Codec int32
+
+const (
+	CodecUncompressed Codec = iota
+	CodecSnappy
+	CodecGzip
+	CodecLZO
+	CodecBrotli
+	CodecLZ4
+	CodecZstd
+	CodecLZ4Raw
+)
+
+type Encoding int32
+
+const (
+	EncodingPlain                Encoding = 0
+	EncodingPlainDictionary      Encoding = 2
+	EncodingRLE                  Encoding = 3
+	EncodingBitPacked            Encoding = 4
+	EncodingDeltaBinaryPacked    Encoding = 5
+	EncodingDeltaLengthByteArray Encoding = 6
+	EncodingRLEDictionary        Encoding = 8
+)
+
+type pageType int32
+
+const (
+	pageTypeData       pageType = 0
+	pageTypeIndex      pageType = 1
+	pageTypeDictionary pageType = 2
+	pageTypeDataV2     pageType = 3
+)
+
+// convertedTypeUTF8 marks a byte array column as a string.
+const convertedTypeUTF8 = 0
+
+type SchemaElement struct {
+	Name        string
+	Type        Type
+	TypeLength  int32
+	Repetition  Repetition
+	NumChildren int32
+	// UTF8 is set if the column is annotated as a string.
+	UTF8 bool
+}
+
+type ColumnChunk struct {
+	Type                 Type
+	Path                 []string
+	Codec                Codec
+	NumValues            int64
+	DataPageOffset       int64
+	DictionaryPageOffset int64
+	TotalCompressedSize  int64
+}
+
+type RowGroup struct {
+	Columns       []ColumnChunk
+	TotalByteSize int64
+	NumRows       int64
+}
+
+type FileMetaData struct {
+	Version   int32
+	Schema    []SchemaElement
+	NumRows   int64
+	RowGroups []RowGroup
+}
+
+// Column describes a leaf column of the schema.
+type Column struct {
+	Path               []string
+	Type               Type
+	TypeLength         int
+	UTF8               bool
+	MaxDefinitionLevel int
+	MaxRepetitionLevel int
+}
+
+func decodeFileMetaData(buf []byte) (*FileMetaData, error) {
+	r := &compactReader{buf: buf}
+	s, err := r.readStruct()
+	if err != nil {
+		return nil, err
+	}
+	m := &FileMetaData{Version: int32(s.int(1)), NumRows: s.int(3)}
+	for _, e := range s.list(2) {
+		e, ok := e.(thriftStruct)
+		if !ok {
+			return nil, fmt.Errorf("invalid schema element")
+		}
+		m.Schema = append(m.Schema, SchemaElement{
+			Name:        e.string(4),
+			Type:        Type(e.int(1)),
+			TypeLength:  int32(e.int(2)),
+			Repetition:  Repetition(e.int(3)),
+			NumChildren: int32(e.int(5)),
+			UTF8:        e.has(6) && e.int(6) == convertedTypeUTF8,
+		})
+	}
+	for _, rg := range s.list(4) {
+		rg, ok := rg.(thriftStruct)
+		if !ok {
+			return nil, fmt.Errorf("invalid row group")
+		}
+		g := RowGroup{TotalByteSize: rg.int(2), NumRows: rg.int(3)}
+		for _, cc := range rg.list(1) {
+			cc, ok := cc.(thriftStruct)
+			if !ok {
+				return nil, fmt.Errorf("invalid column chunk")
+			}
+			if cc.has(1) {
+				return nil, fmt.Errorf("column chunks in external files are not supported")
+			}
+			md := cc.structField(3)
+			if md == nil {
+				return nil, fmt.Errorf("column chunk is missing metadata")
+			}
+			c := ColumnChunk{
+				Type:                Type(md.int(1)),
+				Codec:               Codec(md.int(4)),
+				NumValues:           md.int(5),
+				TotalCompressedSize: md.int(7),
+				DataPageOffset:      md.int(9),
+			}
+			if md.has(11) {
+				c.DictionaryPageOffset = md.int(11)
+			}
+			for _, p := range md.list(3) {
+				p, _ := p.([]byte)
+				c.Path = append(c.Path, string(p))
+			}
+			g.Columns = append(g.Columns, c)
+		}
+		m.RowGroups = append(m.RowGroups, g)
+	}
+	return m, nil
+}
+
+func encodeFileMetaData(m *FileMetaData) []byte {
+	schema := make([]thriftStruct, len(m.Schema))
+	for i, e := range m.Schema {
+		s := thriftStruct{4: e.Name}
+		if e.NumChildren > 0 {
+			s[5] = e.NumChildren
+		} else {
+			s[1] = int32(e.Type)
+			s[3] = int32(e.Repetition)
+			if e.Type == TypeFixedLenByteArray {
+				s[2] = e.TypeLength
+			}
+			if e.UTF8 {
+				s[6] = int32(convertedTypeUTF8)
+			}
+		}
+		schema[i] = s
+	}
+	rowGroups := make([]thriftStruct, len(m.RowGroups))
+	for i, rg := range m.RowGroups {
+		columns := make([]thriftStruct, len(rg.Columns))
+		for j, c := range rg.Columns {
+			encodings := []int32{int32(EncodingPlain), int32(EncodingRLE)}
+			md := thriftStruct{
+				1: int32(c.Type),
+				3: c.Path,
+				4: int32(c.Codec),
+				5: c.NumValues,
+				// the writer doesn't track uncompressed sizes, which are only
+				// used by readers as a hint.
+				6: c.TotalCompressedSize,
+				7: c.TotalCompressedSize,
+				9: c.DataPageOffset,
+			}
+			fileOffset := c.DataPageOffset
+			if c.DictionaryPageOffset > 0 {
+				encodings = append(encodings, int32(EncodingRLEDictionary))
+				md[11] = c.DictionaryPageOffset
+				fileOffset = c.DictionaryPageOffset
+			}
+			md[2] = encodings
+			columns[j] = thriftStruct{2: fileOffset, 3: md}
+		}
+		rowGroups[i] = thriftStruct{1: columns, 2: rg.TotalByteSize, 3: rg.NumRows}
+	}
+	w := &compactWriter{}
+	w.writeStruct(thriftStruct{1: m.Version, 2: schema, 3: m.NumRows, 4: rowGroups})
+	return w.buf
+}
+
+// columns flattens the schema into its leaf columns.
+func columns(schema []SchemaElement) ([]Column, error) {
+	if len(schema) == 0 {
+		return nil, fmt.Errorf("empty schema")
+	}
+	var out []Column
+	// the first element is the root of the schema and is not a column.
+	i := 1
+	var walk func(n int32, path []string, def, rep int) error
+	walk = func(n int32, path []string, def, rep int) error {
+		for ; n > 0; n-- {
+			if i >= len(schema) {
+				return fmt.Errorf("schema has fewer elements than declared")
+			}
+			e := schema[i]
+			i++
+			d, r := def, rep
+			switch e.Repetition {
+			case RepetitionOptional:
+				d++
+			case RepetitionRepeated:
+				d++
+				r++
+			}
+			p := append(path[:len(path):len(path)], e.Name)
+			if e.NumChildren > 0 {
+				if err := walk(e.NumChildren, p, d, r); err != nil {
+					return err
+				}
+				continue
+			}
+			out = append(out, Column{
+				Path:               p,
+				Type:               e.Type,
+				TypeLength:         int(e.TypeLength),
+				UTF8:               e.UTF8,
+				MaxDefinitionLevel: d,
+				MaxRepetitionLevel: r,
+			})
+		}
+		return nil
+	}
+	if err := walk(schema[0].NumChildren, nil, 0, 0); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type pageHeader struct {
+	typ              pageType
+	uncompressedSize int
+	compressedSize   int
+	numValues        int
+	encoding         Encoding
+
+	// data page v2 only
+	defLevelsLength int
+	repLevelsLength int
+	isCompressed    bool
+}
+
+func decodePageHeader(r *compactReader) (*pageHeader, error) {
+	s, err := r.readStruct()
+	if err != nil {
+		return nil, err
+	}
+	h := &pageHeader{
+		typ:              pageType(s.int(1)),
+		uncompressedSize: int(s.int(2)),
+		compressedSize:   int(s.int(3)),
+	}
+	switch h.typ {
+	case pageTypeData:
+		d := s.structField(5)
+		h.numValues = int(d.int(1))
+		h.encoding = Encoding(d.int(2))
+	case pageTypeDictionary:
+		d := s.structField(7)
+		h.numValues = int(d.int(1))
+		h.encoding = Encoding(d.int(2))
+	case pageTypeDataV2:
+		d := s.structField(8)
+		h.numValues = int(d.int(1))
+		h.encoding = Encoding(d.int(4))
+		h.defLevelsLength = int(d.int(5))
+		h.repLevelsLength = int(d.int(6))
+		h.isCompressed = d.bool(7, true)
+	}
+	if h.compressedSize < 0 || h.uncompressedSize < 0 || h.numValues < 0 {
+		return nil, fmt.Errorf("invalid page header")
+	}
+	return h, nil
+}
+
+func encodePageHeader(h *pageHeader) []byte {
+	s := thriftStruct{
+		1: int32(h.typ),
+		2: int32(h.uncompressedSize),
+		3: int32(h.compressedSize),
+	}
+	switch h.typ {
+	case pageTypeData:
+		s[5] = thriftStruct{
+			1: int32(h.numValues),
+			2: int32(h.encoding),
+			3: int32(EncodingRLE),
+			4: int32(EncodingRLE),
+		}
+	case pageTypeDictionary:
+		s[7] = thriftStruct{1: int32(h.numValues), 2: int32(h.encoding)}
+	}
+	w := &compactWriter{}
+	w.writeStruct(s)
+	return w.buf
+}
+
+// bitWidth returns the number of bits needed to store levels up to max.
+func bitWidth(max int) int {
+	return bits.Len(uint(max))
+}
@@ -0,0 +1,233 @@
+package parquet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeHybrid(t *testing.T) {
+	t.Run("bit packed", func(t *testing.T) {
+		// the example from the parquet encoding spec.
+		values, n, err := decodeHybrid([]byte{0x03, 0x88, 0xc6, 0xfa}, 3, 8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 4 {
+			t.Fatalf("expected 4 bytes consumed, got %d", n)
+		}
+		if !reflect.DeepEqual(values, []uint32{0, 1, 2, 3, 4, 5, 6, 7}) {
+			t.Fatalf("got %v", values)
+		}
+	})
+
+	t.Run("round trip rle", func(t *testing.T) {
+		values := []uint32{1, 1, 1, 0, 5, 5, 300, 300, 300, 2}
+		got, _, err := decodeHybrid(encodeHybrid(values, 9), 9, len(values))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, values) {
+			t.Fatalf("got %v, want %v", got, values)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		if _, _, err := decodeHybrid([]byte{0x03, 0x88}, 3, 8); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestDecodeDeltaBinaryPacked(t *testing.T) {
+	t.Run("constant delta", func(t *testing.T) {
+		values, _, err := decodeDeltaBinaryPacked([]byte{0x80, 0x01, 0x04, 0x05, 0x02, 0x02, 0, 0, 0, 0}, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(values, []int64{1, 2, 3, 4, 5}) {
+			t.Fatalf("got %v", values)
+		}
+	})
+
+	t.Run("packed deltas", func(t *testing.T) {
+		buf := []byte{0x80, 0x01, 0x04, 0x08, 14, 3, 2, 0, 0, 0, 0xc0, 0x3f, 0, 0, 0, 0, 0, 0, 'x'}
+		values, n, err := decodeDeltaBinaryPacked(buf, 8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(values, []int64{7, 5, 3, 1, 2, 3, 4, 5}) {
+			t.Fatalf("got %v", values)
+		}
+		if n != len(buf)-1 {
+			t.Fatalf("expected %d bytes consumed, got %d", len(buf)-1, n)
+		}
+	})
+}
+
+func TestSnappy(t *testing.T) {
+	t.Run("copy", func(t *testing.T) {
+		got, err := decodeSnappy([]byte{0x0c, 0x08, 'a', 'b', 'c', 0x15, 0x03})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "abcabcabcabc" {
+			t.Fatalf("got %q", got)
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		src := bytes.Repeat([]byte("appendable"), 10000)
+		got, err := decodeSnappy(encodeSnappy(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, src) {
+			t.Fatal("round trip mismatch")
+		}
+	})
+
+	t.Run("invalid offset", func(t *testing.T) {
+		if _, err := decodeSnappy([]byte{0x0c, 0x08, 'a', 'b', 'c', 0x15, 0x09}); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestFile(t *testing.T) {
+	fields := []Field{
+		{Name: "name", Type: TypeByteArray},
+		{Name: "category", Type: TypeByteArray, Dictionary: true},
+		{Name: "count", Type: TypeInt64},
+		{Name: "small", Type: TypeInt32, Optional: true},
+		{Name: "score", Type: TypeDouble, Optional: true},
+		{Name: "ratio", Type: TypeFloat},
+		{Name: "ok", Type: TypeBoolean},
+	}
+	row := func(i int) []any {
+		var small, score any
+		if i%3 != 0 {
+			small = int32(-i)
+		}
+		if i%5 != 0 {
+			score = float64(i) / 4
+		}
+		return []any{fmt.Sprintf("name %d", i), fmt.Sprintf("category %d", i%7), int64(i) << 40, small, score, float32(i) / 2, i%2 == 0}
+	}
+
+	for _, codec := range []Codec{CodecUncompressed, CodecSnappy, CodecGzip} {
+		t.Run(fmt.Sprintf("codec %d", codec), func(t *testing.T) {
+			w := NewWriter(fields, codec)
+			n := 0
+			for g := 0; g < 3; g++ {
+				var rows [][]any
+				for j := 0; j < 100*(g+1); j++ {
+					rows = append(rows, row(n))
+					n++
+				}
+				if err := w.WriteRowGroup(rows); err != nil {
+					t.Fatal(err)
+				}
+			}
+			data := w.Bytes()
+
+			f, err := Open(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(f.Columns()) != len(fields) {
+				t.Fatalf("expected %d columns, got %d", len(fields), len(f.Columns()))
+			}
+			if f.Metadata().NumRows != int64(n) {
+				t.Fatalf("expected %d rows, got %d", n, f.Metadata().NumRows)
+			}
+
+			i := 0
+			for rg := range f.RowGroups() {
+				columns := make([][]Value, len(fields))
+				for c := range fields {
+					if columns[c], err = f.ReadColumn(rg, c); err != nil {
+						t.Fatal(err)
+					}
+				}
+				for r := range columns[0] {
+					want := row(i)
+					for c, v := range columns {
+						var got any
+						switch {
+						case v[r].Null:
+						case fields[c].Type == TypeByteArray:
+							got = string(v[r].Bytes)
+						case fields[c].Type == TypeInt64:
+							got = v[r].Int64
+						case fields[c].Type == TypeInt32:
+							got = int32(v[r].Int64)
+						case fields[c].Type == TypeDouble:
+							got = v[r].Float64
+						case fields[c].Type == TypeFloat:
+							got = float32(v[r].Float64)
+						case fields[c].Type == TypeBoolean:
+							got = v[r].Boolean
+						}
+						if got != want[c] {
+							t.Fatalf("row %d column %s: got %v, want %v", i, fields[c].Name, got, want[c])
+						}
+
+						// only plain encoded uncompressed values can be addressed.
+						addressable := codec == CodecUncompressed && fields[c].Type == TypeByteArray && !fields[c].Dictionary
+						if addressable != (v[r].Offset >= 0) {
+							t.Fatalf("row %d column %s: unexpected offset %d", i, fields[c].Name, v[r].Offset)
+						}
+						if addressable && !bytes.Equal(data[v[r].Offset:v[r].Offset+int64(len(v[r].Bytes))], v[r].Bytes) {
+							t.Fatalf("row %d column %s: offset doesn't point at the value", i, fields[c].Name)
+						}
+					}
+					i++
+				}
+			}
+			if i != n {
+				t.Fatalf("expected %d rows, got %d", n, i)
+			}
+		})
+	}
+
+	t.Run("incomplete", func(t *testing.T) {
+		w := NewWriter(fields, CodecUncompressed)
+		if err := w.WriteRowGroup([][]any{row(1)}); err != nil {
+			t.Fatal(err)
+		}
+		data := w.Bytes()
+		if _, err := Open(data[:len(data)-1]); !errors.Is(err, ErrIncomplete) {
+			t.Fatalf("expected ErrIncomplete, got %v", err)
+		}
+		if _, err := Open(nil); !errors.Is(err, ErrIncomplete) {
+			t.Fatalf("expected ErrIncomplete, got %v", err)
+		}
+	})
+
+	t.Run("rejects missing required values", func(t *testing.T) {
+		w := NewWriter(fields, CodecUncompressed)
+		r := row(1)
+		r[0] = nil
+		if err := w.WriteRowGroup([][]any{r}); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestUnsupportedCodec(t *testing.T) {
+	w := NewWriter([]Field{{Name: "name", Type: TypeByteArray}}, CodecUncompressed)
+	if err := w.WriteRowGroup([][]any{{"a"}, {"b"}}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Open(w.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.metadata.RowGroups[0].Columns[0].Codec = CodecZstd
+	if _, err := f.ReadColumn(0, 0); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported, got %v", err)
+	}
+}
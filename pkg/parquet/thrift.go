@@ -0,0 +1,329 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Parquet metadata is serialized with the thrift compact protocol. Only the
+// subset of the protocol needed to read and write the parquet metadata
+// structures is implemented here.
+//
+// See https://github.com/apache/thrift/blob/master/doc/specs/thrift-compact-protocol.md
+
+const (
+	compactStop         = 0
+	compactBooleanTrue  = 1
+	compactBooleanFalse = 2
+	compactByte         = 3
+	compactI16          = 4
+	compactI32          = 5
+	compactI64          = 6
+	compactDouble       = 7
+	compactBinary       = 8
+	compactList         = 9
+	compactSet          = 10
+	compactMap          = 11
+	compactStruct       = 12
+)
+
+var errTruncated = errors.New("truncated thrift message")
+
+// thriftStruct is a decoded thrift struct keyed by field id. Integers are
+// decoded as int64, binaries as []byte, lists and sets as []any and nested
+// structs as thriftStruct.
+//
+// When encoding, the thrift type of a field is derived from its Go type, so
+// int32 and int64 must be used explicitly.
+type thriftStruct map[int16]any
+
+func (s thriftStruct) int(id int16) int64 {
+	v, _ := s[id].(int64)
+	return v
+}
+
+func (s thriftStruct) bool(id int16, def bool) bool {
+	v, ok := s[id].(bool)
+	if !ok {
+		return def
+	}
+	return v
+}
+
+func (s thriftStruct) string(id int16) string {
+	v, _ := s[id].([]byte)
+	return string(v)
+}
+
+func (s thriftStruct) has(id int16) bool {
+	_, ok := s[id]
+	return ok
+}
+
+func (s thriftStruct) structField(id int16) thriftStruct {
+	v, _ := s[id].(thriftStruct)
+	return v
+}
+
+func (s thriftStruct) list(id int16) []any {
+	v, _ := s[id].([]any)
+	return v
+}
+
+type compactReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *compactReader) readByte() (byte, error) {
+	if r.pos >= len(r.buf) {
+		return 0, errTruncated
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *compactReader) readUvarint() (uint64, error) {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		return 0, errTruncated
+	}
+	r.pos += n
+	return v, nil
+}
+
+func (r *compactReader) readVarint() (int64, error) {
+	v, err := r.readUvarint()
+	if err != nil {
+		return 0, err
+	}
+	// zigzag decode
+	return int64(v>>1) ^ -int64(v&1), nil
+}
+
+func (r *compactReader) readStruct() (thriftStruct, error) {
+	s := thriftStruct{}
+	var id int16
+	for {
+		header, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		t := header & 0x0f
+		if t == compactStop {
+			return s, nil
+		}
+		if delta := header >> 4; delta != 0 {
+			id += int16(delta)
+		} else {
+			v, err := r.readVarint()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(v)
+		}
+		switch t {
+		case compactBooleanTrue:
+			s[id] = true
+		case compactBooleanFalse:
+			s[id] = false
+		default:
+			v, err := r.readValue(t)
+			if err != nil {
+				return nil, fmt.Errorf("field %d: %w", id, err)
+			}
+			s[id] = v
+		}
+	}
+}
+
+func (r *compactReader) readValue(t byte) (any, error) {
+	switch t {
+	case compactBooleanTrue, compactBooleanFalse:
+		// only reached for list elements, which store booleans as a byte.
+		b, err := r.readByte()
+		return b == compactBooleanTrue, err
+	case compactByte:
+		b, err := r.readByte()
+		return int64(int8(b)), err
+	case compactI16, compactI32, compactI64:
+		return r.readVarint()
+	case compactDouble:
+		if r.pos+8 > len(r.buf) {
+			return nil, errTruncated
+		}
+		v := math.Float64frombits(binary.LittleEndian.Uint64(r.buf[r.pos:]))
+		r.pos += 8
+		return v, nil
+	case compactBinary:
+		n, err := r.readUvarint()
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(len(r.buf)-r.pos) {
+			return nil, errTruncated
+		}
+		v := r.buf[r.pos : r.pos+int(n)]
+		r.pos += int(n)
+		return v, nil
+	case compactList, compactSet:
+		header, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		n := uint64(header >> 4)
+		if n == 15 {
+			if n, err = r.readUvarint(); err != nil {
+				return nil, err
+			}
+		}
+		if n > uint64(len(r.buf)-r.pos) {
+			// every element takes at least one byte.
+			return nil, errTruncated
+		}
+		list := make([]any, n)
+		for i := range list {
+			if list[i], err = r.readValue(header & 0x0f); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case compactMap:
+		n, err := r.readUvarint()
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, nil
+		}
+		types, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		// maps are not used by the metadata we read, so they are skipped.
+		for i := uint64(0); i < n; i++ {
+			if _, err := r.readValue(types >> 4); err != nil {
+				return nil, err
+			}
+			if _, err := r.readValue(types & 0x0f); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	case compactStruct:
+		return r.readStruct()
+	}
+	return nil, fmt.Errorf("unknown thrift type %d", t)
+}
+
+type compactWriter struct {
+	buf []byte
+}
+
+func (w *compactWriter) writeVarint(v int64) {
+	// zigzag encode
+	w.buf = binary.AppendUvarint(w.buf, uint64((v<<1)^(v>>63)))
+}
+
+func (w *compactWriter) writeStruct(s thriftStruct) {
+	ids := make([]int, 0, len(s))
+	for id := range s {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+
+	var last int16
+	for _, id := range ids {
+		v := s[int16(id)]
+		t := compactType(v)
+		if b, ok := v.(bool); ok && !b {
+			t = compactBooleanFalse
+		}
+		if delta := int16(id) - last; delta > 0 && delta <= 15 {
+			w.buf = append(w.buf, byte(delta)<<4|t)
+		} else {
+			w.buf = append(w.buf, t)
+			w.writeVarint(int64(id))
+		}
+		last = int16(id)
+		if _, ok := v.(bool); !ok {
+			w.writeValue(v)
+		}
+	}
+	w.buf = append(w.buf, compactStop)
+}
+
+func (w *compactWriter) writeValue(v any) {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			w.buf = append(w.buf, compactBooleanTrue)
+		} else {
+			w.buf = append(w.buf, compactBooleanFalse)
+		}
+	case int32:
+		w.writeVarint(int64(v))
+	case int64:
+		w.writeVarint(v)
+	case float64:
+		w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(v))
+	case string:
+		w.buf = binary.AppendUvarint(w.buf, uint64(len(v)))
+		w.buf = append(w.buf, v...)
+	case []byte:
+		w.buf = binary.AppendUvarint(w.buf, uint64(len(v)))
+		w.buf = append(w.buf, v...)
+	case thriftStruct:
+		w.writeStruct(v)
+	case []int32:
+		w.writeListHeader(len(v), compactI32)
+		for _, e := range v {
+			w.writeVarint(int64(e))
+		}
+	case []string:
+		w.writeListHeader(len(v), compactBinary)
+		for _, e := range v {
+			w.writeValue(e)
+		}
+	case []thriftStruct:
+		w.writeListHeader(len(v), compactStruct)
+		for _, e := range v {
+			w.writeStruct(e)
+		}
+	default:
+		panic(fmt.Sprintf("unsupported thrift value %T", v))
+	}
+}
+
+func (w *compactWriter) writeListHeader(n int, t byte) {
+	if n < 15 {
+		w.buf = append(w.buf, byte(n)<<4|t)
+		return
+	}
+	w.buf = append(w.buf, 0xf0|t)
+	w.buf = binary.AppendUvarint(w.buf, uint64(n))
+}
+
+func compactType(v any) byte {
+	switch v.(type) {
+	case bool:
+		return compactBooleanTrue
+	case int32:
+		return compactI32
+	case int64:
+		return compactI64
+	case float64:
+		return compactDouble
+	case string, []byte:
+		return compactBinary
+	case thriftStruct:
+		return compactStruct
+	case []int32, []string, []thriftStruct:
+		return compactList
+	}
+	panic(fmt.Sprintf("unsupported thrift value %T", v))
+}
@@ -0,0 +1,161 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Field is a top-level column written by a Writer.
+type Field struct {
+	Name     string
+	Type     Type
+	Optional bool
+	// Dictionary dictionary-encodes the column.
+	Dictionary bool
+}
+
+// Writer writes a parquet file one row group at a time. Every call to
+// WriteRowGroup only appends to the file written so far, with the exception
+// of the footer which is rewritten at the end of the file, so the output can
+// be used to test appending row groups to an existing file.
+type Writer struct {
+	fields []Field
+	codec  Codec
+
+	buf       []byte
+	rowGroups []RowGroup
+	numRows   int64
+}
+
+func NewWriter(fields []Field, codec Codec) *Writer {
+	return &Writer{fields: fields, codec: codec, buf: append([]byte{}, magic...)}
+}
+
+// WriteRowGroup appends a row group. Each row holds one value per field, which
+// is nil for null values or otherwise a bool, int32, int64, float32, float64,
+// string or []byte depending on the field type.
+func (w *Writer) WriteRowGroup(rows [][]any) error {
+	rg := RowGroup{NumRows: int64(len(rows))}
+	start := len(w.buf)
+	for i, field := range w.fields {
+		var values []any
+		levels := make([]uint32, len(rows))
+		for j, row := range rows {
+			if len(row) != len(w.fields) {
+				return fmt.Errorf("row %d has %d values, expected %d", j, len(row), len(w.fields))
+			}
+			if row[i] == nil {
+				if !field.Optional {
+					return fmt.Errorf("row %d: field %s is required", j, field.Name)
+				}
+				continue
+			}
+			levels[j] = 1
+			values = append(values, row[i])
+		}
+		chunk, err := w.writeColumnChunk(field, levels, values)
+		if err != nil {
+			return fmt.Errorf("failed to write column %s: %w", field.Name, err)
+		}
+		chunk.NumValues = int64(len(rows))
+		rg.Columns = append(rg.Columns, chunk)
+	}
+	rg.TotalByteSize = int64(len(w.buf) - start)
+	w.rowGroups = append(w.rowGroups, rg)
+	w.numRows += rg.NumRows
+	return nil
+}
+
+func (w *Writer) writeColumnChunk(field Field, levels []uint32, values []any) (ColumnChunk, error) {
+	chunk := ColumnChunk{Type: field.Type, Path: []string{field.Name}, Codec: w.codec}
+	start := len(w.buf)
+
+	var payload []byte
+	if field.Optional {
+		l := encodeHybrid(levels, 1)
+		payload = binary.LittleEndian.AppendUint32(payload, uint32(len(l)))
+		payload = append(payload, l...)
+	}
+
+	encoding := EncodingPlain
+	if field.Dictionary {
+		var dictionary []any
+		seen := map[any]uint32{}
+		indexes := make([]uint32, len(values))
+		for i, v := range values {
+			k := v
+			if b, ok := v.([]byte); ok {
+				k = string(b)
+			}
+			j, ok := seen[k]
+			if !ok {
+				j = uint32(len(dictionary))
+				seen[k] = j
+				dictionary = append(dictionary, v)
+			}
+			indexes[i] = j
+		}
+		dict, err := encodePlain(nil, field.Type, dictionary)
+		if err != nil {
+			return chunk, err
+		}
+		chunk.DictionaryPageOffset = int64(len(w.buf))
+		if err := w.writePage(pageTypeDictionary, EncodingPlain, len(dictionary), dict); err != nil {
+			return chunk, err
+		}
+		width := bitWidth(max(len(dictionary)-1, 0))
+		payload = append(payload, byte(width))
+		payload = append(payload, encodeHybrid(indexes, width)...)
+		encoding = EncodingRLEDictionary
+	} else {
+		var err error
+		if payload, err = encodePlain(payload, field.Type, values); err != nil {
+			return chunk, err
+		}
+	}
+
+	chunk.DataPageOffset = int64(len(w.buf))
+	if err := w.writePage(pageTypeData, encoding, len(levels), payload); err != nil {
+		return chunk, err
+	}
+	chunk.TotalCompressedSize = int64(len(w.buf) - start)
+	return chunk, nil
+}
+
+func (w *Writer) writePage(typ pageType, encoding Encoding, numValues int, payload []byte) error {
+	compressed, err := compress(w.codec, payload)
+	if err != nil {
+		return err
+	}
+	w.buf = append(w.buf, encodePageHeader(&pageHeader{
+		typ:              typ,
+		uncompressedSize: len(payload),
+		compressedSize:   len(compressed),
+		numValues:        numValues,
+		encoding:         encoding,
+	})...)
+	w.buf = append(w.buf, compressed...)
+	return nil
+}
+
+// Bytes returns the file written so far, including the footer.
+func (w *Writer) Bytes() []byte {
+	schema := []SchemaElement{{Name: "schema", NumChildren: int32(len(w.fields))}}
+	for _, f := range w.fields {
+		e := SchemaElement{Name: f.Name, Type: f.Type, UTF8: f.Type == TypeByteArray}
+		if f.Optional {
+			e.Repetition = RepetitionOptional
+		}
+		schema = append(schema, e)
+	}
+	footer := encodeFileMetaData(&FileMetaData{
+		Version:   1,
+		Schema:    schema,
+		NumRows:   w.numRows,
+		RowGroups: w.rowGroups,
+	})
+	out := append([]byte{}, w.buf...)
+	out = append(out, footer...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(footer)))
+	return append(out, magic...)
+}
@@ -0,0 +1,169 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+	"github.com/kevmo314/appendable/pkg/encoding"
+)
+
+// numericTypes are the types of the indexes that hold numbers. The data
+// handlers index integers in the Int64 index, or the Uint64 index if they
+// overflow an int64, and everything else in the Float64 index, so a number is
+// looked up in all of them.
+var numericTypes = []appendable.FieldType{appendable.FieldTypeInt64, appendable.FieldTypeUint64, appendable.FieldTypeFloat64}
+
+// numericValue returns value as an exact number if it is one of the Go
+// numeric types.
+func numericValue(value any) (*big.Float, bool, error) {
+	x := new(big.Float).SetPrec(128)
+	switch value := value.(type) {
+	case float64:
+		if math.IsNaN(value) {
+			return nil, false, fmt.Errorf("NaN can't be compared")
+		}
+		x.SetFloat64(value)
+	case float32:
+		if math.IsNaN(float64(value)) {
+			return nil, false, fmt.Errorf("NaN can't be compared")
+		}
+		x.SetFloat64(float64(value))
+	case int:
+		x.SetInt64(int64(value))
+	case int8:
+		x.SetInt64(int64(value))
+	case int16:
+		x.SetInt64(int64(value))
+	case int32:
+		x.SetInt64(int64(value))
+	case int64:
+		x.SetInt64(value)
+	case uint:
+		x.SetUint64(uint64(value))
+	case uint8:
+		x.SetUint64(uint64(value))
+	case uint16:
+		x.SetUint64(uint64(value))
+	case uint32:
+		x.SetUint64(uint64(value))
+	case uint64:
+		x.SetUint64(value)
+	default:
+		return nil, false, nil
+	}
+	return x, true, nil
+}
+
+// decodeNumber returns the number that key encodes in an index of type ft.
+func decodeNumber(ft appendable.FieldType, key []byte) *big.Float {
+	x := new(big.Float).SetPrec(128)
+	switch ft {
+	case appendable.FieldTypeInt64:
+		return x.SetInt64(encoding.DecodeInt64(key))
+	case appendable.FieldTypeUint64:
+		return x.SetUint64(encoding.DecodeUint64(key))
+	}
+	return x.SetFloat64(encoding.DecodeFloat64(key))
+}
+
+// boundNumber converts comparing a key with x to an equivalent comparison of
+// the key with a value of the index of type ft, which may round x. It
+// returns false if no key of the index can match.
+func boundNumber(ft appendable.FieldType, op Operation, x *big.Float) (Operation, []byte, bool) {
+	switch ft {
+	case appendable.FieldTypeInt64:
+		op, b, ok := boundInteger(op, x, big.NewInt(math.MinInt64), big.NewInt(math.MaxInt64))
+		if !ok {
+			return op, nil, false
+		}
+		return op, encoding.EncodeInt64(b.Int64()), true
+	case appendable.FieldTypeUint64:
+		op, b, ok := boundInteger(op, x, new(big.Int), new(big.Int).SetUint64(math.MaxUint64))
+		if !ok {
+			return op, nil, false
+		}
+		return op, encoding.EncodeUint64(b.Uint64()), true
+	}
+
+	f, acc := x.Float64()
+	switch {
+	case acc == big.Exact:
+	case op == OperationEqual:
+		return op, nil, false
+	case acc == big.Below:
+		// f is the float just below x.
+		switch op {
+		case OperationLessThan:
+			op = OperationLessThanOrEqual
+		case OperationGreaterThanOrEqual:
+			op = OperationGreaterThan
+		}
+	default:
+		// f is the float just above x.
+		switch op {
+		case OperationLessThanOrEqual:
+			op = OperationLessThan
+		case OperationGreaterThan:
+			op = OperationGreaterThanOrEqual
+		}
+	}
+	return op, encoding.EncodeFloat64(f), true
+}
+
+// boundInteger converts comparing an integer between min and max with x to
+// comparing it with an integer between min and max.
+func boundInteger(op Operation, x *big.Float, min, max *big.Int) (Operation, *big.Int, bool) {
+	// values beyond the range compare the same as the integers just beyond
+	// it, which also handles infinities.
+	lo := new(big.Float).SetInt(new(big.Int).Sub(min, big.NewInt(1)))
+	hi := new(big.Float).SetInt(new(big.Int).Add(max, big.NewInt(1)))
+	switch {
+	case x.Cmp(lo) < 0:
+		x = lo
+	case x.Cmp(hi) > 0:
+		x = hi
+	}
+	floor, acc := x.Int(nil)
+	ceil := new(big.Int).Set(floor)
+	switch acc {
+	case big.Below:
+		ceil.Add(ceil, big.NewInt(1))
+	case big.Above:
+		floor.Sub(floor, big.NewInt(1))
+	}
+
+	var b *big.Int
+	switch op {
+	case OperationEqual:
+		if acc != big.Exact || floor.Cmp(min) < 0 || floor.Cmp(max) > 0 {
+			return op, nil, false
+		}
+		return op, floor, true
+	case OperationLessThan:
+		op, b = OperationLessThanOrEqual, ceil.Sub(ceil, big.NewInt(1))
+	case OperationLessThanOrEqual:
+		b = floor
+	case OperationGreaterThan:
+		op, b = OperationGreaterThanOrEqual, floor.Add(floor, big.NewInt(1))
+	case OperationGreaterThanOrEqual:
+		b = ceil
+	}
+	if op == OperationLessThanOrEqual {
+		if b.Cmp(min) < 0 {
+			return op, nil, false
+		}
+		if b.Cmp(max) > 0 {
+			b = max
+		}
+	} else {
+		if b.Cmp(max) > 0 {
+			return op, nil, false
+		}
+		if b.Cmp(min) < 0 {
+			b = min
+		}
+	}
+	return op, b, true
+}
@@ -0,0 +1,386 @@
+// query implements a Go-native query engine over an appendable index file.
+//
+// The semantics follow the Query type exposed by the TypeScript client in
+// src/db/query-lang.ts so that the same query returns the same records
+// regardless of which client is used.
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+	"github.com/kevmo314/appendable/pkg/bptree"
+	"github.com/kevmo314/appendable/pkg/linkedpage"
+	"github.com/kevmo314/appendable/pkg/pointer"
+)
+
+type Operation string
+
+const (
+	OperationLessThan           Operation = "<"
+	OperationLessThanOrEqual    Operation = "<="
+	OperationEqual              Operation = "=="
+	OperationGreaterThanOrEqual Operation = ">="
+	OperationGreaterThan        Operation = ">"
+)
+
+type Direction string
+
+const (
+	DirectionAscending  Direction = "ASC"
+	DirectionDescending Direction = "DESC"
+)
+
+type Where struct {
+	Operation Operation
+	Key       string
+	// Value is the value to compare against. Supported types are nil, bool,
+	// string and any of the Go numeric types.
+	//
+	// Numbers are compared with every representation of a number in the
+	// field, so 3 and 3.0 select the same records.
+	Value any
+}
+
+type OrderBy struct {
+	Key       string
+	Direction Direction
+}
+
+type Query struct {
+	Where   []Where
+	OrderBy []OrderBy
+	Select  []string
+	// Limit is the maximum number of records returned. Zero means no limit.
+	Limit int
+}
+
+// Record is a single record matched by a query.
+type Record struct {
+	// Pointer is the location of the record in the data file.
+	Pointer pointer.MemoryPointer
+	// Data is the raw record. If the query has a Select clause, Data is
+	// instead a JSON object containing only the selected fields.
+	//
+	// Parquet records are not stored contiguously, so for parquet data files
+	// Data is nil and Pointer holds the row group and row of the record as
+	// described by handlers.ParquetHandler.
+	Data []byte
+}
+
+// index is a single field index, that is one IndexMeta and its B+ tree.
+type index struct {
+	page *linkedpage.LinkedPage
+	meta *appendable.IndexMeta
+}
+
+// encodedWhere is a where clause with its value encoded the same way the
+// data handlers encode keys in the B+ tree of an index.
+type encodedWhere struct {
+	Where
+	value []byte
+}
+
+// match is a key that a scan matched and the record that it points to.
+type match struct {
+	key    []byte
+	record pointer.MemoryPointer
+}
+
+// Execute runs q against the index file f whose data file is df.
+func Execute(f *appendable.IndexFile, df []byte, q Query) ([]Record, error) {
+	if err := f.CheckVersion(); err != nil {
+		return nil, err
+	}
+	indexes, err := readIndexes(f)
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(q, indexes); err != nil {
+		return nil, err
+	}
+	metadata, err := f.Metadata()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	if len(q.Select) > 0 && metadata.Format != appendable.FormatJSONL {
+		return nil, fmt.Errorf("select is only supported for jsonl data files")
+	}
+
+	direction := bptree.Ascending
+	if len(q.OrderBy) > 0 && q.OrderBy[0].Direction == DirectionDescending {
+		direction = bptree.Descending
+	}
+
+	// every index of the field that the where clauses can match is scanned,
+	// which is more than one for numbers.
+	var runs [][]match
+	var types []appendable.FieldType
+	for _, idx := range indexes {
+		if idx.meta.FieldName != q.Where[0].Key {
+			continue
+		}
+		wheres, ok, err := encodeWheres(q.Where, idx.meta.FieldType)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		tree := idx.page.BPTree(&bptree.BPTree{Data: df, DataParser: f.DataHandler(), Width: idx.meta.Width})
+		// the first where clause drives the scan, the rest are used as
+		// filters.
+		run, err := scan(tree, wheres[0], wheres[1:], direction, q.Limit)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+		types = append(types, idx.meta.FieldType)
+	}
+	ptrs := merge(runs, types, direction, q.Limit)
+
+	records := make([]Record, len(ptrs))
+	for i, mp := range ptrs {
+		if metadata.Format == appendable.FormatParquet {
+			records[i] = Record{Pointer: mp}
+			continue
+		}
+		if mp.Offset+uint64(mp.Length) > uint64(len(df)) {
+			return nil, fmt.Errorf("record %v is out of bounds of the data file", mp)
+		}
+		data := df[mp.Offset : mp.Offset+uint64(mp.Length)]
+		if len(q.Select) > 0 {
+			data, err = selectFields(data, q.Select)
+			if err != nil {
+				return nil, fmt.Errorf("failed to select fields from record %v: %w", mp, err)
+			}
+		}
+		records[i] = Record{Pointer: mp, Data: data}
+	}
+	return records, nil
+}
+
+// scan walks the key range selected by the driving where clause in the given
+// direction and returns the keys that also satisfy every filter, once per
+// record.
+func scan(tree *bptree.BPTree, driver encodedWhere, filters []encodedWhere, direction bptree.Direction, limit int) ([]match, error) {
+	// a DataPointer of zero sorts before and a DataPointer of max sorts after
+	// every key with the same value.
+	first := &pointer.ReferencedValue{Value: driver.value}
+	last := &pointer.ReferencedValue{
+		Value:       driver.value,
+		DataPointer: pointer.MemoryPointer{Offset: math.MaxUint64, Length: math.MaxUint32},
+	}
+	var lo, hi *pointer.ReferencedValue
+	var inclusivity bptree.Inclusivity
+	switch driver.Operation {
+	case OperationLessThan:
+		hi = first
+	case OperationLessThanOrEqual:
+		hi, inclusivity = last, bptree.IncludeHi
+	case OperationEqual:
+		lo, hi, inclusivity = first, last, bptree.IncludeBoth
+	case OperationGreaterThanOrEqual:
+		lo, inclusivity = first, bptree.IncludeLo
+	case OperationGreaterThan:
+		lo = last
+	}
+
+	iter, err := tree.Range(lo, hi, inclusivity, direction)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []match
+	// array fields have a key per element, so a record can match more than once.
+	seen := make(map[pointer.MemoryPointer]struct{})
+	for iter.Next() {
+		key := iter.Key()
+		ok := true
+		for _, w := range filters {
+			if !matches(w, key.Value) {
+				ok = false
+				break
+			}
+		}
+		if !ok {
+			continue
+		}
+		if _, ok := seen[iter.Pointer()]; ok {
+			continue
+		}
+		seen[iter.Pointer()] = struct{}{}
+		matched = append(matched, match{key: key.Value, record: iter.Pointer()})
+		if limit > 0 && len(matched) == limit {
+			break
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate index %s: %w", driver.Key, err)
+	}
+	return matched, nil
+}
+
+// merge merges the runs of matches of the indexes of types, which are each
+// sorted in direction, into the records in the order of their keys. Numbers
+// are compared by value across the numeric indexes. Records are returned
+// once, even if they match in more than one index.
+func merge(runs [][]match, types []appendable.FieldType, direction bptree.Direction, limit int) []pointer.MemoryPointer {
+	var ptrs []pointer.MemoryPointer
+	seen := make(map[pointer.MemoryPointer]struct{})
+	heads := make([]int, len(runs))
+	for limit == 0 || len(ptrs) < limit {
+		next := -1
+		for i, run := range runs {
+			if heads[i] == len(run) {
+				continue
+			}
+			if next == -1 {
+				next = i
+				continue
+			}
+			cmp := compareKeys(types[i], run[heads[i]].key, types[next], runs[next][heads[next]].key)
+			if (direction == bptree.Ascending && cmp < 0) || (direction == bptree.Descending && cmp > 0) {
+				next = i
+			}
+		}
+		if next == -1 {
+			break
+		}
+		m := runs[next][heads[next]]
+		heads[next]++
+		if _, ok := seen[m.record]; ok {
+			continue
+		}
+		seen[m.record] = struct{}{}
+		ptrs = append(ptrs, m.record)
+	}
+	return ptrs
+}
+
+// compareKeys compares a key of an index of type at with a key of an index of
+// type bt.
+func compareKeys(at appendable.FieldType, a []byte, bt appendable.FieldType, b []byte) int {
+	if at == bt || !slices.Contains(numericTypes, at) || !slices.Contains(numericTypes, bt) {
+		return bytes.Compare(a, b)
+	}
+	return decodeNumber(at, a).Cmp(decodeNumber(bt, b))
+}
+
+func matches(w encodedWhere, key []byte) bool {
+	cmp := bytes.Compare(key, w.value)
+	switch w.Operation {
+	case OperationLessThan:
+		return cmp < 0
+	case OperationLessThanOrEqual:
+		return cmp <= 0
+	case OperationEqual:
+		return cmp == 0
+	case OperationGreaterThanOrEqual:
+		return cmp >= 0
+	case OperationGreaterThan:
+		return cmp > 0
+	}
+	return false
+}
+
+// encodeWheres encodes the where clauses for the index of type ft. It
+// returns false if no key of the index can match all of them.
+func encodeWheres(wheres []Where, ft appendable.FieldType) ([]encodedWhere, bool, error) {
+	encoded := make([]encodedWhere, len(wheres))
+	for i, w := range wheres {
+		x, ok, err := numericValue(w.Value)
+		if err != nil {
+			return nil, false, fmt.Errorf("where clause %d: %w", i, err)
+		}
+		if ok {
+			if !slices.Contains(numericTypes, ft) {
+				return nil, false, nil
+			}
+			op, value, ok := boundNumber(ft, w.Operation, x)
+			if !ok {
+				return nil, false, nil
+			}
+			w.Operation = op
+			encoded[i] = encodedWhere{Where: w, value: value}
+			continue
+		}
+		vt, value, err := encodeValue(w.Value)
+		if err != nil {
+			return nil, false, fmt.Errorf("where clause %d: %w", i, err)
+		}
+		if vt != ft {
+			return nil, false, nil
+		}
+		encoded[i] = encodedWhere{Where: w, value: value}
+	}
+	return encoded, true, nil
+}
+
+// encodeValue encodes a where value that isn't a number into the field type
+// and key bytes that the data handlers use when inserting into the B+ tree.
+func encodeValue(value any) (appendable.FieldType, []byte, error) {
+	switch value := value.(type) {
+	case nil:
+		return appendable.FieldTypeNull, []byte{}, nil
+	case bool:
+		if value {
+			return appendable.FieldTypeBoolean, []byte{1}, nil
+		}
+		return appendable.FieldTypeBoolean, []byte{0}, nil
+	case string:
+		return appendable.FieldTypeString, []byte(value), nil
+	}
+	return 0, nil, fmt.Errorf("unable to process value with type %T", value)
+}
+
+// indexTypes returns the types of the indexes that value can be compared
+// with.
+func indexTypes(value any) ([]appendable.FieldType, error) {
+	if _, ok, err := numericValue(value); err != nil || ok {
+		return numericTypes, err
+	}
+	ft, _, err := encodeValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return []appendable.FieldType{ft}, nil
+}
+
+func selectFields(data []byte, fields []string) ([]byte, error) {
+	record := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	selected := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if v, ok := record[field]; ok {
+			selected[field] = v
+		}
+	}
+	return json.Marshal(selected)
+}
+
+// readIndexes collects every index in the index file without creating any.
+func readIndexes(f *appendable.IndexFile) ([]index, error) {
+	var indexes []index
+	page, err := f.Indexes()
+	for err == nil {
+		meta := &appendable.IndexMeta{}
+		if err := page.UnmarshalMetadata(meta); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal index metadata: %w", err)
+		}
+		indexes = append(indexes, index{page: page, meta: meta})
+		page, err = page.Next()
+	}
+	if !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+	return indexes, nil
+}
@@ -0,0 +1,250 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+	"github.com/kevmo314/appendable/pkg/buftest"
+	"github.com/kevmo314/appendable/pkg/handlers"
+)
+
+func newTestIndex(t *testing.T, lines ...string) (*appendable.IndexFile, []byte) {
+	df := []byte(strings.Join(lines, "\n") + "\n")
+	f, err := appendable.NewIndexFile(buftest.NewSeekableBuffer(), handlers.JSONLHandler{}, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Synchronize(df); err != nil {
+		t.Fatal(err)
+	}
+	return f, df
+}
+
+func names(t *testing.T, records []Record) []string {
+	var out []string
+	for _, r := range records {
+		var v struct{ Name string }
+		if err := json.Unmarshal(r.Data, &v); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, v.Name)
+	}
+	return out
+}
+
+func TestExecute(t *testing.T) {
+	var lines []string
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, fmt.Sprintf(`{"name":"n%03d","count":%d,"even":%t,"maybe":null}`, i, i%10, i%2 == 0))
+	}
+	f, df := newTestIndex(t, lines...)
+
+	t.Run("equality on a number", func(t *testing.T) {
+		records, err := Execute(f, df, Query{Where: []Where{{Operation: OperationEqual, Key: "count", Value: 3}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 100 {
+			t.Fatalf("expected 100 records, got %d", len(records))
+		}
+		for _, name := range names(t, records) {
+			var i int
+			fmt.Sscanf(name, "n%d", &i)
+			if i%10 != 3 {
+				t.Fatalf("unexpected record %s", name)
+			}
+		}
+	})
+
+	t.Run("equality on a string", func(t *testing.T) {
+		records, err := Execute(f, df, Query{Where: []Where{{Operation: OperationEqual, Key: "name", Value: "n123"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := names(t, records); len(got) != 1 || got[0] != "n123" {
+			t.Fatalf("expected [n123], got %v", got)
+		}
+	})
+
+	t.Run("equality on a boolean and null", func(t *testing.T) {
+		records, err := Execute(f, df, Query{Where: []Where{{Operation: OperationEqual, Key: "even", Value: true}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 500 {
+			t.Fatalf("expected 500 records, got %d", len(records))
+		}
+		records, err = Execute(f, df, Query{Where: []Where{{Operation: OperationEqual, Key: "maybe", Value: nil}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 1000 {
+			t.Fatalf("expected 1000 records, got %d", len(records))
+		}
+	})
+
+	t.Run("range operations", func(t *testing.T) {
+		for _, tc := range []struct {
+			op   Operation
+			want int
+		}{
+			{OperationLessThan, 300},
+			{OperationLessThanOrEqual, 400},
+			{OperationGreaterThanOrEqual, 700},
+			{OperationGreaterThan, 600},
+		} {
+			records, err := Execute(f, df, Query{Where: []Where{{Operation: tc.op, Key: "count", Value: 3}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != tc.want {
+				t.Errorf("count %s 3: expected %d records, got %d", tc.op, tc.want, len(records))
+			}
+		}
+	})
+
+	t.Run("range on strings with a bounded filter", func(t *testing.T) {
+		records, err := Execute(f, df, Query{Where: []Where{
+			{Operation: OperationGreaterThanOrEqual, Key: "name", Value: "n100"},
+			{Operation: OperationLessThan, Key: "name", Value: "n105"},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := names(t, records)
+		want := []string{"n100", "n101", "n102", "n103", "n104"}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("order by descending with limit", func(t *testing.T) {
+		records, err := Execute(f, df, Query{
+			Where:   []Where{{Operation: OperationLessThan, Key: "name", Value: "n010"}},
+			OrderBy: []OrderBy{{Key: "name", Direction: DirectionDescending}},
+			Limit:   3,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := names(t, records)
+		want := []string{"n009", "n008", "n007"}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("select", func(t *testing.T) {
+		records, err := Execute(f, df, Query{
+			Where:  []Where{{Operation: OperationEqual, Key: "name", Value: "n042"}},
+			Select: []string{"count"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 1 || string(records[0].Data) != `{"count":2}` {
+			t.Fatalf("unexpected records %v", records)
+		}
+	})
+
+	t.Run("integers and floats", func(t *testing.T) {
+		f, df := newTestIndex(t,
+			`{"name":"a","id":9007199254740993}`,
+			`{"name":"b","id":9007199254740992}`,
+			`{"name":"c","id":18446744073709551615}`,
+			`{"name":"d","id":2.5}`,
+			`{"name":"e","id":3}`,
+			`{"name":"f","id":3.0}`,
+		)
+		for _, tc := range []struct {
+			query Query
+			want  string
+		}{
+			{Query{Where: []Where{{Operation: OperationEqual, Key: "id", Value: int64(9007199254740993)}}}, "[a]"},
+			{Query{Where: []Where{{Operation: OperationGreaterThan, Key: "id", Value: int64(9007199254740992)}}}, "[a c]"},
+			{Query{Where: []Where{{Operation: OperationEqual, Key: "id", Value: uint64(18446744073709551615)}}}, "[c]"},
+			{Query{Where: []Where{{Operation: OperationEqual, Key: "id", Value: 9007199254740992.0}}}, "[b]"},
+			{Query{Where: []Where{{Operation: OperationEqual, Key: "id", Value: 3}}}, "[e f]"},
+			{Query{Where: []Where{{Operation: OperationEqual, Key: "id", Value: 3.0}}}, "[e f]"},
+			{Query{Where: []Where{{Operation: OperationEqual, Key: "id", Value: 2.5}}}, "[d]"},
+			{Query{Where: []Where{{Operation: OperationLessThan, Key: "id", Value: 3.0}}}, "[d]"},
+			{Query{Where: []Where{{Operation: OperationGreaterThan, Key: "id", Value: 2.75}}}, "[e f b a c]"},
+			{Query{Where: []Where{
+				{Operation: OperationGreaterThanOrEqual, Key: "id", Value: 2},
+				{Operation: OperationLessThanOrEqual, Key: "id", Value: uint64(9007199254740992)},
+			}}, "[d e f b]"},
+			{Query{
+				Where:   []Where{{Operation: OperationGreaterThanOrEqual, Key: "id", Value: 0}},
+				OrderBy: []OrderBy{{Key: "id", Direction: DirectionDescending}},
+				Limit:   3,
+			}, "[c a b]"},
+		} {
+			records, err := Execute(f, df, tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(names(t, records)); got != tc.want {
+				t.Errorf("%+v: expected %s, got %s", tc.query, tc.want, got)
+			}
+		}
+	})
+
+	t.Run("range on negative floats", func(t *testing.T) {
+		f, df := newTestIndex(t,
+			`{"name":"a","t":-0.5}`,
+			`{"name":"b","t":2.5}`,
+			`{"name":"c","t":-12.5}`,
+			`{"name":"d","t":0.25}`,
+		)
+		records, err := Execute(f, df, Query{Where: []Where{{Operation: OperationLessThan, Key: "t", Value: 1.0}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(names(t, records)); got != "[c a d]" {
+			t.Fatalf("expected [c a d], got %s", got)
+		}
+	})
+
+	t.Run("contains on an array", func(t *testing.T) {
+		f, df := newTestIndex(t,
+			`{"name":"a","tags":["x","y","y"]}`,
+			`{"name":"b","tags":["y","z"]}`,
+			`{"name":"c","tags":[]}`,
+		)
+		records, err := Execute(f, df, Query{Where: []Where{{Operation: OperationEqual, Key: "tags", Value: "y"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := names(t, records); fmt.Sprint(got) != "[a b]" {
+			t.Fatalf("expected [a b], got %v", got)
+		}
+
+		// each record is returned once even if several elements match.
+		records, err = Execute(f, df, Query{Where: []Where{{Operation: OperationGreaterThanOrEqual, Key: "tags", Value: "x"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := names(t, records); fmt.Sprint(got) != "[a b]" {
+			t.Fatalf("expected [a b], got %v", got)
+		}
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		for _, q := range []Query{
+			{},
+			{Where: []Where{{Operation: "!=", Key: "count", Value: 1}}},
+			{Where: []Where{{Operation: OperationEqual, Key: "missing", Value: 1}}},
+			{Where: []Where{{Operation: OperationEqual, Key: "count", Value: "1"}}},
+			{Where: []Where{{Operation: OperationEqual, Key: "count", Value: 1}, {Operation: OperationEqual, Key: "name", Value: "n001"}}},
+			{Where: []Where{{Operation: OperationEqual, Key: "count", Value: 1}}, OrderBy: []OrderBy{{Key: "name", Direction: DirectionAscending}}},
+			{Where: []Where{{Operation: OperationEqual, Key: "count", Value: 1}}, Select: []string{"missing"}},
+		} {
+			if _, err := Execute(f, df, q); err == nil {
+				t.Errorf("expected error for query %+v", q)
+			}
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package query
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+)
+
+// validate mirrors validateQuery in src/db/query-validation.ts.
+func validate(q Query, indexes []index) error {
+	if len(q.Where) == 0 {
+		return fmt.Errorf("missing 'where' clause")
+	}
+
+	fieldTypes := make(map[string][]appendable.FieldType)
+	for _, idx := range indexes {
+		fieldTypes[idx.meta.FieldName] = append(fieldTypes[idx.meta.FieldName], idx.meta.FieldType)
+	}
+
+	key := q.Where[0].Key
+	for _, w := range q.Where {
+		switch w.Operation {
+		case OperationLessThan, OperationLessThanOrEqual, OperationEqual, OperationGreaterThanOrEqual, OperationGreaterThan:
+		default:
+			return fmt.Errorf("invalid operation '%s' in 'where' clause", w.Operation)
+		}
+		if w.Key != key {
+			return fmt.Errorf("composite indexes not supported... yet")
+		}
+		types, ok := fieldTypes[w.Key]
+		if !ok {
+			return fmt.Errorf("key: %s in 'where' clause does not exist in dataset", w.Key)
+		}
+		fts, err := indexTypes(w.Value)
+		if err != nil {
+			return err
+		}
+		if !slices.ContainsFunc(fts, func(ft appendable.FieldType) bool { return slices.Contains(types, ft) }) {
+			return fmt.Errorf("%T type not included in %s's header types", w.Value, w.Key)
+		}
+	}
+
+	if len(q.OrderBy) > 0 {
+		// currently only one orderBy is supported and it must be the where key.
+		orderBy := q.OrderBy[0]
+		if orderBy.Direction != DirectionAscending && orderBy.Direction != DirectionDescending {
+			return fmt.Errorf("invalid direction '%s' in 'orderBy' clause", orderBy.Direction)
+		}
+		if orderBy.Key != key {
+			return fmt.Errorf("'key' in 'orderBy' must match 'key' in 'where' clause")
+		}
+	}
+
+	for _, s := range q.Select {
+		if _, ok := fieldTypes[s]; !ok {
+			return fmt.Errorf("%s is not included in the field name headers", s)
+		}
+	}
+
+	if q.Limit < 0 {
+		return fmt.Errorf("limit cannot be negative")
+	}
+	return nil
+}
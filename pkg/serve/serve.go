@@ -0,0 +1,140 @@
+// serve serves a data file and its index file over HTTP.
+package serve
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+)
+
+// Handler serves the data file and index file at paths named after their
+// base names, for example /data.jsonl and /index.dat.
+//
+// The ETag of the index file is derived from its metadata and changes with
+// every commit, and the ETag of the data file changes with the part of it
+// that has been indexed. Only that part is served, so a client never sees
+// records that the index doesn't cover, except for Parquet data files, which
+// are only readable whole. Range requests, including multiple ranges, and
+// conditional requests are supported.
+//
+// The index file may be synchronized in place while it's served, so it's
+// streamed with appendable.ConsistentReader and the response is cut short if
+// a synchronization is committed meanwhile.
+type Handler struct {
+	DataPath    string
+	IndexPath   string
+	DataHandler appendable.DataHandler
+
+	// CacheControl is sent as the Cache-Control header if it isn't empty.
+	CacheControl string
+}
+
+var _ http.Handler = (*Handler)(nil)
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var isData bool
+	switch r.URL.Path {
+	case "/" + filepath.Base(h.DataPath):
+		isData = true
+	case "/" + filepath.Base(h.IndexPath):
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	f, err := os.Open(h.IndexPath)
+	if err != nil {
+		slog.Error("failed to open index file", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	var metadata *appendable.FileMeta
+	var index *appendable.ConsistentReader
+	err = appendable.ReadConsistent(f, h.DataHandler, func(i *appendable.IndexFile) error {
+		var err error
+		if metadata, err = i.Metadata(); err != nil {
+			return err
+		}
+		if !isData {
+			index, err = appendable.NewConsistentReader(f, i)
+		}
+		return err
+	})
+	if err != nil {
+		slog.Error("failed to read index file", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !isData {
+		// the index file is synchronized in place, so the response is cut
+		// short if a synchronization is committed while it's streamed.
+		h.setHeader(w.Header(), indexETag(metadata))
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, index)
+		return
+	}
+
+	df, err := os.Open(h.DataPath)
+	if err != nil {
+		slog.Error("failed to open data file", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer df.Close()
+	tag := dataETag(metadata)
+	// the read offset of a Parquet data file is a row group count instead of
+	// an offset.
+	content := io.ReadSeeker(df)
+	if metadata.Format == appendable.FormatParquet {
+		fi, err := df.Stat()
+		if err != nil {
+			slog.Error("failed to stat data file", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		tag = parquetETag(fi)
+	} else {
+		content = io.NewSectionReader(df, 0, int64(metadata.ReadOffset))
+	}
+	h.setHeader(w.Header(), tag)
+	http.ServeContent(w, r, r.URL.Path, time.Time{}, content)
+}
+
+// setHeader sets the headers that both files are served with.
+func (h *Handler) setHeader(header http.Header, tag string) {
+	header.Set("ETag", tag)
+	if h.CacheControl != "" {
+		header.Set("Cache-Control", h.CacheControl)
+	}
+}
+
+// indexETag returns the entity tag of an index file. Every commit that
+// changes the index file increments its generation, including compacting it
+// and changing its index spec.
+func indexETag(metadata *appendable.FileMeta) string {
+	return fmt.Sprintf("\"i-%x-%x-%x\"", metadata.ReadOffset, metadata.Entries, metadata.Generation)
+}
+
+// dataETag returns the entity tag of the indexed part of a data file, which
+// is appended to, so it only changes with the read offset.
+func dataETag(metadata *appendable.FileMeta) string {
+	return fmt.Sprintf("\"d-%x\"", metadata.ReadOffset)
+}
+
+// parquetETag returns the entity tag of a Parquet data file, which is served
+// whole.
+func parquetETag(fi os.FileInfo) string {
+	return fmt.Sprintf("\"p-%x-%x\"", fi.Size(), fi.ModTime().UnixNano())
+}
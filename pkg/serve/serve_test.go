@@ -0,0 +1,201 @@
+package serve
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kevmo314/appendable/pkg/appendable"
+	"github.com/kevmo314/appendable/pkg/buftest"
+	"github.com/kevmo314/appendable/pkg/handlers"
+	"github.com/kevmo314/appendable/pkg/parquet"
+)
+
+func TestHandler(t *testing.T) {
+	dir := t.TempDir()
+	h := &Handler{
+		DataPath:     filepath.Join(dir, "data.jsonl"),
+		IndexPath:    filepath.Join(dir, "index.dat"),
+		DataHandler:  handlers.JSONLHandler{},
+		CacheControl: "no-cache",
+	}
+
+	// update applies f to the index file and returns its new metadata.
+	update := func(t *testing.T, f func(*appendable.IndexFile) error) *appendable.FileMeta {
+		b, err := os.ReadFile(h.IndexPath)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		buf := buftest.NewSeekableBuffer()
+		if _, err := buf.Write(b); err != nil {
+			t.Fatal(err)
+		}
+		i, err := appendable.NewIndexFile(buf, h.DataHandler, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f(i); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(h.IndexPath, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		metadata, err := i.Metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return metadata
+	}
+
+	// synchronize writes the data file and the index file for it.
+	synchronize := func(t *testing.T, data string) *appendable.FileMeta {
+		if err := os.WriteFile(h.DataPath, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return update(t, func(i *appendable.IndexFile) error {
+			return i.Synchronize([]byte(data))
+		})
+	}
+
+	get := func(path string, header http.Header) *http.Response {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	metadata := synchronize(t, "{\"a\":1}\n{\"a\":2}\n{\"a\":")
+	tag := indexETag(metadata)
+
+	t.Run("serves the indexed part of the data file", func(t *testing.T) {
+		res := get("/data.jsonl", nil)
+		body, _ := io.ReadAll(res.Body)
+		if res.StatusCode != http.StatusOK || string(body) != "{\"a\":1}\n{\"a\":2}\n" {
+			t.Fatalf("got %d %q", res.StatusCode, body)
+		}
+		if got, want := res.Header.Get("ETag"), dataETag(metadata); got != want || got == tag {
+			t.Fatalf("got ETag %s, want %s", got, want)
+		}
+		if got := res.Header.Get("Cache-Control"); got != "no-cache" {
+			t.Fatalf("got Cache-Control %q", got)
+		}
+	})
+
+	t.Run("serves the index file", func(t *testing.T) {
+		b, err := os.ReadFile(h.IndexPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := get("/index.dat", nil)
+		body, _ := io.ReadAll(res.Body)
+		if res.StatusCode != http.StatusOK || string(body) != string(b) {
+			t.Fatalf("got %d with %d bytes, want %d bytes", res.StatusCode, len(body), len(b))
+		}
+		if got := res.Header.Get("ETag"); got != tag {
+			t.Fatalf("got ETag %s, want %s", got, tag)
+		}
+	})
+
+	t.Run("serves a range", func(t *testing.T) {
+		res := get("/data.jsonl", http.Header{"Range": {"bytes=8-14"}})
+		body, _ := io.ReadAll(res.Body)
+		if res.StatusCode != http.StatusPartialContent || string(body) != "{\"a\":2}" {
+			t.Fatalf("got %d %q", res.StatusCode, body)
+		}
+		if got := res.Header.Get("Content-Range"); got != "bytes 8-14/16" {
+			t.Fatalf("got Content-Range %q", got)
+		}
+	})
+
+	t.Run("serves multiple ranges", func(t *testing.T) {
+		res := get("/data.jsonl", http.Header{"Range": {"bytes=0-6,8-14"}})
+		body, _ := io.ReadAll(res.Body)
+		if res.StatusCode != http.StatusPartialContent || !strings.HasPrefix(res.Header.Get("Content-Type"), "multipart/byteranges") {
+			t.Fatalf("got %d %s", res.StatusCode, res.Header.Get("Content-Type"))
+		}
+		for _, want := range []string{"bytes 0-6/16", "bytes 8-14/16", "{\"a\":1}", "{\"a\":2}"} {
+			if !strings.Contains(string(body), want) {
+				t.Fatalf("body doesn't contain %q: %q", want, body)
+			}
+		}
+	})
+
+	t.Run("revalidates with the ETag", func(t *testing.T) {
+		res := get("/index.dat", http.Header{"If-None-Match": {tag}})
+		if res.StatusCode != http.StatusNotModified {
+			t.Fatalf("got %d, want 304", res.StatusCode)
+		}
+
+		// the ETag changes once more records are indexed.
+		updated := indexETag(synchronize(t, "{\"a\":1}\n{\"a\":2}\n{\"a\":3}\n"))
+		res = get("/index.dat", http.Header{"If-None-Match": {tag}})
+		if res.StatusCode != http.StatusOK || res.Header.Get("ETag") != updated {
+			t.Fatalf("got %d with ETag %s, want 200 with %s", res.StatusCode, res.Header.Get("ETag"), updated)
+		}
+
+		// and when the index file is rewritten without indexing records.
+		rewritten := indexETag(update(t, func(i *appendable.IndexFile) error {
+			return i.SetIndexSpec(&appendable.IndexSpec{Exclude: []string{"b"}})
+		}))
+		res = get("/index.dat", http.Header{"If-None-Match": {updated}})
+		if res.StatusCode != http.StatusOK || res.Header.Get("ETag") != rewritten || rewritten == updated {
+			t.Fatalf("got %d with ETag %s, want 200 with %s", res.StatusCode, res.Header.Get("ETag"), rewritten)
+		}
+	})
+
+	t.Run("serves parquet data files whole", func(t *testing.T) {
+		dir := t.TempDir()
+		h := &Handler{
+			DataPath:    filepath.Join(dir, "data.parquet"),
+			IndexPath:   filepath.Join(dir, "index.dat"),
+			DataHandler: handlers.ParquetHandler{},
+		}
+		pw := parquet.NewWriter([]parquet.Field{{Name: "a", Type: parquet.TypeInt64}}, parquet.CodecUncompressed)
+		if err := pw.WriteRowGroup([][]any{{int64(1)}, {int64(2)}}); err != nil {
+			t.Fatal(err)
+		}
+		data := pw.Bytes()
+		if err := os.WriteFile(h.DataPath, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Create(h.IndexPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		i, err := appendable.NewIndexFile(f, h.DataHandler, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.Synchronize(data); err != nil {
+			t.Fatal(err)
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/data.parquet", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+			t.Fatalf("got %d with %d bytes, want %d bytes", w.Code, w.Body.Len(), len(data))
+		}
+	})
+
+	t.Run("only serves the data and index files", func(t *testing.T) {
+		if res := get("/other.jsonl", nil); res.StatusCode != http.StatusNotFound {
+			t.Fatalf("got %d, want 404", res.StatusCode)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/data.jsonl", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("got %d, want 405", w.Code)
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func newInotify(path string) (int, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return -1, fmt.Errorf("inotify_init1: %w", err)
+	}
+	if _, err := unix.InotifyAddWatch(fd, path, unix.IN_MODIFY); err != nil {
+		unix.Close(fd)
+		return -1, fmt.Errorf("inotify_add_watch: %w", err)
+	}
+	return fd, nil
+}
+
+// waitInotify waits for an event for at most timeout and discards any events
+// that are queued.
+func waitInotify(fd int, timeout time.Duration) error {
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	if _, err := unix.Poll(fds, int(timeout.Milliseconds())); err != nil && !errors.Is(err, unix.EINTR) {
+		return fmt.Errorf("poll: %w", err)
+	}
+	buf := make([]byte, 4096)
+	for {
+		if _, err := unix.Read(fd, buf); err != nil {
+			if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+				return nil
+			}
+			return fmt.Errorf("read: %w", err)
+		}
+	}
+}
+
+func closeInotify(fd int) error {
+	return unix.Close(fd)
+}
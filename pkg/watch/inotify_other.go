@@ -0,0 +1,22 @@
+//go:build !linux
+
+package watch
+
+import (
+	"errors"
+	"time"
+)
+
+var errInotifyUnsupported = errors.New("inotify is only supported on linux")
+
+func newInotify(path string) (int, error) {
+	return -1, errInotifyUnsupported
+}
+
+func waitInotify(fd int, timeout time.Duration) error {
+	return errInotifyUnsupported
+}
+
+func closeInotify(fd int) error {
+	return errInotifyUnsupported
+}
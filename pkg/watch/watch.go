@@ -0,0 +1,73 @@
+// watch notifies when a file that is being appended to grows.
+package watch
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Watcher waits for a file to change size. It uses inotify where it is
+// available and otherwise polls the size of the file.
+type Watcher struct {
+	path     string
+	interval time.Duration
+
+	// fd is the inotify instance, or -1 if the file is polled.
+	fd   int
+	size int64
+}
+
+// NewWatcher watches the file at path. interval is how often the size is
+// polled, which is also done with inotify in case an event is missed.
+func NewWatcher(path string, interval time.Duration) (*Watcher, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("stat: %w", err)
+	}
+	w := &Watcher{path: path, interval: interval, fd: -1, size: fi.Size()}
+	fd, err := newInotify(path)
+	if err != nil {
+		slog.Warn("inotify is unavailable, polling instead", "path", path, "error", err)
+	} else {
+		w.fd = fd
+	}
+	return w, nil
+}
+
+// Wait blocks until the size of the file differs from when NewWatcher or the
+// previous Wait returned, or until ctx is done.
+func (w *Watcher) Wait(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fi, err := os.Stat(w.path)
+		if err != nil {
+			return fmt.Errorf("stat: %w", err)
+		}
+		if fi.Size() != w.size {
+			w.size = fi.Size()
+			return nil
+		}
+		if w.fd == -1 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(w.interval):
+			}
+		} else if err := waitInotify(w.fd, w.interval); err != nil {
+			return err
+		}
+	}
+}
+
+// Close stops watching the file.
+func (w *Watcher) Close() error {
+	if w.fd == -1 {
+		return nil
+	}
+	return closeInotify(w.fd)
+}
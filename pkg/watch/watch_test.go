@@ -0,0 +1,71 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	for _, polling := range []bool{false, true} {
+		name := "inotify"
+		if polling {
+			name = "polling"
+		}
+
+		t.Run(name+" notices appends", func(t *testing.T) {
+			f, err := os.CreateTemp("", "watch")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(f.Name())
+			defer f.Close()
+
+			w, err := NewWatcher(f.Name(), 10*time.Millisecond)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+			if polling && w.fd != -1 {
+				if err := closeInotify(w.fd); err != nil {
+					t.Fatal(err)
+				}
+				w.fd = -1
+			}
+
+			go func() {
+				time.Sleep(20 * time.Millisecond)
+				f.Write([]byte("{}\n"))
+			}()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := w.Wait(ctx); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		f, err := os.CreateTemp("", "watch")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+
+		w, err := NewWatcher(f.Name(), 10*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := w.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got %v, want context.DeadlineExceeded", err)
+		}
+	})
+}
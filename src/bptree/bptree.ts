@@ -1,4 +1,9 @@
-import { BPTreeNode, DataPointer, MemoryPointer } from "./node";
+import {
+  BPTreeNode,
+  DataPointer,
+  MemoryPointer,
+  pageSizeBytes,
+} from "./node";
 import { RangeResolver } from "../resolver/resolver";
 import { TraversalIterator, TraversalRecord } from "./traversal";
 import { FileFormat } from "../file/meta";
@@ -20,6 +25,7 @@ export class BPTree {
   private readonly fileFormat: FileFormat;
   private readonly pageFieldType: FieldType;
   private readonly pageFieldWidth: number;
+  private readonly pageSize: number;
 
   private rootNodeCache: Promise<BPTreeNode> | null = null;
   private rootPointerCache: Promise<MemoryPointer> | null = null;
@@ -40,6 +46,7 @@ export class BPTree {
     pageFieldType: FieldType,
     pageFieldWidth: number,
     entries: number,
+    pageSize: number = pageSizeBytes,
   ) {
     this.tree = tree;
     this.meta = meta;
@@ -48,6 +55,7 @@ export class BPTree {
     this.pageFieldType = pageFieldType;
     this.pageFieldWidth = pageFieldWidth;
     this.entries = entries;
+    this.pageSize = pageSize;
   }
 
   async root(): Promise<RootResponse> {
@@ -83,6 +91,7 @@ export class BPTree {
         this.fileFormat,
         this.pageFieldType,
         this.pageFieldWidth,
+        this.pageSize,
       );
 
       if (!bytesRead) {
@@ -1,11 +1,16 @@
 import { FieldType } from "../db/database";
 import { FileFormat } from "../file/meta";
 import { RangeResolver } from "../resolver/resolver";
+import { encodeFloat64, encodeInt64, encodeUint64 } from "../util/sortable";
 import { decodeUvarint } from "../util/uvarint";
 import { ReferencedValue } from "./bptree";
 
 export const pageSizeBytes = 4096;
 
+// storedWidth is the width of trees whose variable width keys are stored in
+// the nodes instead of the data file, see StoredWidth in pkg/bptree.
+export const storedWidth = 65535;
+
 export type MemoryPointer = { offset: bigint; length: number };
 
 export type DataPointer = {
@@ -22,6 +27,7 @@ export class BPTreeNode {
   private readonly pageFieldType: FieldType;
   private readonly tree: RangeResolver;
   private readonly pageFieldWidth: number;
+  private readonly pageSize: number;
 
   private readonly childrenCache: (Promise<BPTreeNode> | null)[];
 
@@ -34,6 +40,7 @@ export class BPTreeNode {
     pageFieldType: FieldType,
     tree: RangeResolver,
     pageFieldWidth: number,
+    pageSize: number = pageSizeBytes,
   ) {
     this.keys = keys;
     this.leafPointers = leafPointers;
@@ -43,6 +50,7 @@ export class BPTreeNode {
     this.pageFieldType = pageFieldType;
     this.tree = tree;
     this.pageFieldWidth = pageFieldWidth;
+    this.pageSize = pageSize;
     this.childrenCache = new Array(this.numPointers()).fill(null);
   }
 
@@ -76,6 +84,7 @@ export class BPTreeNode {
         this.fileFormat,
         this.pageFieldType,
         this.pageFieldWidth,
+        this.pageSize,
       ).then(({ node, bytesRead }) => {
         if (!bytesRead) {
           throw new Error("bytes read do not line up");
@@ -149,7 +158,12 @@ export class BPTreeNode {
         length: dpLength,
       });
 
-      if (pageFieldWidth === 0) {
+      if (pageFieldWidth === storedWidth) {
+        const { value: length, bytesRead } = decodeUvarint(buffer.slice(m));
+        m += bytesRead;
+        this.keys[idx].setValue(buffer.slice(m, m + length));
+        m += length;
+      } else if (pageFieldWidth === 0) {
         const dp = this.keys[idx].dataPointer;
 
         dpRanges.push({
@@ -204,6 +218,7 @@ export class BPTreeNode {
 
     switch (this.fileFormat) {
       case FileFormat.JSONL:
+      case FileFormat.RECORDIO:
         const jValue = JSON.parse(stringData);
 
         switch (this.pageFieldType) {
@@ -216,14 +231,16 @@ export class BPTreeNode {
           case FieldType.Boolean:
             return new Uint8Array([jValue ? 1 : 0]).buffer;
 
-          case FieldType.Float64:
           case FieldType.Int64:
           case FieldType.Uint64:
-            const floatBuf = new ArrayBuffer(8);
-            let floatBufView = new DataView(floatBuf);
-            floatBufView.setFloat64(0, jValue);
+            // integers are parsed from the text since JSON.parse rounds them.
+            const intValue = BigInt(stringData.trim());
+            return this.pageFieldType === FieldType.Int64
+              ? encodeInt64(intValue)
+              : encodeUint64(intValue);
 
-            return floatBuf;
+          case FieldType.Float64:
+            return encodeFloat64(jValue);
 
           case FieldType.String:
             const e = new TextEncoder().encode(jValue);
@@ -236,6 +253,27 @@ export class BPTreeNode {
         }
 
       case FileFormat.CSV:
+        // quoted fields point at the opening quote.
+        if (
+          stringData.length >= 2 &&
+          stringData.startsWith('"') &&
+          stringData.endsWith('"')
+        ) {
+          return new TextEncoder().encode(
+            stringData.slice(1, -1).split('""').join('"'),
+          ).buffer;
+        }
+        return incomingData;
+
+      case FileFormat.TSV:
+        return new TextEncoder().encode(
+          stringData.replace(/\\([tnr\\])/g, (_, c) =>
+            c === "t" ? "\t" : c === "n" ? "\n" : c === "r" ? "\r" : "\\",
+          ),
+        ).buffer;
+
+      case FileFormat.PARQUET:
+        // parquet keys point directly at the plain encoded bytes.
         return incomingData;
     }
   }
@@ -247,11 +285,12 @@ export class BPTreeNode {
     fileFormat: FileFormat,
     pageFieldType: FieldType,
     pageFieldWidth: number,
+    pageSize: number = pageSizeBytes,
   ): Promise<{ node: BPTreeNode; bytesRead: number }> {
     const res = await resolver([
       {
         start: Number(mp.offset),
-        end: Number(mp.offset) + 4096 - 1,
+        end: Number(mp.offset) + pageSize - 1,
       },
     ]);
     const { data: bufferData } = res[0];
@@ -264,10 +303,11 @@ export class BPTreeNode {
       pageFieldType,
       resolver,
       pageFieldWidth,
+      pageSize,
     );
 
     await node.unmarshalBinary(bufferData, pageFieldWidth);
 
-    return { node, bytesRead: pageSizeBytes };
+    return { node, bytesRead: pageSize };
   }
 }
@@ -15,7 +15,12 @@ import {
 } from "./query-lang";
 import { NgramTokenizer } from "../ngram/tokenizer";
 import { PriorityTable } from "../ngram/table";
-import { DataPointer } from "../bptree/node";
+import { DataPointer, MemoryPointer } from "../bptree/node";
+import {
+  boundNumber,
+  compareNumbers,
+  decodeNumber,
+} from "./query-number";
 export enum FieldType {
   String = 0,
   Int64 = 1,
@@ -30,6 +35,16 @@ export enum FieldType {
   Unigram = 10,
 }
 
+// numericTypes are the types of the indexes that hold numbers. The data
+// handlers index integers in the Int64 index, or the Uint64 index if they
+// overflow an int64, and everything else in the Float64 index, so a number is
+// looked up in all of them.
+export const numericTypes = [
+  FieldType.Int64,
+  FieldType.Uint64,
+  FieldType.Float64,
+];
+
 export function fieldTypeToString(f: FieldType): string {
   let str;
   switch (f) {
@@ -76,6 +91,76 @@ export function fieldTypeToString(f: FieldType): string {
   return str;
 }
 
+type ScanKey = { key: ArrayBuffer; pointer: MemoryPointer };
+
+// mergeScans merges the scans of the indexes of a field, which are each in
+// the order ord, into the records in the order of their keys. Numbers are
+// compared by value across the numeric indexes. Records are yielded once,
+// even if they match in more than one index.
+async function* mergeScans(
+  scans: { fieldType: FieldType; keys: AsyncGenerator<ScanKey> }[],
+  ord: "ASC" | "DESC",
+): AsyncGenerator<MemoryPointer> {
+  const heads: (ScanKey | null)[] = [];
+  for (const { keys } of scans) {
+    const res = await keys.next();
+    heads.push(res.done ? null : res.value);
+  }
+  const seen = new Set<string>();
+  while (true) {
+    let next = -1;
+    for (let i = 0; i < scans.length; i++) {
+      const head = heads[i];
+      if (head === null) {
+        continue;
+      }
+      if (next === -1) {
+        next = i;
+        continue;
+      }
+      const cmp = compareKeys(
+        scans[i].fieldType,
+        head.key,
+        scans[next].fieldType,
+        heads[next]!.key,
+      );
+      if ((ord === "ASC" && cmp < 0) || (ord === "DESC" && cmp > 0)) {
+        next = i;
+      }
+    }
+    if (next === -1) {
+      return;
+    }
+    const { pointer } = heads[next]!;
+    const res = await scans[next].keys.next();
+    heads[next] = res.done ? null : res.value;
+    // records are identified by their offset and length in the data file,
+    // which are the row group and the row of Parquet records.
+    const id = `${pointer.offset}:${pointer.length}`;
+    if (seen.has(id)) {
+      continue;
+    }
+    seen.add(id);
+    yield pointer;
+  }
+}
+
+function compareKeys(
+  aType: FieldType,
+  a: ArrayBuffer,
+  bType: FieldType,
+  b: ArrayBuffer,
+): number {
+  if (
+    aType === bType ||
+    !numericTypes.includes(aType) ||
+    !numericTypes.includes(bType)
+  ) {
+    return ReferencedValue.compareBytes(a, b);
+  }
+  return compareNumbers(decodeNumber(aType, a), decodeNumber(bType, b));
+}
+
 export class Database<T extends Schema> {
   private indexHeadersPromise?: Promise<IndexHeader[]>;
 
@@ -156,6 +241,7 @@ export class Database<T extends Schema> {
             mpFieldType,
             mpFieldWidth,
             entries,
+            mp.getPageSize(),
           );
           btreeMap.set(fieldType, btree);
         }
@@ -189,234 +275,211 @@ export class Database<T extends Schema> {
     }
 
     if (query.where) {
+      let ord: "ASC" | "DESC" = "ASC";
+      if (query.orderBy && query.orderBy[0]) {
+        ord = query.orderBy[0].direction;
+      }
+
       for (const { key, value, operation } of query.where ?? []) {
         const header = headers.find((header) => header.fieldName === key);
         if (!header) {
           throw new Error("field not found");
         }
 
-        const res = processWhere(value);
-        if (res === null) {
-          throw new Error(`unable to process key with a type ${typeof value}`);
-        }
-        const { fieldType, valueBuf } = res;
-
-        const mps = await this.indexFile.seek(key as string, fieldType);
-        const mp = mps[0];
-        const { fieldType: mpFieldType, width: mpFieldWidth } = readIndexMeta(
-          await mp.metadata(),
-        );
-
-        let ord: "ASC" | "DESC" = "ASC";
-        if (query.orderBy && query.orderBy[0]) {
-          ord = query.orderBy[0].direction;
-        }
-
-        const btree = new BPTree(
-          this.indexFile.getResolver(),
-          mp,
-          dfResolver,
-          format,
-          mpFieldType,
-          mpFieldWidth,
-          entries,
-        );
-
-        if (operation === ">") {
-          if (ord === "ASC") {
-            const valueRef = new ReferencedValue(
-              { offset: maxUint64, length: 0 },
-              valueBuf,
-            );
-            const iter = btree.iter(valueRef);
-
-            while (await iter.next()) {
-              const mp = iter.getPointer();
-
-              const data = await this.dataFile.get(
-                Number(mp.offset),
-                Number(mp.offset) + mp.length - 1,
-              );
-
-              yield handleSelect(data, query.select);
+        // numbers are compared with every numeric index of the field, the
+        // scans of each index are merged by value.
+        const scans: { fieldType: FieldType; keys: AsyncGenerator<ScanKey> }[] =
+          [];
+        if (typeof value === "number" || typeof value === "bigint") {
+          for (const fieldType of numericTypes) {
+            if (!header.fieldTypes.includes(fieldType)) {
+              continue;
             }
-          } else {
-            const lastKey = await btree.last();
-            const iter = btree.iter(lastKey);
-
-            while (await iter.prev()) {
-              const currentKey = iter.getKey();
-
-              if (
-                ReferencedValue.compareBytes(currentKey.value, valueBuf) < 0
-              ) {
-                break;
-              }
-
-              const mp = iter.getPointer();
-
-              const data = await this.dataFile.get(
-                Number(mp.offset),
-                Number(mp.offset) + mp.length - 1,
-              );
-              yield handleSelect(data, query.select);
+            const bound = boundNumber(fieldType, operation, value);
+            if (bound === null) {
+              continue;
             }
+            const btree = await this.btree(key as string, fieldType);
+            scans.push({
+              fieldType,
+              keys: this.scan(btree, bound.operation, bound.valueBuf, ord),
+            });
           }
-        } else if (operation === ">=") {
-          if (ord === "ASC") {
-            const valueRef = new ReferencedValue(
-              { offset: 0n, length: 0 },
-              valueBuf,
+        } else {
+          const res = processWhere(value);
+          if (res === null) {
+            throw new Error(
+              `unable to process key with a type ${typeof value}`,
             );
-            const iter = btree.iter(valueRef);
-
-            while (await iter.next()) {
-              const mp = iter.getPointer();
-
-              const data = await this.dataFile.get(
-                Number(mp.offset),
-                Number(mp.offset) + mp.length - 1,
-              );
-
-              // console.log(
-              //   `ranges`,
-              //   Number(mp.offset),
-              //   Number(mp.offset) + mp.length - 1,
-              // );
-              yield handleSelect(data, query.select);
-            }
-          } else {
-            const lastKey = await btree.last();
-            const iter = btree.iter(lastKey);
-
-            while (await iter.prev()) {
-              const currentKey = iter.getKey();
-
-              if (
-                ReferencedValue.compareBytes(currentKey.value, valueBuf) < 0
-              ) {
-                break;
-              }
-
-              const mp = iter.getPointer();
-
-              const data = await this.dataFile.get(
-                Number(mp.offset),
-                Number(mp.offset) + mp.length - 1,
-              );
-
-              yield handleSelect(data, query.select);
-            }
           }
-        } else if (operation === "==") {
-          const valueRef = new ReferencedValue(
-            { offset: 0n, length: 0 },
-            valueBuf,
+          const { fieldType, valueBuf } = res;
+          const btree = await this.btree(key as string, fieldType);
+          scans.push({
+            fieldType,
+            keys: this.scan(btree, operation, valueBuf, ord),
+          });
+        }
+
+        for await (const mp of mergeScans(scans, ord)) {
+          const data = await this.dataFile.get(
+            Number(mp.offset),
+            Number(mp.offset) + mp.length - 1,
           );
-          const iter = btree.iter(valueRef);
 
-          while (await iter.next()) {
-            const currentKey = iter.getKey();
+          yield handleSelect(data, query.select);
+        }
+      }
+    }
+  }
 
-            if (
-              ReferencedValue.compareBytes(currentKey.value, valueBuf) !== 0
-            ) {
-              break;
-            }
+  private async btree(key: string, fieldType: FieldType): Promise<BPTree> {
+    const { format, entries } = await this.indexFile.metadata();
+    const dfResolver = this.dataFile.getResolver();
+    if (!dfResolver) {
+      throw new Error("data file is undefined");
+    }
 
-            const mp = iter.getPointer();
+    const mps = await this.indexFile.seek(key, fieldType);
+    const mp = mps[0];
+    const { fieldType: mpFieldType, width: mpFieldWidth } = readIndexMeta(
+      await mp.metadata(),
+    );
+
+    return new BPTree(
+      this.indexFile.getResolver(),
+      mp,
+      dfResolver,
+      format,
+      mpFieldType,
+      mpFieldWidth,
+      entries,
+      mp.getPageSize(),
+    );
+  }
 
-            if (mp === null) {
-              throw new Error(`memory pointer is undefined`);
-            }
+  // scan walks the keys of btree that satisfy the operation with valueBuf in
+  // the order ord.
+  private async *scan(
+    btree: BPTree,
+    operation: WhereNode<T>["operation"],
+    valueBuf: ArrayBuffer,
+    ord: "ASC" | "DESC",
+  ): AsyncGenerator<ScanKey> {
+    if (operation === ">") {
+      if (ord === "ASC") {
+        const valueRef = new ReferencedValue(
+          { offset: maxUint64, length: 0 },
+          valueBuf,
+        );
+        const iter = btree.iter(valueRef);
 
-            const data = await this.dataFile.get(
-              Number(mp.offset),
-              Number(mp.offset) + mp.length - 1,
-            );
+        while (await iter.next()) {
+          yield { key: iter.getKey().value, pointer: iter.getPointer() };
+        }
+      } else {
+        const lastKey = await btree.last();
+        const iter = btree.iter(lastKey);
 
-            yield handleSelect(data, query.select);
+        while (await iter.prev()) {
+          const currentKey = iter.getKey();
+
+          if (ReferencedValue.compareBytes(currentKey.value, valueBuf) <= 0) {
+            break;
           }
-        } else if (operation === "<=") {
-          if (ord === "DESC") {
-            const valueRef = new ReferencedValue(
-              { offset: maxUint64, length: 0 },
-              valueBuf,
-            );
-            const iter = btree.iter(valueRef);
-            while (await iter.prev()) {
-              const mp = iter.getPointer();
 
-              const data = await this.dataFile.get(
-                Number(mp.offset),
-                Number(mp.offset) + mp.length - 1,
-              );
+          yield { key: currentKey.value, pointer: iter.getPointer() };
+        }
+      }
+    } else if (operation === ">=") {
+      if (ord === "ASC") {
+        const valueRef = new ReferencedValue(
+          { offset: 0n, length: 0 },
+          valueBuf,
+        );
+        const iter = btree.iter(valueRef);
 
-              yield handleSelect(data, query.select);
-            }
-          } else {
-            const firstKey = await btree.first();
-            const iter = btree.iter(firstKey);
+        while (await iter.next()) {
+          yield { key: iter.getKey().value, pointer: iter.getPointer() };
+        }
+      } else {
+        const lastKey = await btree.last();
+        const iter = btree.iter(lastKey);
 
-            while (await iter.next()) {
-              const currentKey = iter.getKey();
+        while (await iter.prev()) {
+          const currentKey = iter.getKey();
 
-              if (
-                ReferencedValue.compareBytes(currentKey.value, valueBuf) > 0
-              ) {
-                break;
-              }
+          if (ReferencedValue.compareBytes(currentKey.value, valueBuf) < 0) {
+            break;
+          }
 
-              const mp = iter.getPointer();
+          yield { key: currentKey.value, pointer: iter.getPointer() };
+        }
+      }
+    } else if (operation === "==") {
+      const valueRef = new ReferencedValue({ offset: 0n, length: 0 }, valueBuf);
+      const iter = btree.iter(valueRef);
 
-              const data = await this.dataFile.get(
-                Number(mp.offset),
-                Number(mp.offset) + mp.length - 1,
-              );
+      while (await iter.next()) {
+        const currentKey = iter.getKey();
 
-              yield handleSelect(data, query.select);
-            }
-          }
-        } else if (operation === "<") {
-          if (ord === "DESC") {
-            const valueRef = new ReferencedValue(
-              { offset: 0n, length: 0 },
-              valueBuf,
-            );
-            const iter = btree.iter(valueRef);
-            while (await iter.prev()) {
-              const mp = iter.getPointer();
+        if (ReferencedValue.compareBytes(currentKey.value, valueBuf) !== 0) {
+          break;
+        }
 
-              const data = await this.dataFile.get(
-                Number(mp.offset),
-                Number(mp.offset) + mp.length - 1,
-              );
+        const mp = iter.getPointer();
 
-              yield handleSelect(data, query.select);
-            }
-          } else {
-            const firstKey = await btree.first();
-            const iter = btree.iter(firstKey);
+        if (mp === null) {
+          throw new Error(`memory pointer is undefined`);
+        }
+
+        yield { key: currentKey.value, pointer: mp };
+      }
+    } else if (operation === "<=") {
+      if (ord === "DESC") {
+        const valueRef = new ReferencedValue(
+          { offset: maxUint64, length: 0 },
+          valueBuf,
+        );
+        const iter = btree.iter(valueRef);
+        while (await iter.prev()) {
+          yield { key: iter.getKey().value, pointer: iter.getPointer() };
+        }
+      } else {
+        const firstKey = await btree.first();
+        const iter = btree.iter(firstKey);
 
-            while (await iter.next()) {
-              const currentKey = iter.getKey();
+        while (await iter.next()) {
+          const currentKey = iter.getKey();
 
-              if (
-                ReferencedValue.compareBytes(currentKey.value, valueBuf) >= 0
-              ) {
-                break;
-              }
+          if (ReferencedValue.compareBytes(currentKey.value, valueBuf) > 0) {
+            break;
+          }
 
-              const mp = iter.getPointer();
+          yield { key: currentKey.value, pointer: iter.getPointer() };
+        }
+      }
+    } else if (operation === "<") {
+      if (ord === "DESC") {
+        const valueRef = new ReferencedValue(
+          { offset: 0n, length: 0 },
+          valueBuf,
+        );
+        const iter = btree.iter(valueRef);
+        while (await iter.prev()) {
+          yield { key: iter.getKey().value, pointer: iter.getPointer() };
+        }
+      } else {
+        const firstKey = await btree.first();
+        const iter = btree.iter(firstKey);
 
-              const data = await this.dataFile.get(
-                Number(mp.offset),
-                Number(mp.offset) + mp.length - 1,
-              );
+        while (await iter.next()) {
+          const currentKey = iter.getKey();
 
-              yield handleSelect(data, query.select);
-            }
+          if (ReferencedValue.compareBytes(currentKey.value, valueBuf) >= 0) {
+            break;
           }
+
+          yield { key: currentKey.value, pointer: iter.getPointer() };
         }
       }
     }
@@ -1,4 +1,5 @@
 import { FieldType } from "./database";
+import { encodeFloat64, encodeInt64, encodeUint64 } from "../util/sortable";
 
 export type Schema = {
   [key: string]: {};
@@ -42,8 +43,6 @@ type QueryWhere = {
 };
 
 export function processWhere<T>(value: T[keyof T]): QueryWhere | null {
-  let valueBuf: ArrayBuffer;
-
   if (value === null) {
     return {
       fieldType: FieldType.Null,
@@ -52,12 +51,19 @@ export function processWhere<T>(value: T[keyof T]): QueryWhere | null {
   } else {
     switch (typeof value) {
       case "bigint":
+        // this is the index that holds the value, queries compare numbers
+        // with every numeric index of the field, see boundNumber.
+        if (value >= -(1n << 63n) && value < 1n << 63n) {
+          return { fieldType: FieldType.Int64, valueBuf: encodeInt64(value) };
+        }
+        if (value >= 0n && value < 1n << 64n) {
+          return { fieldType: FieldType.Uint64, valueBuf: encodeUint64(value) };
+        }
+        return null;
       case "number":
-        valueBuf = new ArrayBuffer(8);
-        new DataView(valueBuf).setFloat64(0, Number(value));
         return {
           fieldType: FieldType.Float64,
-          valueBuf,
+          valueBuf: encodeFloat64(value),
         };
       case "boolean":
         return {
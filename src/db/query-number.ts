@@ -0,0 +1,148 @@
+import { FieldType } from "./database";
+import { WhereNode } from "./query-lang";
+import {
+  decodeFloat64,
+  decodeInt64,
+  decodeUint64,
+  encodeFloat64,
+  encodeInt64,
+  encodeUint64,
+} from "../util/sortable";
+
+// These mirror pkg/query/number.go.
+
+type Operation = WhereNode<any>["operation"];
+
+export type NumericBound = {
+  operation: Operation;
+  valueBuf: ArrayBuffer;
+};
+
+// decodeNumber returns the number that key encodes in an index of type
+// fieldType. Comparing a number with a bigint compares their exact values.
+export function decodeNumber(
+  fieldType: FieldType,
+  key: ArrayBuffer,
+): number | bigint {
+  switch (fieldType) {
+    case FieldType.Int64:
+      return decodeInt64(key);
+    case FieldType.Uint64:
+      return decodeUint64(key);
+  }
+  return decodeFloat64(key);
+}
+
+export function compareNumbers(a: number | bigint, b: number | bigint) {
+  return a < b ? -1 : a > b ? 1 : 0;
+}
+
+// boundNumber converts comparing a key with value to an equivalent comparison
+// of the key with a value of the index of type fieldType, which may round
+// value. It returns null if no key of the index can match.
+export function boundNumber(
+  fieldType: FieldType,
+  operation: Operation,
+  value: number | bigint,
+): NumericBound | null {
+  switch (fieldType) {
+    case FieldType.Int64: {
+      const res = boundInteger(
+        operation,
+        value,
+        -(1n << 63n),
+        (1n << 63n) - 1n,
+      );
+      if (!res) {
+        return null;
+      }
+      return { operation: res.operation, valueBuf: encodeInt64(res.value) };
+    }
+    case FieldType.Uint64: {
+      const res = boundInteger(operation, value, 0n, (1n << 64n) - 1n);
+      if (!res) {
+        return null;
+      }
+      return { operation: res.operation, valueBuf: encodeUint64(res.value) };
+    }
+  }
+
+  if (typeof value === "number") {
+    return { operation, valueBuf: encodeFloat64(value) };
+  }
+  const f = Number(value);
+  const cmp = compareNumbers(f, value);
+  if (cmp !== 0) {
+    if (operation === "==") {
+      return null;
+    }
+    if (cmp < 0) {
+      // f is the float just below value.
+      if (operation === "<") operation = "<=";
+      else if (operation === ">=") operation = ">";
+    } else {
+      // f is the float just above value.
+      if (operation === "<=") operation = "<";
+      else if (operation === ">") operation = ">=";
+    }
+  }
+  return { operation, valueBuf: encodeFloat64(f) };
+}
+
+// boundInteger converts comparing an integer between min and max with value
+// to comparing it with an integer between min and max.
+function boundInteger(
+  operation: Operation,
+  value: number | bigint,
+  min: bigint,
+  max: bigint,
+): { operation: Operation; value: bigint } | null {
+  let floor: bigint, ceil: bigint;
+  let exact = true;
+  // values beyond the range compare the same as the integers just beyond it,
+  // which also handles infinities.
+  if (value < min) {
+    floor = ceil = min - 1n;
+  } else if (value > max) {
+    floor = ceil = max + 1n;
+  } else if (typeof value === "bigint") {
+    floor = ceil = value;
+  } else {
+    floor = BigInt(Math.floor(value));
+    ceil = BigInt(Math.ceil(value));
+    exact = Number.isInteger(value);
+  }
+
+  let b: bigint;
+  switch (operation) {
+    case "==":
+      if (!exact || floor < min || floor > max) {
+        return null;
+      }
+      return { operation, value: floor };
+    case "<":
+      operation = "<=";
+      b = ceil - 1n;
+      break;
+    case "<=":
+      b = floor;
+      break;
+    case ">":
+      operation = ">=";
+      b = floor + 1n;
+      break;
+    case ">=":
+      b = ceil;
+      break;
+  }
+  if (operation === "<=") {
+    if (b < min) {
+      return null;
+    }
+    return { operation, value: b > max ? max : b };
+  }
+  if (b > max) {
+    return null;
+  }
+  return { operation, value: b < min ? min : b };
+}
@@ -1,5 +1,5 @@
 import { IndexHeader } from "../file/meta";
-import { FieldType, fieldTypeToString } from "./database";
+import { FieldType, fieldTypeToString, numericTypes } from "./database";
 import {
   OrderBy,
   Schema,
@@ -54,15 +54,18 @@ function validateWhere<T extends Schema>(
       switch (typeof whereNode.value) {
         case "bigint":
         case "number":
-          if (
-            !checkType(headerType, FieldType.Float64) &&
-            !checkType(headerType, FieldType.Uint64) &&
-            !checkType(headerType, FieldType.Int64)
-          ) {
+          // numbers are compared with every numeric index of the field.
+          if (!numericTypes.some((ft) => checkType(headerType, ft))) {
             throw new Error(
-              `number type not included in ${whereNode.key}'s header types.`,
+              `${typeof whereNode.value} type not included in ${whereNode.key}'s header types.`,
             );
           }
+          if (
+            typeof whereNode.value === "number" &&
+            Number.isNaN(whereNode.value)
+          ) {
+            throw new Error(`NaN in 'where' clause can't be compared.`);
+          }
           break;
 
         case "string":
@@ -1,4 +1,9 @@
-import { LinkedMetaPage, PAGE_SIZE_BYTES, ReadMultiBPTree } from "./multi";
+import {
+  LinkedMetaPage,
+  PAGE_SIZE_BYTES,
+  ReadMultiBPTree,
+  readPageSize,
+} from "./multi";
 import { RangeResolver } from "../resolver/resolver";
 import {
   IndexHeader,
@@ -29,6 +34,8 @@ export class IndexFile {
 export interface VersionedIndexFile<T> {
   getResolver(): RangeResolver;
 
+  pageSize(): Promise<number>;
+
   tree(): Promise<LinkedMetaPage>;
 
   metadata(): Promise<FileMeta>;
@@ -42,6 +49,7 @@ export interface VersionedIndexFile<T> {
 
 export class IndexFileV1<T> implements VersionedIndexFile<T> {
   private _tree?: LinkedMetaPage;
+  private _pageSize?: Promise<number>;
 
   private linkedMetaPages: LinkedMetaPage[] = [];
 
@@ -51,12 +59,19 @@ export class IndexFileV1<T> implements VersionedIndexFile<T> {
     return this.resolver;
   }
 
+  async pageSize(): Promise<number> {
+    if (!this._pageSize) {
+      this._pageSize = readPageSize(this.resolver);
+    }
+    return await this._pageSize;
+  }
+
   async tree(): Promise<LinkedMetaPage> {
     if (this._tree) {
       return this._tree;
     }
 
-    const tree = ReadMultiBPTree(this.resolver, 0);
+    const tree = ReadMultiBPTree(this.resolver, 0, await this.pageSize());
 
     this._tree = tree;
     return tree;
@@ -82,19 +97,10 @@ export class IndexFileV1<T> implements VersionedIndexFile<T> {
     while (true) {
       const indexMeta = readIndexMeta(await currMp.metadata());
       if (indexMeta.fieldName === header) {
-        if (fieldType === FieldType.Float64) {
-          // if key is a number or bigint, we cast it as a float64 type
-          if (
-            indexMeta.fieldType === FieldType.Float64 ||
-            indexMeta.fieldType === FieldType.Int64 ||
-            indexMeta.fieldType === FieldType.Uint64
-          ) {
-            headerMps.push(currMp);
-          }
-        } else {
-          if (fieldType === indexMeta.fieldType) {
-            headerMps.push(currMp);
-          }
+        // integers and floats are encoded differently, so numbers are looked
+        // up in each numeric index separately.
+        if (fieldType === indexMeta.fieldType) {
+          headerMps.push(currMp);
         }
       }
 
@@ -3,13 +3,28 @@ import { decodeUvarint } from "../util/uvarint";
 export enum FileFormat {
   JSONL = 0,
   CSV = 1,
+  PARQUET = 2,
+  TSV = 3,
+  RECORDIO = 4,
 }
 
+// CURRENT_VERSION mirrors appendable.CurrentVersion. Older index files are
+// upgraded by the Go library when they are first synchronized.
+export const CURRENT_VERSION = 2;
+
+// MIN_VERSION is the oldest version whose keys are encoded as they are by
+// CURRENT_VERSION, see appendable.CheckVersion.
+export const MIN_VERSION = 2;
+
 export type FileMeta = {
   version: number;
   format: FileFormat;
   readOffset: bigint;
   entries: number;
+  // the field delimiter of CSV and TSV files, zero for the format default.
+  delimiter: number;
+  // incremented by every synchronization, zero for older index files.
+  generation: number;
 };
 
 export async function readFileMeta(buffer: ArrayBuffer): Promise<FileMeta> {
@@ -24,19 +39,35 @@ export async function readFileMeta(buffer: ArrayBuffer): Promise<FileMeta> {
   const version = dataView.getUint8(0);
   const format = dataView.getUint8(1);
 
+  if (version < MIN_VERSION || version > CURRENT_VERSION) {
+    throw new Error(
+      `unsupported index file version ${version}, want ${MIN_VERSION} to ${CURRENT_VERSION}. Synchronize the index file with the current version of appendable to upgrade it.`,
+    );
+  }
+
   if (Object.values(FileFormat).indexOf(format) === -1) {
     throw new Error(`unexpected file format. Got: ${format}`);
   }
 
   const readOffset = dataView.getBigUint64(2, true);
 
-  const { value: entries } = decodeUvarint(buffer.slice(10));
+  const { value: entries, bytesRead } = decodeUvarint(buffer.slice(10));
+
+  const delimiter =
+    buffer.byteLength > 10 + bytesRead ? dataView.getUint8(10 + bytesRead) : 0;
+
+  const generation =
+    buffer.byteLength > 11 + bytesRead
+      ? decodeUvarint(buffer.slice(11 + bytesRead)).value
+      : 0;
 
   return {
     version,
     format,
     readOffset,
     entries,
+    delimiter,
+    generation,
   };
 }
 
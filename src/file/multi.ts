@@ -8,6 +8,35 @@ const POINTER_BYTES = 8;
 const LENGTH_BYTES = 4;
 const COUNT_BYTE = 1;
 
+// the commit record is stored at the end of the first 4096 bytes of the
+// index file and records the page size.
+const COMMIT_RECORD_SIZE = 36;
+const COMMIT_RECORD_MAGIC = "apcr";
+const PAGE_SIZE_FLAG_SHIFT = 8;
+
+/**
+ * readPageSize reads the page size of the index file from its commit record.
+ * Index files written before the page size was configurable have 4096 byte
+ * pages.
+ */
+export async function readPageSize(resolver: RangeResolver): Promise<number> {
+  const res = await resolver([{ start: 0, end: PAGE_SIZE_BYTES - 1 }]);
+  const { data } = res[0];
+  if (data.byteLength < PAGE_SIZE_BYTES) {
+    return PAGE_SIZE_BYTES;
+  }
+  const view = new DataView(data, PAGE_SIZE_BYTES - COMMIT_RECORD_SIZE);
+  const magic = String.fromCharCode(
+    ...new Uint8Array(data, PAGE_SIZE_BYTES - COMMIT_RECORD_SIZE, 4),
+  );
+  if (magic !== COMMIT_RECORD_MAGIC) {
+    // files without a commit record.
+    return PAGE_SIZE_BYTES;
+  }
+  const flags = view.getUint32(4, true);
+  return PAGE_SIZE_BYTES * 2 ** ((flags >>> PAGE_SIZE_FLAG_SHIFT) & 0xff);
+}
+
 export class LinkedMetaPage {
   constructor(
     private readonly resolver: RangeResolver,
@@ -16,8 +45,13 @@ export class LinkedMetaPage {
     private metaPageDataPromise?: Promise<
       { data: ArrayBuffer; totalLength: number }[]
     >,
+    private readonly pageSize: number = PAGE_SIZE_BYTES,
   ) {}
 
+  getPageSize(): number {
+    return this.pageSize;
+  }
+
   async root(): Promise<MemoryPointer> {
     const pageData = await this.getMetaPage();
 
@@ -61,7 +95,7 @@ export class LinkedMetaPage {
       this.metaPageDataPromise = this.resolver([
         {
           start: Number(this.offset),
-          end: Number(this.offset) + PAGE_SIZE_BYTES - 1,
+          end: Number(this.offset) + this.pageSize - 1,
         },
       ]);
     }
@@ -84,6 +118,7 @@ export class LinkedMetaPage {
         this.offset,
         this.index + 1,
         this.metaPageDataPromise,
+        this.pageSize,
       );
     }
 
@@ -93,7 +128,13 @@ export class LinkedMetaPage {
       return null;
     }
 
-    return new LinkedMetaPage(this.resolver, nextOffset, 0);
+    return new LinkedMetaPage(
+      this.resolver,
+      nextOffset,
+      0,
+      undefined,
+      this.pageSize,
+    );
   }
 
   private rootMemoryPointerPageOffset(): number {
@@ -108,7 +149,8 @@ export class LinkedMetaPage {
 export function ReadMultiBPTree(
   resolver: RangeResolver,
   idx: number,
+  pageSize: number = PAGE_SIZE_BYTES,
 ): LinkedMetaPage {
-  let offset = idx < 0 ? BigInt(0) : BigInt(idx + 1) * BigInt(PAGE_SIZE_BYTES);
-  return new LinkedMetaPage(resolver, offset, 0);
+  let offset = idx < 0 ? BigInt(0) : BigInt(idx + 1) * BigInt(pageSize);
+  return new LinkedMetaPage(resolver, offset, 0, undefined, pageSize);
 }
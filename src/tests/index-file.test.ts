@@ -14,11 +14,30 @@ describe("test file parsing", () => {
   it("should read the file meta", async () => {
     const fileMeta = await readFileMeta(fileMetaBuffer.buffer);
     expect(fileMeta.format).toEqual(FileFormat.CSV);
-    expect(fileMeta.version).toEqual(1);
+    expect(fileMeta.version).toEqual(2);
     expect(fileMeta.readOffset).toEqual(4096n);
     expect(fileMeta.entries).toEqual(34);
   });
 
+  it("should read the file meta of older versions with the same keys", async () => {
+    for (const [version, ok] of [
+      [1, false],
+      [2, true],
+      [3, false],
+    ] as const) {
+      const buffer = fileMetaBuffer.slice();
+      buffer[0] = version;
+      if (ok) {
+        const fileMeta = await readFileMeta(buffer.buffer);
+        expect(fileMeta.version).toEqual(version);
+      } else {
+        await expect(readFileMeta(buffer.buffer)).rejects.toThrow(
+          "unsupported index file version",
+        );
+      }
+    }
+  });
+
   it("should read the index meta", async () => {
     const indexMeta = await readIndexMeta(indexMetaBuffer.buffer);
     expect(indexMeta.width).toEqual(2);
@@ -1,6 +1,6 @@
 import { RangeResolver } from "../resolver/resolver";
 import { arrayBufferToString, readBinaryFile } from "./test-util";
-import { ReadMultiBPTree } from "../file/multi";
+import { ReadMultiBPTree, readPageSize } from "../file/multi";
 
 describe("test metadata", () => {
   let mockMetadata: Uint8Array;
@@ -23,4 +23,26 @@ describe("test metadata", () => {
     const metadata = await tree.metadata();
     expect("hello").toEqual(arrayBufferToString(metadata));
   });
+
+  it("reads the page size", async () => {
+    const header = new Uint8Array(4096);
+    const resolver: RangeResolver = async ([{ start, end }]) => {
+      return [
+        {
+          data: header.buffer.slice(start, end + 1),
+          totalLength: header.byteLength,
+        },
+      ];
+    };
+
+    // files without a commit record have 4096 byte pages.
+    expect(await readPageSize(resolver)).toEqual(4096);
+
+    header.set(new TextEncoder().encode("apcr"), 4096 - 36);
+    new DataView(header.buffer).setUint32(4096 - 32, 0b11 | (2 << 8), true);
+    expect(await readPageSize(resolver)).toEqual(16384);
+
+    const tree = ReadMultiBPTree(resolver, 0, 16384);
+    expect(tree.getPageSize()).toEqual(16384);
+  });
 });
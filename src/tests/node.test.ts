@@ -2,7 +2,7 @@ import {
   ReferencedValue,
   binarySearchReferencedValues,
 } from "../bptree/bptree";
-import { BPTreeNode } from "../bptree/node";
+import { BPTreeNode, storedWidth } from "../bptree/node";
 import { FieldType } from "../db/database";
 import { FileFormat } from "../file/meta";
 import { RangeResolver } from "../resolver/resolver";
@@ -180,6 +180,43 @@ describe("node functionality", () => {
     }
   });
 
+  it("should read a BPTree node with stored keys", async () => {
+    const mockStoredNodeData = await readBinaryFile("storednode.bin");
+    mockRangeResolver = async ([{ start, end }]) => {
+      const view = new Uint8Array(new ArrayBuffer(PAGE_SIZE_BYTES));
+      view.set(mockStoredNodeData, 0);
+      const slice = view.slice(start, end + 1);
+
+      return [
+        {
+          data: slice.buffer,
+          totalLength: view.byteLength,
+        },
+      ];
+    };
+
+    const { node } = await BPTreeNode.fromMemoryPointer(
+      { offset: 0n, length: mockStoredNodeData.byteLength },
+      mockRangeResolver,
+      mockDataResolver,
+      FileFormat.PARQUET,
+      FieldType.String,
+      storedWidth,
+    );
+
+    // the keys are read from the node instead of the data file.
+    expect(node.keys.map((k) => new TextDecoder().decode(k.value))).toEqual([
+      "a",
+      "bc",
+      "def",
+    ]);
+    expect(node.leafPointers).toEqual([
+      { offset: 0n, length: 0 },
+      { offset: 0n, length: 1 },
+      { offset: 1n, length: 0 },
+    ]);
+  });
+
   it("should read a internal BPTree node", async () => {
     mockRangeResolver = async ([{ start, end }]) => {
       const view = new Uint8Array(new ArrayBuffer(PAGE_SIZE_BYTES));
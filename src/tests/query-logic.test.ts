@@ -3,11 +3,19 @@ import { handleSelect, processWhere } from "../db/query-lang";
 
 describe("query logic test", () => {
   it("should process the given key", () => {
+    // 3.4 is positive so only the sign bit is flipped.
     let floatBuf1 = new ArrayBuffer(8);
-    new DataView(floatBuf1).setFloat64(0, 3.4, true);
+    new DataView(floatBuf1).setFloat64(0, 3.4);
+    new DataView(floatBuf1).setUint8(
+      0,
+      new DataView(floatBuf1).getUint8(0) | 0x80,
+    );
 
-    let floatBuf2 = new ArrayBuffer(8);
-    new DataView(floatBuf2).setFloat64(0, Number(1n), true);
+    let intBuf = new ArrayBuffer(8);
+    new DataView(intBuf).setBigUint64(0, 1n ^ (1n << 63n));
+
+    let uintBuf = new ArrayBuffer(8);
+    new DataView(uintBuf).setBigUint64(0, (1n << 64n) - 1n);
 
     const values: [
       string | number | bigint | boolean | null,
@@ -16,7 +24,8 @@ describe("query logic test", () => {
     ][] = [
       ["howdy", FieldType.String, new TextEncoder().encode("howdy").buffer],
       [3.4, FieldType.Float64, floatBuf1],
-      [1n, FieldType.Float64, floatBuf2],
+      [1n, FieldType.Int64, intBuf],
+      [(1n << 64n) - 1n, FieldType.Uint64, uintBuf],
       [true, FieldType.Boolean, new Uint8Array([0]).buffer],
       [false, FieldType.Boolean, new Uint8Array([1]).buffer],
       [null, FieldType.Null, new ArrayBuffer(0)],
@@ -0,0 +1,35 @@
+import { FieldType } from "../db/database";
+import { boundNumber, decodeNumber } from "../db/query-number";
+
+describe("numeric bounds", () => {
+  function bound(
+    fieldType: FieldType,
+    operation: "<" | "<=" | "==" | ">=" | ">",
+    value: number | bigint,
+  ) {
+    const res = boundNumber(fieldType, operation, value);
+    return res && [res.operation, decodeNumber(fieldType, res.valueBuf)];
+  }
+
+  it("rounds floats for the integer indexes", () => {
+    expect(bound(FieldType.Int64, "<", 2.5)).toEqual(["<=", 2n]);
+    expect(bound(FieldType.Int64, ">", 2.5)).toEqual([">=", 3n]);
+    expect(bound(FieldType.Int64, "==", 2.5)).toBeNull();
+    expect(bound(FieldType.Int64, "==", 3)).toEqual(["==", 3n]);
+  });
+
+  it("clamps to the range of the index", () => {
+    expect(bound(FieldType.Uint64, "<", -1)).toBeNull();
+    expect(bound(FieldType.Uint64, ">", -1)).toEqual([">=", 0n]);
+    expect(bound(FieldType.Int64, ">=", Infinity)).toBeNull();
+  });
+
+  it("rounds integers for the float index", () => {
+    expect(bound(FieldType.Float64, "==", 3n)).toEqual(["==", 3]);
+    expect(bound(FieldType.Float64, "==", (1n << 53n) + 1n)).toBeNull();
+    expect(bound(FieldType.Float64, ">=", (1n << 53n) + 1n)).toEqual([
+      ">",
+      2 ** 53,
+    ]);
+  });
+});
@@ -100,6 +100,7 @@ describe("validate filter queries", () => {
     store_and_fwd_flag: {};
     fare_amount: {};
     payment_type: {};
+    passenger_count: {};
   }
 
   const headers: IndexHeader[] = [
@@ -119,6 +120,10 @@ describe("validate filter queries", () => {
       fieldName: "payment_type",
       fieldTypes: [3, 0],
     },
+    {
+      fieldName: "passenger_count",
+      fieldTypes: [1],
+    },
   ];
 
   const validQueries: Query<MockSchema>[] = [
@@ -172,6 +177,24 @@ describe("validate filter queries", () => {
       ],
       select: ["fare_amount", "payment_type"],
     },
+    {
+      where: [
+        {
+          operation: "<",
+          key: "passenger_count",
+          value: 2.5,
+        },
+      ],
+    },
+    {
+      where: [
+        {
+          operation: ">=",
+          key: "fare_amount",
+          value: 10n,
+        },
+      ],
+    },
   ];
 
   it("test valid query", () => {
@@ -227,6 +250,15 @@ describe("validate filter queries", () => {
       ],
       select: ["paymet_type"],
     },
+    {
+      where: [
+        {
+          operation: "==",
+          key: "passenger_count",
+          value: NaN,
+        },
+      ],
+    },
   ];
 
   notValidQueries.forEach((query, index) => {
@@ -0,0 +1,78 @@
+import { ReferencedValue } from "../bptree/bptree";
+import {
+  decodeFloat64,
+  decodeInt64,
+  decodeUint64,
+  encodeFloat64,
+  encodeInt64,
+  encodeUint64,
+} from "../util/sortable";
+
+describe("sortable encoding", () => {
+  it("orders floats numerically", () => {
+    const values = [
+      -Infinity, -1e10, -2, -1, -0.5, 0, 0.5, 1, 3, 1e10, Infinity,
+    ];
+    for (let i = 1; i < values.length; i++) {
+      expect(
+        ReferencedValue.compareBytes(
+          encodeFloat64(values[i - 1]),
+          encodeFloat64(values[i]),
+        ),
+      ).toBeLessThan(0);
+    }
+  });
+
+  it("orders integers numerically", () => {
+    const values = [
+      -(1n << 63n),
+      -2n,
+      -1n,
+      0n,
+      1n,
+      (1n << 53n) + 1n,
+      (1n << 63n) - 1n,
+    ];
+    for (let i = 1; i < values.length; i++) {
+      expect(
+        ReferencedValue.compareBytes(
+          encodeInt64(values[i - 1]),
+          encodeInt64(values[i]),
+        ),
+      ).toBeLessThan(0);
+    }
+    expect(
+      ReferencedValue.compareBytes(
+        encodeUint64(1n << 63n),
+        encodeUint64((1n << 64n) - 1n),
+      ),
+    ).toBeLessThan(0);
+  });
+
+  it("matches the go encoding", () => {
+    expect(new Uint8Array(encodeFloat64(-2))).toEqual(
+      new Uint8Array([0x3f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff]),
+    );
+    expect(new Uint8Array(encodeInt64(123n))).toEqual(
+      new Uint8Array([0x80, 0, 0, 0, 0, 0, 0, 0x7b]),
+    );
+  });
+
+  it("encodes -0 as +0", () => {
+    expect(new Uint8Array(encodeFloat64(-0))).toEqual(
+      new Uint8Array(encodeFloat64(0)),
+    );
+  });
+
+  it("decodes what it encodes", () => {
+    for (const value of [-Infinity, -1e10, -0.5, 0, 3.4, 1e300, Infinity]) {
+      expect(decodeFloat64(encodeFloat64(value))).toEqual(value);
+    }
+    for (const value of [-(1n << 63n), -1n, 0n, (1n << 63n) - 1n]) {
+      expect(decodeInt64(encodeInt64(value))).toEqual(value);
+    }
+    expect(decodeUint64(encodeUint64((1n << 64n) - 1n))).toEqual(
+      (1n << 64n) - 1n,
+    );
+  });
+});
@@ -0,0 +1,47 @@
+// These mirror pkg/encoding/sortable.go so that comparing the encoded bytes
+// orders keys the same way as comparing the numbers.
+
+const SIGN_BIT = 1n << 63n;
+
+export function encodeUint64(value: bigint): ArrayBuffer {
+  const buf = new ArrayBuffer(8);
+  new DataView(buf).setBigUint64(0, value);
+  return buf;
+}
+
+export function encodeInt64(value: bigint): ArrayBuffer {
+  return encodeUint64(BigInt.asUintN(64, value) ^ SIGN_BIT);
+}
+
+export function encodeFloat64(value: number): ArrayBuffer {
+  const buf = new ArrayBuffer(8);
+  const view = new DataView(buf);
+  // -0 is encoded as +0, since they compare equal.
+  view.setFloat64(0, value === 0 ? 0 : value);
+  const bits = view.getBigUint64(0);
+  // negative values have all their bits inverted, positive values only the
+  // sign bit.
+  view.setBigUint64(
+    0,
+    bits & SIGN_BIT ? BigInt.asUintN(64, ~bits) : bits | SIGN_BIT,
+  );
+  return buf;
+}
+
+export function decodeUint64(buf: ArrayBuffer): bigint {
+  return new DataView(buf).getBigUint64(0);
+}
+
+export function decodeInt64(buf: ArrayBuffer): bigint {
+  return BigInt.asIntN(64, decodeUint64(buf) ^ SIGN_BIT);
+}
+
+export function decodeFloat64(buf: ArrayBuffer): number {
+  const bits = decodeUint64(buf);
+  const out = new DataView(new ArrayBuffer(8));
+  out.setBigUint64(
+    0,
+    bits & SIGN_BIT ? bits ^ SIGN_BIT : BigInt.asUintN(64, ~bits),
+  );
+  return out.getFloat64(0);
+}